@@ -93,6 +93,12 @@ var (
 	// MAwsCloudWatchGetMetricData is a metric counter for getting metric data time series from aws
 	MAwsCloudWatchGetMetricData prometheus.Counter
 
+	// MAwsCloudWatchThrottledRequests is a metric counter for requests to aws throttled by the CloudWatch data sources
+	MAwsCloudWatchThrottledRequests *prometheus.CounterVec
+
+	// MAwsCloudWatchRetries is a metric counter for requests to aws retried by the CloudWatch data sources
+	MAwsCloudWatchRetries *prometheus.CounterVec
+
 	// MDBDataSourceQueryByID is a metric counter for getting datasource by id
 	MDBDataSourceQueryByID prometheus.Counter
 
@@ -351,6 +357,18 @@ func init() {
 		Namespace: ExporterName,
 	})
 
+	MAwsCloudWatchThrottledRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name:      "aws_cloudwatch_throttled_requests_total",
+		Help:      "counter for requests to aws throttled by the CloudWatch data sources",
+		Namespace: ExporterName,
+	}, []string{"datasource"})
+
+	MAwsCloudWatchRetries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name:      "aws_cloudwatch_retries_total",
+		Help:      "counter for requests to aws retried by the CloudWatch data sources",
+		Namespace: ExporterName,
+	}, []string{"datasource"})
+
 	MDBDataSourceQueryByID = newCounterStartingAtZero(prometheus.CounterOpts{
 		Name:      "db_datasource_query_by_id_total",
 		Help:      "counter for getting datasource by id",
@@ -577,6 +595,8 @@ func initMetricVars() {
 		MAwsCloudWatchGetMetricStatistics,
 		MAwsCloudWatchListMetrics,
 		MAwsCloudWatchGetMetricData,
+		MAwsCloudWatchThrottledRequests,
+		MAwsCloudWatchRetries,
 		MDBDataSourceQueryByID,
 		LDAPUsersSyncExecutionTime,
 		MRenderingRequestTotal,
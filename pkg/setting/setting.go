@@ -175,6 +175,10 @@ var (
 	// Grafana.NET URL
 	GrafanaComUrl string
 
+	// AWS
+	AWSUserAgentSuffix                  string
+	AWSQueryCredentialsOverrideProfiles []string
+
 	ImageUploadProvider string
 )
 
@@ -274,8 +278,10 @@ type Cfg struct {
 	AdminPassword                string
 
 	// AWS Plugin Auth
-	AWSAllowedAuthProviders []string
-	AWSAssumeRoleEnabled    bool
+	AWSAllowedAuthProviders             []string
+	AWSAssumeRoleEnabled                bool
+	AWSUserAgentSuffix                  string
+	AWSQueryCredentialsOverrideProfiles []string
 
 	// Auth proxy settings
 	AuthProxyEnabled          bool
@@ -938,6 +944,17 @@ func (cfg *Cfg) readAWSConfig() {
 			cfg.AWSAllowedAuthProviders = append(cfg.AWSAllowedAuthProviders, authProvider)
 		}
 	}
+	AWSUserAgentSuffix = strings.TrimSpace(awsPluginSec.Key("user_agent_suffix").String())
+	cfg.AWSUserAgentSuffix = AWSUserAgentSuffix
+	AWSQueryCredentialsOverrideProfiles = nil
+	overrideProfiles := awsPluginSec.Key("query_credentials_override_profiles").String()
+	for _, profile := range strings.Split(overrideProfiles, ",") {
+		profile = strings.TrimSpace(profile)
+		if profile != "" {
+			AWSQueryCredentialsOverrideProfiles = append(AWSQueryCredentialsOverrideProfiles, profile)
+		}
+	}
+	cfg.AWSQueryCredentialsOverrideProfiles = AWSQueryCredentialsOverrideProfiles
 }
 
 func (cfg *Cfg) readSessionConfig() {
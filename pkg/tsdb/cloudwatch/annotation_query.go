@@ -3,10 +3,15 @@ package cloudwatch
 import (
 	"context"
 	"errors"
+	"fmt"
+	"sort"
+	"strconv"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/aws/aws-sdk-go/service/cloudwatch/cloudwatchiface"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
 	"github.com/grafana/grafana/pkg/components/simplejson"
 	"github.com/grafana/grafana/pkg/tsdb"
 	"github.com/grafana/grafana/pkg/util/errutil"
@@ -20,6 +25,10 @@ func (e *cloudWatchExecutor) executeAnnotationQuery(ctx context.Context, queryCo
 	queryResult := &tsdb.QueryResult{Meta: simplejson.New(), RefId: firstQuery.RefId}
 
 	parameters := firstQuery.Model
+	if parameters.Get("queryMode").MustString("") == "Logs" {
+		return e.executeLogAnnotationQuery(ctx, queryContext)
+	}
+
 	usePrefixMatch := parameters.Get("prefixMatching").MustBool(false)
 	region := parameters.Get("region").MustString("")
 	namespace := parameters.Get("namespace").MustString("")
@@ -35,6 +44,10 @@ func (e *cloudWatchExecutor) executeAnnotationQuery(ctx context.Context, queryCo
 	}
 	actionPrefix := parameters.Get("actionPrefix").MustString("")
 	alarmNamePrefix := parameters.Get("alarmNamePrefix").MustString("")
+	alarmTypes, err := parseAlarmTypes(parameters)
+	if err != nil {
+		return nil, err
+	}
 
 	cli, err := e.getCWClient(region)
 	if err != nil {
@@ -42,18 +55,25 @@ func (e *cloudWatchExecutor) executeAnnotationQuery(ctx context.Context, queryCo
 	}
 
 	var alarmNames []*string
-	if usePrefixMatch {
+	switch {
+	case !alarmTypes[cloudwatch.AlarmTypeMetricAlarm]:
+		// Only composite alarms are annotated
+	case usePrefixMatch:
+		// Alarms matching the prefixes can span namespaces, which are only filtered on if set
 		params := &cloudwatch.DescribeAlarmsInput{
 			MaxRecords:      aws.Int64(100),
 			ActionPrefix:    aws.String(actionPrefix),
 			AlarmNamePrefix: aws.String(alarmNamePrefix),
 		}
-		resp, err := cli.DescribeAlarms(params)
-		if err != nil {
+		if err := cli.DescribeAlarmsPagesWithContext(ctx, params,
+			func(page *cloudwatch.DescribeAlarmsOutput, lastPage bool) bool {
+				alarmNames = append(alarmNames, filterAlarms(page, namespace, metricName, dimensions, statistics,
+					period)...)
+				return !lastPage
+			}); err != nil {
 			return nil, errutil.Wrap("failed to call cloudwatch:DescribeAlarms", err)
 		}
-		alarmNames = filterAlarms(resp, namespace, metricName, dimensions, statistics, period)
-	} else {
+	default:
 		if region == "" || namespace == "" || metricName == "" || len(statistics) == 0 {
 			return result, errors.New("invalid annotations query")
 		}
@@ -89,6 +109,30 @@ func (e *cloudWatchExecutor) executeAnnotationQuery(ctx context.Context, queryCo
 		}
 	}
 
+	// Composite alarms aren't tied to a metric, so they can only be filtered on by prefix
+	var compositeAlarmNames []*string
+	if alarmTypes[cloudwatch.AlarmTypeCompositeAlarm] {
+		params := &cloudwatch.DescribeAlarmsInput{
+			MaxRecords: aws.Int64(100),
+			AlarmTypes: aws.StringSlice([]string{cloudwatch.AlarmTypeCompositeAlarm}),
+		}
+		if actionPrefix != "" {
+			params.ActionPrefix = aws.String(actionPrefix)
+		}
+		if alarmNamePrefix != "" {
+			params.AlarmNamePrefix = aws.String(alarmNamePrefix)
+		}
+		if err := cli.DescribeAlarmsPagesWithContext(ctx, params,
+			func(page *cloudwatch.DescribeAlarmsOutput, lastPage bool) bool {
+				for _, alarm := range page.CompositeAlarms {
+					compositeAlarmNames = append(compositeAlarmNames, alarm.AlarmName)
+				}
+				return !lastPage
+			}); err != nil {
+			return nil, errutil.Wrap("failed to call cloudwatch:DescribeAlarms", err)
+		}
+	}
+
 	startTime, err := queryContext.TimeRange.ParseFrom()
 	if err != nil {
 		return nil, err
@@ -106,17 +150,23 @@ func (e *cloudWatchExecutor) executeAnnotationQuery(ctx context.Context, queryCo
 			EndDate:    aws.Time(endTime),
 			MaxRecords: aws.Int64(100),
 		}
-		resp, err := cli.DescribeAlarmHistory(params)
-		if err != nil {
-			return nil, errutil.Wrap("failed to call cloudwatch:DescribeAlarmHistory", err)
+		if annotations, err = appendAlarmHistory(ctx, cli, params, annotations); err != nil {
+			return nil, err
 		}
-		for _, history := range resp.AlarmHistoryItems {
-			annotation := make(map[string]string)
-			annotation["time"] = history.Timestamp.UTC().Format(time.RFC3339)
-			annotation["title"] = *history.AlarmName
-			annotation["tags"] = *history.HistoryItemType
-			annotation["text"] = *history.HistorySummary
-			annotations = append(annotations, annotation)
+	}
+	// The history of composite alarms is only returned when asked for, and only their state transitions are of
+	// interest, as they have no data of their own
+	for _, alarmName := range compositeAlarmNames {
+		params := &cloudwatch.DescribeAlarmHistoryInput{
+			AlarmName:       alarmName,
+			AlarmTypes:      aws.StringSlice([]string{cloudwatch.AlarmTypeCompositeAlarm}),
+			HistoryItemType: aws.String(cloudwatch.HistoryItemTypeStateUpdate),
+			StartDate:       aws.Time(startTime),
+			EndDate:         aws.Time(endTime),
+			MaxRecords:      aws.Int64(100),
+		}
+		if annotations, err = appendAlarmHistory(ctx, cli, params, annotations); err != nil {
+			return nil, err
 		}
 	}
 
@@ -125,6 +175,166 @@ func (e *cloudWatchExecutor) executeAnnotationQuery(ctx context.Context, queryCo
 	return result, err
 }
 
+// parseAlarmTypes returns the types of the alarms to annotate, only metric alarms unless alarmTypes is set.
+func parseAlarmTypes(parameters *simplejson.Json) (map[string]bool, error) {
+	types := parameters.Get("alarmTypes").MustStringArray([]string{cloudwatch.AlarmTypeMetricAlarm})
+	if len(types) == 0 {
+		return nil, errors.New("at least one alarm type must be set")
+	}
+
+	alarmTypes := make(map[string]bool, len(types))
+	for _, alarmType := range types {
+		if alarmType != cloudwatch.AlarmTypeMetricAlarm && alarmType != cloudwatch.AlarmTypeCompositeAlarm {
+			return nil, fmt.Errorf("invalid alarm type %q, must be either %q or %q", alarmType,
+				cloudwatch.AlarmTypeMetricAlarm, cloudwatch.AlarmTypeCompositeAlarm)
+		}
+		alarmTypes[alarmType] = true
+	}
+
+	return alarmTypes, nil
+}
+
+// appendAlarmHistory appends an annotation for each alarm history item of all pages matching params.
+func appendAlarmHistory(ctx context.Context, cli cloudwatchiface.CloudWatchAPI,
+	params *cloudwatch.DescribeAlarmHistoryInput, annotations []map[string]string) ([]map[string]string, error) {
+	if err := cli.DescribeAlarmHistoryPagesWithContext(ctx, params,
+		func(page *cloudwatch.DescribeAlarmHistoryOutput, lastPage bool) bool {
+			for _, history := range page.AlarmHistoryItems {
+				annotation := make(map[string]string)
+				annotation["time"] = history.Timestamp.UTC().Format(time.RFC3339)
+				annotation["title"] = *history.AlarmName
+				annotation["tags"] = *history.HistoryItemType
+				annotation["text"] = *history.HistorySummary
+				annotations = append(annotations, annotation)
+			}
+			return !lastPage
+		}); err != nil {
+		return nil, errutil.Wrap("failed to call cloudwatch:DescribeAlarmHistory", err)
+	}
+
+	return annotations, nil
+}
+
+// executeLogAnnotationQuery creates an annotation for each row returned by a Logs Insights query, such as
+// deployment events logged to a log group. The text of an annotation is taken from the textField of its row,
+// @message unless set, and its title from the optional titleField.
+func (e *cloudWatchExecutor) executeLogAnnotationQuery(ctx context.Context, queryContext *tsdb.TsdbQuery) (*tsdb.Response, error) {
+	firstQuery := queryContext.Queries[0]
+	parameters := firstQuery.Model
+	if expression, err := parameters.Get("expression").String(); err == nil {
+		parameters.Set("queryString", expression)
+	}
+
+	region, err := e.resolveRegion(parameters.Get("region").MustString(defaultRegion))
+	if err != nil {
+		return nil, err
+	}
+	parameters.Set("region", region)
+
+	logsClient, err := e.getCWLogsClient(region)
+	if err != nil {
+		return nil, err
+	}
+
+	getQueryResultsOutput, err := e.alertQuery(ctx, logsClient, queryContext)
+	if err != nil {
+		return nil, err
+	}
+
+	frame, err := logsResultsToDataframes(getQueryResultsOutput, false)
+	if err != nil {
+		return nil, err
+	}
+	// Results aren't guaranteed to come ordered by time (ascending), so we need to sort
+	sort.Sort(ByTime(*frame))
+
+	annotations, err := logRowsToAnnotations(frame, parameters.Get("textField").MustString("@message"),
+		parameters.Get("titleField").MustString(""))
+	if err != nil {
+		return nil, err
+	}
+
+	queryResult := &tsdb.QueryResult{Meta: simplejson.New(), RefId: firstQuery.RefId}
+	transformAnnotationToTable(annotations, queryResult)
+	return &tsdb.Response{
+		Results: map[string]*tsdb.QueryResult{
+			firstQuery.RefId: queryResult,
+		},
+	}, nil
+}
+
+// logRowsToAnnotations turns the rows of a logs query result into annotations, skipping rows without a timestamp.
+func logRowsToAnnotations(frame *data.Frame, textField string, titleField string) ([]map[string]string, error) {
+	annotations := make([]map[string]string, 0)
+	rowCount, err := frame.RowLen()
+	if err != nil || rowCount == 0 {
+		return annotations, err
+	}
+
+	timestampIdx, err := logsFieldIndex(frame, "@timestamp")
+	if err != nil {
+		return nil, err
+	}
+	textIdx, err := logsFieldIndex(frame, textField)
+	if err != nil {
+		return nil, err
+	}
+	titleIdx := -1
+	if titleField != "" {
+		if titleIdx, err = logsFieldIndex(frame, titleField); err != nil {
+			return nil, err
+		}
+	}
+
+	for i := 0; i < rowCount; i++ {
+		timestamp, ok := frame.ConcreteAt(timestampIdx, i)
+		if !ok {
+			continue
+		}
+		t, ok := timestamp.(time.Time)
+		if !ok {
+			return nil, errors.New("the @timestamp field of the log query results isn't a time")
+		}
+
+		annotation := map[string]string{
+			"time": t.UTC().Format(time.RFC3339),
+			"text": logsFieldValue(frame, textIdx, i),
+		}
+		if titleIdx >= 0 {
+			annotation["title"] = logsFieldValue(frame, titleIdx, i)
+		}
+		annotations = append(annotations, annotation)
+	}
+
+	return annotations, nil
+}
+
+func logsFieldIndex(frame *data.Frame, name string) (int, error) {
+	for i, field := range frame.Fields {
+		if field.Name == name {
+			return i, nil
+		}
+	}
+
+	return -1, fmt.Errorf("field %q not found in the log query results", name)
+}
+
+func logsFieldValue(frame *data.Frame, fieldIdx int, rowIdx int) string {
+	value, ok := frame.ConcreteAt(fieldIdx, rowIdx)
+	if !ok {
+		return ""
+	}
+
+	switch v := value.(type) {
+	case time.Time:
+		return v.UTC().Format(time.RFC3339)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
 func transformAnnotationToTable(data []map[string]string, result *tsdb.QueryResult) {
 	table := &tsdb.Table{
 		Columns: make([]tsdb.TableColumn, 4),
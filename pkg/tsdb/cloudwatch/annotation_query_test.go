@@ -0,0 +1,284 @@
+package cloudwatch
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/aws/aws-sdk-go/service/cloudwatch/cloudwatchiface"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs/cloudwatchlogsiface"
+	"github.com/grafana/grafana/pkg/components/simplejson"
+	"github.com/grafana/grafana/pkg/tsdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAnnotationQuery_Logs(t *testing.T) {
+	origNewCWLogsClient := NewCWLogsClient
+	t.Cleanup(func() {
+		NewCWLogsClient = origNewCWLogsClient
+	})
+
+	newRow := func(timestamp, message, version string) []*cloudwatchlogs.ResultField {
+		return []*cloudwatchlogs.ResultField{
+			{Field: aws.String("@timestamp"), Value: aws.String(timestamp)},
+			{Field: aws.String("@message"), Value: aws.String(message)},
+			{Field: aws.String("version"), Value: aws.String(version)},
+		}
+	}
+	cli := FakeCWLogsClient{
+		queryResults: cloudwatchlogs.GetQueryResultsOutput{
+			Results: [][]*cloudwatchlogs.ResultField{
+				newRow("2020-03-20 12:00:00.000", "Deployed web to production", "v1.2.0"),
+				newRow("2020-03-20 10:30:00.000", "Deployed api to production", "v3.0.1"),
+			},
+			Status: aws.String("Complete"),
+		},
+		calls: &logsCalls{},
+	}
+	NewCWLogsClient = func(sess *session.Session) cloudwatchlogsiface.CloudWatchLogsAPI {
+		return cli
+	}
+
+	runQuery := func(model map[string]interface{}) (*tsdb.Response, error) {
+		model["type"] = "annotationQuery"
+		model["queryMode"] = "Logs"
+		model["region"] = "us-east-1"
+		model["logGroupNames"] = []interface{}{"deployments"}
+		model["expression"] = "fields @timestamp, @message, version | filter @message like /Deployed/"
+
+		executor := newExecutor(nil)
+		return executor.Query(context.Background(), fakeDataSource(), &tsdb.TsdbQuery{
+			TimeRange: tsdb.NewTimeRange("1584700643000", "1584873443000"),
+			Queries: []*tsdb.Query{
+				{
+					RefId: "Anno",
+					Model: simplejson.NewFromAny(model),
+				},
+			},
+		})
+	}
+
+	t.Run("Log rows become annotations ordered by time", func(t *testing.T) {
+		resp, err := runQuery(map[string]interface{}{
+			"titleField": "version",
+		})
+		require.NoError(t, err)
+
+		require.Len(t, cli.calls.startQuery, 1)
+		assert.Equal(t, []*string{aws.String("deployments")}, cli.calls.startQuery[0].LogGroupNames)
+		assert.Contains(t, *cli.calls.startQuery[0].QueryString, "filter @message like /Deployed/")
+
+		require.Contains(t, resp.Results, "Anno")
+		require.Len(t, resp.Results["Anno"].Tables, 1)
+		assert.Equal(t, []tsdb.RowValues{
+			{"2020-03-20T10:30:00Z", "v3.0.1", "", "Deployed api to production"},
+			{"2020-03-20T12:00:00Z", "v1.2.0", "", "Deployed web to production"},
+		}, resp.Results["Anno"].Tables[0].Rows)
+	})
+
+	t.Run("Unknown text field is rejected", func(t *testing.T) {
+		_, err := runQuery(map[string]interface{}{
+			"textField": "summary",
+		})
+		assert.EqualError(t, err, `field "summary" not found in the log query results`)
+	})
+}
+
+func TestAnnotationQuery_AlarmNamePrefix(t *testing.T) {
+	origNewCWClient := NewCWClient
+	t.Cleanup(func() {
+		NewCWClient = origNewCWClient
+	})
+
+	newAlarm := func(name, namespace string) *cloudwatch.MetricAlarm {
+		return &cloudwatch.MetricAlarm{
+			AlarmName:  aws.String(name),
+			Namespace:  aws.String(namespace),
+			MetricName: aws.String("Deployments"),
+			Statistic:  aws.String("Sum"),
+			Period:     aws.Int64(60),
+		}
+	}
+	newHistoryItem := func(alarmName string, timestamp time.Time, summary string) *cloudwatch.AlarmHistoryItem {
+		return &cloudwatch.AlarmHistoryItem{
+			AlarmName:       aws.String(alarmName),
+			Timestamp:       aws.Time(timestamp),
+			HistoryItemType: aws.String("StateUpdate"),
+			HistorySummary:  aws.String(summary),
+		}
+	}
+	start := time.Date(2020, 3, 20, 10, 0, 0, 0, time.UTC)
+	cli := FakeCWClient{
+		AlarmPages: [][]*cloudwatch.MetricAlarm{
+			{newAlarm("deploy-web", "AWS/EC2")},
+			{newAlarm("deploy-db", "AWS/RDS")},
+		},
+		AlarmHistoryPages: map[string][][]*cloudwatch.AlarmHistoryItem{
+			"deploy-web": {
+				{newHistoryItem("deploy-web", start, "Alarm updated from OK to ALARM")},
+				{newHistoryItem("deploy-web", start.Add(time.Hour), "Alarm updated from ALARM to OK")},
+			},
+			"deploy-db": {
+				{newHistoryItem("deploy-db", start.Add(30*time.Minute), "Alarm updated from OK to ALARM")},
+			},
+		},
+		calls: &cloudWatchCalls{},
+	}
+	NewCWClient = func(sess *session.Session) cloudwatchiface.CloudWatchAPI {
+		return cli
+	}
+
+	executor := newExecutor(nil)
+	resp, err := executor.Query(context.Background(), fakeDataSource(), &tsdb.TsdbQuery{
+		TimeRange: tsdb.NewTimeRange("1584700643000", "1584873443000"),
+		Queries: []*tsdb.Query{
+			{
+				RefId: "Anno",
+				Model: simplejson.NewFromAny(map[string]interface{}{
+					"type":            "annotationQuery",
+					"region":          "us-east-1",
+					"prefixMatching":  true,
+					"alarmNamePrefix": "deploy",
+				}),
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	require.Len(t, cli.calls.describeAlarms, 1)
+	assert.Equal(t, "deploy", aws.StringValue(cli.calls.describeAlarms[0].AlarmNamePrefix))
+	require.Len(t, cli.calls.describeAlarmHistory, 2)
+	assert.Equal(t, "deploy-web", aws.StringValue(cli.calls.describeAlarmHistory[0].AlarmName))
+	assert.Equal(t, "deploy-db", aws.StringValue(cli.calls.describeAlarmHistory[1].AlarmName))
+
+	// Alarms from all pages are annotated, whatever their namespace, with the history items of all pages
+	require.Len(t, resp.Results["Anno"].Tables, 1)
+	assert.Equal(t, []tsdb.RowValues{
+		{"2020-03-20T10:00:00Z", "deploy-web", "StateUpdate", "Alarm updated from OK to ALARM"},
+		{"2020-03-20T11:00:00Z", "deploy-web", "StateUpdate", "Alarm updated from ALARM to OK"},
+		{"2020-03-20T10:30:00Z", "deploy-db", "StateUpdate", "Alarm updated from OK to ALARM"},
+	}, resp.Results["Anno"].Tables[0].Rows)
+}
+
+func TestAnnotationQuery_CompositeAlarms(t *testing.T) {
+	origNewCWClient := NewCWClient
+	t.Cleanup(func() {
+		NewCWClient = origNewCWClient
+	})
+
+	start := time.Date(2020, 3, 20, 10, 0, 0, 0, time.UTC)
+	newCli := func() FakeCWClient {
+		return FakeCWClient{
+			AlarmPages: [][]*cloudwatch.MetricAlarm{
+				{
+					{
+						AlarmName:  aws.String("deploy-cpu"),
+						Namespace:  aws.String("AWS/EC2"),
+						MetricName: aws.String("CPUUtilization"),
+						Statistic:  aws.String("Average"),
+						Period:     aws.Int64(60),
+					},
+				},
+			},
+			CompositeAlarmPages: [][]*cloudwatch.CompositeAlarm{
+				{{AlarmName: aws.String("deploy-health")}},
+				{{AlarmName: aws.String("deploy-latency")}},
+			},
+			AlarmHistoryPages: map[string][][]*cloudwatch.AlarmHistoryItem{
+				"deploy-cpu": {
+					{
+						{
+							AlarmName:       aws.String("deploy-cpu"),
+							Timestamp:       aws.Time(start),
+							HistoryItemType: aws.String("StateUpdate"),
+							HistorySummary:  aws.String("Alarm updated from OK to ALARM"),
+						},
+					},
+				},
+				"deploy-health": {
+					{
+						{
+							AlarmName:       aws.String("deploy-health"),
+							Timestamp:       aws.Time(start.Add(time.Minute)),
+							HistoryItemType: aws.String("StateUpdate"),
+							HistorySummary:  aws.String("Alarm updated from OK to ALARM"),
+						},
+					},
+				},
+			},
+			calls: &cloudWatchCalls{},
+		}
+	}
+
+	runQuery := func(t *testing.T, cli FakeCWClient, alarmTypes []interface{}) (*tsdb.Response, error) {
+		t.Helper()
+
+		NewCWClient = func(sess *session.Session) cloudwatchiface.CloudWatchAPI {
+			return cli
+		}
+
+		executor := newExecutor(nil)
+		return executor.Query(context.Background(), fakeDataSource(), &tsdb.TsdbQuery{
+			TimeRange: tsdb.NewTimeRange("1584700643000", "1584873443000"),
+			Queries: []*tsdb.Query{
+				{
+					RefId: "Anno",
+					Model: simplejson.NewFromAny(map[string]interface{}{
+						"type":            "annotationQuery",
+						"region":          "us-east-1",
+						"prefixMatching":  true,
+						"alarmNamePrefix": "deploy",
+						"alarmTypes":      alarmTypes,
+					}),
+				},
+			},
+		})
+	}
+
+	t.Run("Composite alarms are annotated with their state transitions", func(t *testing.T) {
+		cli := newCli()
+		resp, err := runQuery(t, cli, []interface{}{"CompositeAlarm"})
+		require.NoError(t, err)
+
+		require.Len(t, cli.calls.describeAlarms, 1)
+		assert.Equal(t, []*string{aws.String("CompositeAlarm")}, cli.calls.describeAlarms[0].AlarmTypes)
+		assert.Equal(t, "deploy", aws.StringValue(cli.calls.describeAlarms[0].AlarmNamePrefix))
+		require.Len(t, cli.calls.describeAlarmHistory, 2)
+		for i, alarmName := range []string{"deploy-health", "deploy-latency"} {
+			input := cli.calls.describeAlarmHistory[i]
+			assert.Equal(t, alarmName, aws.StringValue(input.AlarmName))
+			assert.Equal(t, []*string{aws.String("CompositeAlarm")}, input.AlarmTypes)
+			assert.Equal(t, "StateUpdate", aws.StringValue(input.HistoryItemType))
+		}
+
+		assert.Equal(t, []tsdb.RowValues{
+			{"2020-03-20T10:01:00Z", "deploy-health", "StateUpdate", "Alarm updated from OK to ALARM"},
+		}, resp.Results["Anno"].Tables[0].Rows)
+	})
+
+	t.Run("Metric and composite alarms are annotated together", func(t *testing.T) {
+		cli := newCli()
+		resp, err := runQuery(t, cli, []interface{}{"MetricAlarm", "CompositeAlarm"})
+		require.NoError(t, err)
+
+		require.Len(t, cli.calls.describeAlarms, 2)
+		assert.Empty(t, cli.calls.describeAlarms[0].AlarmTypes)
+		assert.Equal(t, []*string{aws.String("CompositeAlarm")}, cli.calls.describeAlarms[1].AlarmTypes)
+
+		assert.Equal(t, []tsdb.RowValues{
+			{"2020-03-20T10:00:00Z", "deploy-cpu", "StateUpdate", "Alarm updated from OK to ALARM"},
+			{"2020-03-20T10:01:00Z", "deploy-health", "StateUpdate", "Alarm updated from OK to ALARM"},
+		}, resp.Results["Anno"].Tables[0].Rows)
+	})
+
+	t.Run("Invalid alarm type is rejected", func(t *testing.T) {
+		_, err := runQuery(t, newCli(), []interface{}{"AnomalyAlarm"})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), `invalid alarm type "AnomalyAlarm"`)
+	})
+}
@@ -2,8 +2,14 @@ package cloudwatch
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"os"
 	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -13,6 +19,7 @@ import (
 	"github.com/aws/aws-sdk-go/aws/client"
 	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/aws/endpoints"
 	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/cloudwatch"
@@ -23,6 +30,9 @@ import (
 	"github.com/aws/aws-sdk-go/service/ec2/ec2iface"
 	"github.com/aws/aws-sdk-go/service/resourcegroupstaggingapi"
 	"github.com/aws/aws-sdk-go/service/resourcegroupstaggingapi/resourcegroupstaggingapiiface"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/aws/aws-sdk-go/service/sts/stsiface"
+	"github.com/grafana/grafana/pkg/components/gtime"
 	"github.com/grafana/grafana/pkg/components/simplejson"
 	"github.com/grafana/grafana/pkg/infra/log"
 	"github.com/grafana/grafana/pkg/models"
@@ -32,21 +42,44 @@ import (
 )
 
 type datasourceInfo struct {
-	Profile       string
-	Region        string
-	AuthType      authType
-	AssumeRoleARN string
-	ExternalID    string
-	Namespace     string
-	Endpoint      string
-
-	AccessKey string
-	SecretKey string
+	Version            string
+	Profile            string
+	Region             string
+	AuthType           authType
+	AssumeRoleARNs     []string
+	ExternalIDs        []string
+	RoleSessionName    string
+	AssumeRoleDuration string
+	MFASerialNumber    string
+	Namespace          string
+	Endpoint           string
+	ProxyURL           string
+	NoProxy            string
+	TLSSkipVerify      bool
+	Timeout            time.Duration
+	DialTimeout        time.Duration
+	// SessionRefreshWindow is how long before they expire cached sessions are refreshed in the background,
+	// or zero if they aren't
+	SessionRefreshWindow time.Duration
+
+	AccessKey    string
+	SecretKey    string
+	SessionToken string
+	TLSCACert    string
+	MFAToken     string
 }
 
 const cloudWatchTSFormat = "2006-01-02 15:04:05.000"
 const defaultRegion = "default"
 
+// The session name used when assuming a role, unless the data source configures another one
+const defaultRoleSessionName = "grafana"
+
+// STS only allows role session names of up to 64 word characters and any of "+=,.@-".
+const maxRoleSessionNameLength = 64
+
+var invalidRoleSessionNameChars = regexp.MustCompile(`[^\w+=,.@-]`)
+
 // Constants also defined in datasource/cloudwatch/datasource.ts
 const logIdentifierInternal = "__log__grafana_internal__"
 const logStreamIdentifierInternal = "__logstream__grafana_internal__"
@@ -85,36 +118,172 @@ func newExecutor(logsService *LogsService) *cloudWatchExecutor {
 // cloudWatchExecutor executes CloudWatch requests.
 type cloudWatchExecutor struct {
 	*models.DataSource
-
-	ec2Client  ec2iface.EC2API
-	rgtaClient resourcegroupstaggingapiiface.ResourceGroupsTaggingAPIAPI
+	// user is the user the queries are executed for, if any
+	user *models.SignedInUser
+	// credentialsOverride replaces the credentials of the data source for the queries, if set
+	credentialsOverride *credentialsOverride
 
 	logsService *LogsService
 }
 
 func (e *cloudWatchExecutor) newSession(region string) (*session.Session, error) {
+	region, err := e.resolveRegion(region)
+	if err != nil {
+		return nil, err
+	}
+
 	dsInfo := e.getDSInfo(region)
+	if e.credentialsOverride != nil {
+		return e.newOverrideSession(dsInfo)
+	}
+	cacheKey := sessionCacheKey(dsInfo, region)
+
+	sessCacheLock.RLock()
+	if env, ok := sessCache[cacheKey]; ok {
+		if env.expiration.After(time.Now().UTC()) {
+			sessCacheLock.RUnlock()
+			e.refreshSessionIfExpiring(cacheKey, dsInfo, env)
+			return env.session, nil
+		}
+	}
+	sessCacheLock.RUnlock()
+
+	sess, expiration, err := e.createSession(dsInfo)
+	if err != nil {
+		return nil, err
+	}
+	addCredentialsErrorHandler(sess, cacheKey)
+	addThrottlingHandlers(sess, e.DataSource.Name)
+
+	sessCacheLock.Lock()
+	sessCache[cacheKey] = envelope{
+		session:    sess,
+		expiration: expiration,
+	}
+	sessCacheLock.Unlock()
+
+	return sess, nil
+}
 
+// errMissingRegion is returned when no region is set on a query and none can be resolved, instead of letting the
+// AWS SDK fail with a less helpful error.
+var errMissingRegion = errors.New("no AWS region is configured, set a default region in the data source settings " +
+	"or a region on the query")
+
+// resolveRegion returns the region to use when region isn't set or is "default", falling back in turn to the
+// data source's default region, the AWS_REGION and AWS_DEFAULT_REGION environment variables and the region of
+// the EC2 instance Grafana runs on.
+func (e *cloudWatchExecutor) resolveRegion(region string) (string, error) {
+	if region != "" && region != defaultRegion {
+		return region, nil
+	}
+
+	if dsRegion := e.DataSource.JsonData.Get("defaultRegion").MustString(); dsRegion != "" && dsRegion != defaultRegion {
+		return dsRegion, nil
+	}
+
+	for _, name := range []string{"AWS_REGION", "AWS_DEFAULT_REGION"} {
+		if envRegion := os.Getenv(name); envRegion != "" {
+			plog.Debug("Using AWS region from the environment", "variable", name, "region", envRegion)
+			return envRegion, nil
+		}
+	}
+
+	if region, ok := cachedMetadataRegion(); ok {
+		return region, nil
+	}
+	sess, err := newSession()
+	if err == nil {
+		var metadataRegion string
+		if metadataRegion, err = newEC2Metadata(sess).Region(); err == nil && metadataRegion != "" {
+			plog.Debug("Using AWS region from the EC2 instance metadata", "region", metadataRegion)
+			cacheMetadataRegion(metadataRegion)
+			return metadataRegion, nil
+		}
+	}
+	plog.Debug("Could not get the AWS region from the EC2 instance metadata", "err", err)
+
+	return "", errMissingRegion
+}
+
+// evictSession removes sess from the session cache, so that the next query for cacheKey creates a new session.
+// A session that has already replaced sess, e.g. after a refresh, is kept.
+func evictSession(cacheKey string, sess *session.Session) {
+	sessCacheLock.Lock()
+	defer sessCacheLock.Unlock()
+
+	if env, ok := sessCache[cacheKey]; ok && env.session == sess {
+		delete(sessCache, cacheKey)
+	}
+}
+
+// dataSourceVersion identifies a data source at a version of its settings. Keying what's cached for a data source
+// on it makes editing the settings discard what was cached for the previous ones.
+func dataSourceVersion(ds *models.DataSource) string {
+	return fmt.Sprintf("%d:%d", ds.Id, ds.Version)
+}
+
+func sessionCacheKey(dsInfo *datasourceInfo, region string) string {
 	bldr := strings.Builder{}
 	for i, s := range []string{
-		dsInfo.AuthType.String(), dsInfo.AccessKey, dsInfo.Profile, dsInfo.AssumeRoleARN, region, dsInfo.Endpoint,
+		dsInfo.Version, dsInfo.AuthType.String(), dsInfo.AccessKey, hashString(dsInfo.SessionToken), dsInfo.Profile,
+		strings.Join(dsInfo.AssumeRoleARNs, ","), strings.Join(dsInfo.ExternalIDs, ","), dsInfo.RoleSessionName,
+		dsInfo.AssumeRoleDuration, dsInfo.MFASerialNumber, hashString(dsInfo.MFAToken), region, dsInfo.Endpoint,
+		dsInfo.ProxyURL, dsInfo.NoProxy, strconv.FormatBool(dsInfo.TLSSkipVerify), hashString(dsInfo.TLSCACert),
+		dsInfo.Timeout.String(), dsInfo.DialTimeout.String(),
 	} {
 		if i != 0 {
 			bldr.WriteString(":")
 		}
 		bldr.WriteString(strings.ReplaceAll(s, ":", `\:`))
 	}
-	cacheKey := bldr.String()
 
-	sessCacheLock.RLock()
-	if env, ok := sessCache[cacheKey]; ok {
-		if env.expiration.After(time.Now().UTC()) {
-			sessCacheLock.RUnlock()
-			return env.session, nil
-		}
+	return bldr.String()
+}
+
+// refreshSessionIfExpiring creates a new session in the background when the cached one is about to expire,
+// so that the next query doesn't have to wait for new credentials.
+func (e *cloudWatchExecutor) refreshSessionIfExpiring(cacheKey string, dsInfo *datasourceInfo, env envelope) {
+	if dsInfo.SessionRefreshWindow <= 0 || time.Until(env.expiration) > dsInfo.SessionRefreshWindow {
+		return
 	}
-	sessCacheLock.RUnlock()
 
+	sessCacheLock.Lock()
+	if sessRefreshing[cacheKey] {
+		sessCacheLock.Unlock()
+		return
+	}
+	sessRefreshing[cacheKey] = true
+	sessCacheLock.Unlock()
+
+	go func() {
+		plog.Debug("Refreshing AWS session ahead of expiry", "expiration", env.expiration)
+		sess, expiration, err := e.createSession(dsInfo)
+		if err == nil {
+			addCredentialsErrorHandler(sess, cacheKey)
+			addThrottlingHandlers(sess, e.DataSource.Name)
+			if sess.Config.Credentials != nil {
+				// Credentials are retrieved lazily, so fetch them now rather than on the next query
+				_, err = sess.Config.Credentials.Get()
+			}
+		}
+
+		sessCacheLock.Lock()
+		defer sessCacheLock.Unlock()
+		delete(sessRefreshing, cacheKey)
+		if err != nil {
+			plog.Warn("Failed to refresh AWS session", "err", err)
+			return
+		}
+		sessCache[cacheKey] = envelope{
+			session:    sess,
+			expiration: expiration,
+		}
+	}()
+}
+
+// createSession creates a new AWS session for the data source, returning it along with its expiration time.
+func (e *cloudWatchExecutor) createSession(dsInfo *datasourceInfo) (*session.Session, time.Time, error) {
 	cfgs := []*aws.Config{
 		{
 			CredentialsChainVerboseErrors: aws.Bool(true),
@@ -131,72 +300,174 @@ func (e *cloudWatchExecutor) newSession(region string) (*session.Session, error)
 		cfgs = append(cfgs, regionCfg)
 	}
 
+	// Regions outside of the standard partition, such as China and GovCloud, need endpoints (including STS ones
+	// used for assuming roles) from their own partition
+	var partitionCfg *aws.Config
+	if partition, ok := endpoints.PartitionForRegion(endpoints.DefaultPartitions(), dsInfo.Region); ok &&
+		partition.ID() != endpoints.AwsPartitionID {
+		plog.Debug("Using non-standard AWS partition", "partition", partition.ID(), "region", dsInfo.Region)
+		partitionCfg = &aws.Config{
+			EndpointResolver:    partition,
+			STSRegionalEndpoint: endpoints.RegionalSTSEndpoint,
+		}
+		cfgs = append(cfgs, partitionCfg)
+	}
+
 	if dsInfo.Endpoint != "" {
 		cfgs = append(cfgs, &aws.Config{Endpoint: aws.String(dsInfo.Endpoint)})
 	}
 
+	httpClient, err := newHTTPClient(dsInfo)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	httpClientCfg := &aws.Config{HTTPClient: httpClient}
+	cfgs = append(cfgs, httpClientCfg)
+
+	var sess *session.Session
 	switch dsInfo.AuthType {
 	case authTypeSharedCreds:
 		plog.Debug("Authenticating towards AWS with shared credentials", "profile", dsInfo.Profile,
 			"region", dsInfo.Region)
-		cfgs = append(cfgs, &aws.Config{
-			Credentials: credentials.NewSharedCredentials("", dsInfo.Profile),
+		// Loading the shared config file, and not only the credentials file, makes profiles using SSO,
+		// credential_process or source_profile work
+		cfg := aws.Config{}
+		cfg.MergeIn(cfgs...)
+		sess, err = newSessionWithOptions(session.Options{
+			Config:            cfg,
+			Profile:           dsInfo.Profile,
+			SharedConfigState: session.SharedConfigEnable,
 		})
 	case authTypeKeys:
 		plog.Debug("Authenticating towards AWS with an access key pair", "region", dsInfo.Region)
 		cfgs = append(cfgs, &aws.Config{
-			Credentials: credentials.NewStaticCredentials(dsInfo.AccessKey, dsInfo.SecretKey, ""),
+			Credentials: credentials.NewStaticCredentials(dsInfo.AccessKey, dsInfo.SecretKey, dsInfo.SessionToken),
 		})
+		sess, err = newSession(cfgs...)
 	case authTypeDefault:
 		plog.Debug("Authenticating towards AWS with default SDK method", "region", dsInfo.Region)
+		sess, err = newSession(cfgs...)
 	default:
 		panic(fmt.Sprintf("Unrecognized authType: %d", dsInfo.AuthType))
 	}
-	sess, err := newSession(cfgs...)
 	if err != nil {
-		return nil, err
+		return nil, time.Time{}, err
 	}
 
 	duration := stscreds.DefaultDuration
 	expiration := time.Now().UTC().Add(duration)
-	if dsInfo.AssumeRoleARN != "" {
+	if len(dsInfo.AssumeRoleARNs) > 0 {
 		// We should assume a role in AWS
-		plog.Debug("Trying to assume role in AWS", "arn", dsInfo.AssumeRoleARN)
+		plog.Debug("Trying to assume role in AWS", "arns", dsInfo.AssumeRoleARNs)
 
-		cfgs := []*aws.Config{
-			{
-				CredentialsChainVerboseErrors: aws.Bool(true),
-			},
-			{
-				Credentials: newSTSCredentials(sess, dsInfo.AssumeRoleARN, func(p *stscreds.AssumeRoleProvider) {
-					// Not sure if this is necessary, overlaps with p.Duration and is undocumented
-					p.Expiry.SetExpiration(expiration, 0)
-					p.Duration = duration
-					if dsInfo.ExternalID != "" {
-						p.ExternalID = aws.String(dsInfo.ExternalID)
-					}
-				}),
-			},
+		if duration, err = parseAssumeRoleDuration(dsInfo.AssumeRoleDuration); err != nil {
+			return nil, time.Time{}, err
 		}
-		if regionCfg != nil {
-			cfgs = append(cfgs, regionCfg)
+		if len(dsInfo.AssumeRoleARNs) > 1 && duration > maxChainedAssumeRoleDuration {
+			return nil, time.Time{}, fmt.Errorf(
+				"invalid assume role duration %q: must be at most 1h when assuming several roles in turn",
+				dsInfo.AssumeRoleDuration)
 		}
-		sess, err = newSession(cfgs...)
-		if err != nil {
-			return nil, err
+		if len(dsInfo.ExternalIDs) > 1 && len(dsInfo.ExternalIDs) != len(dsInfo.AssumeRoleARNs) {
+			return nil, time.Time{}, fmt.Errorf(
+				"invalid external IDs: %d given for %d roles, must be one per role or a single one for the last role",
+				len(dsInfo.ExternalIDs), len(dsInfo.AssumeRoleARNs))
+		}
+		expiration = time.Now().UTC().Add(duration)
+
+		// Backend queries can't prompt for an MFA token, so it has to be configured up front
+		if dsInfo.MFASerialNumber != "" && dsInfo.MFAToken == "" {
+			return nil, time.Time{}, fmt.Errorf(
+				"assuming role %q requires MFA with device %q, but no MFA token is configured",
+				dsInfo.AssumeRoleARNs[0], dsInfo.MFASerialNumber)
+		}
+
+		// Each role is assumed with the credentials of the previous one. The MFA device authenticates the
+		// principal assuming the first role, while each role may expect its own external ID.
+		for i, roleARN := range dsInfo.AssumeRoleARNs {
+			first := i == 0
+			externalID := dsInfo.externalID(i)
+			cfgs := []*aws.Config{
+				{
+					CredentialsChainVerboseErrors: aws.Bool(true),
+				},
+				{
+					Credentials: newSTSCredentials(sess, roleARN, func(p *stscreds.AssumeRoleProvider) {
+						// Not sure if this is necessary, overlaps with p.Duration and is undocumented
+						p.Expiry.SetExpiration(expiration, 0)
+						p.Duration = duration
+						if externalID != "" {
+							p.ExternalID = aws.String(externalID)
+						}
+						p.RoleSessionName = dsInfo.RoleSessionName
+						if first && dsInfo.MFASerialNumber != "" {
+							p.SerialNumber = aws.String(dsInfo.MFASerialNumber)
+							p.TokenProvider = func() (string, error) {
+								return dsInfo.MFAToken, nil
+							}
+						}
+					}),
+				},
+			}
+			if regionCfg != nil {
+				cfgs = append(cfgs, regionCfg)
+			}
+			if partitionCfg != nil {
+				cfgs = append(cfgs, partitionCfg)
+			}
+			cfgs = append(cfgs, httpClientCfg)
+			sess, err = newSession(cfgs...)
+			if err != nil {
+				return nil, time.Time{}, err
+			}
 		}
 	}
 
 	plog.Debug("Successfully created AWS session")
 
-	sessCacheLock.Lock()
-	sessCache[cacheKey] = envelope{
-		session:    sess,
-		expiration: expiration,
+	return sess, expiration, nil
+}
+
+// externalID returns the external ID to assume the role at index i of AssumeRoleARNs with. A single external ID is
+// used for the last role, which is the one expected to be owned by a third party.
+func (dsInfo *datasourceInfo) externalID(i int) string {
+	if len(dsInfo.ExternalIDs) == 1 {
+		if i == len(dsInfo.AssumeRoleARNs)-1 {
+			return dsInfo.ExternalIDs[0]
+		}
+		return ""
+	}
+	if i < len(dsInfo.ExternalIDs) {
+		return dsInfo.ExternalIDs[i]
 	}
-	sessCacheLock.Unlock()
 
-	return sess, nil
+	return ""
+}
+
+// Bounds of the duration of assumed role sessions. Durations over an hour also need the maximum session duration of
+// the role to be raised.
+const (
+	minAssumeRoleDuration = 15 * time.Minute
+	maxAssumeRoleDuration = 12 * time.Hour
+	// AWS limits sessions of roles assumed with the credentials of another role to an hour
+	maxChainedAssumeRoleDuration = time.Hour
+)
+
+// parseAssumeRoleDuration parses the duration of assumed role sessions, returning the SDK default if d is empty.
+func parseAssumeRoleDuration(d string) (time.Duration, error) {
+	if d == "" {
+		return stscreds.DefaultDuration, nil
+	}
+
+	duration, err := gtime.ParseDuration(d)
+	if err != nil {
+		return 0, fmt.Errorf("invalid assume role duration %q: must be a duration such as 1h", d)
+	}
+	if duration < minAssumeRoleDuration || duration > maxAssumeRoleDuration {
+		return 0, fmt.Errorf("invalid assume role duration %q: must be between 15m and 12h", d)
+	}
+
+	return duration, nil
 }
 
 func (e *cloudWatchExecutor) getCWClient(region string) (cloudwatchiface.CloudWatchAPI, error) {
@@ -218,58 +489,103 @@ func (e *cloudWatchExecutor) getCWLogsClient(region string) (cloudwatchlogsiface
 	return logsClient, nil
 }
 
+// getEC2Client returns an EC2 client for region. Clients aren't kept on the executor, as it serves queries for
+// any region, but are cheap to create from the cached sessions.
 func (e *cloudWatchExecutor) getEC2Client(region string) (ec2iface.EC2API, error) {
-	if e.ec2Client != nil {
-		return e.ec2Client, nil
+	sess, err := e.newSession(region)
+	if err != nil {
+		return nil, err
 	}
 
+	return newEC2Client(sess), nil
+}
+
+func (e *cloudWatchExecutor) getSTSClient(region string) (stsiface.STSAPI, error) {
 	sess, err := e.newSession(region)
 	if err != nil {
 		return nil, err
 	}
-	e.ec2Client = newEC2Client(sess)
 
-	return e.ec2Client, nil
+	return newSTSClient(sess), nil
 }
 
 func (e *cloudWatchExecutor) getRGTAClient(region string) (resourcegroupstaggingapiiface.ResourceGroupsTaggingAPIAPI,
 	error) {
-	if e.rgtaClient != nil {
-		return e.rgtaClient, nil
-	}
-
 	sess, err := e.newSession(region)
 	if err != nil {
 		return nil, err
 	}
-	e.rgtaClient = newRGTAClient(sess)
 
-	return e.rgtaClient, nil
+	return newRGTAClient(sess), nil
+}
+
+// Bounds of the delay between the GetQueryResults polls of alert queries. The delay doubles after each poll, so
+// that the results of quick queries are fetched early, without making too many requests for long queries.
+//
+// Stubbable by tests.
+var (
+	minAlertPollDelay = 500 * time.Millisecond
+	maxAlertPollDelay = 5 * time.Second
+)
+
+// alertPollDelay returns the delay before the given poll of the results of an alert query, counting from 1.
+func alertPollDelay(attempt int) time.Duration {
+	delay := minAlertPollDelay
+	for i := 1; i < attempt && delay < maxAlertPollDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxAlertPollDelay {
+		return maxAlertPollDelay
+	}
+
+	return delay
 }
 
 func (e *cloudWatchExecutor) alertQuery(ctx context.Context, logsClient cloudwatchlogsiface.CloudWatchLogsAPI,
 	queryContext *tsdb.TsdbQuery) (*cloudwatchlogs.GetQueryResultsOutput, error) {
 	const maxAttempts = 8
-	const pollPeriod = 1000 * time.Millisecond
 
 	queryParams := queryContext.Queries[0].Model
+	timeout, err := parseQueryTimeout(queryParams)
+	if err != nil {
+		return nil, err
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
 	startQueryOutput, err := e.executeStartQuery(ctx, logsClient, queryParams, queryContext.TimeRange)
 	if err != nil {
 		return nil, err
 	}
+	// The query's slot is released once it terminates, but also when fetching its results fails or is given up on,
+	// so that the alert doesn't keep other queries of the data source waiting
+	defer releaseLogsQuerySlot(*startQueryOutput.QueryId)
 
 	requestParams := simplejson.NewFromAny(map[string]interface{}{
 		"region":  queryParams.Get("region").MustString(""),
 		"queryId": *startQueryOutput.QueryId,
 	})
 
-	ticker := time.NewTicker(pollPeriod)
-	defer ticker.Stop()
-
 	attemptCount := 1
-	for range ticker.C {
+	for {
+		timer := time.NewTimer(alertPollDelay(attemptCount))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			e.stopTimedOutQuery(logsClient, *startQueryOutput.QueryId)
+			return nil, queryTimeoutError(ctx, timeout)
+		case <-timer.C:
+		}
+
 		res, err := e.executeGetQueryResults(ctx, logsClient, requestParams)
 		if err != nil {
+			if ctx.Err() != nil {
+				e.stopTimedOutQuery(logsClient, *startQueryOutput.QueryId)
+				return nil, queryTimeoutError(ctx, timeout)
+			}
 			return nil, err
 		}
 		if isTerminated(*res.Status) {
@@ -281,13 +597,29 @@ func (e *cloudWatchExecutor) alertQuery(ctx context.Context, logsClient cloudwat
 
 		attemptCount++
 	}
-
-	return nil, nil
 }
 
 // Query executes a CloudWatch query.
 func (e *cloudWatchExecutor) Query(ctx context.Context, dsInfo *models.DataSource, queryContext *tsdb.TsdbQuery) (*tsdb.Response, error) {
 	e.DataSource = dsInfo
+	e.user = queryContext.User
+
+	override, err := parseCredentialsOverride(queryContext.Queries)
+	if err != nil {
+		return nil, err
+	}
+	if override != nil {
+		if err := override.checkAllowed(setting.AWSQueryCredentialsOverrideProfiles); err != nil {
+			return nil, err
+		}
+		login := ""
+		if e.user != nil {
+			login = e.user.Login
+		}
+		plog.Debug("Executing queries with overridden credentials", "datasource", dsInfo.Name, "user", login,
+			"profile", override.Profile, "assumeRoleArn", override.AssumeRoleARN)
+	}
+	e.credentialsOverride = override
 
 	/*
 		Unlike many other data sources,	with Cloudwatch Logs query requests don't receive the results as the response to the query, but rather
@@ -305,7 +637,6 @@ func (e *cloudWatchExecutor) Query(ctx context.Context, dsInfo *models.DataSourc
 
 	queryType := queryParams.Get("type").MustString("")
 
-	var err error
 	var result *tsdb.Response
 	switch queryType {
 	case "metricFindQuery":
@@ -319,7 +650,12 @@ func (e *cloudWatchExecutor) Query(ctx context.Context, dsInfo *models.DataSourc
 	case "timeSeriesQuery":
 		fallthrough
 	default:
-		result, err = e.executeTimeSeriesQuery(ctx, queryContext)
+		// Validating queries runs everything but the requests to AWS, to check queries before running them
+		if queryParams.Get("validateOnly").MustBool() {
+			result, err = e.validateTimeSeriesQuery(queryContext)
+		} else {
+			result, err = e.executeTimeSeriesQuery(ctx, queryContext)
+		}
 	}
 
 	return result, err
@@ -328,20 +664,45 @@ func (e *cloudWatchExecutor) Query(ctx context.Context, dsInfo *models.DataSourc
 func (e *cloudWatchExecutor) executeLogAlertQuery(ctx context.Context, queryContext *tsdb.TsdbQuery) (*tsdb.Response, error) {
 	queryParams := queryContext.Queries[0].Model
 	queryParams.Set("subtype", "StartQuery")
-	queryParams.Set("queryString", queryParams.Get("expression").MustString(""))
+	queryString, err := expandLogsQueryMacros(queryParams.Get("expression").MustString(""), e.DataSource, queryParams,
+		queryContext.TimeRange)
+	if err != nil {
+		return nil, err
+	}
+	queryParams.Set("queryString", queryString)
 
-	region := queryParams.Get("region").MustString(defaultRegion)
-	if region == defaultRegion {
-		region = e.DataSource.JsonData.Get("defaultRegion").MustString()
-		queryParams.Set("region", region)
+	region, err := e.resolveRegion(queryParams.Get("region").MustString(defaultRegion))
+	if err != nil {
+		return nil, err
 	}
+	queryParams.Set("region", region)
 
 	logsClient, err := e.getCWLogsClient(region)
 	if err != nil {
 		return nil, err
 	}
 
-	result, err := e.executeStartQuery(ctx, logsClient, queryParams, queryContext.TimeRange)
+	startQueryInput, err := buildStartQueryInput(queryParams, queryContext.TimeRange)
+	if err != nil {
+		return nil, err
+	}
+	result, err := e.startQuery(ctx, logsClient, startQueryInput)
+	if notice, ok := missingLogGroupNotice(err, startQueryInput); ok {
+		// Like for dashboards, a deleted log group results in no data rather than an error, so that the alert's
+		// no data state applies
+		plog.Warn("Log group of alert query not found", "err", err)
+		dataframe := data.NewFrame("A")
+		dataframe.RefID = "A"
+		dataframe.Meta = &data.FrameMeta{Notices: []data.Notice{notice}}
+		return &tsdb.Response{
+			Results: map[string]*tsdb.QueryResult{
+				"A": {
+					RefId:      "A",
+					Dataframes: tsdb.NewDecodedDataFrames(data.Frames{dataframe}),
+				},
+			},
+		}, nil
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -354,14 +715,16 @@ func (e *cloudWatchExecutor) executeLogAlertQuery(ctx context.Context, queryCont
 		return nil, err
 	}
 
-	dataframe, err := logsResultsToDataframes(getQueryResultsOutput)
+	dataframe, err := logsResultsToDataframes(getQueryResultsOutput, queryParams.Get("expandJsonMessage").MustBool())
 	if err != nil {
 		return nil, err
 	}
+	// Results aren't guaranteed to come ordered by time (ascending), so we need to sort
+	sort.Sort(ByTime(*dataframe))
 
 	statsGroups := queryParams.Get("statsGroups").MustStringArray()
 	if len(statsGroups) > 0 && len(dataframe.Fields) > 0 {
-		groupedFrames, err := groupResults(dataframe, statsGroups)
+		groupedFrames, err := groupResults(dataframe, statsGroups, false)
 		if err != nil {
 			return nil, err
 		}
@@ -410,49 +773,240 @@ func (at authType) String() string {
 	}
 }
 
-func (e *cloudWatchExecutor) getDSInfo(region string) *datasourceInfo {
-	if region == defaultRegion {
-		region = e.DataSource.JsonData.Get("defaultRegion").MustString()
-	}
+// authTypeSynonyms maps legacy and alternative spellings of authentication types, found in older provisioning
+// files, to the ones in use.
+var authTypeSynonyms = map[string]string{
+	"sharedcreds":  "credentials",
+	"shared":       "credentials",
+	"profile":      "credentials",
+	"accesskey":    "keys",
+	"access_key":   "keys",
+	"ec2_iam_role": "default",
+}
 
-	atStr := e.DataSource.JsonData.Get("authType").MustString()
-	assumeRoleARN := e.DataSource.JsonData.Get("assumeRoleArn").MustString()
-	externalID := e.DataSource.JsonData.Get("externalId").MustString()
-	endpoint := e.DataSource.JsonData.Get("endpoint").MustString()
-	decrypted := e.DataSource.DecryptedValues()
-	accessKey := decrypted["accessKey"]
-	secretKey := decrypted["secretKey"]
+// parseAuthType parses the authType setting of a data source, ignoring case and surrounding whitespace.
+func parseAuthType(atStr string) authType {
+	normalized := strings.ToLower(strings.TrimSpace(atStr))
+	if synonym, ok := authTypeSynonyms[normalized]; ok {
+		normalized = synonym
+	}
+	if normalized != atStr {
+		plog.Debug("Normalized AWS authentication type", "type", atStr, "normalized", normalized)
+	}
 
-	at := authTypeDefault
-	switch atStr {
+	switch normalized {
 	case "credentials":
-		at = authTypeSharedCreds
+		return authTypeSharedCreds
 	case "keys":
-		at = authTypeKeys
+		return authTypeKeys
 	case "default":
-		at = authTypeDefault
+		return authTypeDefault
 	case "arn":
-		at = authTypeDefault
 		plog.Warn("Authentication type \"arn\" is deprecated, falling back to default")
+		return authTypeDefault
 	default:
 		plog.Warn("Unrecognized AWS authentication type", "type", atStr)
+		return authTypeDefault
+	}
+}
+
+func (e *cloudWatchExecutor) getDSInfo(region string) *datasourceInfo {
+	jsonData := e.DataSource.JsonData
+	if region == defaultRegion {
+		region = jsonDataString(jsonData, "defaultRegion")
+	}
+
+	atStr := jsonDataString(jsonData, "authType")
+	assumeRoleARNs := jsonDataStrings(jsonData, "assumeRoleArn")
+	externalIDs := jsonDataAlignedStrings(jsonData, "externalId")
+	roleSessionName := jsonDataString(jsonData, "roleSessionName")
+	if roleSessionName == "" {
+		roleSessionName = defaultRoleSessionName
+	}
+	// Naming sessions after the user lets operators tell in CloudTrail who made the requests, at the expense of
+	// assuming the role for each user
+	if jsonDataBool(jsonData, "roleSessionNameWithUser") && e.user != nil && e.user.Login != "" {
+		roleSessionName += "-" + e.user.Login
 	}
+	roleSessionName = sanitizeRoleSessionName(roleSessionName)
+	assumeRoleDuration := jsonDataString(jsonData, "assumeRoleDuration")
+	endpoint := jsonDataString(jsonData, "endpoint")
+	proxyURL := jsonDataString(jsonData, "proxyUrl")
+	noProxy := jsonDataString(jsonData, "noProxy")
+	tlsSkipVerify := jsonDataBool(jsonData, "tlsSkipVerify")
+	timeout := time.Duration(jsonDataInt(jsonData, "timeout")) * time.Second
+	dialTimeout := time.Duration(jsonDataInt(jsonData, "dialTimeout")) * time.Second
+	sessionRefreshWindow := jsonDataDuration(jsonData, "sessionRefreshWindow")
+	decrypted := e.DataSource.DecryptedValues()
+	accessKey := decrypted["accessKey"]
+	secretKey := decrypted["secretKey"]
+	sessionToken := decrypted["sessionToken"]
+	tlsCACert := decrypted["tlsCACert"]
+	mfaToken := decrypted["mfaToken"]
+	mfaSerialNumber := jsonDataString(jsonData, "mfaSerialNumber")
+
+	at := parseAuthType(atStr)
 
-	profile := e.DataSource.JsonData.Get("profile").MustString()
+	profile := jsonDataString(jsonData, "profile")
 	if profile == "" {
 		profile = e.DataSource.Database // legacy support
 	}
 
 	return &datasourceInfo{
-		Region:        region,
-		Profile:       profile,
-		AuthType:      at,
-		AssumeRoleARN: assumeRoleARN,
-		ExternalID:    externalID,
-		AccessKey:     accessKey,
-		SecretKey:     secretKey,
-		Endpoint:      endpoint,
+		Version:              dataSourceVersion(e.DataSource),
+		Region:               region,
+		Profile:              profile,
+		AuthType:             at,
+		AssumeRoleARNs:       assumeRoleARNs,
+		ExternalIDs:          externalIDs,
+		RoleSessionName:      roleSessionName,
+		AssumeRoleDuration:   assumeRoleDuration,
+		MFASerialNumber:      mfaSerialNumber,
+		AccessKey:            accessKey,
+		SecretKey:            secretKey,
+		SessionToken:         sessionToken,
+		Endpoint:             endpoint,
+		ProxyURL:             proxyURL,
+		NoProxy:              noProxy,
+		TLSSkipVerify:        tlsSkipVerify,
+		Timeout:              timeout,
+		DialTimeout:          dialTimeout,
+		SessionRefreshWindow: sessionRefreshWindow,
+		TLSCACert:            tlsCACert,
+		MFAToken:             mfaToken,
+	}
+}
+
+// sanitizeRoleSessionName replaces the characters STS doesn't allow in role session names with underscores, and
+// truncates name to the maximum length.
+func sanitizeRoleSessionName(name string) string {
+	name = invalidRoleSessionNameChars.ReplaceAllString(name, "_")
+	if len(name) > maxRoleSessionNameLength {
+		name = name[:maxRoleSessionNameLength]
+	}
+
+	return name
+}
+
+// jsonDataString returns a setting of the data source as a string. Provisioned settings may be numbers or booleans,
+// e.g. an external ID made of digits, which are formatted instead of being ignored.
+func jsonDataString(jsonData *simplejson.Json, key string) string {
+	switch value := jsonData.Get(key).Interface().(type) {
+	case string:
+		return value
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	case json.Number, bool, int, int64:
+		return fmt.Sprint(value)
+	case nil:
+		return ""
+	default:
+		plog.Warn("Ignoring data source setting which isn't a string", "key", key, "type", fmt.Sprintf("%T", value))
+		return ""
+	}
+}
+
+// jsonDataStrings returns a setting of the data source holding a list of strings, given either as a JSON list or
+// as a comma separated string.
+func jsonDataStrings(jsonData *simplejson.Json, key string) []string {
+	values, err := jsonData.Get(key).StringArray()
+	if err != nil {
+		values = strings.Split(jsonDataString(jsonData, key), ",")
+	}
+
+	result := make([]string, 0, len(values))
+	for _, value := range values {
+		if value = strings.TrimSpace(value); value != "" {
+			result = append(result, value)
+		}
+	}
+	if len(result) == 0 {
+		return nil
+	}
+
+	return result
+}
+
+// jsonDataAlignedStrings is like jsonDataStrings, but keeps blank values in place, so that the values stay aligned
+// with those of another list setting. Nil is returned if all values are blank.
+func jsonDataAlignedStrings(jsonData *simplejson.Json, key string) []string {
+	values, err := jsonData.Get(key).StringArray()
+	if err != nil {
+		values = strings.Split(jsonDataString(jsonData, key), ",")
+	}
+
+	result := make([]string, 0, len(values))
+	blank := true
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if value != "" {
+			blank = false
+		}
+		result = append(result, value)
+	}
+	if blank {
+		return nil
+	}
+
+	return result
+}
+
+// jsonDataBool returns a boolean setting of the data source, which may be provisioned as a string such as "true".
+func jsonDataBool(jsonData *simplejson.Json, key string) bool {
+	str := jsonDataString(jsonData, key)
+	if str == "" {
+		return false
+	}
+	value, err := strconv.ParseBool(str)
+	if err != nil {
+		plog.Warn("Ignoring data source setting which isn't a boolean", "key", key, "value", str)
+		return false
+	}
+
+	return value
+}
+
+// jsonDataInt returns an integer setting of the data source, which may be provisioned as a string such as "30".
+func jsonDataInt(jsonData *simplejson.Json, key string) int {
+	if value, err := jsonData.Get(key).Int(); err == nil {
+		return value
+	}
+	str := jsonDataString(jsonData, key)
+	if str == "" {
+		return 0
+	}
+	value, err := strconv.Atoi(str)
+	if err != nil {
+		plog.Warn("Ignoring data source setting which isn't an integer", "key", key, "value", str)
+		return 0
+	}
+
+	return value
+}
+
+// jsonDataDuration returns a duration setting of the data source, given as a string such as "5m", or zero if it
+// isn't set.
+func jsonDataDuration(jsonData *simplejson.Json, key string) time.Duration {
+	str := jsonDataString(jsonData, key)
+	if str == "" {
+		return 0
+	}
+	value, err := time.ParseDuration(str)
+	if err != nil || value < 0 {
+		plog.Warn("Ignoring data source setting which isn't a duration", "key", key, "value", str)
+		return 0
+	}
+
+	return value
+}
+
+// hashString returns a hex encoded SHA-256 hash of s, or an empty string if s is empty.
+func hashString(s string) string {
+	if s == "" {
+		return ""
 	}
+
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(s)))
 }
 
 func isTerminated(queryStatus string) bool {
@@ -464,9 +1018,7 @@ func isTerminated(queryStatus string) bool {
 // Stubbable by tests.
 var NewCWClient = func(sess *session.Session) cloudwatchiface.CloudWatchAPI {
 	client := cloudwatch.New(sess)
-	client.Handlers.Send.PushFront(func(r *request.Request) {
-		r.HTTPRequest.Header.Set("User-Agent", fmt.Sprintf("Grafana/%s", setting.BuildVersion))
-	})
+	setUserAgent(&client.Handlers)
 
 	return client
 }
@@ -476,9 +1028,7 @@ var NewCWClient = func(sess *session.Session) cloudwatchiface.CloudWatchAPI {
 // Stubbable by tests.
 var NewCWLogsClient = func(sess *session.Session) cloudwatchlogsiface.CloudWatchLogsAPI {
 	client := cloudwatchlogs.New(sess)
-	client.Handlers.Send.PushFront(func(r *request.Request) {
-		r.HTTPRequest.Header.Set("User-Agent", fmt.Sprintf("Grafana/%s", setting.BuildVersion))
-	})
+	setUserAgent(&client.Handlers)
 
 	return client
 }
@@ -487,12 +1037,83 @@ var NewCWLogsClient = func(sess *session.Session) cloudwatchlogsiface.CloudWatch
 //
 // Stubbable by tests.
 var newEC2Client = func(provider client.ConfigProvider) ec2iface.EC2API {
-	return ec2.New(provider)
+	client := ec2.New(provider)
+	setUserAgent(&client.Handlers)
+
+	return client
 }
 
 // RGTA client factory.
 //
 // Stubbable by tests.
 var newRGTAClient = func(provider client.ConfigProvider) resourcegroupstaggingapiiface.ResourceGroupsTaggingAPIAPI {
-	return resourcegroupstaggingapi.New(provider)
+	client := resourcegroupstaggingapi.New(provider)
+	setUserAgent(&client.Handlers)
+
+	return client
+}
+
+// STS client factory.
+//
+// Stubbable by tests.
+var newSTSClient = func(provider client.ConfigProvider) stsiface.STSAPI {
+	client := sts.New(provider)
+	setUserAgent(&client.Handlers)
+
+	return client
+}
+
+// setUserAgent makes the requests of a client identify Grafana, followed by the suffix configured in the aws
+// section of the settings, if any.
+func setUserAgent(handlers *request.Handlers) {
+	userAgent := fmt.Sprintf("Grafana/%s", setting.BuildVersion)
+	if setting.AWSUserAgentSuffix != "" {
+		userAgent += " " + setting.AWSUserAgentSuffix
+	}
+
+	handlers.Send.PushFront(func(r *request.Request) {
+		r.HTTPRequest.Header.Set("User-Agent", userAgent)
+	})
+}
+
+// ClientFactories holds the factories used to create AWS service clients.
+type ClientFactories struct {
+	CloudWatch            func(sess *session.Session) cloudwatchiface.CloudWatchAPI
+	CloudWatchLogs        func(sess *session.Session) cloudwatchlogsiface.CloudWatchLogsAPI
+	EC2                   func(provider client.ConfigProvider) ec2iface.EC2API
+	ResourceGroupsTagging func(provider client.ConfigProvider) resourcegroupstaggingapiiface.ResourceGroupsTaggingAPIAPI
+}
+
+// SetClientFactories replaces the AWS client factories, so integration tests can point the data source at
+// e.g. LocalStack without stubbing each factory. Nil factories are left as they are.
+// The returned function restores the previous factories.
+//
+// Not safe for concurrent use with queries, and only meant for tests.
+func SetClientFactories(factories ClientFactories) (restore func()) {
+	prev := ClientFactories{
+		CloudWatch:            NewCWClient,
+		CloudWatchLogs:        NewCWLogsClient,
+		EC2:                   newEC2Client,
+		ResourceGroupsTagging: newRGTAClient,
+	}
+
+	if factories.CloudWatch != nil {
+		NewCWClient = factories.CloudWatch
+	}
+	if factories.CloudWatchLogs != nil {
+		NewCWLogsClient = factories.CloudWatchLogs
+	}
+	if factories.EC2 != nil {
+		newEC2Client = factories.EC2
+	}
+	if factories.ResourceGroupsTagging != nil {
+		newRGTAClient = factories.ResourceGroupsTagging
+	}
+
+	return func() {
+		NewCWClient = prev.CloudWatch
+		NewCWLogsClient = prev.CloudWatchLogs
+		newEC2Client = prev.EC2
+		newRGTAClient = prev.ResourceGroupsTagging
+	}
 }
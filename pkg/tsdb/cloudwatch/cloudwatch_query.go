@@ -1,9 +1,15 @@
 package cloudwatch
 
 import (
+	"regexp"
 	"strings"
+	"time"
 )
 
+// anomalyDetectionBandExpression matches ANOMALY_DETECTION_BAND(m1) and ANOMALY_DETECTION_BAND(m1, 2),
+// capturing the id of the metric the band is computed for.
+var anomalyDetectionBandExpression = regexp.MustCompile(`^\s*ANOMALY_DETECTION_BAND\(\s*([^,\s)]+)\s*(?:,\s*[0-9.]+\s*)?\)\s*$`)
+
 type cloudWatchQuery struct {
 	RefId                   string
 	Region                  string
@@ -12,6 +18,7 @@ type cloudWatchQuery struct {
 	MetricName              string
 	Stats                   string
 	Expression              string
+	SqlExpression           string
 	ReturnData              bool
 	Dimensions              map[string][]string
 	Period                  int
@@ -19,12 +26,56 @@ type cloudWatchQuery struct {
 	MatchExact              bool
 	UsedExpression          string
 	RequestExceededMaxLimit bool
+	Timezone                *time.Location
+	MultipleStats           bool
+	MultipleRegions         bool
+	Unit                    string
+	IncludeRawResults       bool
+	ResolveInstanceNames    bool
+	MaxDataPoints           int64
+}
+
+// isMetricsInsightsQuery tells whether the metrics of the query are selected by a Metrics Insights SQL statement.
+func (q *cloudWatchQuery) isMetricsInsightsQuery() bool {
+	return q.SqlExpression != ""
+}
+
+// metricsInsightsGroupBy matches the GROUP BY clause of a Metrics Insights query, capturing its keys.
+var metricsInsightsGroupBy = regexp.MustCompile(`(?is)\bGROUP\s+BY\s+(.+?)(?:\s+ORDER\s+BY\b|\s+LIMIT\b|$)`)
+
+// metricsInsightsGroupByKeys returns the keys the results of a Metrics Insights query are grouped by.
+func (q *cloudWatchQuery) metricsInsightsGroupByKeys() []string {
+	matches := metricsInsightsGroupBy.FindStringSubmatch(q.SqlExpression)
+	if matches == nil {
+		return nil
+	}
+
+	keys := strings.Split(matches[1], ",")
+	for i, key := range keys {
+		keys[i] = strings.Trim(strings.TrimSpace(key), `"`)
+	}
+	return keys
 }
 
 func (q *cloudWatchQuery) isMathExpression() bool {
 	return q.Expression != "" && !q.isUserDefinedSearchExpression()
 }
 
+// anomalyDetectionBandMetricID returns the id of the metric referenced by an ANOMALY_DETECTION_BAND expression,
+// or an empty string if the query isn't such an expression.
+func (q *cloudWatchQuery) anomalyDetectionBandMetricID() string {
+	matches := anomalyDetectionBandExpression.FindStringSubmatch(q.Expression)
+	if matches == nil {
+		return ""
+	}
+
+	return matches[1]
+}
+
+func (q *cloudWatchQuery) isAnomalyDetectionBandExpression() bool {
+	return q.anomalyDetectionBandMetricID() != ""
+}
+
 func (q *cloudWatchQuery) isSearchExpression() bool {
 	return q.isUserDefinedSearchExpression() || q.isInferredSearchExpression()
 }
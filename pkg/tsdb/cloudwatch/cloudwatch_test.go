@@ -0,0 +1,636 @@
+package cloudwatch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/aws/aws-sdk-go/service/cloudwatch/cloudwatchiface"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs/cloudwatchlogsiface"
+	"github.com/aws/aws-sdk-go/service/ec2/ec2iface"
+	"github.com/aws/aws-sdk-go/service/resourcegroupstaggingapi/resourcegroupstaggingapiiface"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/grafana/grafana/pkg/components/simplejson"
+	"github.com/grafana/grafana/pkg/setting"
+	"github.com/grafana/grafana/pkg/tsdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQuery_LogAlertQuery(t *testing.T) {
+	origNewCWLogsClient := NewCWLogsClient
+	t.Cleanup(func() {
+		NewCWLogsClient = origNewCWLogsClient
+	})
+
+	var cli FakeCWLogsClient
+
+	NewCWLogsClient = func(sess *session.Session) cloudwatchlogsiface.CloudWatchLogsAPI {
+		return cli
+	}
+
+	t.Run("Query statistics are kept in the meta data of grouped frames", func(t *testing.T) {
+		cli = FakeCWLogsClient{
+			queryResults: cloudwatchlogs.GetQueryResultsOutput{
+				Results: [][]*cloudwatchlogs.ResultField{
+					{
+						{Field: aws.String("@timestamp"), Value: aws.String("2020-03-20 10:37:23.000")},
+						{Field: aws.String("level"), Value: aws.String("error")},
+						{Field: aws.String("count"), Value: aws.String("5")},
+					},
+					{
+						{Field: aws.String("@timestamp"), Value: aws.String("2020-03-20 10:37:23.000")},
+						{Field: aws.String("level"), Value: aws.String("warning")},
+						{Field: aws.String("count"), Value: aws.String("12")},
+					},
+				},
+				Statistics: &cloudwatchlogs.QueryStatistics{
+					BytesScanned:   aws.Float64(512),
+					RecordsMatched: aws.Float64(256),
+					RecordsScanned: aws.Float64(1024),
+				},
+				Status: aws.String("Complete"),
+			},
+		}
+
+		executor := newExecutor(nil)
+		resp, err := executor.Query(context.Background(), fakeDataSource(), &tsdb.TsdbQuery{
+			TimeRange: tsdb.NewTimeRange("1584700643000", "1584873443000"),
+			Headers:   map[string]string{"FromAlert": "true"},
+			Queries: []*tsdb.Query{
+				{
+					RefId: "A",
+					Model: simplejson.NewFromAny(map[string]interface{}{
+						"queryMode":     "Logs",
+						"region":        "us-east-1",
+						"expression":    "stats count(*) by level",
+						"logGroupNames": []interface{}{"group_a"},
+						"statsGroups":   []interface{}{"level"},
+					}),
+				},
+			},
+		})
+		require.NoError(t, err)
+
+		frames, err := resp.Results["A"].Dataframes.Decoded()
+		require.NoError(t, err)
+		require.Len(t, frames, 2)
+
+		expStats := []data.QueryStat{
+			{
+				FieldConfig: data.FieldConfig{DisplayName: "Bytes scanned"},
+				Value:       512,
+			},
+			{
+				FieldConfig: data.FieldConfig{DisplayName: "Records scanned"},
+				Value:       1024,
+			},
+			{
+				FieldConfig: data.FieldConfig{DisplayName: "Records matched"},
+				Value:       256,
+			},
+		}
+		for _, frame := range frames {
+			require.NotNil(t, frame.Meta)
+			assert.Equal(t, expStats, frame.Meta.Stats)
+		}
+	})
+
+	t.Run("Query is stopped when its timeout elapses", func(t *testing.T) {
+		cli = FakeCWLogsClient{
+			calls: &logsCalls{},
+			queryResults: cloudwatchlogs.GetQueryResultsOutput{
+				Status: aws.String("Running"),
+			},
+		}
+
+		executor := newExecutor(nil)
+		_, err := executor.Query(context.Background(), fakeDataSource(), &tsdb.TsdbQuery{
+			TimeRange: tsdb.NewTimeRange("1584700643000", "1584873443000"),
+			Headers:   map[string]string{"FromAlert": "true"},
+			Queries: []*tsdb.Query{
+				{
+					RefId: "A",
+					Model: simplejson.NewFromAny(map[string]interface{}{
+						"queryMode":     "Logs",
+						"region":        "us-east-1",
+						"expression":    "fields @message",
+						"logGroupNames": []interface{}{"group_a"},
+						"timeout":       "100ms",
+					}),
+				},
+			},
+		})
+		require.EqualError(t, err, "log query timed out after 100ms")
+
+		require.Len(t, cli.calls.stopQuery, 1)
+		assert.Equal(t, "abcd-efgh-ijkl-mnop", *cli.calls.stopQuery[0].QueryId)
+	})
+
+	t.Run("Invalid timeouts are rejected", func(t *testing.T) {
+		cli = FakeCWLogsClient{calls: &logsCalls{}}
+
+		executor := newExecutor(nil)
+		_, err := executor.Query(context.Background(), fakeDataSource(), &tsdb.TsdbQuery{
+			TimeRange: tsdb.NewTimeRange("1584700643000", "1584873443000"),
+			Headers:   map[string]string{"FromAlert": "true"},
+			Queries: []*tsdb.Query{
+				{
+					RefId: "A",
+					Model: simplejson.NewFromAny(map[string]interface{}{
+						"queryMode":     "Logs",
+						"region":        "us-east-1",
+						"expression":    "fields @message",
+						"logGroupNames": []interface{}{"group_a"},
+						"timeout":       "soon",
+					}),
+				},
+			},
+		})
+		require.EqualError(t, err, `invalid query timeout "soon"`)
+	})
+
+	t.Run("Time macros in the query string are expanded", func(t *testing.T) {
+		cli = FakeCWLogsClient{
+			calls: &logsCalls{},
+			queryResults: cloudwatchlogs.GetQueryResultsOutput{
+				Status: aws.String("Complete"),
+			},
+		}
+
+		executor := newExecutor(nil)
+		_, err := executor.Query(context.Background(), fakeDataSource(), &tsdb.TsdbQuery{
+			TimeRange: tsdb.NewTimeRange("1584700643000", "1584873443000"),
+			Headers:   map[string]string{"FromAlert": "true"},
+			Queries: []*tsdb.Query{
+				{
+					RefId: "A",
+					Model: simplejson.NewFromAny(map[string]interface{}{
+						"queryMode": "Logs",
+						"region":    "us-east-1",
+						"expression": "filter @timestamp >= $__from and @timestamp <= ${__to} " +
+							"| stats count(*) by bin($__interval), bin(${__interval_ms}ms)",
+						"logGroupNames": []interface{}{"group_a"},
+					}),
+				},
+			},
+		})
+		require.NoError(t, err)
+
+		require.NotEmpty(t, cli.calls.startQuery)
+		for _, input := range cli.calls.startQuery {
+			assert.Equal(t, "fields @timestamp,ltrim(@log) as "+logIdentifierInternal+",ltrim(@logStream) as "+
+				logStreamIdentifierInternal+"|filter @timestamp >= 1584700643000 and @timestamp <= 1584873443000 | stats count(*) by bin(2m), bin(120000ms)",
+				*input.QueryString)
+		}
+	})
+
+	t.Run("Missing log group results in an empty frame with a notice", func(t *testing.T) {
+		cli = FakeCWLogsClient{
+			calls: &logsCalls{},
+			startQueryErrors: []error{awserr.New(cloudwatchlogs.ErrCodeResourceNotFoundException,
+				"Log group 'group_a' does not exist for account ID '123456789012'", nil)},
+		}
+
+		executor := newExecutor(nil)
+		resp, err := executor.Query(context.Background(), fakeDataSource(), &tsdb.TsdbQuery{
+			TimeRange: tsdb.NewTimeRange("1584700643000", "1584873443000"),
+			Headers:   map[string]string{"FromAlert": "true"},
+			Queries: []*tsdb.Query{
+				{
+					RefId: "A",
+					Model: simplejson.NewFromAny(map[string]interface{}{
+						"queryMode":     "Logs",
+						"region":        "us-east-1",
+						"expression":    "fields @message",
+						"logGroupNames": []interface{}{"group_a"},
+					}),
+				},
+			},
+		})
+		require.NoError(t, err)
+
+		frames, err := resp.Results["A"].Dataframes.Decoded()
+		require.NoError(t, err)
+		require.Len(t, frames, 1)
+		assert.Empty(t, frames[0].Fields)
+		require.NotNil(t, frames[0].Meta)
+		assert.Equal(t, []data.Notice{
+			{
+				Severity: data.NoticeSeverityWarning,
+				Text:     `log group "group_a" does not exist, it may have been deleted`,
+			},
+		}, frames[0].Meta.Notices)
+		// The query isn't polled, since it never started
+		assert.Len(t, cli.calls.startQuery, 1)
+		assert.Empty(t, cli.calls.getQueryResults)
+	})
+
+	runAlertQuery := func(ctx context.Context) error {
+		executor := newExecutor(nil)
+		_, err := executor.Query(ctx, fakeDataSource(), &tsdb.TsdbQuery{
+			TimeRange: tsdb.NewTimeRange("1584700643000", "1584873443000"),
+			Headers:   map[string]string{"FromAlert": "true"},
+			Queries: []*tsdb.Query{
+				{
+					RefId: "A",
+					Model: simplejson.NewFromAny(map[string]interface{}{
+						"queryMode":     "Logs",
+						"region":        "us-east-1",
+						"expression":    "fields @message",
+						"logGroupNames": []interface{}{"group_a"},
+					}),
+				},
+			},
+		})
+		return err
+	}
+
+	t.Run("Results are polled until the query completes", func(t *testing.T) {
+		origMinAlertPollDelay, origMaxAlertPollDelay := minAlertPollDelay, maxAlertPollDelay
+		t.Cleanup(func() {
+			minAlertPollDelay, maxAlertPollDelay = origMinAlertPollDelay, origMaxAlertPollDelay
+		})
+		minAlertPollDelay, maxAlertPollDelay = time.Millisecond, 4*time.Millisecond
+
+		running := cloudwatchlogs.GetQueryResultsOutput{Status: aws.String("Running")}
+		cli = FakeCWLogsClient{
+			calls: &logsCalls{},
+			queryResultsPolls: []cloudwatchlogs.GetQueryResultsOutput{
+				running, running, running, running,
+				{Status: aws.String("Complete")},
+			},
+		}
+
+		require.NoError(t, runAlertQuery(context.Background()))
+		assert.Len(t, cli.calls.getQueryResults, 5)
+		assert.Empty(t, cli.calls.stopQuery)
+	})
+
+	t.Run("Query is stopped when cancelled while waiting for its results", func(t *testing.T) {
+		origMinAlertPollDelay := minAlertPollDelay
+		t.Cleanup(func() {
+			minAlertPollDelay = origMinAlertPollDelay
+		})
+		minAlertPollDelay = time.Hour
+
+		cli = FakeCWLogsClient{
+			calls: &logsCalls{},
+			queryResults: cloudwatchlogs.GetQueryResultsOutput{
+				Status: aws.String("Running"),
+			},
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(50*time.Millisecond, cancel)
+		start := time.Now()
+		err := runAlertQuery(ctx)
+		require.True(t, errors.Is(err, context.Canceled), err)
+		assert.Less(t, int64(time.Since(start)), int64(time.Minute))
+
+		assert.Empty(t, cli.calls.getQueryResults)
+		require.Len(t, cli.calls.stopQuery, 1)
+		assert.Equal(t, "abcd-efgh-ijkl-mnop", *cli.calls.stopQuery[0].QueryId)
+	})
+}
+
+func TestAlertPollDelay(t *testing.T) {
+	expected := []time.Duration{
+		500 * time.Millisecond,
+		time.Second,
+		2 * time.Second,
+		4 * time.Second,
+		5 * time.Second,
+		5 * time.Second,
+	}
+	for i, delay := range expected {
+		assert.Equal(t, delay, alertPollDelay(i+1), "attempt %d", i+1)
+	}
+}
+
+func TestQuery_MissingRegion(t *testing.T) {
+	stubEC2MetadataWithoutRegion(t)
+	setEnv(t, "AWS_REGION", "")
+	setEnv(t, "AWS_DEFAULT_REGION", "")
+
+	dataSource := fakeDataSource()
+	dataSource.JsonData.Set("defaultRegion", "")
+	timeRange := tsdb.NewTimeRange("1584700643000", "1584873443000")
+
+	t.Run("Metrics query", func(t *testing.T) {
+		executor := newExecutor(nil)
+		_, err := executor.Query(context.Background(), dataSource, &tsdb.TsdbQuery{
+			TimeRange: timeRange,
+			Queries: []*tsdb.Query{
+				{
+					RefId: "A",
+					Model: simplejson.NewFromAny(map[string]interface{}{
+						"region":     "default",
+						"namespace":  "AWS/EC2",
+						"metricName": "CPUUtilization",
+						"dimensions": map[string]interface{}{
+							"InstanceId": "i-123",
+						},
+						"statistics": []interface{}{"Average"},
+						"period":     "300",
+					}),
+				},
+			},
+		})
+		assert.True(t, errors.Is(err, errMissingRegion), "unexpected error: %v", err)
+	})
+
+	t.Run("Logs query", func(t *testing.T) {
+		executor := newExecutor(nil)
+		_, err := executor.Query(context.Background(), dataSource, &tsdb.TsdbQuery{
+			TimeRange: timeRange,
+			Queries: []*tsdb.Query{
+				{
+					RefId: "A",
+					Model: simplejson.NewFromAny(map[string]interface{}{
+						"type":          "logAction",
+						"subtype":       "StartQuery",
+						"region":        "default",
+						"queryString":   "fields @message",
+						"logGroupNames": []interface{}{"group_a"},
+					}),
+				},
+			},
+		})
+		assert.True(t, errors.Is(err, errMissingRegion), "unexpected error: %v", err)
+	})
+
+	t.Run("Logs alert query", func(t *testing.T) {
+		executor := newExecutor(nil)
+		_, err := executor.Query(context.Background(), dataSource, &tsdb.TsdbQuery{
+			TimeRange: timeRange,
+			Headers:   map[string]string{"FromAlert": "true"},
+			Queries: []*tsdb.Query{
+				{
+					RefId: "A",
+					Model: simplejson.NewFromAny(map[string]interface{}{
+						"queryMode":     "Logs",
+						"region":        "default",
+						"expression":    "fields @message",
+						"logGroupNames": []interface{}{"group_a"},
+					}),
+				},
+			},
+		})
+		assert.True(t, errors.Is(err, errMissingRegion), "unexpected error: %v", err)
+	})
+}
+
+func TestSetClientFactories(t *testing.T) {
+	stubNewSession(t)
+
+	cwClient := FakeCWClient{}
+	logsClient := FakeCWLogsClient{}
+	ec2Client := fakeEC2Client{}
+	rgtaClient := fakeRGTAClient{}
+	restore := SetClientFactories(ClientFactories{
+		CloudWatch: func(sess *session.Session) cloudwatchiface.CloudWatchAPI {
+			return cwClient
+		},
+		CloudWatchLogs: func(sess *session.Session) cloudwatchlogsiface.CloudWatchLogsAPI {
+			return logsClient
+		},
+		EC2: func(provider client.ConfigProvider) ec2iface.EC2API {
+			return ec2Client
+		},
+		ResourceGroupsTagging: func(provider client.ConfigProvider) resourcegroupstaggingapiiface.ResourceGroupsTaggingAPIAPI {
+			return rgtaClient
+		},
+	})
+	t.Cleanup(restore)
+
+	executor := newExecutor(nil)
+	executor.DataSource = fakeDataSource()
+
+	t.Run("Clients are created by the overriding factories", func(t *testing.T) {
+		cw, err := executor.getCWClient("us-east-1")
+		require.NoError(t, err)
+		assert.Equal(t, cwClient, cw)
+
+		logs, err := executor.getCWLogsClient("us-east-1")
+		require.NoError(t, err)
+		assert.Equal(t, logsClient, logs)
+
+		ec2Cli, err := executor.getEC2Client("us-east-1")
+		require.NoError(t, err)
+		assert.Equal(t, ec2Client, ec2Cli)
+
+		rgta, err := executor.getRGTAClient("us-east-1")
+		require.NoError(t, err)
+		assert.Equal(t, rgtaClient, rgta)
+	})
+
+	t.Run("Default factories are restored", func(t *testing.T) {
+		restore()
+
+		sess, err := session.NewSession(&aws.Config{Region: aws.String("us-east-1")})
+		require.NoError(t, err)
+		assert.IsType(t, &cloudwatch.CloudWatch{}, NewCWClient(sess))
+		assert.IsType(t, &cloudwatchlogs.CloudWatchLogs{}, NewCWLogsClient(sess))
+	})
+}
+
+func TestGetClients_PerRegion(t *testing.T) {
+	stubNewSession(t)
+
+	origNewEC2Client := newEC2Client
+	origNewRGTAClient := newRGTAClient
+	t.Cleanup(func() {
+		newEC2Client = origNewEC2Client
+		newRGTAClient = origNewRGTAClient
+	})
+	var ec2Regions, rgtaRegions []string
+	newEC2Client = func(provider client.ConfigProvider) ec2iface.EC2API {
+		ec2Regions = append(ec2Regions, aws.StringValue(provider.(*session.Session).Config.Region))
+		return fakeEC2Client{}
+	}
+	newRGTAClient = func(provider client.ConfigProvider) resourcegroupstaggingapiiface.ResourceGroupsTaggingAPIAPI {
+		rgtaRegions = append(rgtaRegions, aws.StringValue(provider.(*session.Session).Config.Region))
+		return fakeRGTAClient{}
+	}
+
+	executor := newExecutor(nil)
+	executor.DataSource = fakeDataSource()
+
+	for _, region := range []string{"us-east-1", "eu-west-1"} {
+		_, err := executor.getEC2Client(region)
+		require.NoError(t, err)
+		_, err = executor.getRGTAClient(region)
+		require.NoError(t, err)
+	}
+
+	assert.Equal(t, []string{"us-east-1", "eu-west-1"}, ec2Regions)
+	assert.Equal(t, []string{"us-east-1", "eu-west-1"}, rgtaRegions)
+}
+
+func TestParseAuthType(t *testing.T) {
+	tests := []struct {
+		authType string
+		expected authType
+	}{
+		{authType: "credentials", expected: authTypeSharedCreds},
+		{authType: "keys", expected: authTypeKeys},
+		{authType: "default", expected: authTypeDefault},
+		{authType: "Keys", expected: authTypeKeys},
+		{authType: " credentials ", expected: authTypeSharedCreds},
+		{authType: "\tDEFAULT\n", expected: authTypeDefault},
+		{authType: "sharedCreds", expected: authTypeSharedCreds},
+		{authType: "AccessKey", expected: authTypeKeys},
+		{authType: "ec2_iam_role", expected: authTypeDefault},
+		{authType: "arn", expected: authTypeDefault},
+		{authType: "unknown", expected: authTypeDefault},
+	}
+	for _, tc := range tests {
+		t.Run(fmt.Sprintf("%q", tc.authType), func(t *testing.T) {
+			assert.Equal(t, tc.expected, parseAuthType(tc.authType))
+		})
+	}
+
+	t.Run("Data source settings are normalized", func(t *testing.T) {
+		ds := fakeDataSource()
+		ds.JsonData.Set("authType", " Keys ")
+
+		executor := newExecutor(nil)
+		executor.DataSource = ds
+		assert.Equal(t, authTypeKeys, executor.getDSInfo("us-east-1").AuthType)
+	})
+}
+
+func TestGetDSInfo_MixedTypeSettings(t *testing.T) {
+	t.Run("Settings of other types are converted", func(t *testing.T) {
+		jsonData, err := simplejson.NewJson([]byte(`{
+			"defaultRegion": "eu-west-1",
+			"authType": "keys",
+			"assumeRoleArn": "arn:aws:iam::123456789012:role/grafana",
+			"externalId": 123456,
+			"mfaSerialNumber": "arn:aws:iam::123456789012:mfa/grafana",
+			"tlsSkipVerify": "true",
+			"timeout": "30",
+			"dialTimeout": 5,
+			"unused": {"nested": [1, true]}
+		}`))
+		require.NoError(t, err)
+
+		ds := fakeDataSource()
+		ds.JsonData = jsonData
+
+		executor := newExecutor(nil)
+		executor.DataSource = ds
+		dsInfo := executor.getDSInfo(defaultRegion)
+
+		assert.Equal(t, "eu-west-1", dsInfo.Region)
+		assert.Equal(t, authTypeKeys, dsInfo.AuthType)
+		assert.Equal(t, []string{"arn:aws:iam::123456789012:role/grafana"}, dsInfo.AssumeRoleARNs)
+		assert.Equal(t, []string{"123456"}, dsInfo.ExternalIDs)
+		assert.Equal(t, "arn:aws:iam::123456789012:mfa/grafana", dsInfo.MFASerialNumber)
+		assert.True(t, dsInfo.TLSSkipVerify)
+		assert.Equal(t, 30*time.Second, dsInfo.Timeout)
+		assert.Equal(t, 5*time.Second, dsInfo.DialTimeout)
+	})
+
+	t.Run("Settings of unexpected types don't prevent others from being read", func(t *testing.T) {
+		jsonData, err := simplejson.NewJson([]byte(`{
+			"defaultRegion": "eu-west-1",
+			"authType": "keys",
+			"endpoint": true,
+			"roleSessionName": ["grafana"],
+			"timeout": "soon",
+			"tlsSkipVerify": 2
+		}`))
+		require.NoError(t, err)
+		ds := fakeDataSource()
+		ds.JsonData = jsonData
+
+		executor := newExecutor(nil)
+		executor.DataSource = ds
+		dsInfo := executor.getDSInfo(defaultRegion)
+
+		assert.Equal(t, "eu-west-1", dsInfo.Region)
+		assert.Equal(t, authTypeKeys, dsInfo.AuthType)
+		assert.Equal(t, "true", dsInfo.Endpoint)
+		assert.Equal(t, defaultRoleSessionName, dsInfo.RoleSessionName)
+		assert.Zero(t, dsInfo.Timeout)
+		assert.False(t, dsInfo.TLSSkipVerify)
+	})
+}
+
+func TestClientFactories_UserAgent(t *testing.T) {
+	origBuildVersion, origSuffix := setting.BuildVersion, setting.AWSUserAgentSuffix
+	t.Cleanup(func() {
+		setting.BuildVersion, setting.AWSUserAgentSuffix = origBuildVersion, origSuffix
+	})
+	setting.BuildVersion = "7.5.0"
+
+	var userAgent string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userAgent = r.Header.Get("User-Agent")
+	}))
+	t.Cleanup(server.Close)
+
+	sess, err := session.NewSession(&aws.Config{
+		Region:      aws.String("us-east-1"),
+		Endpoint:    aws.String(server.URL),
+		Credentials: credentials.NewStaticCredentials("AKID", "SECRET", ""),
+		MaxRetries:  aws.Int(0),
+	})
+	require.NoError(t, err)
+
+	// The AWS service clients embed client.Client, which creates their requests
+	type requestCreator interface {
+		NewRequest(operation *request.Operation, params interface{}, data interface{}) *request.Request
+	}
+	factories := map[string]func() interface{}{
+		"CloudWatch":              func() interface{} { return NewCWClient(sess) },
+		"CloudWatch Logs":         func() interface{} { return NewCWLogsClient(sess) },
+		"EC2":                     func() interface{} { return newEC2Client(sess) },
+		"Resource Groups Tagging": func() interface{} { return newRGTAClient(sess) },
+		"STS":                     func() interface{} { return newSTSClient(sess) },
+		"Service Quotas":          func() interface{} { return newQuotasClient(sess) },
+		"Metric streams":          func() interface{} { return newMetricStreamsClient(sess) },
+	}
+
+	sendRequest := func(t *testing.T, newClient func() interface{}) string {
+		t.Helper()
+
+		userAgent = ""
+		client, ok := newClient().(requestCreator)
+		require.True(t, ok)
+		req := client.NewRequest(&request.Operation{Name: "Test", HTTPMethod: "POST", HTTPPath: "/"},
+			&struct {
+				_ struct{} `type:"structure"`
+			}{}, nil)
+		// Only the headers matter, the response isn't a valid one
+		_ = req.Send()
+
+		return userAgent
+	}
+
+	for name, newClient := range factories {
+		t.Run(name+" identifies Grafana", func(t *testing.T) {
+			setting.AWSUserAgentSuffix = ""
+			assert.Equal(t, "Grafana/7.5.0", sendRequest(t, newClient))
+		})
+
+		t.Run(name+" appends the configured suffix", func(t *testing.T) {
+			setting.AWSUserAgentSuffix = "acme/prod-eu"
+			assert.Equal(t, "Grafana/7.5.0 acme/prod-eu", sendRequest(t, newClient))
+		})
+	}
+}
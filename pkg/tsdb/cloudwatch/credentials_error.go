@@ -0,0 +1,83 @@
+package cloudwatch
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+// credentialsErrorMessages maps the error codes AWS returns for expired, invalid or insufficient credentials
+// to messages telling the user what to do about it.
+var credentialsErrorMessages = map[string]string{
+	"ExpiredToken":                "the AWS credentials have expired, update them in the data source settings or renew them on the Grafana server",
+	"ExpiredTokenException":       "the AWS credentials have expired, update them in the data source settings or renew them on the Grafana server",
+	"AccessDenied":                "access was denied by AWS, check the IAM policies of the principal, and the trust policy of the role if one is assumed",
+	"AccessDeniedException":       "access was denied by AWS, check the IAM policies of the principal, and the trust policy of the role if one is assumed",
+	"UnrecognizedClientException": "the AWS credentials are invalid, check the access key and secret key in the data source settings",
+	"InvalidClientTokenId":        "the AWS credentials are invalid, check the access key and secret key in the data source settings",
+}
+
+// assumeRoleDurationErrorMessage is used when STS rejects the duration of an assumed role session, which happens when
+// it exceeds the maximum session duration of the role.
+const assumeRoleDurationErrorMessage = "the assume role duration exceeds the maximum session duration of the role, " +
+	"lower it in the data source settings or raise the maximum session duration of the role"
+
+// credentialsError is returned instead of the raw SDK error when AWS rejects the credentials of a data source.
+// The message of AWS is kept, since it names e.g. the principal and action that were denied.
+type credentialsError struct {
+	message string
+	err     awserr.Error
+}
+
+func (e *credentialsError) Error() string {
+	return fmt.Sprintf("%s: %s (%s)", e.message, e.err.Message(), e.err.Code())
+}
+
+func (e *credentialsError) Unwrap() error {
+	return e.err
+}
+
+// newCredentialsError returns a credentialsError if err is an AWS error caused by the credentials, or nil.
+func newCredentialsError(err error) *credentialsError {
+	var awsErr awserr.Error
+	if !errors.As(err, &awsErr) {
+		return nil
+	}
+
+	message, ok := credentialsErrorMessages[awsErr.Code()]
+	if !ok && awsErr.Code() == "ValidationError" && strings.Contains(awsErr.Message(), "DurationSeconds") {
+		message, ok = assumeRoleDurationErrorMessage, true
+	}
+	if !ok {
+		return nil
+	}
+
+	return &credentialsError{message: message, err: awsErr}
+}
+
+// addCredentialsErrorHandler makes requests sent with sess return a credentialsError when AWS rejects the
+// credentials, and evicts sess from the session cache, so the next query authenticates again.
+func addCredentialsErrorHandler(sess *session.Session, cacheKey string) {
+	sess.Handlers.Complete.PushBackNamed(credentialsErrorHandler(sess, cacheKey))
+}
+
+func credentialsErrorHandler(sess *session.Session, cacheKey string) request.NamedHandler {
+	return request.NamedHandler{
+		Name: "grafana.CredentialsErrorHandler",
+		Fn: func(r *request.Request) {
+			credsErr := newCredentialsError(r.Error)
+			if credsErr == nil {
+				return
+			}
+
+			plog.Warn("AWS rejected the credentials, evicting the cached session", "code", credsErr.err.Code())
+			evictSession(cacheKey, sess)
+
+			r.Error = credsErr
+		},
+	}
+}
@@ -0,0 +1,79 @@
+package cloudwatch
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCredentialsErrorHandler(t *testing.T) {
+	t.Cleanup(func() {
+		sessCache = map[string]envelope{}
+	})
+
+	const cacheKey = "key"
+
+	for _, code := range []string{
+		"ExpiredToken", "ExpiredTokenException", "AccessDenied", "AccessDeniedException",
+		"UnrecognizedClientException", "InvalidClientTokenId",
+	} {
+		t.Run(code, func(t *testing.T) {
+			sess := &session.Session{}
+			sessCache = map[string]envelope{cacheKey: {session: sess}}
+
+			r := &request.Request{Error: awserr.New(code, "raw SDK message", nil)}
+			credentialsErrorHandler(sess, cacheKey).Fn(r)
+
+			assert.NotContains(t, sessCache, cacheKey)
+
+			var credsErr *credentialsError
+			require.True(t, errors.As(r.Error, &credsErr))
+			assert.Equal(t, credentialsErrorMessages[code]+": raw SDK message ("+code+")", r.Error.Error())
+			var awsErr awserr.Error
+			require.True(t, errors.As(r.Error, &awsErr))
+			assert.Equal(t, code, awsErr.Code())
+		})
+	}
+
+	t.Run("Assume role durations rejected by STS", func(t *testing.T) {
+		sess := &session.Session{}
+		sessCache = map[string]envelope{cacheKey: {session: sess}}
+
+		r := &request.Request{Error: awserr.New("ValidationError",
+			"The requested DurationSeconds exceeds the MaxSessionDuration set for this role.", nil)}
+		credentialsErrorHandler(sess, cacheKey).Fn(r)
+
+		assert.NotContains(t, sessCache, cacheKey)
+		assert.EqualError(t, r.Error, assumeRoleDurationErrorMessage+
+			": The requested DurationSeconds exceeds the MaxSessionDuration set for this role. (ValidationError)")
+	})
+
+	t.Run("Other errors are left as they are", func(t *testing.T) {
+		sess := &session.Session{}
+		sessCache = map[string]envelope{cacheKey: {session: sess}}
+
+		origErr := awserr.New("ThrottlingException", "rate exceeded", nil)
+		r := &request.Request{Error: origErr}
+		credentialsErrorHandler(sess, cacheKey).Fn(r)
+
+		assert.Contains(t, sessCache, cacheKey)
+		assert.Equal(t, origErr, r.Error)
+	})
+
+	t.Run("A refreshed session isn't evicted", func(t *testing.T) {
+		sess := &session.Session{}
+		refreshed := &session.Session{}
+		sessCache = map[string]envelope{cacheKey: {session: refreshed}}
+
+		r := &request.Request{Error: awserr.New("ExpiredToken", "expired", nil)}
+		credentialsErrorHandler(sess, cacheKey).Fn(r)
+
+		require.Contains(t, sessCache, cacheKey)
+		assert.Same(t, refreshed, sessCache[cacheKey].session)
+	})
+}
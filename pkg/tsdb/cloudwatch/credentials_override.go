@@ -0,0 +1,116 @@
+package cloudwatch
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/grafana/grafana/pkg/components/simplejson"
+	"github.com/grafana/grafana/pkg/tsdb"
+)
+
+// credentialsOverride names a shared credentials profile of the server that a request is executed with instead of
+// the credentials of the data source, optionally to assume a role, so that permissions can be debugged without
+// creating another data source. Queries are saved with dashboards and shown in the query inspector, so they only
+// refer to credentials the server already holds, never to secrets.
+type credentialsOverride struct {
+	Profile       string
+	AssumeRoleARN string
+	ExternalID    string
+}
+
+var errCredentialsOverrideDisabled = errors.New("overriding the credentials of queries is disabled, the profiles " +
+	"queries may use can be listed with query_credentials_override_profiles in the [aws] section of the configuration")
+
+// parseCredentialsOverride parses the credentialsOverride property of the queries of a request, which share their
+// sessions, so they must all override the credentials the same way. It returns nil if none of them does.
+func parseCredentialsOverride(queries []*tsdb.Query) (*credentialsOverride, error) {
+	var result *credentialsOverride
+	for i, query := range queries {
+		override, err := parseQueryCredentialsOverride(query.Model)
+		if err != nil {
+			return nil, &queryError{err: err, RefID: query.RefId}
+		}
+
+		if i == 0 {
+			result = override
+			continue
+		}
+		if (override == nil) != (result == nil) || (override != nil && *override != *result) {
+			return nil, errors.New("all queries of a request must override the credentials the same way")
+		}
+	}
+
+	return result, nil
+}
+
+func parseQueryCredentialsOverride(model *simplejson.Json) (*credentialsOverride, error) {
+	overrideJSON, ok := model.CheckGet("credentialsOverride")
+	if !ok {
+		return nil, nil
+	}
+
+	for _, secret := range []string{"accessKey", "secretKey", "sessionToken"} {
+		if _, ok := overrideJSON.CheckGet(secret); ok {
+			return nil, fmt.Errorf("invalid credentials override, %s can't be given since queries are saved with "+
+				"dashboards, a profile has to be used instead", secret)
+		}
+	}
+	override := &credentialsOverride{
+		Profile:       overrideJSON.Get("profile").MustString(),
+		AssumeRoleARN: overrideJSON.Get("assumeRoleArn").MustString(),
+		ExternalID:    overrideJSON.Get("externalId").MustString(),
+	}
+	if override.Profile == "" {
+		return nil, errors.New("a profile is required to override the credentials")
+	}
+
+	return override, nil
+}
+
+// checkAllowed returns an error unless the profile of the override is one of the profiles queries may use.
+func (o *credentialsOverride) checkAllowed(allowedProfiles []string) error {
+	if len(allowedProfiles) == 0 {
+		return errCredentialsOverrideDisabled
+	}
+	for _, profile := range allowedProfiles {
+		if profile == o.Profile {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("profile %q can't be used to override the credentials of queries, "+
+		"it isn't listed in query_credentials_override_profiles", o.Profile)
+}
+
+// apply replaces the credentials of dsInfo with the overridden ones, keeping its other settings.
+func (o *credentialsOverride) apply(dsInfo *datasourceInfo) {
+	dsInfo.AuthType = authTypeSharedCreds
+	dsInfo.Profile = o.Profile
+	dsInfo.AccessKey = ""
+	dsInfo.SecretKey = ""
+	dsInfo.SessionToken = ""
+	dsInfo.AssumeRoleARNs = nil
+	if o.AssumeRoleARN != "" {
+		dsInfo.AssumeRoleARNs = []string{o.AssumeRoleARN}
+	}
+	dsInfo.ExternalIDs = nil
+	if o.ExternalID != "" {
+		dsInfo.ExternalIDs = []string{o.ExternalID}
+	}
+	dsInfo.MFASerialNumber = ""
+	dsInfo.MFAToken = ""
+}
+
+// newOverrideSession creates a session with the overridden credentials. Such sessions only serve a single request,
+// so they're neither cached nor refreshed.
+func (e *cloudWatchExecutor) newOverrideSession(dsInfo *datasourceInfo) (*session.Session, error) {
+	e.credentialsOverride.apply(dsInfo)
+	sess, _, err := e.createSession(dsInfo)
+	if err != nil {
+		return nil, err
+	}
+	addThrottlingHandlers(sess, e.DataSource.Name)
+
+	return sess, nil
+}
@@ -0,0 +1,212 @@
+package cloudwatch
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/cloudwatch/cloudwatchiface"
+	"github.com/grafana/grafana/pkg/components/simplejson"
+	"github.com/grafana/grafana/pkg/setting"
+	"github.com/grafana/grafana/pkg/tsdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQuery_CredentialsOverride(t *testing.T) {
+	stubNewSession(t)
+	origNewSessionWithOptions := newSessionWithOptions
+	origNewCWClient := NewCWClient
+	origProfiles := setting.AWSQueryCredentialsOverrideProfiles
+	t.Cleanup(func() {
+		newSessionWithOptions = origNewSessionWithOptions
+		NewCWClient = origNewCWClient
+		setting.AWSQueryCredentialsOverrideProfiles = origProfiles
+	})
+
+	var opts []session.Options
+	newSessionWithOptions = func(o session.Options) (*session.Session, error) {
+		opts = append(opts, o)
+		cfg := o.Config
+		return &session.Session{
+			Config: &cfg,
+		}, nil
+	}
+	var sessions []*session.Session
+	NewCWClient = func(sess *session.Session) cloudwatchiface.CloudWatchAPI {
+		sessions = append(sessions, sess)
+		return FakeCWClient{}
+	}
+
+	newModel := func(override map[string]interface{}) map[string]interface{} {
+		model := map[string]interface{}{
+			"region":     "us-east-1",
+			"namespace":  "AWS/EC2",
+			"metricName": "CPUUtilization",
+			"statistics": []interface{}{"Average"},
+			"period":     "300",
+		}
+		if override != nil {
+			model["credentialsOverride"] = override
+		}
+		return model
+	}
+	runQuery := func(models ...map[string]interface{}) error {
+		queries := make([]*tsdb.Query, 0, len(models))
+		for i, model := range models {
+			queries = append(queries, &tsdb.Query{
+				RefId: string(rune('A' + i)),
+				Model: simplejson.NewFromAny(model),
+			})
+		}
+
+		executor := newExecutor(nil)
+		_, err := executor.Query(context.Background(), fakeDataSource(fakeDataSourceCfg{
+			accessKey: "AKIADATASOURCE",
+			secretKey: "data-source-secret",
+		}), &tsdb.TsdbQuery{
+			TimeRange: tsdb.NewTimeRange("now-1h", "now"),
+			Queries:   queries,
+		})
+		return err
+	}
+	override := map[string]interface{}{
+		"profile": "debug",
+	}
+
+	t.Run("Overriding credentials is rejected unless profiles are allowed", func(t *testing.T) {
+		setting.AWSQueryCredentialsOverrideProfiles = nil
+		sessions = nil
+
+		err := runQuery(newModel(override))
+		assert.Equal(t, errCredentialsOverrideDisabled, err)
+		assert.Empty(t, sessions)
+	})
+
+	t.Run("Profiles which aren't allowed are rejected", func(t *testing.T) {
+		setting.AWSQueryCredentialsOverrideProfiles = []string{"readonly"}
+		sessions = nil
+
+		err := runQuery(newModel(override))
+		assert.EqualError(t, err, `profile "debug" can't be used to override the credentials of queries, `+
+			`it isn't listed in query_credentials_override_profiles`)
+		assert.Empty(t, sessions)
+	})
+
+	t.Run("Overridden credentials are used for an uncached session", func(t *testing.T) {
+		t.Cleanup(func() {
+			sessCache = map[string]envelope{}
+		})
+		setting.AWSQueryCredentialsOverrideProfiles = []string{"readonly", "debug"}
+		sessions = nil
+		opts = nil
+
+		err := runQuery(newModel(override))
+		require.NoError(t, err)
+
+		require.Len(t, sessions, 1)
+		require.Len(t, opts, 1)
+		assert.Equal(t, "debug", opts[0].Profile)
+		assert.Empty(t, sessCache)
+	})
+
+	t.Run("Data source credentials are used without override", func(t *testing.T) {
+		t.Cleanup(func() {
+			sessCache = map[string]envelope{}
+		})
+		setting.AWSQueryCredentialsOverrideProfiles = []string{"debug"}
+		sessions = nil
+		opts = nil
+
+		err := runQuery(newModel(nil))
+		require.NoError(t, err)
+
+		require.Len(t, sessions, 1)
+		assert.Empty(t, opts)
+		value, err := sessions[0].Config.Credentials.Get()
+		require.NoError(t, err)
+		assert.Equal(t, "AKIADATASOURCE", value.AccessKeyID)
+		assert.Len(t, sessCache, 1)
+	})
+
+	t.Run("Queries of a request must override credentials the same way", func(t *testing.T) {
+		setting.AWSQueryCredentialsOverrideProfiles = []string{"debug"}
+		sessions = nil
+
+		err := runQuery(newModel(override), newModel(nil))
+		assert.EqualError(t, err, "all queries of a request must override the credentials the same way")
+		assert.Empty(t, sessions)
+	})
+}
+
+func TestParseCredentialsOverride(t *testing.T) {
+	parse := func(override interface{}) (*credentialsOverride, error) {
+		return parseCredentialsOverride([]*tsdb.Query{
+			{
+				RefId: "A",
+				Model: simplejson.NewFromAny(map[string]interface{}{
+					"credentialsOverride": override,
+				}),
+			},
+		})
+	}
+
+	t.Run("Profile and role", func(t *testing.T) {
+		override, err := parse(map[string]interface{}{
+			"profile":       "debug",
+			"assumeRoleArn": "arn:aws:iam::123456789012:role/debug",
+			"externalId":    "external",
+		})
+		require.NoError(t, err)
+		assert.Equal(t, &credentialsOverride{
+			Profile:       "debug",
+			AssumeRoleARN: "arn:aws:iam::123456789012:role/debug",
+			ExternalID:    "external",
+		}, override)
+
+		dsInfo := &datasourceInfo{
+			AuthType:        authTypeKeys,
+			AccessKey:       "AKIADATASOURCE",
+			SecretKey:       "data-source-secret",
+			SessionToken:    "data-source-token",
+			AssumeRoleARNs:  []string{"arn:aws:iam::123456789012:role/a", "arn:aws:iam::123456789012:role/b"},
+			MFASerialNumber: "arn:aws:iam::123456789012:mfa/user",
+			MFAToken:        "123456",
+			Endpoint:        "https://monitoring.example.com",
+		}
+		override.apply(dsInfo)
+		assert.Equal(t, &datasourceInfo{
+			AuthType:       authTypeSharedCreds,
+			Profile:        "debug",
+			AssumeRoleARNs: []string{"arn:aws:iam::123456789012:role/debug"},
+			ExternalIDs:    []string{"external"},
+			Endpoint:       "https://monitoring.example.com",
+		}, dsInfo)
+	})
+
+	t.Run("No override", func(t *testing.T) {
+		override, err := parseCredentialsOverride([]*tsdb.Query{
+			{RefId: "A", Model: simplejson.New()},
+		})
+		require.NoError(t, err)
+		assert.Nil(t, override)
+	})
+
+	t.Run("Secrets are rejected", func(t *testing.T) {
+		for _, secret := range []string{"accessKey", "secretKey", "sessionToken"} {
+			_, err := parse(map[string]interface{}{
+				"profile": "debug",
+				secret:    "secret",
+			})
+			assert.EqualError(t, err, `error parsing query "A", invalid credentials override, `+secret+
+				` can't be given since queries are saved with dashboards, a profile has to be used instead`)
+		}
+	})
+
+	t.Run("A profile is required", func(t *testing.T) {
+		_, err := parse(map[string]interface{}{
+			"assumeRoleArn": "arn:aws:iam::123456789012:role/debug",
+		})
+		assert.EqualError(t, err, `error parsing query "A", a profile is required to override the credentials`)
+	})
+}
@@ -0,0 +1,105 @@
+package cloudwatch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/aws/aws-sdk-go/service/ecs/ecsiface"
+	"github.com/grafana/grafana/pkg/components/simplejson"
+	"github.com/grafana/grafana/pkg/tsdb"
+)
+
+// ECS client factory.
+//
+// Stubbable by tests.
+var newECSClient = func(provider client.ConfigProvider) ecsiface.ECSAPI {
+	client := ecs.New(provider)
+	setUserAgent(&client.Handlers)
+
+	return client
+}
+
+func (e *cloudWatchExecutor) getECSClient(region string) (ecsiface.ECSAPI, error) {
+	sess, err := e.newSession(region)
+	if err != nil {
+		return nil, err
+	}
+
+	return newECSClient(sess), nil
+}
+
+// handleGetEcsClusters returns the names of the ECS clusters in a region, as used by the ClusterName dimension.
+func (e *cloudWatchExecutor) handleGetEcsClusters(ctx context.Context, parameters *simplejson.Json,
+	queryContext *tsdb.TsdbQuery) ([]suggestData, error) {
+	region := parameters.Get("region").MustString(defaultRegion)
+
+	client, err := e.getECSClient(region)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	if err := client.ListClustersPagesWithContext(ctx, &ecs.ListClustersInput{},
+		func(page *ecs.ListClustersOutput, lastPage bool) bool {
+			for _, arn := range page.ClusterArns {
+				names = append(names, ecsResourceName(aws.StringValue(arn)))
+			}
+			return !lastPage
+		}); err != nil {
+		return nil, fmt.Errorf("failed to call ecs:ListClusters, %w", err)
+	}
+
+	return sortedSuggestData(names), nil
+}
+
+// handleGetEcsServices returns the names of the services of an ECS cluster, as used by the ServiceName dimension.
+func (e *cloudWatchExecutor) handleGetEcsServices(ctx context.Context, parameters *simplejson.Json,
+	queryContext *tsdb.TsdbQuery) ([]suggestData, error) {
+	region := parameters.Get("region").MustString(defaultRegion)
+	cluster := parameters.Get("cluster").MustString()
+	if cluster == "" {
+		return nil, errors.New("cluster is required")
+	}
+
+	client, err := e.getECSClient(region)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	if err := client.ListServicesPagesWithContext(ctx, &ecs.ListServicesInput{Cluster: aws.String(cluster)},
+		func(page *ecs.ListServicesOutput, lastPage bool) bool {
+			for _, arn := range page.ServiceArns {
+				names = append(names, ecsResourceName(aws.StringValue(arn)))
+			}
+			return !lastPage
+		}); err != nil {
+		return nil, fmt.Errorf("failed to call ecs:ListServices, %w", err)
+	}
+
+	return sortedSuggestData(names), nil
+}
+
+// ecsResourceName returns the name of an ECS cluster or service from its ARN, which ends with the name, e.g.
+// arn:aws:ecs:us-east-1:123456789012:service/cluster/name, or older service ARNs without the cluster.
+func ecsResourceName(arn string) string {
+	return arn[strings.LastIndex(arn, "/")+1:]
+}
+
+// sortedSuggestData returns sorted values as suggestions using them as both text and value.
+func sortedSuggestData(values []string) []suggestData {
+	sort.Strings(values)
+
+	result := make([]suggestData, 0, len(values))
+	for _, value := range values {
+		result = append(result, suggestData{Text: value, Value: value})
+	}
+
+	return result
+}
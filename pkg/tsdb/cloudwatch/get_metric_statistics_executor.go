@@ -0,0 +1,187 @@
+package cloudwatch
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/aws/aws-sdk-go/service/cloudwatch/cloudwatchiface"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/grafana/grafana/pkg/infra/metrics"
+	"github.com/grafana/grafana/pkg/tsdb"
+)
+
+// executeGetMetricStatisticsQuery executes a query with the legacy GetMetricStatistics API, for the few metrics
+// behaving differently under GetMetricData. One frame is returned per requested statistic.
+func (e *cloudWatchExecutor) executeGetMetricStatisticsQuery(ctx context.Context, client cloudwatchiface.CloudWatchAPI,
+	query *requestQuery, startTime time.Time, endTime time.Time) (*tsdb.QueryResult, error) {
+	queries, err := getMetricStatisticsQueries(query)
+	if err != nil {
+		return nil, err
+	}
+
+	input := buildGetMetricStatisticsInput(query, queries, startTime, endTime)
+
+	output, err := client.GetMetricStatisticsWithContext(ctx, input)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call cloudwatch:GetMetricStatistics: %w", err)
+	}
+	metrics.MAwsCloudWatchGetMetricStatistics.Inc()
+
+	frames := data.Frames{}
+	for _, q := range queries {
+		frame := datapointsToFrame(output.Datapoints, q)
+		frame.Meta = &data.FrameMeta{
+			Custom: map[string]interface{}{
+				"period": effectivePeriod(query.Period, startTime, time.Now()),
+			},
+		}
+		frames = append(frames, frame)
+	}
+
+	queryResult := tsdb.NewQueryResult()
+	queryResult.RefId = query.RefId
+	queryResult.Dataframes = tsdb.NewDecodedDataFrames(frames)
+
+	return queryResult, nil
+}
+
+// getMetricStatisticsQueries returns a query per statistic, used to name and label the frames like the
+// GetMetricData path does.
+func getMetricStatisticsQueries(query *requestQuery) ([]*cloudWatchQuery, error) {
+	if query.Expression != "" {
+		return nil, fmt.Errorf("expressions aren't supported by GetMetricStatistics")
+	}
+
+	for key, values := range query.Dimensions {
+		if len(values) != 1 || values[0] == "*" {
+			return nil, fmt.Errorf("dimension %q must have exactly one value when using GetMetricStatistics", key)
+		}
+	}
+
+	queries := make([]*cloudWatchQuery, 0, len(query.Statistics))
+	for _, stat := range query.Statistics {
+		stat, err := validateStatistic(*stat)
+		if err != nil {
+			return nil, err
+		}
+
+		queries = append(queries, &cloudWatchQuery{
+			RefId:           query.RefId,
+			Region:          query.Region,
+			Namespace:       query.Namespace,
+			MetricName:      query.MetricName,
+			Dimensions:      query.Dimensions,
+			Stats:           stat,
+			Period:          query.Period,
+			Alias:           query.Alias,
+			ReturnData:      true,
+			MatchExact:      true,
+			Timezone:        query.Timezone,
+			MultipleStats:   len(query.Statistics) > 1,
+			MultipleRegions: query.MultipleRegions,
+			Unit:            query.Unit,
+		})
+	}
+
+	return queries, nil
+}
+
+func buildGetMetricStatisticsInput(query *requestQuery, queries []*cloudWatchQuery, startTime time.Time,
+	endTime time.Time) *cloudwatch.GetMetricStatisticsInput {
+	queriesByID := make(map[string]*cloudWatchQuery, len(queries))
+	for _, q := range queries {
+		queriesByID[q.Stats] = q
+	}
+	startTime, endTime = snapTimeRange(startTime, endTime, queriesByID)
+
+	input := &cloudwatch.GetMetricStatisticsInput{
+		Namespace:  aws.String(query.Namespace),
+		MetricName: aws.String(query.MetricName),
+		StartTime:  aws.Time(startTime),
+		EndTime:    aws.Time(endTime),
+		Period:     aws.Int64(int64(query.Period)),
+	}
+	if query.Unit != "" {
+		input.Unit = aws.String(query.Unit)
+	}
+
+	keys := make([]string, 0, len(query.Dimensions))
+	for key := range query.Dimensions {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		input.Dimensions = append(input.Dimensions, &cloudwatch.Dimension{
+			Name:  aws.String(key),
+			Value: aws.String(query.Dimensions[key][0]),
+		})
+	}
+
+	for _, q := range queries {
+		if isStandardStatistic(q.Stats) {
+			input.Statistics = append(input.Statistics, aws.String(q.Stats))
+		} else {
+			input.ExtendedStatistics = append(input.ExtendedStatistics, aws.String(q.Stats))
+		}
+	}
+
+	return input
+}
+
+// datapointsToFrame builds the frame of a statistic from GetMetricStatistics datapoints, which hold all the
+// requested statistics as separate fields and aren't guaranteed to be ordered by time.
+func datapointsToFrame(datapoints []*cloudwatch.Datapoint, query *cloudWatchQuery) *data.Frame {
+	sorted := make([]*cloudwatch.Datapoint, len(datapoints))
+	copy(sorted, datapoints)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Timestamp.Before(*sorted[j].Timestamp)
+	})
+
+	timestamps := make([]*time.Time, 0, len(sorted))
+	points := make([]*float64, 0, len(sorted))
+	for _, dp := range sorted {
+		timestamps = append(timestamps, dp.Timestamp)
+		points = append(points, datapointValue(dp, query.Stats))
+	}
+
+	tags := data.Labels{}
+	for key, values := range query.Dimensions {
+		tags[key] = values[0]
+	}
+	frameName := regionFrameName(query, formatAlias(query, query.Stats, tags, ""))
+	addMetricLabels(tags, query)
+
+	timeField := data.NewField(data.TimeSeriesTimeFieldName, nil, timestamps)
+	valueField := data.NewField(data.TimeSeriesValueFieldName, tags, points)
+	valueField.SetConfig(&data.FieldConfig{DisplayNameFromDS: frameName})
+
+	return &data.Frame{
+		Name: frameName,
+		Fields: []*data.Field{
+			timeField,
+			valueField,
+		},
+		RefID: query.RefId,
+	}
+}
+
+func datapointValue(dp *cloudwatch.Datapoint, stat string) *float64 {
+	switch stat {
+	case "Average":
+		return dp.Average
+	case "Sum":
+		return dp.Sum
+	case "Minimum":
+		return dp.Minimum
+	case "Maximum":
+		return dp.Maximum
+	case "SampleCount":
+		return dp.SampleCount
+	default:
+		return dp.ExtendedStatistics[stat]
+	}
+}
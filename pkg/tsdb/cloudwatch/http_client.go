@@ -0,0 +1,101 @@
+package cloudwatch
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"golang.org/x/net/http/httpproxy"
+)
+
+// Timeouts of the requests sent to AWS, unless the data source configures others.
+const (
+	defaultHTTPTimeout = 30 * time.Second
+	defaultDialTimeout = 10 * time.Second
+)
+
+// newHTTPClient creates the HTTP client used by the AWS SDK for a data source.
+func newHTTPClient(dsInfo *datasourceInfo) (*http.Client, error) {
+	timeout := dsInfo.Timeout
+	if timeout <= 0 {
+		timeout = defaultHTTPTimeout
+	}
+	dialTimeout := dsInfo.DialTimeout
+	if dialTimeout <= 0 {
+		dialTimeout = defaultDialTimeout
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = (&net.Dialer{
+		Timeout:   dialTimeout,
+		KeepAlive: 30 * time.Second,
+	}).DialContext
+
+	if dsInfo.ProxyURL != "" {
+		proxy, err := newProxyFunc(dsInfo.ProxyURL, dsInfo.NoProxy)
+		if err != nil {
+			return nil, err
+		}
+		transport.Proxy = proxy
+	}
+
+	if dsInfo.TLSSkipVerify || dsInfo.TLSCACert != "" {
+		tlsConfig, err := newTLSConfig(dsInfo)
+		if err != nil {
+			return nil, err
+		}
+		transport.TLSClientConfig = tlsConfig
+	}
+
+	return &http.Client{
+		Transport: transport,
+		Timeout:   timeout,
+	}, nil
+}
+
+// newProxyFunc returns a proxy function which sends requests via proxyURL, except for hosts matching noProxy.
+// If noProxy is empty, the NO_PROXY environment variable is used instead.
+func newProxyFunc(proxyURL, noProxy string) (func(*http.Request) (*url.URL, error), error) {
+	if _, err := url.Parse(proxyURL); err != nil {
+		return nil, fmt.Errorf("invalid proxy URL %q: %w", proxyURL, err)
+	}
+
+	if noProxy == "" {
+		noProxy = httpproxy.FromEnvironment().NoProxy
+	}
+
+	cfg := &httpproxy.Config{
+		HTTPProxy:  proxyURL,
+		HTTPSProxy: proxyURL,
+		NoProxy:    noProxy,
+	}
+	proxyFunc := cfg.ProxyFunc()
+
+	return func(req *http.Request) (*url.URL, error) {
+		return proxyFunc(req.URL)
+	}, nil
+}
+
+func newTLSConfig(dsInfo *datasourceInfo) (*tls.Config, error) {
+	tlsConfig := &tls.Config{}
+
+	if dsInfo.TLSCACert != "" {
+		caPool := x509.NewCertPool()
+		if ok := caPool.AppendCertsFromPEM([]byte(dsInfo.TLSCACert)); !ok {
+			return nil, errors.New("failed to parse TLS CA PEM certificate")
+		}
+		tlsConfig.RootCAs = caPool
+	}
+
+	if dsInfo.TLSSkipVerify {
+		plog.Warn("TLS certificate verification is disabled for AWS requests, this is insecure")
+		tlsConfig.InsecureSkipVerify = true
+	}
+
+	return tlsConfig, nil
+}
@@ -0,0 +1,185 @@
+package cloudwatch
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/ec2/ec2iface"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// How long the Name tags of instances are cached
+const instanceNameCacheTTL = 5 * time.Minute
+
+// The maximum number of values of a DescribeTags filter
+const maxDescribeTagsFilterValues = 200
+
+type instanceName struct {
+	name   string
+	expire time.Time
+}
+
+// instanceNameCache holds the Name tags of instances by data source, region and instance id. Instances without
+// a Name tag are cached with an empty name, so they aren't looked up again until the entry expires.
+var instanceNameCache sync.Map
+
+// resolveInstanceNames labels the series of the queries resolving instance names with the Name tag of the instance
+// in their InstanceId label. A series named after its dimensions, or with an alias using {{Name}}, is named after
+// the instance instead of its id. Series of untagged instances keep their id.
+func (e *cloudWatchExecutor) resolveInstanceNames(ctx context.Context, region string,
+	queries map[string]*cloudWatchQuery, responses []*cloudwatchResponse) error {
+	instanceIds := map[string]bool{}
+	for _, response := range responses {
+		if !queries[response.Id].ResolveInstanceNames {
+			continue
+		}
+		for _, frame := range response.DataFrames {
+			if id := frameInstanceId(frame); id != "" {
+				instanceIds[id] = true
+			}
+		}
+	}
+	if len(instanceIds) == 0 {
+		return nil
+	}
+
+	names, err := e.getInstanceNames(ctx, region, instanceIds)
+	if err != nil {
+		return err
+	}
+
+	for _, response := range responses {
+		query := queries[response.Id]
+		if !query.ResolveInstanceNames {
+			continue
+		}
+		for _, frame := range response.DataFrames {
+			renameInstanceFrame(frame, query, names)
+		}
+	}
+
+	return nil
+}
+
+func (e *cloudWatchExecutor) getInstanceNames(ctx context.Context, region string,
+	instanceIds map[string]bool) (map[string]string, error) {
+	names := make(map[string]string, len(instanceIds))
+	var missing []string
+	now := time.Now()
+	for id := range instanceIds {
+		if cached, ok := instanceNameCache.Load(e.instanceNameCacheKey(region, id)); ok &&
+			cached.(instanceName).expire.After(now) {
+			names[id] = cached.(instanceName).name
+			continue
+		}
+		missing = append(missing, id)
+	}
+	if len(missing) == 0 {
+		return names, nil
+	}
+
+	client, err := e.getEC2Client(region)
+	if err != nil {
+		return nil, err
+	}
+
+	fetched, err := describeInstanceNames(ctx, client, missing)
+	if err != nil {
+		return nil, err
+	}
+	expire := time.Now().Add(instanceNameCacheTTL)
+	for _, id := range missing {
+		names[id] = fetched[id]
+		instanceNameCache.Store(e.instanceNameCacheKey(region, id), instanceName{name: fetched[id], expire: expire})
+	}
+
+	return names, nil
+}
+
+func (e *cloudWatchExecutor) instanceNameCacheKey(region string, instanceId string) string {
+	return fmt.Sprintf("%d:%s:%s", e.DataSource.Id, region, instanceId)
+}
+
+// describeInstanceNames returns the Name tags of instances, leaving out the instances without one.
+func describeInstanceNames(ctx context.Context, client ec2iface.EC2API, instanceIds []string) (map[string]string,
+	error) {
+	names := map[string]string{}
+	for start := 0; start < len(instanceIds); start += maxDescribeTagsFilterValues {
+		end := start + maxDescribeTagsFilterValues
+		if end > len(instanceIds) {
+			end = len(instanceIds)
+		}
+
+		params := &ec2.DescribeTagsInput{
+			Filters: []*ec2.Filter{
+				{
+					Name:   aws.String("resource-id"),
+					Values: aws.StringSlice(instanceIds[start:end]),
+				},
+				{
+					Name:   aws.String("key"),
+					Values: []*string{aws.String("Name")},
+				},
+			},
+		}
+		if err := client.DescribeTagsPagesWithContext(ctx, params,
+			func(page *ec2.DescribeTagsOutput, lastPage bool) bool {
+				for _, tag := range page.Tags {
+					names[*tag.ResourceId] = *tag.Value
+				}
+				return !lastPage
+			}); err != nil {
+			return nil, fmt.Errorf("failed to call ec2:DescribeTags, %w", err)
+		}
+	}
+
+	return names, nil
+}
+
+func frameInstanceId(frame *data.Frame) string {
+	if len(frame.Fields) < 2 {
+		return ""
+	}
+
+	return frame.Fields[1].Labels["InstanceId"]
+}
+
+func renameInstanceFrame(frame *data.Frame, query *cloudWatchQuery, names map[string]string) {
+	id := frameInstanceId(frame)
+	if id == "" {
+		return
+	}
+	name := names[id]
+	if name != "" {
+		frame.Fields[1].Labels["Name"] = name
+	}
+
+	if query.Alias == "" {
+		if name == "" {
+			return
+		}
+		frame.Name = strings.ReplaceAll(frame.Name, id, name)
+	} else {
+		if name == "" {
+			name = id
+		}
+		frame.Name = aliasFormat.ReplaceAllStringFunc(frame.Name, func(in string) string {
+			if aliasFormat.FindStringSubmatch(in)[1] == "Name" {
+				return name
+			}
+			return in
+		})
+	}
+
+	config := frame.Fields[1].Config
+	if config == nil {
+		config = &data.FieldConfig{}
+	}
+	config.DisplayNameFromDS = frame.Name
+	frame.Fields[1].SetConfig(config)
+}
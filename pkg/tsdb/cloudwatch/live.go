@@ -4,11 +4,11 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"sort"
 	"sync"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
 	"github.com/aws/aws-sdk-go/service/servicequotas"
@@ -18,7 +18,6 @@ import (
 	"github.com/grafana/grafana-plugin-sdk-go/data"
 	"github.com/grafana/grafana/pkg/components/simplejson"
 	"github.com/grafana/grafana/pkg/models"
-	"github.com/grafana/grafana/pkg/setting"
 	"github.com/grafana/grafana/pkg/tsdb"
 	"github.com/grafana/grafana/pkg/util/retryer"
 	"golang.org/x/sync/errgroup"
@@ -39,8 +38,10 @@ type logQueryRunner struct {
 	service     *LogsService
 }
 
-const (
-	maxAttempts   = 8
+// Bounds of the delay between GetQueryResults polls.
+//
+// Stubbable by tests.
+var (
 	minRetryDelay = 500 * time.Millisecond
 	maxRetryDelay = 30 * time.Second
 )
@@ -108,6 +109,8 @@ func (r *logQueryRunner) publishResults(channelName string) error {
 
 // executeLiveLogQuery executes a CloudWatch Logs query with live updates over WebSocket.
 // A WebSocket channel is created, which goroutines send responses over.
+// The results of Logs Insights queries are polled with GetQueryResults, while queries with liveTail set stream the
+// log events of a StartLiveTail session instead.
 func (e *cloudWatchExecutor) executeLiveLogQuery(ctx context.Context, queryContext *tsdb.TsdbQuery) (*tsdb.Response, error) {
 	responseChannelName := uuid.New().String()
 	responseChannel := make(chan *tsdb.Response)
@@ -142,6 +145,9 @@ func (e *cloudWatchExecutor) sendLiveQueriesToChannel(queryContext *tsdb.TsdbQue
 	for _, query := range queryContext.Queries {
 		query := query
 		eg.Go(func() error {
+			if query.Model.Get("liveTail").MustBool() {
+				return e.startLiveTail(ectx, responseChannel, query)
+			}
 			return e.startLiveQuery(ectx, responseChannel, query, queryContext.TimeRange)
 		})
 	}
@@ -226,6 +232,17 @@ func (e *cloudWatchExecutor) startLiveQuery(ctx context.Context, responseChannel
 	queue <- true
 	defer func() { <-queue }()
 
+	// The timeout only covers the execution of the query, not the time spent waiting in the queue
+	timeout, err := parseQueryTimeout(parameters)
+	if err != nil {
+		return err
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
 	startQueryOutput, err := e.executeStartQuery(ctx, logsClient, parameters, timeRange)
 	if err != nil {
 		return err
@@ -235,52 +252,33 @@ func (e *cloudWatchExecutor) startLiveQuery(ctx context.Context, responseChannel
 		QueryId: startQueryOutput.QueryId,
 	}
 
+	// Polls without new matched records only back off rather than give up, as the query may still be aggregating
+	// them. Polling goes on until the query terminates, so that the last frames published are the complete result,
+	// or until the context is done.
 	recordsMatched := 0.0
 	return retryer.Retry(func() (retryer.RetrySignal, error) {
+		if ctx.Err() != nil {
+			e.stopTimedOutQuery(logsClient, *startQueryOutput.QueryId)
+			return retryer.FuncError, queryTimeoutError(ctx, timeout)
+		}
+
 		getQueryResultsOutput, err := logsClient.GetQueryResultsWithContext(ctx, queryResultsInput)
 		if err != nil {
+			if ctx.Err() != nil {
+				e.stopTimedOutQuery(logsClient, *startQueryOutput.QueryId)
+				return retryer.FuncError, queryTimeoutError(ctx, timeout)
+			}
 			return retryer.FuncError, err
 		}
 
 		retryNeeded := *getQueryResultsOutput.Statistics.RecordsMatched <= recordsMatched
 		recordsMatched = *getQueryResultsOutput.Statistics.RecordsMatched
 
-		dataFrame, err := logsResultsToDataframes(getQueryResultsOutput)
+		dataFrames, err := liveQueryFrames(getQueryResultsOutput, parameters, query.RefId)
 		if err != nil {
 			return retryer.FuncError, err
 		}
 
-		dataFrame.Name = query.RefId
-		dataFrame.RefID = query.RefId
-		var dataFrames data.Frames
-
-		// When a query of the form "stats ... by ..." is made, we want to return
-		// one series per group defined in the query, but due to the format
-		// the query response is in, there does not seem to be a way to tell
-		// by the response alone if/how the results should be grouped.
-		// Because of this, if the frontend sees that a "stats ... by ..." query is being made
-		// the "statsGroups" parameter is sent along with the query to the backend so that we
-		// can correctly group the CloudWatch logs response.
-		statsGroups := parameters.Get("statsGroups").MustStringArray()
-		if len(statsGroups) > 0 && len(dataFrame.Fields) > 0 {
-			groupedFrames, err := groupResults(dataFrame, statsGroups)
-			if err != nil {
-				return retryer.FuncError, err
-			}
-
-			dataFrames = groupedFrames
-		} else {
-			if dataFrame.Meta != nil {
-				dataFrame.Meta.PreferredVisualization = "logs"
-			} else {
-				dataFrame.Meta = &data.FrameMeta{
-					PreferredVisualization: "logs",
-				}
-			}
-
-			dataFrames = data.Frames{dataFrame}
-		}
-
 		responseChannel <- &tsdb.Response{
 			Results: map[string]*tsdb.QueryResult{
 				query.RefId: {
@@ -291,13 +289,55 @@ func (e *cloudWatchExecutor) startLiveQuery(ctx context.Context, responseChannel
 		}
 
 		if isTerminated(*getQueryResultsOutput.Status) {
+			releaseLogsQuerySlot(*startQueryOutput.QueryId)
 			return retryer.FuncComplete, nil
 		} else if retryNeeded {
 			return retryer.FuncFailure, nil
 		}
 
 		return retryer.FuncSuccess, nil
-	}, maxAttempts, minRetryDelay, maxRetryDelay)
+	}, 0, minRetryDelay, maxRetryDelay)
+}
+
+// liveQueryFrames converts the results of a GetQueryResults poll to the frames published for a query. Each poll
+// returns all the results found so far, so the frames of a poll replace those of the previous ones, and the frames
+// of the last poll are those of the complete result.
+func liveQueryFrames(output *cloudwatchlogs.GetQueryResultsOutput, parameters *simplejson.Json,
+	refID string) (data.Frames, error) {
+	dataFrame, err := logsResultsToDataframes(output, parameters.Get("expandJsonMessage").MustBool())
+	if err != nil {
+		return nil, err
+	}
+	// Results aren't guaranteed to come ordered by time (ascending), so we need to sort
+	sort.Sort(ByTime(*dataFrame))
+
+	dataFrame.Name = refID
+	dataFrame.RefID = refID
+
+	// When a query of the form "stats ... by ..." is made, we want to return
+	// one series per group defined in the query, but due to the format
+	// the query response is in, there does not seem to be a way to tell
+	// by the response alone if/how the results should be grouped.
+	// Because of this, if the frontend sees that a "stats ... by ..." query is being made
+	// the "statsGroups" parameter is sent along with the query to the backend so that we
+	// can correctly group the CloudWatch logs response.
+	statsGroups := parameters.Get("statsGroups").MustStringArray()
+	if wideFrame, ok := logsTimeSeriesFrame(dataFrame, statsGroups); ok {
+		return data.Frames{wideFrame}, nil
+	}
+	if len(statsGroups) > 0 && len(dataFrame.Fields) > 0 {
+		return groupResults(dataFrame, statsGroups, false)
+	}
+
+	if dataFrame.Meta != nil {
+		dataFrame.Meta.PreferredVisualization = "logs"
+	} else {
+		dataFrame.Meta = &data.FrameMeta{
+			PreferredVisualization: "logs",
+		}
+	}
+
+	return data.Frames{dataFrame}, nil
 }
 
 // Service quotas client factory.
@@ -305,9 +345,7 @@ func (e *cloudWatchExecutor) startLiveQuery(ctx context.Context, responseChannel
 // Stubbable by tests.
 var newQuotasClient = func(sess *session.Session) servicequotasiface.ServiceQuotasAPI {
 	client := servicequotas.New(sess)
-	client.Handlers.Send.PushFront(func(r *request.Request) {
-		r.HTTPRequest.Header.Set("User-Agent", fmt.Sprintf("Grafana/%s", setting.BuildVersion))
-	})
+	setUserAgent(&client.Handlers)
 
 	return client
 }
@@ -0,0 +1,309 @@
+package cloudwatch
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/private/protocol"
+	"github.com/aws/aws-sdk-go/private/protocol/eventstream"
+	"github.com/aws/aws-sdk-go/private/protocol/eventstream/eventstreamapi"
+	"github.com/aws/aws-sdk-go/private/protocol/jsonrpc"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/grafana/grafana/pkg/tsdb"
+)
+
+// The AWS SDK version in use predates Live Tail, so the StartLiveTail input and the events of its response stream
+// are declared here, with the same shapes and tags as the SDK would generate. The operation is sent with the
+// CloudWatch Logs client, and its response stream read with the SDK's event stream reader, like the SDK does for
+// the event stream operations of other services.
+
+type startLiveTailInput struct {
+	_ struct{} `type:"structure"`
+
+	LogEventFilterPattern *string   `locationName:"logEventFilterPattern" type:"string"`
+	LogGroupIdentifiers   []*string `locationName:"logGroupIdentifiers" min:"1" type:"list" required:"true"`
+	LogStreamNamePrefixes []*string `locationName:"logStreamNamePrefixes" min:"1" type:"list"`
+	LogStreamNames        []*string `locationName:"logStreamNames" min:"1" type:"list"`
+}
+
+type startLiveTailOutput struct {
+	_ struct{} `type:"structure"`
+}
+
+type liveTailSessionUpdate struct {
+	_ struct{} `type:"structure"`
+
+	SessionMetadata *liveTailSessionMetadata   `locationName:"sessionMetadata" type:"structure"`
+	SessionResults  []*liveTailSessionLogEvent `locationName:"sessionResults" type:"list"`
+}
+
+type liveTailSessionMetadata struct {
+	_ struct{} `type:"structure"`
+
+	Sampled *bool `locationName:"sampled" type:"boolean"`
+}
+
+type liveTailSessionLogEvent struct {
+	_ struct{} `type:"structure"`
+
+	IngestionTime      *int64  `locationName:"ingestionTime" type:"long"`
+	LogGroupIdentifier *string `locationName:"logGroupIdentifier" min:"1" type:"string"`
+	LogStreamName      *string `locationName:"logStreamName" min:"1" type:"string"`
+	Message            *string `locationName:"message" type:"string"`
+	Timestamp          *int64  `locationName:"timestamp" type:"long"`
+}
+
+// UnmarshalEvent unmarshals a sessionUpdate event of the response stream.
+func (s *liveTailSessionUpdate) UnmarshalEvent(payloadUnmarshaler protocol.PayloadUnmarshaler,
+	msg eventstream.Message) error {
+	return payloadUnmarshaler.UnmarshalPayload(bytes.NewReader(msg.Payload), s)
+}
+
+// liveTailIgnoredEvent stands for the events of the response stream without log events, i.e. the sessionStart
+// event and any type of event added since.
+type liveTailIgnoredEvent struct{}
+
+func (liveTailIgnoredEvent) UnmarshalEvent(protocol.PayloadUnmarshaler, eventstream.Message) error {
+	return nil
+}
+
+// liveTailException is an exception ending the response stream, e.g. the SessionTimeoutException sent once a
+// session has lasted three hours.
+type liveTailException struct {
+	_ struct{} `type:"structure"`
+
+	code string
+
+	Message_ *string `locationName:"message" type:"string"`
+}
+
+// UnmarshalEvent unmarshals an exception event of the response stream.
+func (s *liveTailException) UnmarshalEvent(payloadUnmarshaler protocol.PayloadUnmarshaler,
+	msg eventstream.Message) error {
+	return payloadUnmarshaler.UnmarshalPayload(bytes.NewReader(msg.Payload), s)
+}
+
+func (s *liveTailException) Code() string {
+	return s.code
+}
+
+func (s *liveTailException) Message() string {
+	return aws.StringValue(s.Message_)
+}
+
+func (s *liveTailException) OrigErr() error {
+	return nil
+}
+
+func (s *liveTailException) Error() string {
+	return awserr.SprintError(s.Code(), s.Message(), "", nil)
+}
+
+func unmarshalerForLiveTailEvent(eventType string) (eventstreamapi.Unmarshaler, error) {
+	switch eventType {
+	case "sessionUpdate":
+		return &liveTailSessionUpdate{}, nil
+	case "SessionStreamingException", "SessionTimeoutException":
+		return &liveTailException{code: eventType}, nil
+	default:
+		return liveTailIgnoredEvent{}, nil
+	}
+}
+
+// liveTailStream is the response stream of a Live Tail session.
+type liveTailStream interface {
+	// Recv returns the next update of the session, or io.EOF once the session has ended.
+	Recv() (*liveTailSessionUpdate, error)
+	// Close ends the session.
+	Close() error
+}
+
+type liveTailEventStream struct {
+	reader *eventstreamapi.EventReader
+	body   io.Closer
+}
+
+func (s *liveTailEventStream) Recv() (*liveTailSessionUpdate, error) {
+	for {
+		event, err := s.reader.ReadEvent()
+		if err != nil {
+			return nil, err
+		}
+		if update, ok := event.(*liveTailSessionUpdate); ok {
+			return update, nil
+		}
+	}
+}
+
+func (s *liveTailEventStream) Close() error {
+	return s.body.Close()
+}
+
+type liveTailAPI interface {
+	StartLiveTailWithContext(ctx aws.Context, input *startLiveTailInput, opts ...request.Option) (liveTailStream, error)
+}
+
+type liveTailClient struct {
+	*cloudwatchlogs.CloudWatchLogs
+}
+
+// StartLiveTailWithContext starts a Live Tail session, which lasts until the returned stream is closed, the context
+// is done or the session times out.
+func (c *liveTailClient) StartLiveTailWithContext(ctx aws.Context, input *startLiveTailInput,
+	opts ...request.Option) (liveTailStream, error) {
+	op := &request.Operation{
+		Name:       "StartLiveTail",
+		HTTPMethod: "POST",
+		HTTPPath:   "/",
+	}
+	req := c.NewRequest(op, input, &startLiveTailOutput{})
+	req.Handlers.Build.PushBackNamed(protocol.NewHostPrefixHandler("streaming-", nil))
+	req.Handlers.Build.PushBackNamed(protocol.ValidateEndpointHostHandler)
+	// The response body is the stream of events, so it's left unread by the handlers
+	req.Handlers.Send.Swap(client.LogHTTPResponseHandler.Name, client.LogHTTPResponseHeaderHandler)
+	req.Handlers.Unmarshal.Remove(jsonrpc.UnmarshalHandler)
+	req.SetContext(ctx)
+	req.ApplyOptions(opts...)
+
+	if err := req.Send(); err != nil {
+		return nil, err
+	}
+
+	var payloadUnmarshalers request.HandlerList
+	payloadUnmarshalers.PushBackNamed(jsonrpc.UnmarshalHandler)
+	reader := eventstreamapi.NewEventReader(eventstream.NewDecoder(req.HTTPResponse.Body),
+		protocol.HandlerPayloadUnmarshal{Unmarshalers: payloadUnmarshalers}, unmarshalerForLiveTailEvent)
+
+	return &liveTailEventStream{reader: reader, body: req.HTTPResponse.Body}, nil
+}
+
+// Live Tail client factory.
+//
+// Stubbable by tests.
+var newLiveTailClient = func(sess *session.Session) liveTailAPI {
+	// Sessions stream for up to three hours, so reading the response mustn't be bounded by the timeout of the
+	// data source's requests
+	cfg := &aws.Config{}
+	if httpClient := sess.Config.HTTPClient; httpClient != nil && httpClient.Timeout > 0 {
+		streamingClient := *httpClient
+		streamingClient.Timeout = 0
+		cfg.HTTPClient = &streamingClient
+	}
+	client := cloudwatchlogs.New(sess, cfg)
+	setUserAgent(&client.Handlers)
+
+	return &liveTailClient{CloudWatchLogs: client}
+}
+
+// startLiveTail publishes the log events of a Live Tail session on the response channel, one response per session
+// update, until the session ends. The session is closed once the context is done.
+func (e *cloudWatchExecutor) startLiveTail(ctx context.Context, responseChannel chan *tsdb.Response,
+	query *tsdb.Query) error {
+	parameters := query.Model
+	region := parameters.Get("region").MustString(defaultRegion)
+
+	input := &startLiveTailInput{}
+	for _, logGroup := range parameters.Get("logGroupNames").MustStringArray() {
+		input.LogGroupIdentifiers = append(input.LogGroupIdentifiers, aws.String(strings.TrimSuffix(logGroup, ":*")))
+	}
+	if len(input.LogGroupIdentifiers) == 0 {
+		return fmt.Errorf("at least one log group is required for Live Tail")
+	}
+	if logStreamNames := parameters.Get("logStreamNames").MustStringArray(); len(logStreamNames) > 0 {
+		input.LogStreamNames = aws.StringSlice(logStreamNames)
+	}
+	if prefixes := parameters.Get("logStreamNamePrefixes").MustStringArray(); len(prefixes) > 0 {
+		input.LogStreamNamePrefixes = aws.StringSlice(prefixes)
+	}
+	if pattern := parameters.Get("logEventFilterPattern").MustString(); pattern != "" {
+		input.LogEventFilterPattern = aws.String(pattern)
+	}
+
+	sess, err := e.newSession(region)
+	if err != nil {
+		return err
+	}
+	stream, err := newLiveTailClient(sess).StartLiveTailWithContext(ctx, input)
+	if err != nil {
+		return fmt.Errorf("failed to call cloudwatch:StartLiveTail, %w", err)
+	}
+
+	// Reading the stream blocks until the next update, so the session is closed as soon as the context is done,
+	// rather than once another update arrives
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-done:
+		}
+		if err := stream.Close(); err != nil {
+			plog.Debug("Failed to close Live Tail session", "err", err)
+		}
+	}()
+
+	for {
+		update, err := stream.Recv()
+		if err != nil {
+			if ctx.Err() != nil || errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+
+		responseChannel <- &tsdb.Response{
+			Results: map[string]*tsdb.QueryResult{
+				query.RefId: {
+					RefId:      query.RefId,
+					Dataframes: tsdb.NewDecodedDataFrames(data.Frames{liveTailFrame(update, query.RefId)}),
+				},
+			},
+		}
+	}
+}
+
+// liveTailFrame converts a Live Tail session update to a frame. Unlike the polls of a query, each update only holds
+// the log events ingested since the previous one, so the frames of a session add up rather than replace each other.
+func liveTailFrame(update *liveTailSessionUpdate, refID string) *data.Frame {
+	timestamps := make([]*time.Time, 0, len(update.SessionResults))
+	messages := make([]*string, 0, len(update.SessionResults))
+	logStreams := make([]*string, 0, len(update.SessionResults))
+	logGroups := make([]*string, 0, len(update.SessionResults))
+	for _, event := range update.SessionResults {
+		timestamp := aws.MillisecondsTimeValue(event.Timestamp).UTC()
+		timestamps = append(timestamps, &timestamp)
+		messages = append(messages, event.Message)
+		logStreams = append(logStreams, event.LogStreamName)
+		logGroups = append(logGroups, event.LogGroupIdentifier)
+	}
+
+	timeField := data.NewField("@timestamp", nil, timestamps)
+	timeField.SetConfig(&data.FieldConfig{DisplayName: "Time"})
+	frame := data.NewFrame(refID,
+		timeField,
+		data.NewField("@message", nil, messages),
+		data.NewField("@logStream", nil, logStreams),
+		data.NewField("@log", nil, logGroups),
+	)
+	frame.RefID = refID
+	frame.Meta = &data.FrameMeta{PreferredVisualization: "logs"}
+	if update.SessionMetadata != nil && aws.BoolValue(update.SessionMetadata.Sampled) {
+		frame.Meta.Notices = []data.Notice{{
+			Severity: data.NoticeSeverityWarning,
+			Text:     "More log events are ingested than Live Tail streams, so only a sample of them is shown",
+		}}
+	}
+
+	return frame
+}
@@ -0,0 +1,200 @@
+package cloudwatch
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/private/protocol/eventstream"
+	"github.com/aws/aws-sdk-go/private/protocol/eventstream/eventstreamapi"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/grafana/grafana/pkg/components/simplejson"
+	"github.com/grafana/grafana/pkg/tsdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStartLiveTail(t *testing.T) {
+	origNewLiveTailClient := newLiveTailClient
+	t.Cleanup(func() {
+		newLiveTailClient = origNewLiveTailClient
+	})
+
+	stream := newFakeLiveTailStream()
+	var calls []*startLiveTailInput
+	newLiveTailClient = func(*session.Session) liveTailAPI {
+		return fakeLiveTailClient{stream: stream, calls: &calls}
+	}
+
+	executor := newExecutor(nil)
+	executor.DataSource = fakeDataSource()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	responseChannel := make(chan *tsdb.Response)
+	result := make(chan error)
+	go func() {
+		result <- executor.startLiveTail(ctx, responseChannel, &tsdb.Query{
+			RefId: "A",
+			Model: simplejson.NewFromAny(map[string]interface{}{
+				"region":                "us-east-1",
+				"liveTail":              true,
+				"logGroupNames":         []interface{}{"arn:aws:logs:us-east-1:123456789012:log-group:/ecs/web:*"},
+				"logEventFilterPattern": "ERROR",
+			}),
+		})
+	}()
+
+	event := func(timestamp int64, message string) *liveTailSessionLogEvent {
+		return &liveTailSessionLogEvent{
+			LogGroupIdentifier: aws.String("123456789012:/ecs/web"),
+			LogStreamName:      aws.String("web/1"),
+			Message:            aws.String(message),
+			Timestamp:          aws.Int64(timestamp),
+		}
+	}
+	receiveFrame := func(t *testing.T) *data.Frame {
+		t.Helper()
+
+		response := <-responseChannel
+		frames, err := response.Results["A"].Dataframes.Decoded()
+		require.NoError(t, err)
+		require.Len(t, frames, 1)
+		return frames[0]
+	}
+
+	// Each update is published as a frame of its own log events
+	stream.updates <- &liveTailSessionUpdate{
+		SessionMetadata: &liveTailSessionMetadata{Sampled: aws.Bool(false)},
+		SessionResults:  []*liveTailSessionLogEvent{event(1700000000000, "ERROR first"), event(1700000001000, "ERROR second")},
+	}
+	frame := receiveFrame(t)
+	assert.Equal(t, "A", frame.RefID)
+	require.Equal(t, 2, frame.Rows())
+	assert.True(t, time.Date(2023, 11, 14, 22, 13, 20, 0, time.UTC).Equal(*frame.Fields[0].At(0).(*time.Time)))
+	assert.Equal(t, aws.String("ERROR first"), frame.Fields[1].At(0))
+	assert.Equal(t, aws.String("ERROR second"), frame.Fields[1].At(1))
+	assert.Equal(t, aws.String("web/1"), frame.Fields[2].At(0))
+	assert.Equal(t, aws.String("123456789012:/ecs/web"), frame.Fields[3].At(0))
+	assert.Equal(t, "logs", string(frame.Meta.PreferredVisualization))
+	assert.Empty(t, frame.Meta.Notices)
+
+	stream.updates <- &liveTailSessionUpdate{
+		SessionMetadata: &liveTailSessionMetadata{Sampled: aws.Bool(true)},
+		SessionResults:  []*liveTailSessionLogEvent{event(1700000002000, "ERROR third")},
+	}
+	frame = receiveFrame(t)
+	require.Equal(t, 1, frame.Rows())
+	assert.Equal(t, aws.String("ERROR third"), frame.Fields[1].At(0))
+	require.Len(t, frame.Meta.Notices, 1)
+	assert.Equal(t, data.NoticeSeverityWarning, frame.Meta.Notices[0].Severity)
+
+	// The session is closed once the context is done, although no update is coming
+	cancel()
+	select {
+	case err := <-result:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Live Tail went on after its context was done")
+	}
+	select {
+	case <-stream.closed:
+	default:
+		t.Fatal("Live Tail session wasn't closed")
+	}
+
+	require.Len(t, calls, 1)
+	assert.Equal(t, &startLiveTailInput{
+		LogGroupIdentifiers:   aws.StringSlice([]string{"arn:aws:logs:us-east-1:123456789012:log-group:/ecs/web"}),
+		LogEventFilterPattern: aws.String("ERROR"),
+	}, calls[0])
+}
+
+func TestLiveTailClient(t *testing.T) {
+	message := func(typeHeader, messageType, eventType, payload string) eventstream.Message {
+		msg := eventstream.Message{Payload: []byte(payload)}
+		msg.Headers.Set(eventstreamapi.MessageTypeHeader, eventstream.StringValue(messageType))
+		msg.Headers.Set(typeHeader, eventstream.StringValue(eventType))
+		return msg
+	}
+	// Events as documented for the CloudWatch Logs API, since the SDK in use has no StartLiveTail to compare with
+	messages := []eventstream.Message{
+		message(eventstreamapi.EventTypeHeader, eventstreamapi.EventMessageType, "sessionStart",
+			`{"requestId":"1a2b","sessionId":"3c4d","logGroupIdentifiers":["123456789012:/ecs/web"]}`),
+		message(eventstreamapi.EventTypeHeader, eventstreamapi.EventMessageType, "sessionUpdate",
+			`{"sessionMetadata":{"sampled":false},"sessionResults":[{"logGroupIdentifier":"123456789012:/ecs/web",`+
+				`"logStreamName":"web/1","message":"ERROR first","timestamp":1700000000000,"ingestionTime":1700000000100}]}`),
+		message(eventstreamapi.ExceptionTypeHeader, eventstreamapi.ExceptionMessageType, "SessionTimeoutException",
+			`{"message":"Live Tail session has ended after 3 hours"}`),
+	}
+
+	var target string
+	var body map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		target = r.Header.Get("X-Amz-Target")
+		b, err := ioutil.ReadAll(r.Body)
+		require.NoError(t, err)
+		require.NoError(t, json.Unmarshal(b, &body))
+
+		w.Header().Set("Content-Type", "application/vnd.amazon.eventstream")
+		encoder := eventstream.NewEncoder(w)
+		for _, msg := range messages {
+			require.NoError(t, encoder.Encode(msg))
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	sess, err := session.NewSession(&aws.Config{
+		Region:                    aws.String("us-east-1"),
+		Endpoint:                  aws.String(server.URL),
+		Credentials:               credentials.NewStaticCredentials("AKID", "SECRET", ""),
+		MaxRetries:                aws.Int(0),
+		DisableEndpointHostPrefix: aws.Bool(true),
+	})
+	require.NoError(t, err)
+
+	stream, err := newLiveTailClient(sess).StartLiveTailWithContext(context.Background(), &startLiveTailInput{
+		LogGroupIdentifiers:   aws.StringSlice([]string{"arn:aws:logs:us-east-1:123456789012:log-group:/ecs/web"}),
+		LogEventFilterPattern: aws.String("ERROR"),
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		assert.NoError(t, stream.Close())
+	})
+
+	assert.Equal(t, "Logs_20140328.StartLiveTail", target)
+	assert.Equal(t, map[string]interface{}{
+		"logGroupIdentifiers":   []interface{}{"arn:aws:logs:us-east-1:123456789012:log-group:/ecs/web"},
+		"logEventFilterPattern": "ERROR",
+	}, body)
+
+	// The session start is skipped
+	update, err := stream.Recv()
+	require.NoError(t, err)
+	assert.Equal(t, &liveTailSessionUpdate{
+		SessionMetadata: &liveTailSessionMetadata{Sampled: aws.Bool(false)},
+		SessionResults: []*liveTailSessionLogEvent{
+			{
+				IngestionTime:      aws.Int64(1700000000100),
+				LogGroupIdentifier: aws.String("123456789012:/ecs/web"),
+				LogStreamName:      aws.String("web/1"),
+				Message:            aws.String("ERROR first"),
+				Timestamp:          aws.Int64(1700000000000),
+			},
+		},
+	}, update)
+
+	_, err = stream.Recv()
+	awsErr, ok := err.(awserr.Error)
+	require.True(t, ok, "expected an AWS error, got %v", err)
+	assert.Equal(t, "SessionTimeoutException", awsErr.Code())
+	assert.Equal(t, "Live Tail session has ended after 3 hours", awsErr.Message())
+}
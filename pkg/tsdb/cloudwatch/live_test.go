@@ -0,0 +1,166 @@
+package cloudwatch
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs/cloudwatchlogsiface"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/grafana/grafana/pkg/components/simplejson"
+	"github.com/grafana/grafana/pkg/tsdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStartLiveQuery_Timeout(t *testing.T) {
+	origNewCWLogsClient := NewCWLogsClient
+	t.Cleanup(func() {
+		NewCWLogsClient = origNewCWLogsClient
+	})
+
+	cli := FakeCWLogsClient{
+		calls: &logsCalls{},
+		queryResults: cloudwatchlogs.GetQueryResultsOutput{
+			Statistics: &cloudwatchlogs.QueryStatistics{
+				RecordsMatched: aws.Float64(0),
+			},
+			Status: aws.String("Running"),
+		},
+	}
+	NewCWLogsClient = func(sess *session.Session) cloudwatchlogsiface.CloudWatchLogsAPI {
+		return cli
+	}
+
+	dataSource := fakeDataSource()
+	executor := newExecutor(&LogsService{
+		queues: map[string](chan bool){
+			fmt.Sprintf("us-east-1-%d", dataSource.Id): make(chan bool, 1),
+		},
+	})
+	executor.DataSource = dataSource
+
+	responseChannel := make(chan *tsdb.Response)
+	go func() {
+		for range responseChannel {
+		}
+	}()
+	t.Cleanup(func() {
+		close(responseChannel)
+	})
+
+	err := executor.startLiveQuery(context.Background(), responseChannel, &tsdb.Query{
+		RefId: "A",
+		Model: simplejson.NewFromAny(map[string]interface{}{
+			"region":        "us-east-1",
+			"queryString":   "fields @message",
+			"logGroupNames": []interface{}{"group_a"},
+			"timeout":       "700ms",
+		}),
+	}, tsdb.NewTimeRange("1584700643000", "1584873443000"))
+	require.EqualError(t, err, "log query timed out after 700ms")
+
+	require.Len(t, cli.calls.stopQuery, 1)
+	assert.Equal(t, "abcd-efgh-ijkl-mnop", *cli.calls.stopQuery[0].QueryId)
+}
+
+func TestStartLiveQuery_PartialResults(t *testing.T) {
+	origNewCWLogsClient := NewCWLogsClient
+	origMinRetryDelay, origMaxRetryDelay := minRetryDelay, maxRetryDelay
+	t.Cleanup(func() {
+		NewCWLogsClient = origNewCWLogsClient
+		minRetryDelay, maxRetryDelay = origMinRetryDelay, origMaxRetryDelay
+	})
+	minRetryDelay, maxRetryDelay = time.Millisecond, time.Millisecond
+
+	poll := func(status string, recordsMatched float64, counts ...string) cloudwatchlogs.GetQueryResultsOutput {
+		output := cloudwatchlogs.GetQueryResultsOutput{
+			Statistics: &cloudwatchlogs.QueryStatistics{
+				RecordsMatched: aws.Float64(recordsMatched),
+			},
+			Status: aws.String(status),
+		}
+		for i := 0; i < len(counts); i += 2 {
+			output.Results = append(output.Results, []*cloudwatchlogs.ResultField{
+				{Field: aws.String("level"), Value: aws.String(counts[i])},
+				{Field: aws.String("count"), Value: aws.String(counts[i+1])},
+			})
+		}
+		return output
+	}
+	// The query goes on aggregating the records it matched after its first poll, for longer than it used to take
+	// to give up on a query without progress
+	polls := []cloudwatchlogs.GetQueryResultsOutput{poll("Running", 10, "error", "10")}
+	for i := 0; i < 10; i++ {
+		polls = append(polls, poll("Running", 10, "error", "10"))
+	}
+	polls = append(polls,
+		poll("Running", 20, "error", "10", "warn", "5"),
+		poll("Complete", 30, "error", "12", "warn", "18"),
+	)
+
+	cli := FakeCWLogsClient{
+		calls:             &logsCalls{},
+		queryResultsPolls: polls,
+	}
+	NewCWLogsClient = func(sess *session.Session) cloudwatchlogsiface.CloudWatchLogsAPI {
+		return cli
+	}
+
+	dataSource := fakeDataSource()
+	executor := newExecutor(&LogsService{
+		queues: map[string](chan bool){
+			fmt.Sprintf("us-east-1-%d", dataSource.Id): make(chan bool, 1),
+		},
+	})
+	executor.DataSource = dataSource
+
+	responseChannel := make(chan *tsdb.Response)
+	published := make(chan []data.Frames)
+	go func() {
+		var frames []data.Frames
+		for response := range responseChannel {
+			decoded, err := response.Results["A"].Dataframes.Decoded()
+			if err != nil {
+				panic(err)
+			}
+			frames = append(frames, decoded)
+		}
+		published <- frames
+	}()
+
+	parameters := simplejson.NewFromAny(map[string]interface{}{
+		"region":        "us-east-1",
+		"queryString":   "stats count(*) by level",
+		"logGroupNames": []interface{}{"group_a"},
+		"statsGroups":   []interface{}{"level"},
+	})
+	err := executor.startLiveQuery(context.Background(), responseChannel, &tsdb.Query{
+		RefId: "A",
+		Model: parameters,
+	}, tsdb.NewTimeRange("1584700643000", "1584873443000"))
+	close(responseChannel)
+	require.NoError(t, err)
+
+	frames := <-published
+	require.Len(t, cli.calls.getQueryResults, len(polls))
+	require.Len(t, frames, len(polls))
+
+	// Progress is published as the results come
+	assert.Len(t, frames[0], 1)
+	assert.Len(t, frames[len(polls)-2], 2)
+
+	// The last frames are those of the complete result
+	complete, err := liveQueryFrames(&polls[len(polls)-1], parameters, "A")
+	require.NoError(t, err)
+	require.Len(t, frames[len(polls)-1], 2)
+	for i, frame := range frames[len(polls)-1] {
+		assert.Equal(t, complete[i].Name, frame.Name)
+		assert.Equal(t, complete[i].Fields[1].At(0), frame.Fields[1].At(0))
+	}
+	assert.Empty(t, cli.calls.stopQuery)
+}
@@ -2,11 +2,19 @@ package cloudwatch
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"math/rand"
+	"regexp"
 	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/arn"
 	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
 	"github.com/aws/aws-sdk-go/service/cloudwatchlogs/cloudwatchlogsiface"
@@ -35,9 +43,15 @@ func (e *cloudWatchExecutor) executeLogActions(ctx context.Context, queryContext
 			// Because of this, if the frontend sees that a "stats ... by ..." query is being made
 			// the "statsGroups" parameter is sent along with the query to the backend so that we
 			// can correctly group the CloudWatch logs response.
+			// The results of queries grouping by time buckets with bin() are returned as time series instead.
 			statsGroups := query.Model.Get("statsGroups").MustStringArray()
+			if wideFrame, ok := logsTimeSeriesFrame(dataframe, statsGroups); ok {
+				resultChan <- &tsdb.QueryResult{RefId: query.RefId, Dataframes: tsdb.NewDecodedDataFrames(data.Frames{wideFrame})}
+				return nil
+			}
 			if len(statsGroups) > 0 && len(dataframe.Fields) > 0 {
-				groupedFrames, err := groupResults(dataframe, statsGroups)
+				groupedFrames, err := groupResults(dataframe, statsGroups,
+					query.Model.Get("sortOrder").MustString() == sortOrderDescending)
 				if err != nil {
 					return err
 				}
@@ -103,6 +117,10 @@ func (e *cloudWatchExecutor) executeLogAction(ctx context.Context, queryContext
 		data, err = e.handleGetQueryResults(ctx, logsClient, parameters, query.RefId)
 	case "GetLogEvents":
 		data, err = e.handleGetLogEvents(ctx, logsClient, parameters)
+	case "GetLogRecord":
+		data, err = e.handleGetLogRecord(ctx, logsClient, parameters, query.RefId)
+	default:
+		return nil, fmt.Errorf("unrecognized log action subtype %q", subType)
 	}
 	if err != nil {
 		return nil, err
@@ -163,39 +181,291 @@ func (e *cloudWatchExecutor) handleGetLogEvents(ctx context.Context, logsClient
 	return data.NewFrame("logEvents", timestampField, messageField), nil
 }
 
+// handleGetLogRecord returns all the fields of a log event, including those Logs Insights doesn't index, as a frame
+// with a single row. The event is given by the @ptr value of a query result, as the logRecordPointer parameter.
+func (e *cloudWatchExecutor) handleGetLogRecord(ctx context.Context, logsClient cloudwatchlogsiface.CloudWatchLogsAPI,
+	parameters *simplejson.Json, refID string) (*data.Frame, error) {
+	logRecordPointer := strings.TrimSpace(parameters.Get("logRecordPointer").MustString())
+	if logRecordPointer == "" {
+		return nil, errors.New("logRecordPointer is required, it's the @ptr field of a query result")
+	}
+
+	output, err := logsClient.GetLogRecordWithContext(ctx, &cloudwatchlogs.GetLogRecordInput{
+		LogRecordPointer: aws.String(logRecordPointer),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to call logs:GetLogRecord, %w", err)
+	}
+
+	fieldNames := make([]string, 0, len(output.LogRecord))
+	for name := range output.LogRecord {
+		fieldNames = append(fieldNames, name)
+	}
+	sort.Strings(fieldNames)
+
+	fields := make([]*data.Field, 0, len(fieldNames))
+	for _, name := range fieldNames {
+		fields = append(fields, data.NewField(name, nil, []*string{output.LogRecord[name]}))
+	}
+
+	frame := data.NewFrame(refID, fields...)
+	frame.RefID = refID
+	return frame, nil
+}
+
 func (e *cloudWatchExecutor) handleDescribeLogGroups(ctx context.Context,
 	logsClient cloudwatchlogsiface.CloudWatchLogsAPI, parameters *simplejson.Json) (*data.Frame, error) {
 	logGroupNamePrefix := parameters.Get("logGroupNamePrefix").MustString("")
+	logGroupClass := parameters.Get("logGroupClass").MustString("")
+	if err := validateLogGroupClass(logGroupClass); err != nil {
+		return nil, err
+	}
 
-	var response *cloudwatchlogs.DescribeLogGroupsOutput = nil
-	var err error
-	if len(logGroupNamePrefix) == 0 {
-		response, err = logsClient.DescribeLogGroupsWithContext(ctx, &cloudwatchlogs.DescribeLogGroupsInput{
-			Limit: aws.Int64(parameters.Get("limit").MustInt64(50)),
-		})
-	} else {
-		response, err = logsClient.DescribeLogGroupsWithContext(ctx, &cloudwatchlogs.DescribeLogGroupsInput{
-			Limit:              aws.Int64(parameters.Get("limit").MustInt64(50)),
-			LogGroupNamePrefix: aws.String(logGroupNamePrefix),
-		})
+	input := &describeLogGroupsInput{
+		Limit: aws.Int64(parameters.Get("limit").MustInt64(50)),
+	}
+	if len(logGroupNamePrefix) > 0 {
+		input.LogGroupNamePrefix = aws.String(logGroupNamePrefix)
 	}
-	if err != nil || response == nil {
+	if logGroupClass != "" {
+		input.LogGroupClass = aws.String(logGroupClass)
+	}
+	response := &describeLogGroupsOutput{}
+	if _, err := logsClient.DescribeLogGroupsWithContext(ctx, input.sdkInput(), withShapes(input, response)); err != nil {
 		return nil, err
 	}
 
 	logGroupNames := make([]*string, 0)
+	logGroupClasses := make([]*string, 0)
 	for _, logGroup := range response.LogGroups {
 		logGroupNames = append(logGroupNames, logGroup.LogGroupName)
+		logGroupClasses = append(logGroupClasses, logGroup.LogGroupClass)
 	}
 
 	groupNamesField := data.NewField("logGroupName", nil, logGroupNames)
-	frame := data.NewFrame("logGroups", groupNamesField)
+	groupClassesField := data.NewField("logGroupClass", nil, logGroupClasses)
+	frame := data.NewFrame("logGroups", groupNamesField, groupClassesField)
 
 	return frame, nil
 }
 
+// Log group classes, which DescribeLogGroups can filter log groups by.
+const (
+	logGroupClassStandard         = "STANDARD"
+	logGroupClassInfrequentAccess = "INFREQUENT_ACCESS"
+)
+
+func validateLogGroupClass(logGroupClass string) error {
+	switch logGroupClass {
+	case "", logGroupClassStandard, logGroupClassInfrequentAccess:
+		return nil
+	default:
+		return fmt.Errorf("invalid log group class %q, must be either %q or %q", logGroupClass,
+			logGroupClassStandard, logGroupClassInfrequentAccess)
+	}
+}
+
+// Query languages supported by Logs Insights: the classic Logs Insights QL, OpenSearch SQL and OpenSearch PPL.
+const (
+	queryLanguageCWLI = "CWLI"
+	queryLanguageSQL  = "SQL"
+	queryLanguagePPL  = "PPL"
+)
+
+func validateQueryLanguage(queryLanguage string) error {
+	switch queryLanguage {
+	case queryLanguageCWLI, queryLanguageSQL, queryLanguagePPL:
+		return nil
+	default:
+		return fmt.Errorf("invalid query language %q, must be one of %q, %q or %q", queryLanguage,
+			queryLanguageCWLI, queryLanguageSQL, queryLanguagePPL)
+	}
+}
+
+var validAccountID = regexp.MustCompile(`^\d{12}$`)
+
+// validateLogGroupNames validates the log groups of a query, returning whether some of them are given as ARNs. Log
+// groups of accounts linked by cross-account observability are given as ARNs, which StartQuery only accepts as
+// LogGroupIdentifiers.
+func validateLogGroupNames(logGroupNames []string) (bool, error) {
+	hasARNs := false
+	for _, name := range logGroupNames {
+		if !strings.HasPrefix(name, "arn:") {
+			continue
+		}
+
+		logGroupARN, err := arn.Parse(name)
+		if err != nil || logGroupARN.Service != "logs" || !validAccountID.MatchString(logGroupARN.AccountID) ||
+			!strings.HasPrefix(logGroupARN.Resource, "log-group:") {
+			return false, fmt.Errorf(
+				"invalid log group ARN %q, must be like arn:aws:logs:<region>:<account id>:log-group:<name>", name)
+		}
+		hasARNs = true
+	}
+
+	return hasARNs, nil
+}
+
 func (e *cloudWatchExecutor) executeStartQuery(ctx context.Context, logsClient cloudwatchlogsiface.CloudWatchLogsAPI,
 	parameters *simplejson.Json, timeRange *tsdb.TimeRange) (*cloudwatchlogs.StartQueryOutput, error) {
+	startQueryInput, err := buildStartQueryInput(parameters, timeRange)
+	if err != nil {
+		return nil, err
+	}
+
+	return e.startQuery(ctx, logsClient, startQueryInput)
+}
+
+// The number of queries a data source may have running, unless it configures another limit
+const defaultMaxConcurrentQueries = 10
+
+// logsQuerySlotTimeout is how long a query holds its slot at most, in case it's neither polled until it terminates
+// nor stopped, e.g. because the dashboard running it was closed. It's the time CloudWatch Logs Insights queries
+// time out after. Stubbable by tests.
+var logsQuerySlotTimeout = 15 * time.Minute
+
+// Semaphores bounding the queries running per data source, keyed by data source ID, and the slots held by the
+// running queries, keyed by query ID.
+var (
+	logsQuerySlots     = map[int64]chan struct{}{}
+	heldLogsQuerySlots = map[string]*heldLogsQuerySlot{}
+	logsQuerySlotsLock sync.Mutex
+)
+
+// heldLogsQuerySlot is the slot of a running query, along with the timer releasing it once the query has timed out,
+// and the limit of results the query was started with, if any.
+type heldLogsQuerySlot struct {
+	slots chan struct{}
+	timer *time.Timer
+	limit int64
+}
+
+// getLogsQuerySlots returns the semaphore of a data source, replacing it if the limit has been changed.
+func getLogsQuerySlots(dsID int64, limit int) chan struct{} {
+	logsQuerySlotsLock.Lock()
+	defer logsQuerySlotsLock.Unlock()
+
+	if slots, ok := logsQuerySlots[dsID]; ok && cap(slots) == limit {
+		return slots
+	}
+
+	slots := make(chan struct{}, limit)
+	logsQuerySlots[dsID] = slots
+	return slots
+}
+
+// holdLogsQuerySlot makes a started query hold the slot it has taken until releaseLogsQuerySlot is called for it,
+// or it times out.
+func holdLogsQuerySlot(queryID string, slots chan struct{}, limit int64) {
+	logsQuerySlotsLock.Lock()
+	defer logsQuerySlotsLock.Unlock()
+
+	// A query ID only ever holds one slot
+	if held, ok := heldLogsQuerySlots[queryID]; ok {
+		held.limit = limit
+		<-slots
+		return
+	}
+
+	heldLogsQuerySlots[queryID] = &heldLogsQuerySlot{
+		slots: slots,
+		timer: time.AfterFunc(logsQuerySlotTimeout, func() { releaseLogsQuerySlot(queryID) }),
+		limit: limit,
+	}
+}
+
+// runningLogsQueryLimit returns the limit of results a running query was started with, or 0 if it has none or
+// isn't running anymore.
+func runningLogsQueryLimit(queryID string) int64 {
+	logsQuerySlotsLock.Lock()
+	defer logsQuerySlotsLock.Unlock()
+
+	if held, ok := heldLogsQuerySlots[queryID]; ok {
+		return held.limit
+	}
+	return 0
+}
+
+// releaseLogsQuerySlot releases the slot of a query which has terminated or been stopped, if it holds one.
+func releaseLogsQuerySlot(queryID string) {
+	logsQuerySlotsLock.Lock()
+	defer logsQuerySlotsLock.Unlock()
+
+	held, ok := heldLogsQuerySlots[queryID]
+	if !ok {
+		return
+	}
+
+	held.timer.Stop()
+	delete(heldLogsQuerySlots, queryID)
+	<-held.slots
+}
+
+// startQuery starts a query once the data source has fewer than its maximum number of concurrent queries running,
+// to avoid hitting the account-wide concurrent query limit of CloudWatch Logs. The query holds its slot until
+// GetQueryResults reports it has terminated, it's stopped, or it times out.
+func (e *cloudWatchExecutor) startQuery(ctx context.Context, logsClient cloudwatchlogsiface.CloudWatchLogsAPI,
+	input *startQueryInput) (*cloudwatchlogs.StartQueryOutput, error) {
+	limit := jsonDataInt(e.DataSource.JsonData, "maxConcurrentQueries")
+	if limit <= 0 {
+		limit = defaultMaxConcurrentQueries
+	}
+
+	slots := getLogsQuerySlots(e.DataSource.Id, limit)
+	select {
+	case slots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	output, err := startQueryWithRetry(ctx, logsClient, input)
+	if err != nil {
+		<-slots
+		return nil, err
+	}
+
+	holdLogsQuerySlot(aws.StringValue(output.QueryId), slots, aws.Int64Value(input.Limit))
+	return output, nil
+}
+
+// Bounds of the backoff between StartQuery attempts rejected because too many queries are running.
+// Stubbable by tests.
+var (
+	startQueryMaxRetries    = 5
+	startQueryMinRetryDelay = 500 * time.Millisecond
+	startQueryMaxRetryDelay = 8 * time.Second
+)
+
+// startQueryWithRetry starts a query, retrying with exponential backoff and jitter while CloudWatch Logs rejects
+// it with LimitExceededException, which happens when the account's concurrent query limit is reached.
+func startQueryWithRetry(ctx context.Context, logsClient cloudwatchlogsiface.CloudWatchLogsAPI,
+	input *startQueryInput) (*cloudwatchlogs.StartQueryOutput, error) {
+	delay := startQueryMinRetryDelay
+	for attempt := 0; ; attempt++ {
+		output, err := logsClient.StartQueryWithContext(ctx, input.sdkInput(), withShapes(input, nil))
+		var awsErr awserr.Error
+		if err == nil || attempt >= startQueryMaxRetries ||
+			!errors.As(err, &awsErr) || awsErr.Code() != cloudwatchlogs.ErrCodeLimitExceededException {
+			return output, err
+		}
+
+		// Full jitter, so that queries rejected at the same time don't retry in lockstep
+		wait := time.Duration(rand.Int63n(int64(delay) + 1))
+		plog.Debug("Too many concurrent log queries, retrying StartQuery", "attempt", attempt+1, "wait", wait)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(wait):
+		}
+
+		delay *= 2
+		if delay > startQueryMaxRetryDelay {
+			delay = startQueryMaxRetryDelay
+		}
+	}
+}
+
+func buildStartQueryInput(parameters *simplejson.Json, timeRange *tsdb.TimeRange) (*startQueryInput, error) {
 	startTime, err := timeRange.ParseFrom()
 	if err != nil {
 		return nil, err
@@ -210,33 +480,110 @@ func (e *cloudWatchExecutor) executeStartQuery(ctx context.Context, logsClient c
 		return nil, fmt.Errorf("invalid time range: start time must be before end time")
 	}
 
+	queryLanguage := parameters.Get("queryLanguage").MustString()
+	if queryLanguage == "" {
+		queryLanguage = queryLanguageCWLI
+	}
+	if err := validateQueryLanguage(queryLanguage); err != nil {
+		return nil, err
+	}
+
+	logGroupNames := parameters.Get("logGroupNames").MustStringArray()
+	hasLogGroupARNs, err := validateLogGroupNames(logGroupNames)
+	if err != nil {
+		return nil, err
+	}
+
+	queryString := parameters.Get("queryString").MustString("")
+	var limit *int64
+	if resultsLimit, err := parameters.Get("limit").Int64(); err == nil {
+		if resultsLimit < 1 || resultsLimit > maxLogsResultsLimit {
+			return nil, fmt.Errorf("invalid limit %d: must be between 1 and %d", resultsLimit, maxLogsResultsLimit)
+		}
+		// SQL and PPL queries are only limited by the limit parameter, the limit command being Logs Insights QL
+		if queryLanguage == queryLanguageCWLI {
+			queryString, resultsLimit = limitLogsQuery(queryString, resultsLimit)
+		}
+		limit = aws.Int64(resultsLimit)
+	}
+
 	// The fields @log and @logStream are always included in the results of a user's query
 	// so that a row's context can be retrieved later if necessary.
 	// The usage of ltrim around the @log/@logStream fields is a necessary workaround, as without it,
 	// CloudWatch wouldn't consider a query using a non-alised @log/@logStream valid.
-	modifiedQueryString := "fields @timestamp,ltrim(@log) as " + logIdentifierInternal + ",ltrim(@logStream) as " + logStreamIdentifierInternal + "|" + parameters.Get("queryString").MustString("")
+	// SQL and PPL queries are sent as they are, as the fields command is Logs Insights QL.
+	modifiedQueryString := queryString
+	if queryLanguage == queryLanguageCWLI {
+		modifiedQueryString = "fields @timestamp,ltrim(@log) as " + logIdentifierInternal + ",ltrim(@logStream) as " + logStreamIdentifierInternal + "|" + queryString
+	}
 
-	startQueryInput := &cloudwatchlogs.StartQueryInput{
+	input := &startQueryInput{
 		StartTime:     aws.Int64(startTime.Unix()),
 		EndTime:       aws.Int64(endTime.Unix()),
-		LogGroupNames: aws.StringSlice(parameters.Get("logGroupNames").MustStringArray()),
+		QueryLanguage: aws.String(queryLanguage),
 		QueryString:   aws.String(modifiedQueryString),
+		Limit:         limit,
+	}
+	// StartQuery takes either log group names or identifiers, which are names or ARNs, so all the log groups are sent
+	// as identifiers if one of them is an ARN. ARNs are sent without the trailing :* DescribeLogGroups returns them with.
+	if hasLogGroupARNs {
+		for _, name := range logGroupNames {
+			input.LogGroupIdentifiers = append(input.LogGroupIdentifiers, aws.String(strings.TrimSuffix(name, ":*")))
+		}
+	} else {
+		input.LogGroupNames = aws.StringSlice(logGroupNames)
 	}
 
-	if resultsLimit, err := parameters.Get("limit").Int64(); err == nil {
-		startQueryInput.Limit = aws.Int64(resultsLimit)
+	return input, nil
+}
+
+// The maximum number of results CloudWatch Logs Insights returns for a query
+const maxLogsResultsLimit = 10000
+
+var logsLimitCommand = regexp.MustCompile(`(?i)(?:^|\|)\s*limit\s+(\d+)`)
+
+// limitLogsQuery applies the limit of a query to its query string, returning the query string and the number of
+// results to request. A limit command is appended unless the query string has its own, in which case the smaller
+// of both limits is requested.
+func limitLogsQuery(queryString string, limit int64) (string, int64) {
+	matches := logsLimitCommand.FindAllStringSubmatch(queryString, -1)
+	if len(matches) == 0 {
+		return fmt.Sprintf("%s | limit %d", queryString, limit), limit
 	}
 
-	return logsClient.StartQueryWithContext(ctx, startQueryInput)
+	for _, match := range matches {
+		if queryLimit, err := strconv.ParseInt(match[1], 10, 64); err == nil && queryLimit < limit {
+			limit = queryLimit
+		}
+	}
+	return queryString, limit
 }
 
 func (e *cloudWatchExecutor) handleStartQuery(ctx context.Context, logsClient cloudwatchlogsiface.CloudWatchLogsAPI,
 	parameters *simplejson.Json, timeRange *tsdb.TimeRange, refID string) (*data.Frame, error) {
-	startQueryResponse, err := e.executeStartQuery(ctx, logsClient, parameters, timeRange)
+	startQueryInput, err := buildStartQueryInput(parameters, timeRange)
 	if err != nil {
 		return nil, err
 	}
 
+	startQueryResponse, err := e.startQuery(ctx, logsClient, startQueryInput)
+	if notice, ok := missingLogGroupNotice(err, startQueryInput); ok {
+		plog.Warn("Log group of query not found", "refId", refID, "err", err)
+		dataFrame := data.NewFrame(refID)
+		dataFrame.RefID = refID
+		dataFrame.Meta = &data.FrameMeta{Notices: []data.Notice{notice}}
+		return dataFrame, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Like for GetMetricData, the input holds no credentials and can be shown in the query inspector
+	executedRequest, err := json.Marshal(startQueryInput)
+	if err != nil {
+		return nil, fmt.Errorf("could not marshal StartQuery request: %w", err)
+	}
+
 	dataFrame := data.NewFrame(refID, data.NewField("queryId", nil, []string{*startQueryResponse.QueryId}))
 	dataFrame.RefID = refID
 
@@ -245,16 +592,49 @@ func (e *cloudWatchExecutor) handleStartQuery(ctx context.Context, logsClient cl
 	dataFrame.Meta = &data.FrameMeta{
 		Custom: map[string]interface{}{
 			"Region": clientRegion,
+			"query":  string(executedRequest),
 		},
 	}
 
 	return dataFrame, nil
 }
 
+// missingLogGroupPattern matches the name of the log group in the message of the ResourceNotFoundException
+// StartQuery returns for log groups which don't exist, e.g. "Log group 'a' does not exist for account ID '1'".
+var missingLogGroupPattern = regexp.MustCompile(`(?i)log group '([^']+)'`)
+
+// missingLogGroupNotice returns a warning naming the missing log group if err is the ResourceNotFoundException
+// StartQuery returns when a log group of the query doesn't exist, typically because it has been deleted.
+func missingLogGroupNotice(err error, input *startQueryInput) (data.Notice, bool) {
+	var awsErr awserr.Error
+	if !errors.As(err, &awsErr) || awsErr.Code() != cloudwatchlogs.ErrCodeResourceNotFoundException {
+		return data.Notice{}, false
+	}
+
+	logGroups := input.LogGroupNames
+	if len(input.LogGroupIdentifiers) > 0 {
+		logGroups = input.LogGroupIdentifiers
+	}
+	text := fmt.Sprintf("one of the log groups %s does not exist, it may have been deleted",
+		strings.Join(aws.StringValueSlice(logGroups), ", "))
+	if matches := missingLogGroupPattern.FindStringSubmatch(awsErr.Message()); matches != nil {
+		text = fmt.Sprintf("log group %q does not exist, it may have been deleted", matches[1])
+	}
+
+	return data.Notice{
+		Severity: data.NoticeSeverityWarning,
+		Text:     text,
+	}, true
+}
+
 func (e *cloudWatchExecutor) executeStopQuery(ctx context.Context, logsClient cloudwatchlogsiface.CloudWatchLogsAPI,
 	parameters *simplejson.Json) (*cloudwatchlogs.StopQueryOutput, error) {
+	queryID, err := queryIDParameter(parameters)
+	if err != nil {
+		return nil, err
+	}
 	queryInput := &cloudwatchlogs.StopQueryInput{
-		QueryId: aws.String(parameters.Get("queryId").MustString()),
+		QueryId: aws.String(queryID),
 	}
 
 	response, err := logsClient.StopQueryWithContext(ctx, queryInput)
@@ -268,10 +648,66 @@ func (e *cloudWatchExecutor) executeStopQuery(ctx context.Context, logsClient cl
 			err = nil
 		}
 	}
+	if err == nil {
+		releaseLogsQuerySlot(queryID)
+	}
 
 	return response, err
 }
 
+// queryIDParameter returns the ID of the query a GetQueryResults or StopQuery action refers to, as returned by
+// StartQuery.
+func queryIDParameter(parameters *simplejson.Json) (string, error) {
+	queryID := parameters.Get("queryId").MustString()
+	if queryID == "" {
+		return "", errors.New("queryId is required")
+	}
+
+	return queryID, nil
+}
+
+// stopQueryTimeout bounds the StopQuery request issued for a query that has timed out.
+const stopQueryTimeout = 10 * time.Second
+
+// parseQueryTimeout parses the optional timeout of a log query, given as a duration string such as "30s".
+// Zero is returned if the query has no timeout.
+func parseQueryTimeout(parameters *simplejson.Json) (time.Duration, error) {
+	timeoutStr := parameters.Get("timeout").MustString("")
+	if timeoutStr == "" {
+		return 0, nil
+	}
+
+	timeout, err := time.ParseDuration(timeoutStr)
+	if err != nil || timeout < 0 {
+		return 0, fmt.Errorf("invalid query timeout %q", timeoutStr)
+	}
+
+	return timeout, nil
+}
+
+// stopTimedOutQuery stops a query whose context is done, so it doesn't keep running in CloudWatch.
+// A new context is used for the request, since the query's own context has already expired.
+func (e *cloudWatchExecutor) stopTimedOutQuery(logsClient cloudwatchlogsiface.CloudWatchLogsAPI, queryID string) {
+	ctx, cancel := context.WithTimeout(context.Background(), stopQueryTimeout)
+	defer cancel()
+
+	parameters := simplejson.NewFromAny(map[string]interface{}{
+		"queryId": queryID,
+	})
+	if _, err := e.executeStopQuery(ctx, logsClient, parameters); err != nil {
+		plog.Warn("Failed to stop timed out query", "queryId", queryID, "err", err)
+	}
+}
+
+// queryTimeoutError returns the error to report for a query whose context is done.
+func queryTimeoutError(ctx context.Context, timeout time.Duration) error {
+	if timeout > 0 && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("log query timed out after %s", timeout)
+	}
+
+	return ctx.Err()
+}
+
 func (e *cloudWatchExecutor) handleStopQuery(ctx context.Context, logsClient cloudwatchlogsiface.CloudWatchLogsAPI,
 	parameters *simplejson.Json) (*data.Frame, error) {
 	response, err := e.executeStopQuery(ctx, logsClient, parameters)
@@ -279,17 +715,42 @@ func (e *cloudWatchExecutor) handleStopQuery(ctx context.Context, logsClient clo
 		return nil, err
 	}
 
-	dataFrame := data.NewFrame("StopQueryResponse", data.NewField("success", nil, []bool{*response.Success}))
+	dataFrame := data.NewFrame("StopQueryResponse", data.NewField("success", nil,
+		[]bool{aws.BoolValue(response.Success)}))
 	return dataFrame, nil
 }
 
 func (e *cloudWatchExecutor) executeGetQueryResults(ctx context.Context, logsClient cloudwatchlogsiface.CloudWatchLogsAPI,
 	parameters *simplejson.Json) (*cloudwatchlogs.GetQueryResultsOutput, error) {
+	queryID, err := queryIDParameter(parameters)
+	if err != nil {
+		return nil, err
+	}
 	queryInput := &cloudwatchlogs.GetQueryResultsInput{
-		QueryId: aws.String(parameters.Get("queryId").MustString()),
+		QueryId: aws.String(queryID),
 	}
 
-	return logsClient.GetQueryResultsWithContext(ctx, queryInput)
+	output, err := logsClient.GetQueryResultsWithContext(ctx, queryInput)
+	if err != nil {
+		return nil, err
+	}
+
+	// GetQueryResults can't limit the results it returns in the AWS SDK version in use, so the results are
+	// truncated here in case the query returned more than the limit it was started with. Polls don't have to repeat
+	// the limit, which is kept until the query terminates, so it must be looked up before releasing the query's slot.
+	limit, err := parameters.Get("limit").Int64()
+	if err != nil {
+		limit = runningLogsQueryLimit(queryID)
+	}
+	if limit > 0 && int64(len(output.Results)) > limit {
+		output.Results = output.Results[:limit]
+	}
+
+	if isTerminated(aws.StringValue(output.Status)) {
+		releaseLogsQuerySlot(queryID)
+	}
+
+	return output, nil
 }
 
 func (e *cloudWatchExecutor) handleGetQueryResults(ctx context.Context, logsClient cloudwatchlogsiface.CloudWatchLogsAPI,
@@ -299,11 +760,21 @@ func (e *cloudWatchExecutor) handleGetQueryResults(ctx context.Context, logsClie
 		return nil, err
 	}
 
-	dataFrame, err := logsResultsToDataframes(getQueryResultsOutput)
+	dataFrame, err := logsResultsToDataframes(getQueryResultsOutput, parameters.Get("expandJsonMessage").MustBool())
 	if err != nil {
 		return nil, err
 	}
 
+	switch sortOrder := parameters.Get("sortOrder").MustString(); sortOrder {
+	case "":
+		// Keep the order the results were returned in by CloudWatch
+	case sortOrderAscending, sortOrderDescending:
+		sortByTimestamp(dataFrame, sortOrder == sortOrderDescending)
+	default:
+		return nil, fmt.Errorf("invalid sort order %q, must be either %q or %q", sortOrder, sortOrderAscending,
+			sortOrderDescending)
+	}
+
 	dataFrame.Name = refID
 	dataFrame.RefID = refID
 
@@ -3,10 +3,14 @@ package cloudwatch
 import (
 	"context"
 	"fmt"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
 	"github.com/aws/aws-sdk-go/service/cloudwatchlogs/cloudwatchlogsiface"
@@ -72,6 +76,7 @@ func TestQuery_DescribeLogGroups(t *testing.T) {
 								data.NewField("logGroupName", nil, []*string{
 									aws.String("group_a"), aws.String("group_b"), aws.String("group_c"),
 								}),
+								data.NewField("logGroupClass", nil, []*string{nil, nil, nil}),
 							},
 							Meta: &data.FrameMeta{
 								PreferredVisualization: "logs",
@@ -125,6 +130,7 @@ func TestQuery_DescribeLogGroups(t *testing.T) {
 								data.NewField("logGroupName", nil, []*string{
 									aws.String("group_a"), aws.String("group_b"), aws.String("group_c"),
 								}),
+								data.NewField("logGroupClass", nil, []*string{nil, nil, nil}),
 							},
 							Meta: &data.FrameMeta{
 								PreferredVisualization: "logs",
@@ -137,6 +143,86 @@ func TestQuery_DescribeLogGroups(t *testing.T) {
 	})
 }
 
+func TestQuery_DescribeLogGroups_LogGroupClass(t *testing.T) {
+	origNewCWLogsClient := NewCWLogsClient
+	t.Cleanup(func() {
+		NewCWLogsClient = origNewCWLogsClient
+	})
+
+	var cli FakeCWLogsClient
+	NewCWLogsClient = func(sess *session.Session) cloudwatchlogsiface.CloudWatchLogsAPI {
+		return cli
+	}
+
+	runQuery := func(logGroupClass string) (*tsdb.Response, error) {
+		executor := newExecutor(nil)
+		return executor.Query(context.Background(), fakeDataSource(), &tsdb.TsdbQuery{
+			Queries: []*tsdb.Query{
+				{
+					Model: simplejson.NewFromAny(map[string]interface{}{
+						"type":          "logAction",
+						"subtype":       "DescribeLogGroups",
+						"logGroupClass": logGroupClass,
+					}),
+				},
+			},
+		})
+	}
+
+	t.Run("Log groups are filtered by class, which is returned", func(t *testing.T) {
+		cli = FakeCWLogsClient{
+			logGroups: cloudwatchlogs.DescribeLogGroupsOutput{
+				LogGroups: []*cloudwatchlogs.LogGroup{
+					{LogGroupName: aws.String("/archive/a")},
+					{LogGroupName: aws.String("/archive/b")},
+				},
+			},
+			logGroupClasses: map[string]string{
+				"/archive/a": "INFREQUENT_ACCESS",
+				"/archive/b": "INFREQUENT_ACCESS",
+			},
+			calls: &logsCalls{},
+		}
+
+		resp, err := runQuery("INFREQUENT_ACCESS")
+		require.NoError(t, err)
+
+		require.Len(t, cli.calls.describeLogGroupsParams, 1)
+		assert.Equal(t, &describeLogGroupsInput{
+			Limit:         aws.Int64(50),
+			LogGroupClass: aws.String("INFREQUENT_ACCESS"),
+		}, cli.calls.describeLogGroupsParams[0])
+
+		frames, err := resp.Results[""].Dataframes.Decoded()
+		require.NoError(t, err)
+		require.Len(t, frames, 1)
+		require.Len(t, frames[0].Fields, 2)
+		assert.Equal(t, "logGroupClass", frames[0].Fields[1].Name)
+		for i, name := range []string{"/archive/a", "/archive/b"} {
+			assert.Equal(t, aws.String(name), frames[0].Fields[0].At(i))
+			assert.Equal(t, aws.String("INFREQUENT_ACCESS"), frames[0].Fields[1].At(i))
+		}
+	})
+
+	t.Run("Log groups of all classes are described without a class", func(t *testing.T) {
+		cli = FakeCWLogsClient{calls: &logsCalls{}}
+
+		_, err := runQuery("")
+		require.NoError(t, err)
+
+		require.Len(t, cli.calls.describeLogGroupsParams, 1)
+		assert.Nil(t, cli.calls.describeLogGroupsParams[0].LogGroupClass)
+	})
+
+	t.Run("Unknown class is rejected", func(t *testing.T) {
+		cli = FakeCWLogsClient{calls: &logsCalls{}}
+
+		_, err := runQuery("GLACIER")
+		assert.EqualError(t, err, `invalid log group class "GLACIER", must be either "STANDARD" or "INFREQUENT_ACCESS"`)
+		assert.Empty(t, cli.calls.describeLogGroups)
+	})
+}
+
 func TestQuery_GetLogGroupFields(t *testing.T) {
 	origNewCWLogsClient := NewCWLogsClient
 	t.Cleanup(func() {
@@ -313,6 +399,22 @@ func TestQuery_StartQuery(t *testing.T) {
 		})
 		require.NoError(t, err)
 
+		frames, err := resp.Results[refID].Dataframes.Decoded()
+		require.NoError(t, err)
+		require.Len(t, frames, 1)
+		executedRequest := frames[0].Meta.Custom.(map[string]interface{})["query"]
+		require.IsType(t, "", executedRequest)
+		assert.JSONEq(t, `{
+			"EndTime": 1584873443,
+			"Limit": 50,
+			"LogGroupIdentifiers": null,
+			"LogGroupName": null,
+			"LogGroupNames": [],
+			"QueryLanguage": "CWLI",
+			"QueryString": "fields @timestamp,ltrim(@log) as __log__grafana_internal__,ltrim(@logStream) as __logstream__grafana_internal__|fields @message | limit 50",
+			"StartTime": 1584700643
+		}`, executedRequest.(string))
+
 		expFrame := data.NewFrame(
 			refID,
 			data.NewField("queryId", nil, []string{"abcd-efgh-ijkl-mnop"}),
@@ -321,6 +423,7 @@ func TestQuery_StartQuery(t *testing.T) {
 		expFrame.Meta = &data.FrameMeta{
 			Custom: map[string]interface{}{
 				"Region": "default",
+				"query":  executedRequest,
 			},
 			PreferredVisualization: "logs",
 		}
@@ -335,6 +438,167 @@ func TestQuery_StartQuery(t *testing.T) {
 	})
 }
 
+func TestQuery_StartQuery_QueryLanguage(t *testing.T) {
+	origNewCWLogsClient := NewCWLogsClient
+	t.Cleanup(func() {
+		NewCWLogsClient = origNewCWLogsClient
+	})
+
+	var cli FakeCWLogsClient
+
+	NewCWLogsClient = func(sess *session.Session) cloudwatchlogsiface.CloudWatchLogsAPI {
+		return cli
+	}
+
+	timeRange := &tsdb.TimeRange{
+		From: "1584700643000",
+		To:   "1584873443000",
+	}
+
+	runQuery := func(queryLanguage string) error {
+		model := map[string]interface{}{
+			"type":        "logAction",
+			"subtype":     "StartQuery",
+			"region":      "default",
+			"queryString": "fields @message",
+		}
+		if queryLanguage != "" {
+			model["queryLanguage"] = queryLanguage
+		}
+
+		executor := newExecutor(nil)
+		_, err := executor.Query(context.Background(), fakeDataSource(), &tsdb.TsdbQuery{
+			TimeRange: timeRange,
+			Queries: []*tsdb.Query{
+				{
+					RefId: "A",
+					Model: simplejson.NewFromAny(model),
+				},
+			},
+		})
+		return err
+	}
+
+	t.Run("Defaults to Logs Insights QL", func(t *testing.T) {
+		cli = FakeCWLogsClient{calls: &logsCalls{}}
+
+		err := runQuery("")
+		require.NoError(t, err)
+		require.Len(t, cli.calls.startQueryParams, 1)
+		assert.Equal(t, "CWLI", aws.StringValue(cli.calls.startQueryParams[0].QueryLanguage))
+		assert.Equal(t, "fields @timestamp,ltrim(@log) as __log__grafana_internal__,ltrim(@logStream) as __logstream__grafana_internal__|fields @message",
+			*cli.calls.startQueryParams[0].QueryString)
+	})
+
+	t.Run("Logs Insights QL is forwarded", func(t *testing.T) {
+		cli = FakeCWLogsClient{calls: &logsCalls{}}
+
+		err := runQuery("CWLI")
+		require.NoError(t, err)
+		require.Len(t, cli.calls.startQueryParams, 1)
+		assert.Equal(t, "CWLI", aws.StringValue(cli.calls.startQueryParams[0].QueryLanguage))
+	})
+
+	for _, queryLanguage := range []string{"SQL", "PPL"} {
+		t.Run(queryLanguage+" is forwarded with the query string as it is", func(t *testing.T) {
+			cli = FakeCWLogsClient{calls: &logsCalls{}}
+
+			err := runQuery(queryLanguage)
+			require.NoError(t, err)
+			require.Len(t, cli.calls.startQueryParams, 1)
+			assert.Equal(t, queryLanguage, aws.StringValue(cli.calls.startQueryParams[0].QueryLanguage))
+			assert.Equal(t, "fields @message", aws.StringValue(cli.calls.startQueryParams[0].QueryString))
+		})
+	}
+
+	t.Run("Unknown query language is rejected", func(t *testing.T) {
+		cli = FakeCWLogsClient{calls: &logsCalls{}}
+
+		err := runQuery("KQL")
+		require.Error(t, err)
+		assert.Equal(t, `invalid query language "KQL", must be one of "CWLI", "SQL" or "PPL"`, err.Error())
+		assert.Empty(t, cli.calls.startQuery)
+	})
+}
+
+func TestQuery_StartQuery_LogGroupARNs(t *testing.T) {
+	origNewCWLogsClient := NewCWLogsClient
+	t.Cleanup(func() {
+		NewCWLogsClient = origNewCWLogsClient
+	})
+
+	cli := FakeCWLogsClient{calls: &logsCalls{}}
+	NewCWLogsClient = func(sess *session.Session) cloudwatchlogsiface.CloudWatchLogsAPI {
+		return cli
+	}
+
+	runQuery := func(logGroupNames ...interface{}) error {
+		executor := newExecutor(nil)
+		_, err := executor.Query(context.Background(), fakeDataSource(), &tsdb.TsdbQuery{
+			TimeRange: &tsdb.TimeRange{
+				From: "1584700643000",
+				To:   "1584873443000",
+			},
+			Queries: []*tsdb.Query{
+				{
+					RefId: "A",
+					Model: simplejson.NewFromAny(map[string]interface{}{
+						"type":          "logAction",
+						"subtype":       "StartQuery",
+						"region":        "default",
+						"logGroupNames": logGroupNames,
+						"queryString":   "fields @message",
+					}),
+				},
+			},
+		})
+		return err
+	}
+
+	t.Run("Log group names are forwarded", func(t *testing.T) {
+		cli.calls.startQuery = nil
+		cli.calls.startQueryParams = nil
+
+		err := runQuery("/aws/lambda/api", "/ecs/web")
+		require.NoError(t, err)
+		require.Len(t, cli.calls.startQuery, 1)
+		assert.Equal(t, aws.StringSlice([]string{"/aws/lambda/api", "/ecs/web"}), cli.calls.startQuery[0].LogGroupNames)
+		require.Len(t, cli.calls.startQueryParams, 1)
+		assert.Nil(t, cli.calls.startQueryParams[0].LogGroupIdentifiers)
+	})
+
+	t.Run("Account qualified log group ARNs are forwarded as identifiers along with names", func(t *testing.T) {
+		cli.calls.startQuery = nil
+		cli.calls.startQueryParams = nil
+
+		err := runQuery("/ecs/web", "arn:aws:logs:us-east-1:123456789012:log-group:/aws/lambda/api:*")
+		require.NoError(t, err)
+		require.Len(t, cli.calls.startQueryParams, 1)
+		assert.Equal(t, aws.StringSlice([]string{
+			"/ecs/web",
+			"arn:aws:logs:us-east-1:123456789012:log-group:/aws/lambda/api",
+		}), cli.calls.startQueryParams[0].LogGroupIdentifiers)
+		assert.Nil(t, cli.calls.startQueryParams[0].LogGroupNames)
+	})
+
+	for _, logGroupARN := range []string{
+		"arn:aws:logs:us-east-1:log-group:/aws/lambda/api",
+		"arn:aws:logs:us-east-1:1234:log-group:/aws/lambda/api",
+		"arn:aws:s3:us-east-1:123456789012:log-group:/aws/lambda/api",
+		"arn:aws:logs:us-east-1:123456789012:destination:api",
+	} {
+		t.Run("Invalid log group ARN "+logGroupARN, func(t *testing.T) {
+			cli.calls.startQuery = nil
+
+			err := runQuery(logGroupARN)
+			require.Error(t, err)
+			assert.Equal(t, fmt.Sprintf("invalid log group ARN %q, must be like "+
+				"arn:aws:logs:<region>:<account id>:log-group:<name>", logGroupARN), err.Error())
+			assert.Empty(t, cli.calls.startQuery)
+		})
+	}
+}
+
 func TestQuery_StopQuery(t *testing.T) {
 	origNewCWLogsClient := NewCWLogsClient
 	t.Cleanup(func() {
@@ -404,6 +668,83 @@ func TestQuery_StopQuery(t *testing.T) {
 	}, resp)
 }
 
+func TestQuery_StopQuery_Region(t *testing.T) {
+	origNewCWLogsClient := NewCWLogsClient
+	t.Cleanup(func() {
+		NewCWLogsClient = origNewCWLogsClient
+	})
+
+	var cli FakeCWLogsClient
+	var regions []string
+	NewCWLogsClient = func(sess *session.Session) cloudwatchlogsiface.CloudWatchLogsAPI {
+		regions = append(regions, aws.StringValue(sess.Config.Region))
+		return cli
+	}
+
+	stopQuery := func() (*tsdb.Response, error) {
+		executor := newExecutor(nil)
+		return executor.Query(context.Background(), fakeDataSource(), &tsdb.TsdbQuery{
+			TimeRange: tsdb.NewTimeRange("1584700643000", "1584873443000"),
+			Queries: []*tsdb.Query{
+				{
+					RefId: "A",
+					Model: simplejson.NewFromAny(map[string]interface{}{
+						"type":    "logAction",
+						"subtype": "StopQuery",
+						"region":  "eu-west-1",
+						"queryId": "abcd-efgh-ijkl-mnop",
+					}),
+				},
+			},
+		})
+	}
+	stopQuerySuccess := func(t *testing.T, resp *tsdb.Response) bool {
+		t.Helper()
+
+		frames, err := resp.Results["A"].Dataframes.Decoded()
+		require.NoError(t, err)
+		require.Len(t, frames, 1)
+		success, ok := frames[0].Fields[0].At(0).(bool)
+		require.True(t, ok)
+		return success
+	}
+
+	t.Run("Query is stopped in the region of the action", func(t *testing.T) {
+		regions = nil
+		cli = FakeCWLogsClient{calls: &logsCalls{}}
+
+		resp, err := stopQuery()
+		require.NoError(t, err)
+
+		assert.True(t, stopQuerySuccess(t, resp))
+		assert.Equal(t, []string{"eu-west-1"}, regions)
+		require.Len(t, cli.calls.stopQuery, 1)
+		assert.Equal(t, "abcd-efgh-ijkl-mnop", aws.StringValue(cli.calls.stopQuery[0].QueryId))
+	})
+
+	t.Run("Query which has already stopped is reported as not stopped", func(t *testing.T) {
+		cli = FakeCWLogsClient{
+			calls:          &logsCalls{},
+			stopQueryError: awserr.New("InvalidParameterException", "query is not running", nil),
+		}
+
+		resp, err := stopQuery()
+		require.NoError(t, err)
+
+		assert.False(t, stopQuerySuccess(t, resp))
+	})
+
+	t.Run("Other errors fail the action", func(t *testing.T) {
+		cli = FakeCWLogsClient{
+			calls:          &logsCalls{},
+			stopQueryError: awserr.New("AccessDeniedException", "access denied", nil),
+		}
+
+		_, err := stopQuery()
+		require.Error(t, err)
+	})
+}
+
 func TestQuery_GetQueryResults(t *testing.T) {
 	origNewCWLogsClient := NewCWLogsClient
 	t.Cleanup(func() {
@@ -484,7 +825,15 @@ func TestQuery_GetQueryResults(t *testing.T) {
 	expField2 := data.NewField("field_b", nil, []*string{
 		aws.String("b_1"), aws.String("b_2"),
 	})
-	expFrame := data.NewFrame(refID, expField1, expField2)
+	expField3 := data.NewField("@ptr", nil, []*string{
+		aws.String("abcdefg"), aws.String("hijklmnop"),
+	})
+	expField3.SetConfig(&data.FieldConfig{
+		Custom: map[string]interface{}{
+			"hidden": true,
+		},
+	})
+	expFrame := data.NewFrame(refID, expField1, expField2, expField3)
 	expFrame.RefID = refID
 	expFrame.Meta = &data.FrameMeta{
 		Custom: map[string]interface{}{
@@ -516,3 +865,878 @@ func TestQuery_GetQueryResults(t *testing.T) {
 		},
 	}, resp)
 }
+
+func TestQuery_LogActions_DashboardPolling(t *testing.T) {
+	origNewCWLogsClient := NewCWLogsClient
+	t.Cleanup(func() {
+		NewCWLogsClient = origNewCWLogsClient
+	})
+
+	cli := FakeCWLogsClient{
+		queryResults: cloudwatchlogs.GetQueryResultsOutput{
+			Status: aws.String("Running"),
+		},
+		calls: &logsCalls{},
+	}
+	NewCWLogsClient = func(sess *session.Session) cloudwatchlogsiface.CloudWatchLogsAPI {
+		return cli
+	}
+
+	runAction := func(model map[string]interface{}) *data.Frame {
+		t.Helper()
+
+		model["type"] = "logAction"
+		model["region"] = "us-east-1"
+		executor := newExecutor(nil)
+		resp, err := executor.Query(context.Background(), fakeDataSource(), &tsdb.TsdbQuery{
+			TimeRange: tsdb.NewTimeRange("1584700643000", "1584873443000"),
+			Queries: []*tsdb.Query{
+				{
+					RefId: "A",
+					Model: simplejson.NewFromAny(model),
+				},
+			},
+		})
+		require.NoError(t, err)
+		frames, err := resp.Results["A"].Dataframes.Decoded()
+		require.NoError(t, err)
+		require.Len(t, frames, 1)
+		return frames[0]
+	}
+
+	frame := runAction(map[string]interface{}{
+		"subtype":       "StartQuery",
+		"logGroupNames": []interface{}{"group_a"},
+		"queryString":   "fields @message",
+	})
+	require.Len(t, frame.Fields, 1)
+	queryID := frame.Fields[0].At(0).(string)
+	assert.Equal(t, "abcd-efgh-ijkl-mnop", queryID)
+	assert.Equal(t, "us-east-1", frame.Meta.Custom.(map[string]interface{})["Region"])
+
+	frame = runAction(map[string]interface{}{
+		"subtype": "GetQueryResults",
+		"queryId": queryID,
+	})
+	assert.Equal(t, map[string]interface{}{"Status": "Running"}, frame.Meta.Custom)
+
+	frame = runAction(map[string]interface{}{
+		"subtype": "StopQuery",
+		"queryId": queryID,
+	})
+	assert.Equal(t, true, frame.Fields[0].At(0))
+	require.Len(t, cli.calls.stopQuery, 1)
+	assert.Equal(t, queryID, *cli.calls.stopQuery[0].QueryId)
+}
+
+func TestQuery_GetLogRecord(t *testing.T) {
+	origNewCWLogsClient := NewCWLogsClient
+	t.Cleanup(func() {
+		NewCWLogsClient = origNewCWLogsClient
+	})
+
+	cli := FakeCWLogsClient{
+		calls: &logsCalls{},
+		logRecord: map[string]*string{
+			"@timestamp":     aws.String("1584700643000"),
+			"@message":       aws.String(`{"level": "error", "requestId": "abc"}`),
+			"@logStream":     aws.String("stream_a"),
+			"@log":           aws.String("123456789012:group_a"),
+			"unindexedField": aws.String("value"),
+		},
+	}
+	NewCWLogsClient = func(sess *session.Session) cloudwatchlogsiface.CloudWatchLogsAPI {
+		return cli
+	}
+
+	const refID = "A"
+	executor := newExecutor(nil)
+	resp, err := executor.Query(context.Background(), fakeDataSource(), &tsdb.TsdbQuery{
+		Queries: []*tsdb.Query{
+			{
+				RefId: refID,
+				Model: simplejson.NewFromAny(map[string]interface{}{
+					"type":             "logAction",
+					"subtype":          "GetLogRecord",
+					"logRecordPointer": "CmAKJwojMTIzNDU2Nzg5MDEyOmdyb3VwX2EQBxIaGAIGBp",
+				}),
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	require.Len(t, cli.calls.getLogRecord, 1)
+	assert.Equal(t, "CmAKJwojMTIzNDU2Nzg5MDEyOmdyb3VwX2EQBxIaGAIGBp",
+		aws.StringValue(cli.calls.getLogRecord[0].LogRecordPointer))
+
+	expFrame := data.NewFrame(refID,
+		data.NewField("@log", nil, []*string{aws.String("123456789012:group_a")}),
+		data.NewField("@logStream", nil, []*string{aws.String("stream_a")}),
+		data.NewField("@message", nil, []*string{aws.String(`{"level": "error", "requestId": "abc"}`)}),
+		data.NewField("@timestamp", nil, []*string{aws.String("1584700643000")}),
+		data.NewField("unindexedField", nil, []*string{aws.String("value")}),
+	)
+	expFrame.RefID = refID
+	expFrame.Meta = &data.FrameMeta{
+		PreferredVisualization: "logs",
+	}
+	assert.Equal(t, &tsdb.Response{
+		Results: map[string]*tsdb.QueryResult{
+			refID: {
+				Dataframes: tsdb.NewDecodedDataFrames(data.Frames{expFrame}),
+				RefId:      refID,
+			},
+		},
+	}, resp)
+}
+
+func TestQuery_LogActions_InvalidParameters(t *testing.T) {
+	origNewCWLogsClient := NewCWLogsClient
+	t.Cleanup(func() {
+		NewCWLogsClient = origNewCWLogsClient
+	})
+
+	NewCWLogsClient = func(sess *session.Session) cloudwatchlogsiface.CloudWatchLogsAPI {
+		return FakeCWLogsClient{}
+	}
+
+	testCases := map[string]struct {
+		subtype     string
+		expectedErr string
+	}{
+		"GetQueryResults without query ID": {
+			subtype:     "GetQueryResults",
+			expectedErr: "queryId is required",
+		},
+		"StopQuery without query ID": {
+			subtype:     "StopQuery",
+			expectedErr: "queryId is required",
+		},
+		"GetLogRecord without log record pointer": {
+			subtype:     "GetLogRecord",
+			expectedErr: "logRecordPointer is required, it's the @ptr field of a query result",
+		},
+		"Unknown subtype": {
+			subtype:     "GetQueryStatus",
+			expectedErr: `unrecognized log action subtype "GetQueryStatus"`,
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			executor := newExecutor(nil)
+			_, err := executor.Query(context.Background(), fakeDataSource(), &tsdb.TsdbQuery{
+				Queries: []*tsdb.Query{
+					{
+						RefId: "A",
+						Model: simplejson.NewFromAny(map[string]interface{}{
+							"type":    "logAction",
+							"subtype": tc.subtype,
+						}),
+					},
+				},
+			})
+			assert.EqualError(t, err, tc.expectedErr)
+		})
+	}
+}
+
+func TestQuery_GetQueryResults_SortOrder(t *testing.T) {
+	origNewCWLogsClient := NewCWLogsClient
+	t.Cleanup(func() {
+		NewCWLogsClient = origNewCWLogsClient
+	})
+
+	newRow := func(timestamp, message string) []*cloudwatchlogs.ResultField {
+		return []*cloudwatchlogs.ResultField{
+			{Field: aws.String("@timestamp"), Value: aws.String(timestamp)},
+			{Field: aws.String("@message"), Value: aws.String(message)},
+		}
+	}
+	cli := FakeCWLogsClient{
+		queryResults: cloudwatchlogs.GetQueryResultsOutput{
+			Results: [][]*cloudwatchlogs.ResultField{
+				newRow("2020-03-20 10:40:43.000", "b"),
+				newRow("2020-03-20 10:37:23.000", "a"),
+				newRow("2020-03-20 10:45:00.000", "c"),
+			},
+			Status: aws.String("Complete"),
+		},
+	}
+	NewCWLogsClient = func(sess *session.Session) cloudwatchlogsiface.CloudWatchLogsAPI {
+		return cli
+	}
+
+	getMessages := func(t *testing.T, sortOrder string) ([]string, error) {
+		model := map[string]interface{}{
+			"type":    "logAction",
+			"subtype": "GetQueryResults",
+			"queryId": "abcd-efgh-ijkl-mnop",
+		}
+		if sortOrder != "" {
+			model["sortOrder"] = sortOrder
+		}
+
+		executor := newExecutor(nil)
+		resp, err := executor.Query(context.Background(), fakeDataSource(), &tsdb.TsdbQuery{
+			Queries: []*tsdb.Query{
+				{
+					RefId: "A",
+					Model: simplejson.NewFromAny(model),
+				},
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		frames, err := resp.Results["A"].Dataframes.Decoded()
+		require.NoError(t, err)
+		require.Len(t, frames, 1)
+		messages := make([]string, 0)
+		for i := 0; i < frames[0].Fields[1].Len(); i++ {
+			messages = append(messages, *frames[0].Fields[1].At(i).(*string))
+		}
+		return messages, nil
+	}
+
+	t.Run("Server ordering is kept by default", func(t *testing.T) {
+		messages, err := getMessages(t, "")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"b", "a", "c"}, messages)
+	})
+
+	t.Run("Results are sorted oldest first", func(t *testing.T) {
+		messages, err := getMessages(t, "asc")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"a", "b", "c"}, messages)
+	})
+
+	t.Run("Results are sorted newest first", func(t *testing.T) {
+		messages, err := getMessages(t, "desc")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"c", "b", "a"}, messages)
+	})
+
+	t.Run("Invalid sort order is rejected", func(t *testing.T) {
+		_, err := getMessages(t, "newest")
+		require.EqualError(t, err, `invalid sort order "newest", must be either "asc" or "desc"`)
+	})
+}
+
+func TestQuery_StartQuery_Limit(t *testing.T) {
+	origNewCWLogsClient := NewCWLogsClient
+	t.Cleanup(func() {
+		NewCWLogsClient = origNewCWLogsClient
+	})
+
+	startQuery := func(t *testing.T, queryString string, limit int) (*cloudwatchlogs.StartQueryInput, error) {
+		t.Helper()
+
+		cli := FakeCWLogsClient{calls: &logsCalls{}}
+		NewCWLogsClient = func(sess *session.Session) cloudwatchlogsiface.CloudWatchLogsAPI {
+			return cli
+		}
+
+		executor := newExecutor(nil)
+		_, err := executor.Query(context.Background(), fakeDataSource(), &tsdb.TsdbQuery{
+			TimeRange: &tsdb.TimeRange{
+				From: "1584700643000",
+				To:   "1584873443000",
+			},
+			Queries: []*tsdb.Query{
+				{
+					RefId: "A",
+					Model: simplejson.NewFromAny(map[string]interface{}{
+						"type":        "logAction",
+						"subtype":     "StartQuery",
+						"region":      "default",
+						"queryString": queryString,
+						"limit":       limit,
+					}),
+				},
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		require.Len(t, cli.calls.startQuery, 1)
+		return cli.calls.startQuery[0], nil
+	}
+
+	t.Run("Limit is appended to the query string", func(t *testing.T) {
+		input, err := startQuery(t, "fields @message | sort @timestamp desc", 20)
+		require.NoError(t, err)
+
+		assert.Equal(t, aws.Int64(20), input.Limit)
+		assert.True(t, strings.HasSuffix(*input.QueryString, "|fields @message | sort @timestamp desc | limit 20"),
+			*input.QueryString)
+	})
+
+	t.Run("Lower limit of the query string is requested", func(t *testing.T) {
+		input, err := startQuery(t, "fields @message | limit 5", 20)
+		require.NoError(t, err)
+
+		assert.Equal(t, aws.Int64(5), input.Limit)
+		assert.True(t, strings.HasSuffix(*input.QueryString, "|fields @message | limit 5"), *input.QueryString)
+	})
+
+	t.Run("Higher limit of the query string is capped", func(t *testing.T) {
+		input, err := startQuery(t, "fields @message | LIMIT 500", 20)
+		require.NoError(t, err)
+
+		assert.Equal(t, aws.Int64(20), input.Limit)
+		assert.True(t, strings.HasSuffix(*input.QueryString, "|fields @message | LIMIT 500"), *input.QueryString)
+	})
+
+	t.Run("Limit out of range is rejected", func(t *testing.T) {
+		_, err := startQuery(t, "fields @message", 10001)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "invalid limit 10001: must be between 1 and 10000")
+	})
+}
+
+func TestQuery_GetQueryResults_Limit(t *testing.T) {
+	origNewCWLogsClient := NewCWLogsClient
+	t.Cleanup(func() {
+		NewCWLogsClient = origNewCWLogsClient
+	})
+
+	var results [][]*cloudwatchlogs.ResultField
+	for _, message := range []string{"a", "b", "c"} {
+		results = append(results, []*cloudwatchlogs.ResultField{
+			{
+				Field: aws.String("@message"),
+				Value: aws.String(message),
+			},
+		})
+	}
+	NewCWLogsClient = func(sess *session.Session) cloudwatchlogsiface.CloudWatchLogsAPI {
+		return FakeCWLogsClient{
+			queryResults: cloudwatchlogs.GetQueryResultsOutput{
+				Results: results,
+				Status:  aws.String("Complete"),
+			},
+		}
+	}
+
+	executor := newExecutor(nil)
+	resp, err := executor.Query(context.Background(), fakeDataSource(), &tsdb.TsdbQuery{
+		Queries: []*tsdb.Query{
+			{
+				RefId: "A",
+				Model: simplejson.NewFromAny(map[string]interface{}{
+					"type":    "logAction",
+					"subtype": "GetQueryResults",
+					"queryId": "abcd-efgh-ijkl-mnop",
+					"limit":   2,
+				}),
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	frames, err := resp.Results["A"].Dataframes.Decoded()
+	require.NoError(t, err)
+	require.Len(t, frames, 1)
+	assert.Equal(t, 2, frames[0].Rows())
+}
+
+func TestQuery_GetQueryResults_StartedLimit(t *testing.T) {
+	origNewCWLogsClient := NewCWLogsClient
+	t.Cleanup(func() {
+		NewCWLogsClient = origNewCWLogsClient
+	})
+	// The fake client starts all queries with the same ID, which other tests may have left running
+	releaseLogsQuerySlot("abcd-efgh-ijkl-mnop")
+
+	var results [][]*cloudwatchlogs.ResultField
+	for _, message := range []string{"a", "b", "c", "d"} {
+		results = append(results, []*cloudwatchlogs.ResultField{
+			{
+				Field: aws.String("@message"),
+				Value: aws.String(message),
+			},
+		})
+	}
+	cli := FakeCWLogsClient{
+		calls: &logsCalls{},
+		queryResultsPolls: []cloudwatchlogs.GetQueryResultsOutput{
+			{Results: results[:3], Status: aws.String("Running")},
+			{Results: results, Status: aws.String("Complete")},
+		},
+	}
+	NewCWLogsClient = func(sess *session.Session) cloudwatchlogsiface.CloudWatchLogsAPI {
+		return cli
+	}
+
+	executor := newExecutor(nil)
+	_, err := executor.Query(context.Background(), fakeDataSource(), &tsdb.TsdbQuery{
+		TimeRange: tsdb.NewTimeRange("1584700643000", "1584873443000"),
+		Queries: []*tsdb.Query{
+			{
+				RefId: "A",
+				Model: simplejson.NewFromAny(map[string]interface{}{
+					"type":          "logAction",
+					"subtype":       "StartQuery",
+					"region":        "us-east-1",
+					"logGroupNames": []interface{}{"group_a"},
+					"queryString":   "fields @message",
+					"limit":         2,
+				}),
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	// The polls of the query don't repeat its limit, which still applies to each of them, the last included
+	for _, status := range []string{"Running", "Complete"} {
+		resp, err := executor.Query(context.Background(), fakeDataSource(), &tsdb.TsdbQuery{
+			Queries: []*tsdb.Query{
+				{
+					RefId: "A",
+					Model: simplejson.NewFromAny(map[string]interface{}{
+						"type":    "logAction",
+						"subtype": "GetQueryResults",
+						"region":  "us-east-1",
+						"queryId": "abcd-efgh-ijkl-mnop",
+					}),
+				},
+			},
+		})
+		require.NoError(t, err)
+
+		frames, err := resp.Results["A"].Dataframes.Decoded()
+		require.NoError(t, err)
+		require.Len(t, frames, 1)
+		assert.Equal(t, 2, frames[0].Rows(), status)
+	}
+	assert.Zero(t, runningLogsQueryLimit("abcd-efgh-ijkl-mnop"))
+}
+
+func TestQuery_StartQuery_ExecutedRequest(t *testing.T) {
+	origNewCWLogsClient := NewCWLogsClient
+	t.Cleanup(func() {
+		NewCWLogsClient = origNewCWLogsClient
+	})
+
+	cli := FakeCWLogsClient{}
+	NewCWLogsClient = func(sess *session.Session) cloudwatchlogsiface.CloudWatchLogsAPI {
+		return cli
+	}
+
+	executor := newExecutor(nil)
+	resp, err := executor.Query(context.Background(), fakeDataSource(fakeDataSourceCfg{
+		accessKey: "AKIAFAKEACCESSKEY",
+		secretKey: "fake-secret-key",
+	}), &tsdb.TsdbQuery{
+		TimeRange: &tsdb.TimeRange{
+			From: "1584700643000",
+			To:   "1584873443000",
+		},
+		Queries: []*tsdb.Query{
+			{
+				RefId: "A",
+				Model: simplejson.NewFromAny(map[string]interface{}{
+					"type":          "logAction",
+					"subtype":       "StartQuery",
+					"region":        "default",
+					"logGroupNames": []interface{}{"group_a"},
+					"queryString":   "fields @message",
+				}),
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	frames, err := resp.Results["A"].Dataframes.Decoded()
+	require.NoError(t, err)
+	require.Len(t, frames, 1)
+	executedRequest, ok := frames[0].Meta.Custom.(map[string]interface{})["query"].(string)
+	require.True(t, ok)
+
+	assert.Contains(t, executedRequest, `"LogGroupNames":["group_a"]`)
+	assert.NotContains(t, executedRequest, "AKIAFAKEACCESSKEY")
+	assert.NotContains(t, executedRequest, "fake-secret-key")
+}
+
+func TestQuery_StartQuery_LimitExceededRetry(t *testing.T) {
+	origNewCWLogsClient := NewCWLogsClient
+	origMaxRetries, origMinRetryDelay := startQueryMaxRetries, startQueryMinRetryDelay
+	t.Cleanup(func() {
+		NewCWLogsClient = origNewCWLogsClient
+		startQueryMaxRetries, startQueryMinRetryDelay = origMaxRetries, origMinRetryDelay
+	})
+	startQueryMinRetryDelay = time.Millisecond
+
+	var cli FakeCWLogsClient
+	NewCWLogsClient = func(sess *session.Session) cloudwatchlogsiface.CloudWatchLogsAPI {
+		return cli
+	}
+
+	limitExceeded := awserr.New(cloudwatchlogs.ErrCodeLimitExceededException, "too many concurrent queries", nil)
+	runQuery := func() (*tsdb.Response, error) {
+		executor := newExecutor(nil)
+		return executor.Query(context.Background(), fakeDataSource(), &tsdb.TsdbQuery{
+			TimeRange: &tsdb.TimeRange{
+				From: "1584700643000",
+				To:   "1584873443000",
+			},
+			Queries: []*tsdb.Query{
+				{
+					RefId: "A",
+					Model: simplejson.NewFromAny(map[string]interface{}{
+						"type":          "logAction",
+						"subtype":       "StartQuery",
+						"region":        "default",
+						"logGroupNames": []interface{}{"group_a"},
+						"queryString":   "fields @message",
+					}),
+				},
+			},
+		})
+	}
+
+	t.Run("Query is started once the limit is no longer exceeded", func(t *testing.T) {
+		cli = FakeCWLogsClient{
+			calls:            &logsCalls{},
+			startQueryErrors: []error{limitExceeded, limitExceeded},
+		}
+
+		resp, err := runQuery()
+		require.NoError(t, err)
+
+		assert.Len(t, cli.calls.startQuery, 3)
+		frames, err := resp.Results["A"].Dataframes.Decoded()
+		require.NoError(t, err)
+		require.Len(t, frames, 1)
+		assert.Equal(t, "abcd-efgh-ijkl-mnop", frames[0].Fields[0].At(0))
+	})
+
+	t.Run("Retries are bounded", func(t *testing.T) {
+		startQueryMaxRetries = 2
+		cli = FakeCWLogsClient{
+			calls:            &logsCalls{},
+			startQueryErrors: []error{limitExceeded, limitExceeded, limitExceeded, limitExceeded},
+		}
+
+		_, err := runQuery()
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), cloudwatchlogs.ErrCodeLimitExceededException)
+		assert.Len(t, cli.calls.startQuery, 3)
+	})
+
+	t.Run("Other errors aren't retried", func(t *testing.T) {
+		cli = FakeCWLogsClient{
+			calls:            &logsCalls{},
+			startQueryErrors: []error{awserr.New("AccessDeniedException", "access denied", nil)},
+		}
+
+		_, err := runQuery()
+		require.Error(t, err)
+		assert.Len(t, cli.calls.startQuery, 1)
+	})
+}
+
+// runningQueriesClient starts queries with distinct IDs, which GetQueryResults reports as running until they're
+// stopped or given another status.
+type runningQueriesClient struct {
+	cloudwatchlogsiface.CloudWatchLogsAPI
+
+	prefix string
+
+	// getQueryResultsErr, if set, is returned by GetQueryResults
+	getQueryResultsErr error
+
+	lock     sync.Mutex
+	started  []string
+	statuses map[string]string
+}
+
+func (c *runningQueriesClient) StartQueryWithContext(ctx context.Context, input *cloudwatchlogs.StartQueryInput,
+	option ...request.Option) (*cloudwatchlogs.StartQueryOutput, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	queryID := fmt.Sprintf("%s-%d", c.prefix, len(c.started)+1)
+	c.started = append(c.started, queryID)
+	if c.statuses == nil {
+		c.statuses = map[string]string{}
+	}
+	c.statuses[queryID] = cloudwatchlogs.QueryStatusRunning
+
+	return &cloudwatchlogs.StartQueryOutput{QueryId: aws.String(queryID)}, nil
+}
+
+func (c *runningQueriesClient) GetQueryResultsWithContext(ctx context.Context, input *cloudwatchlogs.GetQueryResultsInput,
+	option ...request.Option) (*cloudwatchlogs.GetQueryResultsOutput, error) {
+	if c.getQueryResultsErr != nil {
+		return nil, c.getQueryResultsErr
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return &cloudwatchlogs.GetQueryResultsOutput{Status: aws.String(c.statuses[*input.QueryId])}, nil
+}
+
+func (c *runningQueriesClient) StopQueryWithContext(ctx context.Context, input *cloudwatchlogs.StopQueryInput,
+	option ...request.Option) (*cloudwatchlogs.StopQueryOutput, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.statuses[*input.QueryId] = cloudwatchlogs.QueryStatusCancelled
+	return &cloudwatchlogs.StopQueryOutput{Success: aws.Bool(true)}, nil
+}
+
+func (c *runningQueriesClient) setStatus(queryID string, status string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.statuses[queryID] = status
+}
+
+func TestQuery_StartQuery_MissingLogGroup(t *testing.T) {
+	origNewCWLogsClient := NewCWLogsClient
+	t.Cleanup(func() {
+		NewCWLogsClient = origNewCWLogsClient
+	})
+
+	var cli FakeCWLogsClient
+	NewCWLogsClient = func(sess *session.Session) cloudwatchlogsiface.CloudWatchLogsAPI {
+		return cli
+	}
+
+	runQuery := func() (*tsdb.Response, error) {
+		executor := newExecutor(nil)
+		return executor.Query(context.Background(), fakeDataSource(), &tsdb.TsdbQuery{
+			TimeRange: &tsdb.TimeRange{
+				From: "1584700643000",
+				To:   "1584873443000",
+			},
+			Queries: []*tsdb.Query{
+				{
+					RefId: "A",
+					Model: simplejson.NewFromAny(map[string]interface{}{
+						"type":          "logAction",
+						"subtype":       "StartQuery",
+						"region":        "default",
+						"logGroupNames": []interface{}{"group_a", "group_b"},
+						"queryString":   "fields @message",
+					}),
+				},
+			},
+		})
+	}
+
+	t.Run("Missing log group results in an empty frame with a notice", func(t *testing.T) {
+		cli = FakeCWLogsClient{
+			calls: &logsCalls{},
+			startQueryErrors: []error{awserr.New(cloudwatchlogs.ErrCodeResourceNotFoundException,
+				"Log group 'group_b' does not exist for account ID '123456789012'", nil)},
+		}
+
+		resp, err := runQuery()
+		require.NoError(t, err)
+
+		frames, err := resp.Results["A"].Dataframes.Decoded()
+		require.NoError(t, err)
+		require.Len(t, frames, 1)
+		assert.Empty(t, frames[0].Fields)
+		require.NotNil(t, frames[0].Meta)
+		assert.Equal(t, []data.Notice{
+			{
+				Severity: data.NoticeSeverityWarning,
+				Text:     `log group "group_b" does not exist, it may have been deleted`,
+			},
+		}, frames[0].Meta.Notices)
+	})
+
+	t.Run("Query log groups are named if the message doesn't name the missing one", func(t *testing.T) {
+		cli = FakeCWLogsClient{
+			calls: &logsCalls{},
+			startQueryErrors: []error{awserr.New(cloudwatchlogs.ErrCodeResourceNotFoundException,
+				"The specified log group does not exist.", nil)},
+		}
+
+		resp, err := runQuery()
+		require.NoError(t, err)
+
+		frames, err := resp.Results["A"].Dataframes.Decoded()
+		require.NoError(t, err)
+		require.Len(t, frames, 1)
+		require.NotNil(t, frames[0].Meta)
+		require.Len(t, frames[0].Meta.Notices, 1)
+		assert.Equal(t, "one of the log groups group_a, group_b does not exist, it may have been deleted",
+			frames[0].Meta.Notices[0].Text)
+	})
+
+	t.Run("Other errors still fail the query", func(t *testing.T) {
+		cli = FakeCWLogsClient{
+			calls:            &logsCalls{},
+			startQueryErrors: []error{awserr.New("AccessDeniedException", "access denied", nil)},
+		}
+
+		_, err := runQuery()
+		require.Error(t, err)
+	})
+}
+
+func TestStartQuery_MaxConcurrentQueries(t *testing.T) {
+	input := &startQueryInput{
+		LogGroupNames: []*string{aws.String("group_a")},
+		QueryString:   aws.String("fields @message"),
+	}
+	queryID := func(queryID string) *simplejson.Json {
+		return simplejson.NewFromAny(map[string]interface{}{"queryId": queryID})
+	}
+
+	// setup returns an executor of a data source running at most two queries, and a client starting its queries
+	setup := func(t *testing.T, dsID int64) (*cloudWatchExecutor, *runningQueriesClient) {
+		cli := &runningQueriesClient{prefix: t.Name()}
+		t.Cleanup(func() {
+			for _, queryID := range cli.started {
+				releaseLogsQuerySlot(queryID)
+			}
+			logsQuerySlotsLock.Lock()
+			defer logsQuerySlotsLock.Unlock()
+			delete(logsQuerySlots, dsID)
+		})
+
+		executor := newExecutor(nil)
+		executor.DataSource = fakeDataSource()
+		executor.DataSource.Id = dsID
+		executor.DataSource.JsonData.Set("maxConcurrentQueries", 2)
+		return executor, cli
+	}
+
+	// startWaiting starts a query in the background, returning the channel its error is sent to once started
+	startWaiting := func(ctx context.Context, executor *cloudWatchExecutor, cli *runningQueriesClient) chan error {
+		started := make(chan error, 1)
+		go func() {
+			_, err := executor.startQuery(ctx, cli, input)
+			started <- err
+		}()
+		return started
+	}
+	assertWaiting := func(t *testing.T, started chan error) {
+		t.Helper()
+		select {
+		case <-started:
+			t.Fatal("a query was started while the maximum number of queries were running")
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+	assertStarted := func(t *testing.T, started chan error) {
+		t.Helper()
+		select {
+		case err := <-started:
+			assert.NoError(t, err)
+		case <-time.After(time.Second):
+			t.Fatal("the waiting query wasn't started")
+		}
+	}
+
+	t.Run("Queries beyond the limit wait until a running query terminates", func(t *testing.T) {
+		executor, cli := setup(t, 5771)
+		for i := 0; i < 2; i++ {
+			_, err := executor.startQuery(context.Background(), cli, input)
+			require.NoError(t, err)
+		}
+
+		started := startWaiting(context.Background(), executor, cli)
+		assertWaiting(t, started)
+
+		_, err := executor.executeGetQueryResults(context.Background(), cli, queryID(cli.started[0]))
+		require.NoError(t, err)
+		assertWaiting(t, started)
+
+		cli.setStatus(cli.started[0], cloudwatchlogs.QueryStatusComplete)
+		_, err = executor.executeGetQueryResults(context.Background(), cli, queryID(cli.started[0]))
+		require.NoError(t, err)
+		assertStarted(t, started)
+	})
+
+	t.Run("Stopping a query releases its slot", func(t *testing.T) {
+		executor, cli := setup(t, 5772)
+		for i := 0; i < 2; i++ {
+			_, err := executor.startQuery(context.Background(), cli, input)
+			require.NoError(t, err)
+		}
+
+		started := startWaiting(context.Background(), executor, cli)
+		assertWaiting(t, started)
+
+		_, err := executor.executeStopQuery(context.Background(), cli, queryID(cli.started[1]))
+		require.NoError(t, err)
+		assertStarted(t, started)
+	})
+
+	t.Run("Slots are released once the queries time out", func(t *testing.T) {
+		origTimeout := logsQuerySlotTimeout
+		t.Cleanup(func() {
+			logsQuerySlotTimeout = origTimeout
+		})
+		logsQuerySlotTimeout = 100 * time.Millisecond
+
+		executor, cli := setup(t, 5773)
+		for i := 0; i < 2; i++ {
+			_, err := executor.startQuery(context.Background(), cli, input)
+			require.NoError(t, err)
+		}
+
+		started := startWaiting(context.Background(), executor, cli)
+		assertWaiting(t, started)
+		assertStarted(t, started)
+	})
+
+	t.Run("Alert queries release their slot when fetching their results fails", func(t *testing.T) {
+		origMinAlertPollDelay := minAlertPollDelay
+		t.Cleanup(func() {
+			minAlertPollDelay = origMinAlertPollDelay
+		})
+		minAlertPollDelay = time.Millisecond
+
+		executor, cli := setup(t, 5775)
+		_, err := executor.startQuery(context.Background(), cli, input)
+		require.NoError(t, err)
+
+		cli.getQueryResultsErr = awserr.New("ServiceUnavailableException", "The service is unavailable", nil)
+		_, err = executor.alertQuery(context.Background(), cli, &tsdb.TsdbQuery{
+			TimeRange: tsdb.NewTimeRange("1584700643000", "1584873443000"),
+			Queries: []*tsdb.Query{
+				{
+					RefId: "A",
+					Model: simplejson.NewFromAny(map[string]interface{}{
+						"region":        "us-east-1",
+						"queryString":   "fields @message",
+						"logGroupNames": []interface{}{"group_a"},
+					}),
+				},
+			},
+		})
+		require.Error(t, err)
+		require.Len(t, cli.started, 2)
+
+		// Only the first query still holds its slot
+		started := startWaiting(context.Background(), executor, cli)
+		assertStarted(t, started)
+		started = startWaiting(context.Background(), executor, cli)
+		assertWaiting(t, started)
+		releaseLogsQuerySlot(cli.started[0])
+		assertStarted(t, started)
+	})
+
+	t.Run("Waiting for a slot is cancelled with the context", func(t *testing.T) {
+		executor, cli := setup(t, 5774)
+		for i := 0; i < 2; i++ {
+			_, err := executor.startQuery(context.Background(), cli, input)
+			require.NoError(t, err)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		_, err := executor.startQuery(ctx, cli, input)
+		assert.Equal(t, context.DeadlineExceeded, err)
+	})
+}
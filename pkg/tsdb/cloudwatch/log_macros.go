@@ -0,0 +1,46 @@
+package cloudwatch
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana/pkg/components/simplejson"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/tsdb"
+)
+
+// expandLogsQueryMacros replaces the time macros of a Logs Insights query string. The frontend interpolates
+// them for dashboard queries, but alert queries are sent to the backend as they were saved.
+//
+// The supported macros are $__interval, $__interval_ms, $__from and $__to, the latter two in epoch milliseconds.
+func expandLogsQueryMacros(queryString string, dsInfo *models.DataSource, model *simplejson.Json,
+	timeRange *tsdb.TimeRange) (string, error) {
+	if !strings.Contains(queryString, "$") {
+		return queryString, nil
+	}
+
+	minInterval, err := tsdb.GetIntervalFrom(dsInfo, model, time.Second)
+	if err != nil {
+		return "", fmt.Errorf("invalid interval: %w", err)
+	}
+	calculator := tsdb.NewIntervalCalculator(&tsdb.IntervalOptions{})
+	interval := calculator.Calculate(timeRange, minInterval)
+
+	from := strconv.FormatInt(timeRange.GetFromAsMsEpoch(), 10)
+	to := strconv.FormatInt(timeRange.GetToAsMsEpoch(), 10)
+
+	replacer := strings.NewReplacer(
+		"${__interval_ms}", strconv.FormatInt(interval.Milliseconds(), 10),
+		"$__interval_ms", strconv.FormatInt(interval.Milliseconds(), 10),
+		"${__interval}", interval.Text,
+		"$__interval", interval.Text,
+		"${__from}", from,
+		"$__from", from,
+		"${__to}", to,
+		"$__to", to,
+	)
+
+	return replacer.Replace(queryString), nil
+}
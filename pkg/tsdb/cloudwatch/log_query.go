@@ -1,9 +1,12 @@
 package cloudwatch
 
 import (
+	"encoding/json"
 	"fmt"
+	"regexp"
 	"sort"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
@@ -11,7 +14,13 @@ import (
 	"github.com/grafana/grafana-plugin-sdk-go/data"
 )
 
-func logsResultsToDataframes(response *cloudwatchlogs.GetQueryResultsOutput) (*data.Frame, error) {
+// logRecordPointerField is the field of query results identifying their log event, which is kept hidden so that
+// the full event can be fetched with the GetLogRecord log action.
+const logRecordPointerField = "@ptr"
+
+// logsResultsToDataframes converts the results of a logs query to a frame. If expandJSONMessage is set, the
+// top-level keys of @message values holding a JSON object are added as fields.
+func logsResultsToDataframes(response *cloudwatchlogs.GetQueryResultsOutput, expandJSONMessage bool) (*data.Frame, error) {
 	if response == nil {
 		return nil, fmt.Errorf("response is nil, cannot convert log results to data frames")
 	}
@@ -36,7 +45,9 @@ func logsResultsToDataframes(response *cloudwatchlogs.GetQueryResultsOutput) (*d
 
 	rowCount := len(nonEmptyRows)
 
-	fieldValues := make(map[string]interface{})
+	// CloudWatch returns all values as strings, so they're collected by field first, for the type of each field to
+	// be told from all of its values
+	fieldValues := make(map[string][]*string)
 
 	// Maintaining a list of field names in the order returned from CloudWatch
 	// as just iterating over fieldValues would not give a consistent order
@@ -44,50 +55,25 @@ func logsResultsToDataframes(response *cloudwatchlogs.GetQueryResultsOutput) (*d
 
 	for i, row := range nonEmptyRows {
 		for _, resultField := range row {
-			// Strip @ptr field from results as it's not needed
-			if *resultField.Field == "@ptr" {
-				continue
-			}
-
-			if _, exists := fieldValues[*resultField.Field]; !exists {
-				fieldNames = append(fieldNames, *resultField.Field)
-
-				// Check if it's a time field
-				if _, err := time.Parse(cloudWatchTSFormat, *resultField.Value); err == nil {
-					fieldValues[*resultField.Field] = make([]*time.Time, rowCount)
-				} else if _, err := strconv.ParseFloat(*resultField.Value, 64); err == nil {
-					fieldValues[*resultField.Field] = make([]*float64, rowCount)
-				} else {
-					fieldValues[*resultField.Field] = make([]*string, rowCount)
-				}
-			}
-
-			if timeField, ok := fieldValues[*resultField.Field].([]*time.Time); ok {
-				parsedTime, err := time.Parse(cloudWatchTSFormat, *resultField.Value)
-				if err != nil {
-					return nil, err
-				}
-
-				timeField[i] = &parsedTime
-			} else if numericField, ok := fieldValues[*resultField.Field].([]*float64); ok {
-				parsedFloat, err := strconv.ParseFloat(*resultField.Value, 64)
-				if err != nil {
-					return nil, err
-				}
-				numericField[i] = &parsedFloat
-			} else {
-				fieldValues[*resultField.Field].([]*string)[i] = resultField.Value
+			fieldName := aws.StringValue(resultField.Field)
+			if _, exists := fieldValues[fieldName]; !exists {
+				fieldNames = append(fieldNames, fieldName)
+				fieldValues[fieldName] = make([]*string, rowCount)
 			}
+			fieldValues[fieldName][i] = resultField.Value
 		}
 	}
 
+	typedFieldValues := make(map[string]interface{}, len(fieldNames))
 	newFields := make([]*data.Field, 0, len(fieldNames))
 	for _, fieldName := range fieldNames {
-		newFields = append(newFields, data.NewField(fieldName, nil, fieldValues[fieldName]))
+		typedFieldValues[fieldName] = typedLogFieldValues(fieldValues[fieldName])
+		newFields = append(newFields, data.NewField(fieldName, nil, typedFieldValues[fieldName]))
 
 		if fieldName == "@timestamp" {
 			newFields[len(newFields)-1].SetConfig(&data.FieldConfig{DisplayName: "Time"})
-		} else if fieldName == logStreamIdentifierInternal || fieldName == logIdentifierInternal {
+		} else if fieldName == logStreamIdentifierInternal || fieldName == logIdentifierInternal ||
+			fieldName == logRecordPointerField {
 			newFields[len(newFields)-1].SetConfig(
 				&data.FieldConfig{
 					Custom: map[string]interface{}{
@@ -98,6 +84,10 @@ func logsResultsToDataframes(response *cloudwatchlogs.GetQueryResultsOutput) (*d
 		}
 	}
 
+	if messages, ok := typedFieldValues["@message"].([]*string); ok && expandJSONMessage {
+		newFields = append(newFields, jsonMessageFields(messages, typedFieldValues)...)
+	}
+
 	queryStats := make([]data.QueryStat, 0)
 	if response.Statistics != nil {
 		if response.Statistics.BytesScanned != nil {
@@ -138,12 +128,149 @@ func logsResultsToDataframes(response *cloudwatchlogs.GetQueryResultsOutput) (*d
 		}
 	}
 
-	// Results aren't guaranteed to come ordered by time (ascending), so we need to sort
-	sort.Sort(ByTime(*frame))
+	// The order of the results is kept as returned by CloudWatch, since it reflects any sort command in the query.
+	// Callers needing the results ordered by time have to sort the frame themselves.
 	return frame, nil
 }
 
-func groupResults(results *data.Frame, groupingFieldNames []string) ([]*data.Frame, error) {
+// typedLogFieldValues returns the values of a field of the results as times if they're all timestamps, as numbers if
+// they're all numbers, or as strings otherwise, such as when a field holds both numbers and text. Missing and empty
+// values are left out of times and numbers.
+func typedLogFieldValues(values []*string) interface{} {
+	isTime, isNumeric, isEmpty := true, true, true
+	for _, value := range values {
+		if value == nil || *value == "" {
+			continue
+		}
+		isEmpty = false
+
+		if isTime {
+			if _, err := time.Parse(cloudWatchTSFormat, *value); err != nil {
+				isTime = false
+			}
+		}
+		if isNumeric {
+			if _, err := strconv.ParseFloat(*value, 64); err != nil {
+				isNumeric = false
+			}
+		}
+		if !isTime && !isNumeric {
+			break
+		}
+	}
+
+	switch {
+	case isEmpty:
+		return values
+	case isTime:
+		times := make([]*time.Time, len(values))
+		for i, value := range values {
+			if value == nil || *value == "" {
+				continue
+			}
+			parsed, _ := time.Parse(cloudWatchTSFormat, *value)
+			times[i] = &parsed
+		}
+		return times
+	case isNumeric:
+		numbers := make([]*float64, len(values))
+		for i, value := range values {
+			if value == nil || *value == "" {
+				continue
+			}
+			parsed, _ := strconv.ParseFloat(*value, 64)
+			numbers[i] = &parsed
+		}
+		return numbers
+	default:
+		return values
+	}
+}
+
+// jsonMessageFields returns a field for each top-level key of the messages holding a JSON object, in the order the
+// keys are first seen. Keys clashing with a field of the results are skipped. Rows whose message isn't a JSON
+// object, or lacks a key, are left empty in its field.
+func jsonMessageFields(messages []*string, resultFields map[string]interface{}) []*data.Field {
+	keyNames := make([]string, 0)
+	keyValues := make(map[string][]interface{})
+	for i, message := range messages {
+		if message == nil || !strings.HasPrefix(strings.TrimSpace(*message), "{") {
+			continue
+		}
+
+		var object map[string]interface{}
+		if err := json.Unmarshal([]byte(*message), &object); err != nil {
+			continue
+		}
+
+		keys := make([]string, 0, len(object))
+		for key := range object {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			if _, exists := resultFields[key]; exists {
+				continue
+			}
+			if _, exists := keyValues[key]; !exists {
+				keyNames = append(keyNames, key)
+				keyValues[key] = make([]interface{}, len(messages))
+			}
+			keyValues[key][i] = object[key]
+		}
+	}
+
+	fields := make([]*data.Field, 0, len(keyNames))
+	for _, key := range keyNames {
+		fields = append(fields, data.NewField(key, nil, jsonValuesToFieldValues(keyValues[key])))
+	}
+
+	return fields
+}
+
+// jsonValuesToFieldValues returns the values of a key as numbers if they're all numbers, or as strings otherwise,
+// with objects and arrays kept as JSON.
+func jsonValuesToFieldValues(values []interface{}) interface{} {
+	numeric := true
+	for _, value := range values {
+		if _, ok := value.(float64); value != nil && !ok {
+			numeric = false
+			break
+		}
+	}
+
+	if numeric {
+		numbers := make([]*float64, len(values))
+		for i, value := range values {
+			if number, ok := value.(float64); ok {
+				numbers[i] = aws.Float64(number)
+			}
+		}
+		return numbers
+	}
+
+	strs := make([]*string, len(values))
+	for i, value := range values {
+		switch v := value.(type) {
+		case nil:
+		case string:
+			strs[i] = aws.String(v)
+		default:
+			encoded, err := json.Marshal(v)
+			if err != nil {
+				continue
+			}
+			strs[i] = aws.String(string(encoded))
+		}
+	}
+	return strs
+}
+
+// groupResults splits the results of a stats query into a frame per group of the grouping fields, sorted by group
+// key. Since Logs Insights may return the rows of a group more than once and in any order, identical rows are
+// dropped and the rows of a group are sorted by time, newest first if descending is set.
+func groupResults(results *data.Frame, groupingFieldNames []string, descending bool) ([]*data.Frame, error) {
 	groupingFields := make([]*data.Field, 0)
 
 	for i, field := range results.Fields {
@@ -169,25 +296,175 @@ func groupResults(results *data.Frame, groupingFieldNames []string) ([]*data.Fra
 		return nil, err
 	}
 
-	groupedDataFrames := make(map[string]*data.Frame)
+	groupedRows := make(map[string][]int)
+	groupKeys := make([]string, 0)
 	for i := 0; i < rowLength; i++ {
 		groupKey := generateGroupKey(groupingFields, i)
-		if _, exists := groupedDataFrames[groupKey]; !exists {
-			newFrame := results.EmptyCopy()
-			newFrame.Name = groupKey
-			newFrame.Meta = results.Meta
-			groupedDataFrames[groupKey] = newFrame
+		if _, exists := groupedRows[groupKey]; !exists {
+			groupKeys = append(groupKeys, groupKey)
+		}
+		groupedRows[groupKey] = append(groupedRows[groupKey], i)
+	}
+	sort.Strings(groupKeys)
+
+	timeField := firstTimeField(results)
+	newDataFrames := make([]*data.Frame, 0, len(groupKeys))
+	for _, groupKey := range groupKeys {
+		newFrame := results.EmptyCopy()
+		newFrame.Name = groupKey
+		newFrame.Meta = results.Meta
+		seen := make(map[string]bool, len(groupedRows[groupKey]))
+		for _, row := range groupedRows[groupKey] {
+			key := rowKey(results, row)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			newFrame.AppendRow(results.RowCopy(row)...)
+		}
+		// Rows with the same time keep their order, so that frames are the same for the same results
+		if timeField >= 0 {
+			sort.Stable(byTimestamp{frame: newFrame, timeField: newFrame.Fields[timeField], descending: descending})
 		}
+		newDataFrames = append(newDataFrames, newFrame)
+	}
+
+	return newDataFrames, nil
+}
 
-		groupedDataFrames[groupKey].AppendRow(results.RowCopy(i)...)
+// firstTimeField returns the index of the first time field of frame, or -1 if it has none.
+func firstTimeField(frame *data.Frame) int {
+	for i, field := range frame.Fields {
+		if field.Type() == data.FieldTypeNullableTime {
+			return i
+		}
 	}
 
-	newDataFrames := make([]*data.Frame, 0, len(groupedDataFrames))
-	for _, dataFrame := range groupedDataFrames {
-		newDataFrames = append(newDataFrames, dataFrame)
+	return -1
+}
+
+// rowKey returns a key identifying the values of a row of frame, used to find duplicate rows. Log events are told
+// apart by their hidden @ptr field, if the query returns it.
+func rowKey(frame *data.Frame, row int) string {
+	var key strings.Builder
+	for i := range frame.Fields {
+		if value, ok := frame.ConcreteAt(i, row); ok {
+			fmt.Fprintf(&key, "=%v", value)
+		} else {
+			key.WriteString("null")
+		}
+		key.WriteByte(0)
 	}
 
-	return newDataFrames, nil
+	return key.String()
+}
+
+// binFieldPattern matches the name of the field holding the time buckets of stats queries grouping by bin().
+var binFieldPattern = regexp.MustCompile(`^bin\(.+\)$`)
+
+// logsTimeSeriesFrame returns the results of a stats query grouping by time buckets with bin() as a wide frame, with
+// the buckets as time field and a numeric field per statistic and group, so that they can be graphed directly. The
+// groups are the statsGroups other than the bin, or the string fields if there are none. False is returned for the
+// results of other queries.
+func logsTimeSeriesFrame(frame *data.Frame, statsGroups []string) (*data.Frame, bool) {
+	timeIndex := -1
+	for i, field := range frame.Fields {
+		if binFieldPattern.MatchString(field.Name) && field.Type() == data.FieldTypeNullableTime {
+			timeIndex = i
+			break
+		}
+	}
+	if timeIndex < 0 {
+		return nil, false
+	}
+
+	isGroup := make(map[string]bool, len(statsGroups))
+	for _, name := range statsGroups {
+		isGroup[name] = true
+	}
+	var groupIndices, valueIndices []int
+	for i, field := range frame.Fields {
+		switch {
+		case i == timeIndex:
+		case isGroup[field.Name] || (len(statsGroups) == 0 && field.Type() == data.FieldTypeNullableString):
+			groupIndices = append(groupIndices, i)
+		case field.Type() == data.FieldTypeNullableFloat64:
+			valueIndices = append(valueIndices, i)
+		}
+	}
+
+	// Rows are indexed by bucket, and series by group and statistic, both in order
+	timeField := frame.Fields[timeIndex]
+	rowsByTime := make(map[time.Time]int)
+	times := make([]time.Time, 0)
+	for row := 0; row < timeField.Len(); row++ {
+		if t, ok := timeField.At(row).(*time.Time); ok && t != nil {
+			if _, exists := rowsByTime[*t]; !exists {
+				rowsByTime[*t] = 0
+				times = append(times, *t)
+			}
+		}
+	}
+	sort.Slice(times, func(i, j int) bool {
+		return times[i].Before(times[j])
+	})
+	for i, t := range times {
+		rowsByTime[t] = i
+	}
+
+	type series struct {
+		name   string
+		labels data.Labels
+		values []*float64
+	}
+	seriesByKey := make(map[string]*series)
+	keys := make([]string, 0)
+	for row := 0; row < timeField.Len(); row++ {
+		t, ok := timeField.At(row).(*time.Time)
+		if !ok || t == nil {
+			continue
+		}
+
+		labels := data.Labels{}
+		for _, i := range groupIndices {
+			if value, ok := frame.ConcreteAt(i, row); ok {
+				labels[frame.Fields[i].Name] = fmt.Sprintf("%v", value)
+			}
+		}
+		for _, i := range valueIndices {
+			name := frame.Fields[i].Name
+			key := labels.String() + "\x00" + name
+			s, exists := seriesByKey[key]
+			if !exists {
+				s = &series{name: name, labels: labels, values: make([]*float64, len(times))}
+				seriesByKey[key] = s
+				keys = append(keys, key)
+			}
+			if value, ok := frame.Fields[i].At(row).(*float64); ok {
+				s.values[rowsByTime[*t]] = value
+			}
+		}
+	}
+	sort.Strings(keys)
+
+	fields := make([]*data.Field, 0, len(keys)+1)
+	fields = append(fields, data.NewField(timeField.Name, nil, times))
+	for _, key := range keys {
+		s := seriesByKey[key]
+		fields = append(fields, data.NewField(s.name, s.labels, s.values))
+	}
+
+	meta := data.FrameMeta{}
+	if frame.Meta != nil {
+		meta = *frame.Meta
+	}
+	meta.PreferredVisualization = "graph"
+
+	wideFrame := data.NewFrame(frame.Name, fields...)
+	wideFrame.RefID = frame.RefID
+	wideFrame.Meta = &meta
+
+	return wideFrame, true
 }
 
 func generateGroupKey(fields []*data.Field, row int) string {
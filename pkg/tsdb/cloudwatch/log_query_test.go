@@ -127,7 +127,7 @@ func TestLogsResultsToDataframes(t *testing.T) {
 		},
 	}
 
-	dataframes, err := logsResultsToDataframes(fakeCloudwatchResponse)
+	dataframes, err := logsResultsToDataframes(fakeCloudwatchResponse, false)
 	require.NoError(t, err)
 	timeA, err := time.Parse("2006-01-02 15:04:05.000", "2020-03-02 15:04:05.000")
 	require.NoError(t, err)
@@ -181,9 +181,21 @@ func TestLogsResultsToDataframes(t *testing.T) {
 		},
 	})
 
+	hiddenPtrField := data.NewField("@ptr", nil, []*string{
+		aws.String("fake ptr"),
+		aws.String("fake ptr"),
+		aws.String("fake ptr"),
+	})
+	hiddenPtrField.SetConfig(&data.FieldConfig{
+		Custom: map[string]interface{}{
+			"hidden": true,
+		},
+	})
+
 	expectedDataframe := &data.Frame{
 		Name: "CloudWatchLogsResponse",
 		Fields: []*data.Field{
+			hiddenPtrField,
 			timeField,
 			lineField,
 			logStreamField,
@@ -221,6 +233,126 @@ func TestLogsResultsToDataframes(t *testing.T) {
 	assert.ElementsMatch(t, expectedDataframe.Fields, dataframes.Fields)
 }
 
+func TestLogsResultsToDataframes_FieldTypes(t *testing.T) {
+	newRow := func(values ...string) []*cloudwatchlogs.ResultField {
+		row := make([]*cloudwatchlogs.ResultField, 0, len(values)/2)
+		for i := 0; i < len(values); i += 2 {
+			row = append(row, &cloudwatchlogs.ResultField{
+				Field: aws.String(values[i]),
+				Value: aws.String(values[i+1]),
+			})
+		}
+		return row
+	}
+	frame, err := logsResultsToDataframes(&cloudwatchlogs.GetQueryResultsOutput{
+		Results: [][]*cloudwatchlogs.ResultField{
+			newRow("@timestamp", "2020-03-02 15:04:05.000", "count", "12", "avgLatency", "3.5", "status", "200",
+				"bin(5m)", "2020-03-02 15:00:00.000"),
+			newRow("@timestamp", "2020-03-02 16:04:05.000", "count", "7", "avgLatency", "", "status", "timeout",
+				"bin(5m)", "2020-03-02 16:00:00.000"),
+			newRow("@timestamp", "2020-03-02 17:04:05.000", "count", "1e3", "status", "503",
+				"bin(5m)", "not a time"),
+		},
+	}, false)
+	require.NoError(t, err)
+
+	fields := make(map[string]*data.Field, len(frame.Fields))
+	fieldTypes := make(map[string]data.FieldType, len(frame.Fields))
+	for _, field := range frame.Fields {
+		fields[field.Name] = field
+		fieldTypes[field.Name] = field.Type()
+	}
+
+	t.Run("Timestamps are time fields", func(t *testing.T) {
+		assert.Equal(t, data.FieldTypeNullableTime, fieldTypes["@timestamp"])
+		timeField := fields["@timestamp"]
+		assert.Equal(t, time.Date(2020, 3, 2, 16, 4, 5, 0, time.UTC), *timeField.At(1).(*time.Time))
+	})
+
+	t.Run("Numeric stats are float fields", func(t *testing.T) {
+		assert.Equal(t, data.FieldTypeNullableFloat64, fieldTypes["count"])
+		countField := fields["count"]
+		assert.Equal(t, []float64{12, 7, 1000}, []float64{
+			*countField.At(0).(*float64), *countField.At(1).(*float64), *countField.At(2).(*float64),
+		})
+	})
+
+	t.Run("Missing and empty values are null", func(t *testing.T) {
+		assert.Equal(t, data.FieldTypeNullableFloat64, fieldTypes["avgLatency"])
+		latencyField := fields["avgLatency"]
+		assert.Equal(t, 3.5, *latencyField.At(0).(*float64))
+		assert.Nil(t, latencyField.At(1))
+		assert.Nil(t, latencyField.At(2))
+	})
+
+	t.Run("Fields with values of several types are string fields", func(t *testing.T) {
+		assert.Equal(t, data.FieldTypeNullableString, fieldTypes["status"])
+		statusField := fields["status"]
+		assert.Equal(t, "200", *statusField.At(0).(*string))
+		assert.Equal(t, "timeout", *statusField.At(1).(*string))
+
+		assert.Equal(t, data.FieldTypeNullableString, fieldTypes["bin(5m)"])
+	})
+}
+
+func TestLogsResultsToDataframes_ExpandJSONMessage(t *testing.T) {
+	newRow := func(timestamp, message string) []*cloudwatchlogs.ResultField {
+		return []*cloudwatchlogs.ResultField{
+			{
+				Field: aws.String("@timestamp"),
+				Value: aws.String(timestamp),
+			},
+			{
+				Field: aws.String("@message"),
+				Value: aws.String(message),
+			},
+		}
+	}
+	response := &cloudwatchlogs.GetQueryResultsOutput{
+		Results: [][]*cloudwatchlogs.ResultField{
+			newRow("2020-03-02 15:04:05.000", `{"level": "error", "latency": 12.5, "tags": ["a", "b"], "@timestamp": "x"}`),
+			newRow("2020-03-02 16:04:05.000", "plain text message"),
+			newRow("2020-03-02 17:04:05.000", `{"level": "info", "latency": 3, "user": {"id": 7}}`),
+			newRow("2020-03-02 18:04:05.000", `{not json`),
+		},
+	}
+
+	t.Run("Messages are kept as is when disabled", func(t *testing.T) {
+		frame, err := logsResultsToDataframes(response, false)
+		require.NoError(t, err)
+
+		names := []string{}
+		for _, field := range frame.Fields {
+			names = append(names, field.Name)
+		}
+		assert.Equal(t, []string{"@timestamp", "@message"}, names)
+	})
+
+	t.Run("Top-level keys of JSON messages are added as fields", func(t *testing.T) {
+		frame, err := logsResultsToDataframes(response, true)
+		require.NoError(t, err)
+
+		names := []string{}
+		for _, field := range frame.Fields {
+			names = append(names, field.Name)
+		}
+		assert.Equal(t, []string{"@timestamp", "@message", "latency", "level", "tags", "user"}, names)
+
+		assert.Equal(t, data.NewField("@message", nil, []*string{
+			aws.String(`{"level": "error", "latency": 12.5, "tags": ["a", "b"], "@timestamp": "x"}`),
+			aws.String("plain text message"),
+			aws.String(`{"level": "info", "latency": 3, "user": {"id": 7}}`),
+			aws.String(`{not json`),
+		}), frame.Fields[1])
+		assert.Equal(t, data.NewField("latency", nil, []*float64{aws.Float64(12.5), nil, aws.Float64(3), nil}),
+			frame.Fields[2])
+		assert.Equal(t, data.NewField("level", nil, []*string{aws.String("error"), nil, aws.String("info"), nil}),
+			frame.Fields[3])
+		assert.Equal(t, data.NewField("tags", nil, []*string{aws.String(`["a","b"]`), nil, nil, nil}), frame.Fields[4])
+		assert.Equal(t, data.NewField("user", nil, []*string{nil, nil, aws.String(`{"id":7}`), nil}), frame.Fields[5])
+	})
+}
+
 func TestGroupKeyGeneration(t *testing.T) {
 	logField := data.NewField("@log", data.Labels{}, []*string{
 		aws.String("fakelog-a"),
@@ -361,11 +493,94 @@ func TestGroupingResults(t *testing.T) {
 		},
 	}
 
-	groupedResults, err := groupResults(fakeDataFrame, []string{"@log"})
+	groupedResults, err := groupResults(fakeDataFrame, []string{"@log"}, false)
 	require.NoError(t, err)
 	assert.ElementsMatch(t, expectedGroupedFrames, groupedResults)
 }
 
+func TestGroupingResults_OverlappingRows(t *testing.T) {
+	timeA, err := time.Parse("2006-01-02 15:04:05.000", "2020-03-02 15:04:05.000")
+	require.NoError(t, err)
+	timeB, err := time.Parse("2006-01-02 15:04:05.000", "2020-03-02 16:04:05.000")
+	require.NoError(t, err)
+	timeC, err := time.Parse("2006-01-02 15:04:05.000", "2020-03-02 17:04:05.000")
+	require.NoError(t, err)
+
+	// Out of order, with rows returned twice and different rows of the same group and time
+	fakeDataFrame := &data.Frame{
+		Name: "CloudWatchLogsResponse",
+		Fields: []*data.Field{
+			data.NewField("@timestamp", data.Labels{}, []*time.Time{
+				&timeC, &timeA, &timeB, &timeC, &timeA, &timeB, &timeA, &timeB,
+			}),
+			data.NewField("@log", data.Labels{}, []*string{
+				aws.String("fakelog-b"),
+				aws.String("fakelog-a"),
+				aws.String("fakelog-b"),
+				aws.String("fakelog-b"),
+				aws.String("fakelog-b"),
+				aws.String("fakelog-a"),
+				aws.String("fakelog-a"),
+				aws.String("fakelog-b"),
+			}),
+			data.NewField("count", data.Labels{}, []*string{
+				aws.String("3"),
+				aws.String("10"),
+				aws.String("2"),
+				aws.String("3"),
+				aws.String("1"),
+				aws.String("20"),
+				aws.String("10"),
+				aws.String("5"),
+			}),
+		},
+	}
+
+	groupFrame := func(name string, times []*time.Time, counts ...string) *data.Frame {
+		logs := make([]*string, 0, len(counts))
+		for range counts {
+			logs = append(logs, aws.String(name))
+		}
+		return &data.Frame{
+			Name: name,
+			Fields: []*data.Field{
+				data.NewField("@timestamp", data.Labels{}, times),
+				data.NewField("@log", data.Labels{}, logs),
+				data.NewField("count", data.Labels{}, aws.StringSlice(counts)),
+			},
+		}
+	}
+
+	testCases := map[string]struct {
+		descending bool
+		expected   []*data.Frame
+	}{
+		"Rows are sorted oldest first": {
+			expected: []*data.Frame{
+				groupFrame("fakelog-a", []*time.Time{&timeA, &timeB}, "10", "20"),
+				groupFrame("fakelog-b", []*time.Time{&timeA, &timeB, &timeB, &timeC}, "1", "2", "5", "3"),
+			},
+		},
+		"Rows are sorted newest first": {
+			descending: true,
+			expected: []*data.Frame{
+				groupFrame("fakelog-a", []*time.Time{&timeB, &timeA}, "20", "10"),
+				groupFrame("fakelog-b", []*time.Time{&timeC, &timeB, &timeB, &timeA}, "3", "2", "5", "1"),
+			},
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			// Grouping the same results several times gives the same frames, in the same order
+			for i := 0; i < 10; i++ {
+				groupedResults, err := groupResults(fakeDataFrame, []string{"@log"}, tc.descending)
+				require.NoError(t, err)
+				assert.Equal(t, tc.expected, groupedResults)
+			}
+		})
+	}
+}
+
 func TestGroupingResultsWithNumericField(t *testing.T) {
 	timeA, err := time.Parse("2006-01-02 15:04:05.000", "2020-03-02 15:04:05.000")
 	require.NoError(t, err)
@@ -482,7 +697,74 @@ func TestGroupingResultsWithNumericField(t *testing.T) {
 		},
 	}
 
-	groupedResults, err := groupResults(fakeDataFrame, []string{"httpresponse"})
+	groupedResults, err := groupResults(fakeDataFrame, []string{"httpresponse"}, false)
 	require.NoError(t, err)
 	assert.ElementsMatch(t, expectedGroupedFrames, groupedResults)
 }
+
+func TestLogsTimeSeriesFrame(t *testing.T) {
+	resultRow := func(fields ...string) []*cloudwatchlogs.ResultField {
+		row := make([]*cloudwatchlogs.ResultField, 0, len(fields)/2)
+		for i := 0; i < len(fields); i += 2 {
+			row = append(row, &cloudwatchlogs.ResultField{Field: aws.String(fields[i]), Value: aws.String(fields[i+1])})
+		}
+		return row
+	}
+	bucketA := time.Date(2020, 3, 20, 10, 35, 0, 0, time.UTC)
+	bucketB := time.Date(2020, 3, 20, 10, 40, 0, 0, time.UTC)
+
+	t.Run("Results of stats by bin() are a wide frame", func(t *testing.T) {
+		frame, err := logsResultsToDataframes(&cloudwatchlogs.GetQueryResultsOutput{
+			Results: [][]*cloudwatchlogs.ResultField{
+				resultRow("bin(5m)", "2020-03-20 10:40:00.000", "level", "error", "count(*)", "3"),
+				resultRow("bin(5m)", "2020-03-20 10:35:00.000", "level", "error", "count(*)", "5"),
+				resultRow("bin(5m)", "2020-03-20 10:35:00.000", "level", "warning", "count(*)", "12"),
+			},
+			Status: aws.String("Complete"),
+		}, false)
+		require.NoError(t, err)
+
+		wideFrame, ok := logsTimeSeriesFrame(frame, []string{"bin(5m)", "level"})
+		require.True(t, ok)
+
+		assert.Equal(t, data.NewFrame("CloudWatchLogsResponse",
+			data.NewField("bin(5m)", nil, []time.Time{bucketA, bucketB}),
+			data.NewField("count(*)", data.Labels{"level": "error"}, []*float64{aws.Float64(5), aws.Float64(3)}),
+			data.NewField("count(*)", data.Labels{"level": "warning"}, []*float64{aws.Float64(12), nil}),
+		).SetMeta(&data.FrameMeta{
+			Custom:                 map[string]interface{}{"Status": "Complete"},
+			PreferredVisualization: "graph",
+		}), wideFrame)
+	})
+
+	t.Run("Without stats groups string fields are the groups", func(t *testing.T) {
+		frame, err := logsResultsToDataframes(&cloudwatchlogs.GetQueryResultsOutput{
+			Results: [][]*cloudwatchlogs.ResultField{
+				resultRow("bin(5m)", "2020-03-20 10:35:00.000", "count(*)", "5", "avg(duration)", "1.5"),
+				resultRow("bin(5m)", "2020-03-20 10:40:00.000", "count(*)", "3", "avg(duration)", "2"),
+			},
+		}, false)
+		require.NoError(t, err)
+
+		wideFrame, ok := logsTimeSeriesFrame(frame, nil)
+		require.True(t, ok)
+
+		assert.Equal(t, []*data.Field{
+			data.NewField("bin(5m)", nil, []time.Time{bucketA, bucketB}),
+			data.NewField("avg(duration)", data.Labels{}, []*float64{aws.Float64(1.5), aws.Float64(2)}),
+			data.NewField("count(*)", data.Labels{}, []*float64{aws.Float64(5), aws.Float64(3)}),
+		}, wideFrame.Fields)
+	})
+
+	t.Run("Results of other queries are kept as is", func(t *testing.T) {
+		frame, err := logsResultsToDataframes(&cloudwatchlogs.GetQueryResultsOutput{
+			Results: [][]*cloudwatchlogs.ResultField{
+				resultRow("@timestamp", "2020-03-20 10:35:00.000", "level", "error", "count(*)", "5"),
+			},
+		}, false)
+		require.NoError(t, err)
+
+		_, ok := logsTimeSeriesFrame(frame, []string{"level"})
+		assert.False(t, ok)
+	})
+}
@@ -0,0 +1,97 @@
+package cloudwatch
+
+import (
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+)
+
+// The AWS SDK version in use predates parameters CloudWatch Logs has gained since, such as the query language of
+// StartQuery or the class of log groups, so the inputs and outputs of these operations are declared here, with the
+// same shapes and tags as the SDK would generate. Requests are still made with the operations of the SDK's client,
+// which withShapes makes send these inputs and unmarshal these outputs instead of the SDK's own.
+
+type startQueryInput struct {
+	_ struct{} `type:"structure"`
+
+	EndTime             *int64    `locationName:"endTime" type:"long" required:"true"`
+	Limit               *int64    `locationName:"limit" min:"1" type:"integer"`
+	LogGroupIdentifiers []*string `locationName:"logGroupIdentifiers" type:"list"`
+	LogGroupName        *string   `locationName:"logGroupName" min:"1" type:"string"`
+	LogGroupNames       []*string `locationName:"logGroupNames" type:"list"`
+	QueryLanguage       *string   `locationName:"queryLanguage" type:"string" enum:"QueryLanguage"`
+	QueryString         *string   `locationName:"queryString" type:"string" required:"true"`
+	StartTime           *int64    `locationName:"startTime" type:"long" required:"true"`
+}
+
+// sdkInput returns the parameters of the input the AWS SDK knows about, which its StartQuery operation is called
+// with.
+func (s *startQueryInput) sdkInput() *cloudwatchlogs.StartQueryInput {
+	return &cloudwatchlogs.StartQueryInput{
+		EndTime:       s.EndTime,
+		Limit:         s.Limit,
+		LogGroupName:  s.LogGroupName,
+		LogGroupNames: s.LogGroupNames,
+		QueryString:   s.QueryString,
+		StartTime:     s.StartTime,
+	}
+}
+
+// Validate validates the input like the AWS SDK does before sending the request.
+func (s *startQueryInput) Validate() error {
+	return s.sdkInput().Validate()
+}
+
+type describeLogGroupsInput struct {
+	_ struct{} `type:"structure"`
+
+	Limit              *int64  `locationName:"limit" min:"1" type:"integer"`
+	LogGroupClass      *string `locationName:"logGroupClass" type:"string" enum:"LogGroupClass"`
+	LogGroupNamePrefix *string `locationName:"logGroupNamePrefix" min:"1" type:"string"`
+	NextToken          *string `locationName:"nextToken" min:"1" type:"string"`
+}
+
+// sdkInput returns the parameters of the input the AWS SDK knows about, which its DescribeLogGroups operation is
+// called with.
+func (s *describeLogGroupsInput) sdkInput() *cloudwatchlogs.DescribeLogGroupsInput {
+	return &cloudwatchlogs.DescribeLogGroupsInput{
+		Limit:              s.Limit,
+		LogGroupNamePrefix: s.LogGroupNamePrefix,
+		NextToken:          s.NextToken,
+	}
+}
+
+// Validate validates the input like the AWS SDK does before sending the request.
+func (s *describeLogGroupsInput) Validate() error {
+	return s.sdkInput().Validate()
+}
+
+type describeLogGroupsOutput struct {
+	_ struct{} `type:"structure"`
+
+	LogGroups []*logGroup `locationName:"logGroups" type:"list"`
+	NextToken *string     `locationName:"nextToken" min:"1" type:"string"`
+}
+
+type logGroup struct {
+	_ struct{} `type:"structure"`
+
+	Arn               *string `locationName:"arn" type:"string"`
+	CreationTime      *int64  `locationName:"creationTime" type:"long"`
+	KmsKeyId          *string `locationName:"kmsKeyId" type:"string"`
+	LogGroupClass     *string `locationName:"logGroupClass" type:"string" enum:"LogGroupClass"`
+	LogGroupName      *string `locationName:"logGroupName" min:"1" type:"string"`
+	MetricFilterCount *int64  `locationName:"metricFilterCount" type:"integer"`
+	RetentionInDays   *int64  `locationName:"retentionInDays" type:"integer"`
+	StoredBytes       *int64  `locationName:"storedBytes" type:"long"`
+}
+
+// withShapes makes a request of the AWS SDK send input rather than the params it was created with, and unmarshal
+// its response into output, unless it's nil. The SDK's own output is then left empty.
+func withShapes(input interface{}, output interface{}) request.Option {
+	return func(r *request.Request) {
+		r.Params = input
+		if output != nil {
+			r.Data = output
+		}
+	}
+}
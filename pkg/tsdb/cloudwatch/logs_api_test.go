@@ -0,0 +1,167 @@
+package cloudwatch
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/grafana/grafana/pkg/components/simplejson"
+	"github.com/grafana/grafana/pkg/tsdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newLogsAPIServer returns an executor whose CloudWatch Logs requests are sent to a server answering with response,
+// and the function returning the target and body of the last request it received.
+func newLogsAPIServer(t *testing.T, response string) (*cloudWatchExecutor, func() (string, map[string]interface{})) {
+	t.Helper()
+	t.Cleanup(func() {
+		sessCache = map[string]envelope{}
+	})
+
+	var target string
+	var body map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		target = r.Header.Get("X-Amz-Target")
+		b, err := ioutil.ReadAll(r.Body)
+		require.NoError(t, err)
+		body = nil
+		require.NoError(t, json.Unmarshal(b, &body))
+
+		w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+		_, err = w.Write([]byte(response))
+		require.NoError(t, err)
+	}))
+	t.Cleanup(server.Close)
+
+	ds := fakeDataSource(fakeDataSourceCfg{
+		accessKey: "AKIAFAKEACCESSKEY",
+		secretKey: "fake-secret-key",
+	})
+	ds.JsonData.Set("endpoint", server.URL)
+	e := newExecutor(nil)
+	e.DataSource = ds
+
+	return e, func() (string, map[string]interface{}) {
+		return target, body
+	}
+}
+
+func TestStartQuery_SentParameters(t *testing.T) {
+	const queryID = "sent-parameters-query"
+	t.Cleanup(func() {
+		releaseLogsQuerySlot(queryID)
+	})
+	e, lastRequest := newLogsAPIServer(t, `{"queryId": "`+queryID+`"}`)
+
+	_, err := e.Query(context.Background(), e.DataSource, &tsdb.TsdbQuery{
+		TimeRange: &tsdb.TimeRange{
+			From: "1584700643000",
+			To:   "1584873443000",
+		},
+		Queries: []*tsdb.Query{
+			{
+				RefId: "A",
+				Model: simplejson.NewFromAny(map[string]interface{}{
+					"type":          "logAction",
+					"subtype":       "StartQuery",
+					"region":        "us-east-1",
+					"logGroupNames": []interface{}{"/ecs/web"},
+					"queryLanguage": "SQL",
+					"queryString":   "SELECT `@message` FROM `/ecs/web`",
+					"limit":         10,
+				}),
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	target, body := lastRequest()
+	assert.Equal(t, "Logs_20140328.StartQuery", target)
+	assert.Equal(t, map[string]interface{}{
+		"startTime":     1584700643.0,
+		"endTime":       1584873443.0,
+		"limit":         10.0,
+		"logGroupNames": []interface{}{"/ecs/web"},
+		"queryLanguage": "SQL",
+		"queryString":   "SELECT `@message` FROM `/ecs/web`",
+	}, body)
+}
+
+func TestStartQuery_SentLogGroupIdentifiers(t *testing.T) {
+	const queryID = "sent-log-group-identifiers-query"
+	t.Cleanup(func() {
+		releaseLogsQuerySlot(queryID)
+	})
+	e, lastRequest := newLogsAPIServer(t, `{"queryId": "`+queryID+`"}`)
+
+	_, err := e.Query(context.Background(), e.DataSource, &tsdb.TsdbQuery{
+		TimeRange: &tsdb.TimeRange{
+			From: "1584700643000",
+			To:   "1584873443000",
+		},
+		Queries: []*tsdb.Query{
+			{
+				RefId: "A",
+				Model: simplejson.NewFromAny(map[string]interface{}{
+					"type":    "logAction",
+					"subtype": "StartQuery",
+					"region":  "us-east-1",
+					"logGroupNames": []interface{}{
+						"/ecs/web",
+						"arn:aws:logs:us-east-1:210987654321:log-group:/aws/lambda/api:*",
+					},
+					"queryString": "fields @message",
+				}),
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	target, body := lastRequest()
+	assert.Equal(t, "Logs_20140328.StartQuery", target)
+	assert.Equal(t, []interface{}{"/ecs/web", "arn:aws:logs:us-east-1:210987654321:log-group:/aws/lambda/api"},
+		body["logGroupIdentifiers"])
+	assert.NotContains(t, body, "logGroupNames")
+}
+
+func TestDescribeLogGroups_SentParameters(t *testing.T) {
+	e, lastRequest := newLogsAPIServer(t, `{"logGroups": [
+		{"logGroupName": "/archive/a", "logGroupClass": "INFREQUENT_ACCESS", "storedBytes": 1024},
+		{"logGroupName": "/archive/b", "logGroupClass": "INFREQUENT_ACCESS"}
+	]}`)
+
+	resp, err := e.Query(context.Background(), e.DataSource, &tsdb.TsdbQuery{
+		Queries: []*tsdb.Query{
+			{
+				Model: simplejson.NewFromAny(map[string]interface{}{
+					"type":               "logAction",
+					"subtype":            "DescribeLogGroups",
+					"region":             "us-east-1",
+					"logGroupNamePrefix": "/archive",
+					"logGroupClass":      "INFREQUENT_ACCESS",
+				}),
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	target, body := lastRequest()
+	assert.Equal(t, "Logs_20140328.DescribeLogGroups", target)
+	assert.Equal(t, map[string]interface{}{
+		"limit":              50.0,
+		"logGroupNamePrefix": "/archive",
+		"logGroupClass":      "INFREQUENT_ACCESS",
+	}, body)
+
+	frames, err := resp.Results[""].Dataframes.Decoded()
+	require.NoError(t, err)
+	require.Len(t, frames, 1)
+	require.Len(t, frames[0].Fields, 2)
+	assert.Equal(t, aws.String("/archive/b"), frames[0].Fields[0].At(1))
+	assert.Equal(t, aws.String("INFREQUENT_ACCESS"), frames[0].Fields[1].At(1))
+}
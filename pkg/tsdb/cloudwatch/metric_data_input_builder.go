@@ -1,6 +1,7 @@
 package cloudwatch
 
 import (
+	"fmt"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
@@ -9,11 +10,18 @@ import (
 
 func (e *cloudWatchExecutor) buildMetricDataInput(startTime time.Time, endTime time.Time,
 	queries map[string]*cloudWatchQuery) (*cloudwatch.GetMetricDataInput, error) {
+	startTime, endTime = snapTimeRange(startTime, endTime, queries)
 	metricDataInput := &cloudwatch.GetMetricDataInput{
 		StartTime: aws.Time(startTime),
 		EndTime:   aws.Time(endTime),
 		ScanBy:    aws.String("TimestampAscending"),
 	}
+	if timezone := labelTimezone(startTime, queries); timezone != "" {
+		metricDataInput.LabelOptions = &cloudwatch.LabelOptions{Timezone: aws.String(timezone)}
+	}
+	if maxDataPoints := minMaxDataPoints(queries); maxDataPoints > 0 {
+		metricDataInput.MaxDatapoints = aws.Int64(maxDataPoints)
+	}
 	for _, query := range queries {
 		metricDataQuery, err := e.buildMetricDataQuery(query)
 		if err != nil {
@@ -24,3 +32,108 @@ func (e *cloudWatchExecutor) buildMetricDataInput(startTime time.Time, endTime t
 
 	return metricDataInput, nil
 }
+
+// excludeInvalidQueries removes the queries whose MetricDataQuery can't be built from queries, along with the
+// other queries of their RefID, and returns their errors by RefID. This way an invalid query doesn't fail the
+// GetMetricData request it shares with the other queries of its region.
+func (e *cloudWatchExecutor) excludeInvalidQueries(queries map[string]*cloudWatchQuery) map[string]error {
+	queryErrors := make(map[string]error)
+	for _, query := range queries {
+		if _, err := e.buildMetricDataQuery(query); err != nil {
+			queryErrors[query.RefId] = &queryError{err, query.RefId}
+		}
+	}
+	for id, query := range queries {
+		if _, invalid := queryErrors[query.RefId]; invalid {
+			delete(queries, id)
+		}
+	}
+
+	return queryErrors
+}
+
+// withoutRefIDs returns the request queries whose RefID isn't a key of refIDs.
+func withoutRefIDs(requestQueries []*requestQuery, refIDs map[string]error) []*requestQuery {
+	result := make([]*requestQuery, 0, len(requestQueries))
+	for _, query := range requestQueries {
+		if _, exists := refIDs[query.RefId]; !exists {
+			result = append(result, query)
+		}
+	}
+
+	return result
+}
+
+// minMaxDataPoints returns the smallest positive max data points of the queries, since they share a single
+// GetMetricData request, or 0 if none of them has one.
+func minMaxDataPoints(queries map[string]*cloudWatchQuery) int64 {
+	var result int64
+	for _, query := range queries {
+		if query.MaxDataPoints > 0 && (result == 0 || query.MaxDataPoints < result) {
+			result = query.MaxDataPoints
+		}
+	}
+
+	return result
+}
+
+// snapTimeRange widens the time range so that it starts and ends on period boundaries in the timezone of
+// the queries that have one set. CloudWatch aligns the periods to the start time, so this makes e.g. daily
+// periods start at midnight in the query's timezone instead of at midnight UTC. GetMetricData's LabelOptions
+// only change the timezone of the labels, not how the periods are aligned.
+func snapTimeRange(startTime time.Time, endTime time.Time, queries map[string]*cloudWatchQuery) (time.Time, time.Time) {
+	snappedStart, snappedEnd := startTime, endTime
+	for _, query := range queries {
+		if query.Timezone == nil || query.Period <= 0 {
+			continue
+		}
+
+		period := time.Duration(query.Period) * time.Second
+		start := snapToPeriod(startTime, period, query.Timezone)
+		end := snapToPeriod(endTime, period, query.Timezone)
+		if end.Before(endTime) {
+			end = end.Add(period)
+		}
+
+		if start.Before(snappedStart) {
+			snappedStart = start
+		}
+		if end.After(snappedEnd) {
+			snappedEnd = end
+		}
+	}
+
+	return snappedStart, snappedEnd
+}
+
+// labelTimezone returns the timezone of the queries formatted as an offset like "+0130", the way GetMetricData's
+// LabelOptions expect it, taking the offset at startTime for time zones with daylight saving time. The queries
+// share a single GetMetricData request, so no timezone is returned if theirs differ or none of them has one.
+func labelTimezone(startTime time.Time, queries map[string]*cloudWatchQuery) string {
+	timezone := ""
+	for _, query := range queries {
+		if query.Timezone == nil {
+			continue
+		}
+
+		_, offset := startTime.In(query.Timezone).Zone()
+		sign := '+'
+		if offset < 0 {
+			sign, offset = '-', -offset
+		}
+		queryTimezone := fmt.Sprintf("%c%02d%02d", sign, offset/3600, offset%3600/60)
+		if timezone != "" && timezone != queryTimezone {
+			return ""
+		}
+		timezone = queryTimezone
+	}
+
+	return timezone
+}
+
+// snapToPeriod rounds t down to the closest period boundary in the given location.
+func snapToPeriod(t time.Time, period time.Duration, location *time.Location) time.Time {
+	_, offset := t.In(location).Zone()
+	shift := time.Duration(offset) * time.Second
+	return t.Add(shift).Truncate(period).Add(-shift)
+}
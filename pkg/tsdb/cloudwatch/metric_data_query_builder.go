@@ -2,6 +2,7 @@ package cloudwatch
 
 import (
 	"fmt"
+	"regexp"
 	"sort"
 	"strconv"
 	"strings"
@@ -16,11 +17,20 @@ func (e *cloudWatchExecutor) buildMetricDataQuery(query *cloudWatchQuery) (*clou
 		ReturnData: aws.Bool(query.ReturnData),
 	}
 
-	if query.Expression != "" {
+	if query.isMetricsInsightsQuery() {
+		// Metrics Insights queries are sent as expressions, which need the period set on the query itself
+		mdq.Expression = aws.String(query.SqlExpression)
+		mdq.Period = aws.Int64(int64(query.Period))
+	} else if query.Expression != "" {
 		mdq.Expression = aws.String(query.Expression)
 	} else {
+		stat, err := validateStatistic(query.Stats)
+		if err != nil {
+			return nil, err
+		}
+
 		if query.isSearchExpression() {
-			mdq.Expression = aws.String(buildSearchExpression(query, query.Stats))
+			mdq.Expression = aws.String(buildSearchExpression(query, stat))
 		} else {
 			mdq.MetricStat = &cloudwatch.MetricStat{
 				Metric: &cloudwatch.Metric{
@@ -37,7 +47,10 @@ func (e *cloudWatchExecutor) buildMetricDataQuery(query *cloudWatchQuery) (*clou
 						Value: aws.String(values[0]),
 					})
 			}
-			mdq.MetricStat.Stat = aws.String(query.Stats)
+			mdq.MetricStat.Stat = aws.String(stat)
+			if query.Unit != "" {
+				mdq.MetricStat.Unit = aws.String(query.Unit)
+			}
 		}
 	}
 
@@ -50,6 +63,89 @@ func (e *cloudWatchExecutor) buildMetricDataQuery(query *cloudWatchQuery) (*clou
 	return mdq, nil
 }
 
+var (
+	percentileStatistic = regexp.MustCompile(`^[pP](\d+(?:\.\d+)?)$`)
+	// Trimmed mean, winsorized mean, trimmed count and trimmed sum with a single upper percentile, e.g. tm90
+	shortTrimmedStatistic = regexp.MustCompile(`(?i)^(tm|wm|tc|ts)(\d+(?:\.\d+)?)$`)
+	// The same statistics and percentile rank with a range of percentages or absolute values, e.g. TM(10%:90%)
+	rangeTrimmedStatistic = regexp.MustCompile(`(?i)^(tm|wm|tc|ts|pr)\((\d+(?:\.\d+)?%?)?:(\d+(?:\.\d+)?%?)?\)$`)
+)
+
+func isStandardStatistic(stat string) bool {
+	switch stat {
+	case "Average", "Sum", "Minimum", "Maximum", "SampleCount":
+		return true
+	default:
+		return false
+	}
+}
+
+// validateStatistic checks that a statistic is either a standard one or an extended statistic CloudWatch accepts,
+// so that malformed statistics fail with a clear error before GetMetricData is called. The statistic is returned
+// in its normalized form, e.g. " P95 " becomes p95 and tm(10%:90%) becomes TM(10%:90%).
+func validateStatistic(stat string) (string, error) {
+	stat = strings.TrimSpace(stat)
+	if isStandardStatistic(stat) {
+		return stat, nil
+	}
+
+	// The interquartile mean, the same as TM(25%:75%)
+	if strings.EqualFold(stat, "IQM") {
+		return "IQM", nil
+	}
+
+	if matches := percentileStatistic.FindStringSubmatch(stat); matches != nil {
+		if err := validatePercentage(matches[1]); err != nil {
+			return "", fmt.Errorf("invalid statistic %q: %w", stat, err)
+		}
+		return "p" + matches[1], nil
+	}
+
+	if matches := shortTrimmedStatistic.FindStringSubmatch(stat); matches != nil {
+		if err := validatePercentage(matches[2]); err != nil {
+			return "", fmt.Errorf("invalid statistic %q: %w", stat, err)
+		}
+		return strings.ToLower(matches[1]) + matches[2], nil
+	}
+
+	if matches := rangeTrimmedStatistic.FindStringSubmatch(stat); matches != nil {
+		lower, upper := matches[2], matches[3]
+		if lower == "" && upper == "" {
+			return "", fmt.Errorf("invalid statistic %q: at least one bound is required", stat)
+		}
+		for _, bound := range []string{lower, upper} {
+			if strings.HasSuffix(bound, "%") {
+				if err := validatePercentage(strings.TrimSuffix(bound, "%")); err != nil {
+					return "", fmt.Errorf("invalid statistic %q: %w", stat, err)
+				}
+			}
+		}
+		if lower != "" && upper != "" && strings.HasSuffix(lower, "%") == strings.HasSuffix(upper, "%") {
+			l, _ := strconv.ParseFloat(strings.TrimSuffix(lower, "%"), 64)
+			u, _ := strconv.ParseFloat(strings.TrimSuffix(upper, "%"), 64)
+			if l >= u {
+				return "", fmt.Errorf("invalid statistic %q: the lower bound must be less than the upper bound", stat)
+			}
+		}
+		return fmt.Sprintf("%s(%s:%s)", strings.ToUpper(matches[1]), lower, upper), nil
+	}
+
+	return "", fmt.Errorf("invalid statistic %q, must be one of Average, Sum, Minimum, Maximum, SampleCount "+
+		"or an extended statistic such as p99 or TM(10%%:90%%)", stat)
+}
+
+func validatePercentage(value string) error {
+	percentage, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return err
+	}
+	if percentage < 0 || percentage > 100 {
+		return fmt.Errorf("%s is not a percentage between 0 and 100", value)
+	}
+
+	return nil
+}
+
 func buildSearchExpression(query *cloudWatchQuery, stat string) string {
 	knownDimensions := make(map[string][]string)
 	dimensionNames := []string{}
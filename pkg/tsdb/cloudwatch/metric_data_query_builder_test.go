@@ -4,6 +4,7 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestMetricDataQueryBuilder_buildSearchExpression(t *testing.T) {
@@ -212,3 +213,141 @@ func TestMetricDataQueryBuilder_buildSearchExpression(t *testing.T) {
 		assert.Contains(t, res, `lb4\"\"`, "Expected escape double quotes")
 	})
 }
+
+func TestMetricDataQueryBuilder_validateStatistic(t *testing.T) {
+	validStats := map[string]string{
+		"Average":        "Average",
+		"SampleCount":    "SampleCount",
+		"p0":             "p0",
+		"p95":            "p95",
+		"p99.9":          "p99.9",
+		"p100":           "p100",
+		" P99.99 ":       "p99.99",
+		"tm90":           "tm90",
+		"TM90":           "tm90",
+		"wm99.5":         "wm99.5",
+		"TM(10%:90%)":    "TM(10%:90%)",
+		"tm(10%:90%)":    "TM(10%:90%)",
+		"TM(:95%)":       "TM(:95%)",
+		"TC(5%:)":        "TC(5%:)",
+		"TS(150:1000)":   "TS(150:1000)",
+		"PR(:300)":       "PR(:300)",
+		"TM(10%:1000.5)": "TM(10%:1000.5)",
+		"IQM":            "IQM",
+		"iqm":            "IQM",
+		"pr(10:)":        "PR(10:)",
+		"tc90":           "tc90",
+		"TS99":           "ts99",
+	}
+	for stat, expected := range validStats {
+		t.Run(stat, func(t *testing.T) {
+			normalized, err := validateStatistic(stat)
+			require.NoError(t, err)
+			assert.Equal(t, expected, normalized)
+		})
+	}
+
+	invalidStats := map[string]string{
+		"":             `invalid statistic "", must be one of Average, Sum, Minimum, Maximum, SampleCount or an extended statistic such as p99 or TM(10%:90%)`,
+		"average":      `invalid statistic "average", must be one of Average, Sum, Minimum, Maximum, SampleCount or an extended statistic such as p99 or TM(10%:90%)`,
+		"p":            `invalid statistic "p", must be one of Average, Sum, Minimum, Maximum, SampleCount or an extended statistic such as p99 or TM(10%:90%)`,
+		"p101":         `invalid statistic "p101": 101 is not a percentage between 0 and 100`,
+		"p-1":          `invalid statistic "p-1", must be one of Average, Sum, Minimum, Maximum, SampleCount or an extended statistic such as p99 or TM(10%:90%)`,
+		"p9.":          `invalid statistic "p9.", must be one of Average, Sum, Minimum, Maximum, SampleCount or an extended statistic such as p99 or TM(10%:90%)`,
+		"tm120":        `invalid statistic "tm120": 120 is not a percentage between 0 and 100`,
+		"TM(:)":        `invalid statistic "TM(:)": at least one bound is required`,
+		"TM(90%:10%)":  `invalid statistic "TM(90%:10%)": the lower bound must be less than the upper bound`,
+		"TM(10%:150%)": `invalid statistic "TM(10%:150%)": 150 is not a percentage between 0 and 100`,
+		"TM(10%-90%)":  `invalid statistic "TM(10%-90%)", must be one of Average, Sum, Minimum, Maximum, SampleCount or an extended statistic such as p99 or TM(10%:90%)`,
+	}
+	for stat, expected := range invalidStats {
+		t.Run(stat, func(t *testing.T) {
+			_, err := validateStatistic(stat)
+			require.EqualError(t, err, expected)
+		})
+	}
+}
+
+func TestMetricDataQueryBuilder_buildMetricDataQuery_InvalidStatistic(t *testing.T) {
+	executor := newExecutor(nil)
+	query := &cloudWatchQuery{
+		RefId:      "A",
+		Id:         "queryA",
+		Namespace:  "AWS/EC2",
+		MetricName: "CPUUtilization",
+		Dimensions: map[string][]string{
+			"InstanceId": {"i-123"},
+		},
+		Stats:      "p101",
+		Period:     300,
+		MatchExact: true,
+	}
+
+	_, err := executor.buildMetricDataQuery(query)
+	require.EqualError(t, err, `invalid statistic "p101": 101 is not a percentage between 0 and 100`)
+}
+
+func TestMetricDataQueryBuilder_buildMetricDataQuery_Unit(t *testing.T) {
+	executor := newExecutor(nil)
+	query := &cloudWatchQuery{
+		RefId:      "A",
+		Id:         "queryA",
+		Namespace:  "AWS/EC2",
+		MetricName: "NetworkIn",
+		Dimensions: map[string][]string{
+			"InstanceId": {"i-123"},
+		},
+		Stats:      "Sum",
+		Period:     300,
+		MatchExact: true,
+	}
+
+	t.Run("Unit is left out if not set", func(t *testing.T) {
+		mdq, err := executor.buildMetricDataQuery(query)
+		require.NoError(t, err)
+		require.NotNil(t, mdq.MetricStat)
+		assert.Nil(t, mdq.MetricStat.Unit)
+	})
+
+	t.Run("Unit is set on the metric stat", func(t *testing.T) {
+		query.Unit = "Bytes"
+		mdq, err := executor.buildMetricDataQuery(query)
+		require.NoError(t, err)
+		require.NotNil(t, mdq.MetricStat)
+		require.NotNil(t, mdq.MetricStat.Unit)
+		assert.Equal(t, "Bytes", *mdq.MetricStat.Unit)
+	})
+}
+
+func TestMetricDataQueryBuilder_buildMetricDataQuery_ExtendedStatistics(t *testing.T) {
+	executor := newExecutor(nil)
+
+	stats := map[string]string{
+		"p99":          "p99",
+		"IQM":          "IQM",
+		"tm(10%:90%)":  "TM(10%:90%)",
+		"wm99":         "wm99",
+		"PR(100:2000)": "PR(100:2000)",
+		"TC(:0.5)":     "TC(:0.5)",
+		"ts(5%:95%)":   "TS(5%:95%)",
+	}
+	for stat, expected := range stats {
+		t.Run(stat, func(t *testing.T) {
+			mdq, err := executor.buildMetricDataQuery(&cloudWatchQuery{
+				RefId:      "A",
+				Id:         "queryA",
+				Namespace:  "AWS/ApplicationELB",
+				MetricName: "TargetResponseTime",
+				Dimensions: map[string][]string{
+					"LoadBalancer": {"lb"},
+				},
+				Stats:      stat,
+				Period:     300,
+				MatchExact: true,
+			})
+			require.NoError(t, err)
+			require.NotNil(t, mdq.MetricStat)
+			assert.Equal(t, expected, *mdq.MetricStat.Stat)
+		})
+	}
+}
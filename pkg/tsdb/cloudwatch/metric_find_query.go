@@ -13,8 +13,10 @@ import (
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awsutil"
 	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
 	"github.com/aws/aws-sdk-go/service/ec2"
 	"github.com/aws/aws-sdk-go/service/resourcegroupstaggingapi"
+	"github.com/aws/aws-sdk-go/service/sts"
 	"github.com/grafana/grafana/pkg/components/simplejson"
 	"github.com/grafana/grafana/pkg/infra/metrics"
 	"github.com/grafana/grafana/pkg/tsdb"
@@ -239,8 +241,6 @@ var dimensionsMap = map[string][]string{
 	"AWS/Cassandra":               {"Keyspace", "Operation", "TableName"},
 }
 
-var regionCache sync.Map
-
 func (e *cloudWatchExecutor) executeMetricFindQuery(ctx context.Context, queryContext *tsdb.TsdbQuery) (*tsdb.Response, error) {
 	firstQuery := queryContext.Queries[0]
 
@@ -248,36 +248,124 @@ func (e *cloudWatchExecutor) executeMetricFindQuery(ctx context.Context, queryCo
 	subType := firstQuery.Model.Get("subtype").MustString()
 	var data []suggestData
 	var err error
+	// Testing regions reports on each region itself
+	if regions := metricFindQueryRegions(parameters); regions != nil && subType != "test_region" {
+		data, err = e.executeMultiRegionMetricFindQuery(ctx, subType, parameters, regions, queryContext)
+	} else {
+		data, err = e.executeSubtype(ctx, subType, parameters, queryContext)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	queryResult := &tsdb.QueryResult{Meta: simplejson.New(), RefId: firstQuery.RefId}
+	transformToTable(data, queryResult)
+	result := &tsdb.Response{
+		Results: map[string]*tsdb.QueryResult{
+			firstQuery.RefId: queryResult,
+		},
+	}
+	return result, nil
+}
+
+func (e *cloudWatchExecutor) executeSubtype(ctx context.Context, subType string, parameters *simplejson.Json,
+	queryContext *tsdb.TsdbQuery) ([]suggestData, error) {
 	switch subType {
 	case "regions":
-		data, err = e.handleGetRegions(ctx, parameters, queryContext)
+		return e.handleGetRegions(ctx, parameters, queryContext)
 	case "namespaces":
-		data, err = e.handleGetNamespaces(ctx, parameters, queryContext)
+		return e.handleGetNamespaces(ctx, parameters, queryContext)
+	case "statistics":
+		return e.handleGetStatistics(ctx, parameters, queryContext)
 	case "metrics":
-		data, err = e.handleGetMetrics(ctx, parameters, queryContext)
+		return e.handleGetMetrics(ctx, parameters, queryContext)
 	case "dimension_keys":
-		data, err = e.handleGetDimensions(ctx, parameters, queryContext)
+		return e.handleGetDimensions(ctx, parameters, queryContext)
+	case "allDimensionKeys":
+		return e.handleGetAllDimensionKeys(ctx, parameters, queryContext)
 	case "dimension_values":
-		data, err = e.handleGetDimensionValues(ctx, parameters, queryContext)
+		return e.handleGetDimensionValues(ctx, parameters, queryContext)
 	case "ebs_volume_ids":
-		data, err = e.handleGetEbsVolumeIds(ctx, parameters, queryContext)
+		return e.handleGetEbsVolumeIds(ctx, parameters, queryContext)
 	case "ec2_instance_attribute":
-		data, err = e.handleGetEc2InstanceAttribute(ctx, parameters, queryContext)
+		return e.handleGetEc2InstanceAttribute(ctx, parameters, queryContext)
 	case "resource_arns":
-		data, err = e.handleGetResourceArns(ctx, parameters, queryContext)
+		return e.handleGetResourceArns(ctx, parameters, queryContext)
+	case "ec2_tag_values":
+		return e.handleGetEc2TagValues(ctx, parameters, queryContext)
+	case "logGroups":
+		return e.handleGetLogGroups(ctx, parameters, queryContext)
+	case "instance_types":
+		return e.handleGetInstanceTypes(ctx, parameters, queryContext)
+	case "caller_identity":
+		return e.handleGetCallerIdentity(ctx, parameters, queryContext)
+	case "metric_streams":
+		return e.handleGetMetricStreams(ctx, parameters, queryContext)
+	case "ecs_clusters":
+		return e.handleGetEcsClusters(ctx, parameters, queryContext)
+	case "ecs_services":
+		return e.handleGetEcsServices(ctx, parameters, queryContext)
+	case "s3_buckets":
+		return e.handleGetS3Buckets(ctx, parameters, queryContext)
+	case "test_region":
+		return e.handleTestRegion(ctx, parameters, queryContext)
 	}
+
+	return nil, nil
+}
+
+// metricFindQueryRegions returns the regions of a metric find query whose region is either a list, or a
+// multi-valued template variable formatted like {us-east-1,eu-west-1}. It returns nil for a single region, and
+// for a list without any region, which is then queried like a single one in the default region.
+func metricFindQueryRegions(parameters *simplejson.Json) []string {
+	values, err := parameters.Get("region").StringArray()
 	if err != nil {
-		return nil, err
+		region := parameters.Get("region").MustString(defaultRegion)
+		if !strings.HasPrefix(strings.TrimSpace(region), "{") {
+			return nil
+		}
+		values = parseMultiSelectValue(region)
 	}
 
-	queryResult := &tsdb.QueryResult{Meta: simplejson.New(), RefId: firstQuery.RefId}
-	transformToTable(data, queryResult)
-	result := &tsdb.Response{
-		Results: map[string]*tsdb.QueryResult{
-			firstQuery.RefId: queryResult,
-		},
+	regions := make([]string, 0, len(values))
+	for _, region := range values {
+		if region = strings.TrimSpace(region); region != "" {
+			regions = append(regions, region)
+		}
 	}
-	return result, nil
+	if len(regions) == 0 {
+		return nil
+	}
+	return regions
+}
+
+// executeMultiRegionMetricFindQuery executes a metric find query in each of its regions, merging the results in
+// the order of the regions. Results found in several regions, such as the same dimension value, are only returned
+// once.
+func (e *cloudWatchExecutor) executeMultiRegionMetricFindQuery(ctx context.Context, subType string,
+	parameters *simplejson.Json, regions []string, queryContext *tsdb.TsdbQuery) ([]suggestData, error) {
+	var merged []suggestData
+	seen := make(map[suggestData]bool)
+	for _, region := range regions {
+		regionParameters := make(map[string]interface{})
+		for key, value := range parameters.MustMap() {
+			regionParameters[key] = value
+		}
+		regionParameters["region"] = region
+
+		data, err := e.executeSubtype(ctx, subType, simplejson.NewFromAny(regionParameters), queryContext)
+		if err != nil {
+			return nil, fmt.Errorf("region %s: %w", region, err)
+		}
+		for _, d := range data {
+			if !seen[d] {
+				seen[d] = true
+				merged = append(merged, d)
+			}
+		}
+	}
+
+	return merged, nil
 }
 
 func transformToTable(data []suggestData, result *tsdb.QueryResult) {
@@ -322,12 +410,9 @@ func parseMultiSelectValue(input string) []string {
 // Please update the region list in public/app/plugins/datasource/cloudwatch/partials/config.html
 func (e *cloudWatchExecutor) handleGetRegions(ctx context.Context, parameters *simplejson.Json,
 	queryContext *tsdb.TsdbQuery) ([]suggestData, error) {
-	dsInfo := e.getDSInfo(defaultRegion)
-	profile := dsInfo.Profile
-	if cache, ok := regionCache.Load(profile); ok {
-		if cache2, ok2 := cache.([]suggestData); ok2 {
-			return cache2, nil
-		}
+	cacheKey := dataSourceVersion(e.DataSource)
+	if regions, ok := cachedRegions(cacheKey); ok {
+		return regions, nil
 	}
 
 	client, err := e.getEC2Client(defaultRegion)
@@ -337,7 +422,7 @@ func (e *cloudWatchExecutor) handleGetRegions(ctx context.Context, parameters *s
 	regions := knownRegions
 	r, err := client.DescribeRegions(&ec2.DescribeRegionsInput{})
 	if err != nil {
-		// ignore error for backward compatibility
+		// ignore error for backward compatibility, but don't cache the known regions so the next query tries again
 		plog.Error("Failed to get regions", "error", err)
 	} else {
 		for _, region := range r.Regions {
@@ -361,7 +446,9 @@ func (e *cloudWatchExecutor) handleGetRegions(ctx context.Context, parameters *s
 	for _, region := range regions {
 		result = append(result, suggestData{Text: region, Value: region})
 	}
-	regionCache.Store(profile, result)
+	if err == nil {
+		cacheRegions(cacheKey, result)
+	}
 
 	return result, nil
 }
@@ -414,6 +501,12 @@ func (e *cloudWatchExecutor) handleGetMetrics(ctx context.Context, parameters *s
 func (e *cloudWatchExecutor) handleGetDimensions(ctx context.Context, parameters *simplejson.Json, queryContext *tsdb.TsdbQuery) ([]suggestData, error) {
 	region := parameters.Get("region").MustString()
 	namespace := parameters.Get("namespace").MustString()
+	metricName := parameters.Get("metricName").MustString()
+	dimensionFilters := parseDimensionFilters(parameters.Get("dimensions"))
+
+	if metricName != "" || len(dimensionFilters) > 0 {
+		return e.getDimensionKeysByFilter(region, namespace, metricName, dimensionFilters)
+	}
 
 	var dimensionValues []string
 	if !isCustomMetrics(namespace) {
@@ -437,38 +530,80 @@ func (e *cloudWatchExecutor) handleGetDimensions(ctx context.Context, parameters
 	return result, nil
 }
 
+// handleGetAllDimensionKeys returns every dimension key of the metrics in a namespace, as listed by ListMetrics,
+// regardless of the metric they belong to.
+func (e *cloudWatchExecutor) handleGetAllDimensionKeys(ctx context.Context, parameters *simplejson.Json,
+	queryContext *tsdb.TsdbQuery) ([]suggestData, error) {
+	region := parameters.Get("region").MustString(defaultRegion)
+	namespace := parameters.Get("namespace").MustString()
+	if namespace == "" {
+		return nil, fmt.Errorf("a namespace is required to list its dimension keys")
+	}
+
+	metrics, err := e.cloudwatchListMetrics(region, namespace, "", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	dupCheck := make(map[string]bool)
+	var keys []string
+	for _, metric := range metrics.Metrics {
+		for _, dim := range metric.Dimensions {
+			if dupCheck[*dim.Name] {
+				continue
+			}
+
+			dupCheck[*dim.Name] = true
+			keys = append(keys, *dim.Name)
+		}
+	}
+	sort.Strings(keys)
+
+	result := make([]suggestData, 0, len(keys))
+	for _, key := range keys {
+		result = append(result, suggestData{Text: key, Value: key})
+	}
+
+	return result, nil
+}
+
 func (e *cloudWatchExecutor) handleGetDimensionValues(ctx context.Context, parameters *simplejson.Json, queryContext *tsdb.TsdbQuery) ([]suggestData, error) {
-	region := parameters.Get("region").MustString()
+	region := parameters.Get("region").MustString(defaultRegion)
 	namespace := parameters.Get("namespace").MustString()
 	metricName := parameters.Get("metricName").MustString()
 	dimensionKey := parameters.Get("dimensionKey").MustString()
-	dimensionsJson := parameters.Get("dimensions").MustMap()
-
-	var dimensions []*cloudwatch.DimensionFilter
-	for k, v := range dimensionsJson {
-		if vv, ok := v.(string); ok {
-			dimensions = append(dimensions, &cloudwatch.DimensionFilter{
-				Name:  aws.String(k),
-				Value: aws.String(vv),
-			})
-		} else if vv, ok := v.([]interface{}); ok {
-			for _, v := range vv {
-				dimensions = append(dimensions, &cloudwatch.DimensionFilter{
-					Name:  aws.String(k),
-					Value: aws.String(v.(string)),
-				})
-			}
+	dimensions := parseDimensionFilters(parameters.Get("dimensions"))
+
+	// Only list metrics which have the dimension, unless values have already been chosen for it
+	hasKeyFilter := false
+	for _, dimension := range dimensions {
+		if *dimension.Name == dimensionKey {
+			hasKeyFilter = true
+			break
 		}
 	}
+	if dimensionKey != "" && !hasKeyFilter {
+		dimensions = append(dimensions, &cloudwatch.DimensionFilter{
+			Name: aws.String(dimensionKey),
+		})
+	}
 
-	metrics, err := e.cloudwatchListMetrics(region, namespace, metricName, dimensions)
+	combinations, err := dimensionFilterCombinations(dimensions)
 	if err != nil {
 		return nil, err
 	}
+	var matchingMetrics []*cloudwatch.Metric
+	for _, filters := range combinations {
+		metrics, err := e.cloudwatchListMetrics(region, namespace, metricName, filters)
+		if err != nil {
+			return nil, err
+		}
+		matchingMetrics = append(matchingMetrics, metrics.Metrics...)
+	}
 
 	result := make([]suggestData, 0)
 	dupCheck := make(map[string]bool)
-	for _, metric := range metrics.Metrics {
+	for _, metric := range matchingMetrics {
 		for _, dim := range metric.Dimensions {
 			if *dim.Name == dimensionKey {
 				if _, exists := dupCheck[*dim.Value]; exists {
@@ -488,10 +623,109 @@ func (e *cloudWatchExecutor) handleGetDimensionValues(ctx context.Context, param
 	return result, nil
 }
 
+// getDimensionKeysByFilter returns the dimension keys of the metrics matching a metric name and the dimensions
+// already selected, leaving out the keys of the selected dimensions.
+func (e *cloudWatchExecutor) getDimensionKeysByFilter(region string, namespace string, metricName string,
+	dimensionFilters []*cloudwatch.DimensionFilter) ([]suggestData, error) {
+	metrics, err := e.cloudwatchListMetrics(region, namespace, metricName, dimensionFilters)
+	if err != nil {
+		return nil, err
+	}
+
+	dupCheck := make(map[string]bool)
+	for _, filter := range dimensionFilters {
+		dupCheck[*filter.Name] = true
+	}
+
+	result := make([]suggestData, 0)
+	for _, metric := range metrics.Metrics {
+		for _, dim := range metric.Dimensions {
+			if _, exists := dupCheck[*dim.Name]; exists {
+				continue
+			}
+
+			dupCheck[*dim.Name] = true
+			result = append(result, suggestData{Text: *dim.Name, Value: *dim.Name})
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Text < result[j].Text
+	})
+
+	return result, nil
+}
+
+// parseDimensionFilters turns a map of dimension names to either a single value or a list of values into
+// ListMetrics dimension filters.
+func parseDimensionFilters(dimensionsJson *simplejson.Json) []*cloudwatch.DimensionFilter {
+	var dimensions []*cloudwatch.DimensionFilter
+	for k, v := range dimensionsJson.MustMap() {
+		if vv, ok := v.(string); ok {
+			dimensions = append(dimensions, &cloudwatch.DimensionFilter{
+				Name:  aws.String(k),
+				Value: aws.String(vv),
+			})
+		} else if vv, ok := v.([]interface{}); ok {
+			for _, v := range vv {
+				// Values that aren't strings, e.g. from a malformed dashboard, are left out rather than panicking
+				if s, ok := v.(string); ok {
+					dimensions = append(dimensions, &cloudwatch.DimensionFilter{
+						Name:  aws.String(k),
+						Value: aws.String(s),
+					})
+				}
+			}
+		}
+	}
+
+	return dimensions
+}
+
+// maxDimensionFilterCombinations limits the number of ListMetrics calls made for dimensions filtered by several values.
+const maxDimensionFilterCombinations = 100
+
+// dimensionFilterCombinations splits dimension filters into the sets of filters to list metrics with. ListMetrics
+// only returns metrics matching all of its filters, so a set is made per combination of the values of each dimension,
+// and the metrics listed with each set are merged: the values of a dimension are ORed, different dimensions ANDed.
+func dimensionFilterCombinations(filters []*cloudwatch.DimensionFilter) ([][]*cloudwatch.DimensionFilter, error) {
+	var names []string
+	filtersByName := make(map[string][]*cloudwatch.DimensionFilter)
+	for _, filter := range filters {
+		name := aws.StringValue(filter.Name)
+		if _, exists := filtersByName[name]; !exists {
+			names = append(names, name)
+		}
+		filtersByName[name] = append(filtersByName[name], filter)
+	}
+
+	combinations := [][]*cloudwatch.DimensionFilter{nil}
+	for _, name := range names {
+		next := make([][]*cloudwatch.DimensionFilter, 0, len(combinations)*len(filtersByName[name]))
+		for _, combination := range combinations {
+			for _, filter := range filtersByName[name] {
+				filters := make([]*cloudwatch.DimensionFilter, len(combination), len(combination)+1)
+				copy(filters, combination)
+				next = append(next, append(filters, filter))
+			}
+		}
+		if len(next) > maxDimensionFilterCombinations {
+			return nil, fmt.Errorf("too many dimension values: at most %d combinations of dimension values can be listed",
+				maxDimensionFilterCombinations)
+		}
+		combinations = next
+	}
+
+	return combinations, nil
+}
+
 func (e *cloudWatchExecutor) handleGetEbsVolumeIds(ctx context.Context, parameters *simplejson.Json,
 	queryContext *tsdb.TsdbQuery) ([]suggestData, error) {
 	region := parameters.Get("region").MustString()
 	instanceId := parameters.Get("instanceId").MustString()
+	if instanceId == "" {
+		return e.getEbsVolumeIdsByTags(ctx, region, parameters.Get("tags").MustMap())
+	}
 
 	instanceIds := aws.StringSlice(parseMultiSelectValue(instanceId))
 	instances, err := e.ec2DescribeInstances(region, nil, instanceIds)
@@ -511,6 +745,127 @@ func (e *cloudWatchExecutor) handleGetEbsVolumeIds(ctx context.Context, paramete
 	return result, nil
 }
 
+// getEbsVolumeIdsByTags returns the ids of the EBS volumes having any of the values of each tag, or of all the
+// volumes of the region without tags.
+func (e *cloudWatchExecutor) getEbsVolumeIdsByTags(ctx context.Context, region string,
+	tags map[string]interface{}) ([]suggestData, error) {
+	var filters []*ec2.Filter
+	for k, v := range tags {
+		if vv, ok := v.([]interface{}); ok {
+			var values []*string
+			for _, vvv := range vv {
+				if vvvv, ok := vvv.(string); ok {
+					values = append(values, aws.String(vvvv))
+				}
+			}
+			filters = append(filters, &ec2.Filter{
+				Name:   aws.String("tag:" + k),
+				Values: values,
+			})
+		}
+	}
+
+	client, err := e.getEC2Client(region)
+	if err != nil {
+		return nil, err
+	}
+
+	var volumeIds []string
+	params := &ec2.DescribeVolumesInput{Filters: filters}
+	if err := client.DescribeVolumesPagesWithContext(ctx, params,
+		func(page *ec2.DescribeVolumesOutput, lastPage bool) bool {
+			for _, volume := range page.Volumes {
+				volumeIds = append(volumeIds, *volume.VolumeId)
+			}
+			return !lastPage
+		}); err != nil {
+		return nil, fmt.Errorf("failed to call ec2:DescribeVolumes, %w", err)
+	}
+	sort.Strings(volumeIds)
+
+	result := make([]suggestData, 0, len(volumeIds))
+	for _, volumeId := range volumeIds {
+		result = append(result, suggestData{Text: volumeId, Value: volumeId})
+	}
+
+	return result, nil
+}
+
+// handleGetCallerIdentity returns the account, ARN and user id of the IAM principal the data source uses, to
+// help confirm that e.g. assuming a role worked. With maskArn set, the account id in the ARN is masked.
+func (e *cloudWatchExecutor) handleGetCallerIdentity(ctx context.Context, parameters *simplejson.Json,
+	queryContext *tsdb.TsdbQuery) ([]suggestData, error) {
+	region := parameters.Get("region").MustString(defaultRegion)
+	maskARN := parameters.Get("maskArn").MustBool(false)
+
+	client, err := e.getSTSClient(region)
+	if err != nil {
+		return nil, err
+	}
+
+	identity, err := client.GetCallerIdentityWithContext(ctx, &sts.GetCallerIdentityInput{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to call sts:GetCallerIdentity, %w", err)
+	}
+
+	account := aws.StringValue(identity.Account)
+	arn := aws.StringValue(identity.Arn)
+	if maskARN {
+		arn = maskAccountID(arn, account)
+	}
+
+	return []suggestData{
+		{Text: "account", Value: account},
+		{Text: "arn", Value: arn},
+		{Text: "userId", Value: aws.StringValue(identity.UserId)},
+	}, nil
+}
+
+// maskAccountID replaces all but the last four digits of an account id in an ARN with asterisks.
+func maskAccountID(arn string, account string) string {
+	if len(account) <= 4 {
+		return arn
+	}
+
+	masked := strings.Repeat("*", len(account)-4) + account[len(account)-4:]
+	return strings.ReplaceAll(arn, account, masked)
+}
+
+// handleGetInstanceTypes returns the names of the EC2 instance types offered in a region, optionally only the ones
+// containing the filter parameter.
+func (e *cloudWatchExecutor) handleGetInstanceTypes(ctx context.Context, parameters *simplejson.Json,
+	queryContext *tsdb.TsdbQuery) ([]suggestData, error) {
+	region := parameters.Get("region").MustString(defaultRegion)
+	filter := strings.ToLower(parameters.Get("filter").MustString())
+
+	client, err := e.getEC2Client(region)
+	if err != nil {
+		return nil, err
+	}
+
+	var instanceTypes []string
+	if err := client.DescribeInstanceTypesPagesWithContext(ctx, &ec2.DescribeInstanceTypesInput{},
+		func(page *ec2.DescribeInstanceTypesOutput, lastPage bool) bool {
+			for _, info := range page.InstanceTypes {
+				instanceType := aws.StringValue(info.InstanceType)
+				if strings.Contains(strings.ToLower(instanceType), filter) {
+					instanceTypes = append(instanceTypes, instanceType)
+				}
+			}
+			return !lastPage
+		}); err != nil {
+		return nil, fmt.Errorf("failed to call ec2:DescribeInstanceTypes, %w", err)
+	}
+	sort.Strings(instanceTypes)
+
+	result := make([]suggestData, 0, len(instanceTypes))
+	for _, instanceType := range instanceTypes {
+		result = append(result, suggestData{Text: instanceType, Value: instanceType})
+	}
+
+	return result, nil
+}
+
 func (e *cloudWatchExecutor) handleGetEc2InstanceAttribute(ctx context.Context, parameters *simplejson.Json,
 	queryContext *tsdb.TsdbQuery) ([]suggestData, error) {
 	region := parameters.Get("region").MustString()
@@ -591,6 +946,88 @@ func (e *cloudWatchExecutor) handleGetEc2InstanceAttribute(ctx context.Context,
 	return result, nil
 }
 
+func (e *cloudWatchExecutor) handleGetEc2TagValues(ctx context.Context, parameters *simplejson.Json,
+	queryContext *tsdb.TsdbQuery) ([]suggestData, error) {
+	region := parameters.Get("region").MustString()
+	tagKey := parameters.Get("tagKey").MustString()
+	if tagKey == "" {
+		return nil, errors.New("a tag key is required")
+	}
+
+	filters := []*ec2.Filter{
+		{
+			Name:   aws.String("tag-key"),
+			Values: []*string{aws.String(tagKey)},
+		},
+	}
+	instances, err := e.ec2DescribeInstances(region, filters, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]suggestData, 0)
+	dupCheck := make(map[string]bool)
+	for _, reservation := range instances.Reservations {
+		for _, instance := range reservation.Instances {
+			for _, tag := range instance.Tags {
+				if *tag.Key != tagKey {
+					continue
+				}
+				if _, exists := dupCheck[*tag.Value]; exists {
+					continue
+				}
+
+				dupCheck[*tag.Value] = true
+				result = append(result, suggestData{Text: *tag.Value, Value: *tag.Value})
+			}
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Text < result[j].Text
+	})
+
+	return result, nil
+}
+
+// handleGetLogGroups returns the names of the log groups matching a prefix. When returnArns is set, the ARNs of
+// the log groups are used as values instead of their names.
+func (e *cloudWatchExecutor) handleGetLogGroups(ctx context.Context, parameters *simplejson.Json,
+	queryContext *tsdb.TsdbQuery) ([]suggestData, error) {
+	region := parameters.Get("region").MustString(defaultRegion)
+	logGroupNamePrefix := parameters.Get("logGroupNamePrefix").MustString()
+	returnArns := parameters.Get("returnArns").MustBool()
+
+	logsClient, err := e.getCWLogsClient(region)
+	if err != nil {
+		return nil, err
+	}
+
+	input := &cloudwatchlogs.DescribeLogGroupsInput{
+		Limit: aws.Int64(parameters.Get("limit").MustInt64(50)),
+	}
+	if logGroupNamePrefix != "" {
+		input.LogGroupNamePrefix = aws.String(logGroupNamePrefix)
+	}
+	response, err := logsClient.DescribeLogGroupsWithContext(ctx, input)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call logs:DescribeLogGroups, %w", err)
+	}
+
+	result := make([]suggestData, 0, len(response.LogGroups))
+	for _, logGroup := range response.LogGroups {
+		name := aws.StringValue(logGroup.LogGroupName)
+		value := name
+		if returnArns {
+			// The ARN returned by DescribeLogGroups has a trailing :* which isn't part of the log group ARN
+			value = strings.TrimSuffix(aws.StringValue(logGroup.Arn), ":*")
+		}
+		result = append(result, suggestData{Text: name, Value: value})
+	}
+
+	return result, nil
+}
+
 func (e *cloudWatchExecutor) handleGetResourceArns(ctx context.Context, parameters *simplejson.Json,
 	queryContext *tsdb.TsdbQuery) ([]suggestData, error) {
 	region := parameters.Get("region").MustString()
@@ -614,9 +1051,11 @@ func (e *cloudWatchExecutor) handleGetResourceArns(ctx context.Context, paramete
 	}
 
 	var resourceTypes []*string
-	resourceTypes = append(resourceTypes, &resourceType)
+	if resourceType != "" {
+		resourceTypes = append(resourceTypes, aws.String(resourceType))
+	}
 
-	resources, err := e.resourceGroupsGetResources(region, filters, resourceTypes)
+	resources, err := e.resourceGroupsGetResources(ctx, region, filters, resourceTypes)
 	if err != nil {
 		return nil, err
 	}
@@ -630,6 +1069,11 @@ func (e *cloudWatchExecutor) handleGetResourceArns(ctx context.Context, paramete
 	return result, nil
 }
 
+// maxListMetricsPages caps the number of ListMetrics pages fetched for a single lookup.
+//
+// Stubbable by tests.
+var maxListMetricsPages = 500
+
 func (e *cloudWatchExecutor) cloudwatchListMetrics(region string, namespace string, metricName string,
 	dimensions []*cloudwatch.DimensionFilter) (*cloudwatch.ListMetricsOutput, error) {
 	svc, err := e.getCWClient(region)
@@ -647,6 +1091,7 @@ func (e *cloudWatchExecutor) cloudwatchListMetrics(region string, namespace stri
 	}
 
 	var resp cloudwatch.ListMetricsOutput
+	pageCount := 0
 	if err := svc.ListMetricsPages(params,
 		func(page *cloudwatch.ListMetricsOutput, lastPage bool) bool {
 			metrics.MAwsCloudWatchListMetrics.Inc()
@@ -654,7 +1099,8 @@ func (e *cloudWatchExecutor) cloudwatchListMetrics(region string, namespace stri
 			for _, metric := range metrics {
 				resp.Metrics = append(resp.Metrics, metric.(*cloudwatch.Metric))
 			}
-			return !lastPage
+			pageCount++
+			return !lastPage && !listMetricsPageLimitReached(pageCount, namespace)
 		}); err != nil {
 		return nil, fmt.Errorf("failed to call cloudwatch:ListMetrics: %w", err)
 	}
@@ -662,6 +1108,18 @@ func (e *cloudWatchExecutor) cloudwatchListMetrics(region string, namespace stri
 	return &resp, nil
 }
 
+// listMetricsPageLimitReached tells whether enough ListMetrics pages have been fetched. Each page holds up to 500
+// metrics, so the limit is only hit by accounts with a very large number of metrics in a namespace.
+func listMetricsPageLimitReached(pageCount int, namespace string) bool {
+	if pageCount < maxListMetricsPages {
+		return false
+	}
+
+	plog.Warn("Reached the maximum number of ListMetrics pages, the remaining metrics are left out",
+		"namespace", namespace, "pages", pageCount)
+	return true
+}
+
 func (e *cloudWatchExecutor) ec2DescribeInstances(region string, filters []*ec2.Filter, instanceIds []*string) (*ec2.DescribeInstancesOutput, error) {
 	params := &ec2.DescribeInstancesInput{
 		Filters:     filters,
@@ -684,8 +1142,8 @@ func (e *cloudWatchExecutor) ec2DescribeInstances(region string, filters []*ec2.
 	return &resp, nil
 }
 
-func (e *cloudWatchExecutor) resourceGroupsGetResources(region string, filters []*resourcegroupstaggingapi.TagFilter,
-	resourceTypes []*string) (*resourcegroupstaggingapi.GetResourcesOutput, error) {
+func (e *cloudWatchExecutor) resourceGroupsGetResources(ctx context.Context, region string,
+	filters []*resourcegroupstaggingapi.TagFilter, resourceTypes []*string) (*resourcegroupstaggingapi.GetResourcesOutput, error) {
 	params := &resourcegroupstaggingapi.GetResourcesInput{
 		ResourceTypeFilters: resourceTypes,
 		TagFilters:          filters,
@@ -697,12 +1155,17 @@ func (e *cloudWatchExecutor) resourceGroupsGetResources(region string, filters [
 	}
 
 	var resp resourcegroupstaggingapi.GetResourcesOutput
-	if err := client.GetResourcesPages(params,
-		func(page *resourcegroupstaggingapi.GetResourcesOutput, lastPage bool) bool {
-			resp.ResourceTagMappingList = append(resp.ResourceTagMappingList, page.ResourceTagMappingList...)
-			return !lastPage
-		}); err != nil {
-		return nil, fmt.Errorf("failed to call tag:GetResources, %w", err)
+	for {
+		page, err := client.GetResourcesWithContext(ctx, params)
+		if err != nil {
+			return nil, fmt.Errorf("failed to call tag:GetResources, %w", err)
+		}
+		resp.ResourceTagMappingList = append(resp.ResourceTagMappingList, page.ResourceTagMappingList...)
+
+		if page.PaginationToken == nil || *page.PaginationToken == "" {
+			break
+		}
+		params.PaginationToken = page.PaginationToken
 	}
 
 	return &resp, nil
@@ -720,17 +1183,19 @@ func (e *cloudWatchExecutor) getAllMetrics(region, namespace string) (cloudwatch
 
 	plog.Debug("Listing metrics pages")
 	var resp cloudwatch.ListMetricsOutput
+	pageCount := 0
 	err = client.ListMetricsPages(params, func(page *cloudwatch.ListMetricsOutput, lastPage bool) bool {
 		metrics.MAwsCloudWatchListMetrics.Inc()
+		pageCount++
 		metrics, err := awsutil.ValuesAtPath(page, "Metrics")
 		if err != nil {
-			return !lastPage
+			return !lastPage && !listMetricsPageLimitReached(pageCount, namespace)
 		}
 
 		for _, metric := range metrics {
 			resp.Metrics = append(resp.Metrics, metric.(*cloudwatch.Metric))
 		}
-		return !lastPage
+		return !lastPage && !listMetricsPageLimitReached(pageCount, namespace)
 	})
 
 	return resp, err
@@ -2,23 +2,52 @@ package cloudwatch
 
 import (
 	"context"
+	"fmt"
 	"testing"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/client"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/cloudwatch"
 	"github.com/aws/aws-sdk-go/service/cloudwatch/cloudwatchiface"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs/cloudwatchlogsiface"
 	"github.com/aws/aws-sdk-go/service/ec2"
 	"github.com/aws/aws-sdk-go/service/ec2/ec2iface"
+	"github.com/aws/aws-sdk-go/service/ecs/ecsiface"
 	"github.com/aws/aws-sdk-go/service/resourcegroupstaggingapi"
 	"github.com/aws/aws-sdk-go/service/resourcegroupstaggingapi/resourcegroupstaggingapiiface"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/aws/aws-sdk-go/service/sts/stsiface"
 	"github.com/grafana/grafana/pkg/components/simplejson"
+	"github.com/grafana/grafana/pkg/models"
 	"github.com/grafana/grafana/pkg/tsdb"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
+// runMetricFindQuery runs a metric find query with model against the fake data source, and returns the rows of its
+// result.
+func runMetricFindQuery(t *testing.T, model map[string]interface{}) []tsdb.RowValues {
+	t.Helper()
+
+	model["type"] = "metricFindQuery"
+	executor := newExecutor(nil)
+	resp, err := executor.Query(context.Background(), fakeDataSource(), &tsdb.TsdbQuery{
+		Queries: []*tsdb.Query{
+			{
+				Model: simplejson.NewFromAny(model),
+			},
+		},
+	})
+	require.NoError(t, err)
+	require.Len(t, resp.Results[""].Tables, 1)
+
+	return resp.Results[""].Tables[0].Rows
+}
+
 func TestQuery_Metrics(t *testing.T) {
 	origNewCWClient := NewCWClient
 	t.Cleanup(func() {
@@ -150,15 +179,36 @@ func TestQuery_Regions(t *testing.T) {
 	origNewEC2Client := newEC2Client
 	t.Cleanup(func() {
 		newEC2Client = origNewEC2Client
+		invalidateRegionCaches()
 	})
 
 	var cli fakeEC2Client
+	numClients := 0
 
 	newEC2Client = func(client.ConfigProvider) ec2iface.EC2API {
+		numClients++
 		return cli
 	}
 
+	runQuery := func(t *testing.T, dataSource *models.DataSource) {
+		t.Helper()
+
+		executor := newExecutor(nil)
+		_, err := executor.Query(context.Background(), dataSource, &tsdb.TsdbQuery{
+			Queries: []*tsdb.Query{
+				{
+					Model: simplejson.NewFromAny(map[string]interface{}{
+						"type":    "metricFindQuery",
+						"subtype": "regions",
+					}),
+				},
+			},
+		})
+		require.NoError(t, err)
+	}
+
 	t.Run("An extra region", func(t *testing.T) {
+		t.Cleanup(invalidateRegionCaches)
 		const regionName = "xtra-region"
 		cli = fakeEC2Client{
 			regions: []string{regionName},
@@ -212,6 +262,46 @@ func TestQuery_Regions(t *testing.T) {
 			},
 		}, resp)
 	})
+
+	t.Run("Regions of a data source are cached within the TTL", func(t *testing.T) {
+		t.Cleanup(invalidateRegionCaches)
+		cli = fakeEC2Client{}
+		numClients = 0
+		dataSource := fakeDataSource()
+		dataSource.Id = 1
+
+		runQuery(t, dataSource)
+		runQuery(t, dataSource)
+		assert.Equal(t, 1, numClients)
+
+		otherDataSource := fakeDataSource()
+		otherDataSource.Id = 2
+		runQuery(t, otherDataSource)
+		assert.Equal(t, 2, numClients)
+
+		dataSource.Version++
+		runQuery(t, dataSource)
+		assert.Equal(t, 3, numClients, "regions should be listed again after the data source is updated")
+
+		invalidateRegionCaches()
+		runQuery(t, dataSource)
+		assert.Equal(t, 4, numClients)
+	})
+
+	t.Run("Expired regions are listed again", func(t *testing.T) {
+		t.Cleanup(invalidateRegionCaches)
+		origRegionCacheTTL := regionCacheTTL
+		t.Cleanup(func() {
+			regionCacheTTL = origRegionCacheTTL
+		})
+		regionCacheTTL = 0
+		cli = fakeEC2Client{}
+		numClients = 0
+
+		runQuery(t, fakeDataSource())
+		runQuery(t, fakeDataSource())
+		assert.Equal(t, 2, numClients)
+	})
 }
 
 func TestQuery_InstanceAttributes(t *testing.T) {
@@ -293,6 +383,113 @@ func TestQuery_InstanceAttributes(t *testing.T) {
 	})
 }
 
+func TestQuery_EC2TagValues(t *testing.T) {
+	origNewEC2Client := newEC2Client
+	t.Cleanup(func() {
+		newEC2Client = origNewEC2Client
+	})
+
+	var cli fakeEC2Client
+
+	newEC2Client = func(client.ConfigProvider) ec2iface.EC2API {
+		return cli
+	}
+
+	newInstance := func(id string, tags map[string]string) *ec2.Instance {
+		instance := &ec2.Instance{InstanceId: aws.String(id)}
+		for k, v := range tags {
+			instance.Tags = append(instance.Tags, &ec2.Tag{Key: aws.String(k), Value: aws.String(v)})
+		}
+		return instance
+	}
+
+	t.Run("Tag values are deduplicated and sorted", func(t *testing.T) {
+		cli = fakeEC2Client{
+			reservations: []*ec2.Reservation{
+				{
+					Instances: []*ec2.Instance{
+						newInstance("i-1", map[string]string{"Environment": "staging", "Team": "a"}),
+						newInstance("i-2", map[string]string{"Environment": "production"}),
+					},
+				},
+				{
+					Instances: []*ec2.Instance{
+						newInstance("i-3", map[string]string{"Environment": "staging"}),
+						newInstance("i-4", map[string]string{"Team": "b"}),
+						newInstance("i-5", map[string]string{"Environment": "development"}),
+					},
+				},
+			},
+		}
+		executor := newExecutor(nil)
+		resp, err := executor.Query(context.Background(), fakeDataSource(), &tsdb.TsdbQuery{
+			Queries: []*tsdb.Query{
+				{
+					Model: simplejson.NewFromAny(map[string]interface{}{
+						"type":    "metricFindQuery",
+						"subtype": "ec2_tag_values",
+						"region":  "us-east-1",
+						"tagKey":  "Environment",
+					}),
+				},
+			},
+		})
+		require.NoError(t, err)
+
+		assert.Equal(t, &tsdb.Response{
+			Results: map[string]*tsdb.QueryResult{
+				"": {
+					Meta: simplejson.NewFromAny(map[string]interface{}{
+						"rowCount": 3,
+					}),
+					Tables: []*tsdb.Table{
+						{
+							Columns: []tsdb.TableColumn{
+								{
+									Text: "text",
+								},
+								{
+									Text: "value",
+								},
+							},
+							Rows: []tsdb.RowValues{
+								{
+									"development",
+									"development",
+								},
+								{
+									"production",
+									"production",
+								},
+								{
+									"staging",
+									"staging",
+								},
+							},
+						},
+					},
+				},
+			},
+		}, resp)
+	})
+
+	t.Run("Tag key is required", func(t *testing.T) {
+		executor := newExecutor(nil)
+		_, err := executor.Query(context.Background(), fakeDataSource(), &tsdb.TsdbQuery{
+			Queries: []*tsdb.Query{
+				{
+					Model: simplejson.NewFromAny(map[string]interface{}{
+						"type":    "metricFindQuery",
+						"subtype": "ec2_tag_values",
+						"region":  "us-east-1",
+					}),
+				},
+			},
+		})
+		require.EqualError(t, err, "a tag key is required")
+	})
+}
+
 func TestQuery_EBSVolumeIDs(t *testing.T) {
 	origNewEC2Client := newEC2Client
 	t.Cleanup(func() {
@@ -411,6 +608,145 @@ func TestQuery_EBSVolumeIDs(t *testing.T) {
 			},
 		}, resp)
 	})
+
+	t.Run("Volumes of all pages are filtered by tags", func(t *testing.T) {
+		newVolume := func(id string, env string) *ec2.Volume {
+			return &ec2.Volume{
+				VolumeId: aws.String(id),
+				Tags: []*ec2.Tag{
+					{Key: aws.String("Environment"), Value: aws.String(env)},
+				},
+			}
+		}
+		cli = fakeEC2Client{
+			volumes: [][]*ec2.Volume{
+				{newVolume("vol-3", "production"), newVolume("vol-2", "development")},
+				{newVolume("vol-1", "staging"), {VolumeId: aws.String("vol-4")}},
+			},
+		}
+
+		rows := runMetricFindQuery(t, map[string]interface{}{
+			"subtype": "ebs_volume_ids",
+			"region":  "us-east-1",
+			"tags": map[string]interface{}{
+				"Environment": []interface{}{"production", "staging"},
+			},
+		})
+
+		assert.Equal(t, []tsdb.RowValues{
+			{"vol-1", "vol-1"},
+			{"vol-3", "vol-3"},
+		}, rows)
+	})
+
+	t.Run("Volumes without tags are all returned", func(t *testing.T) {
+		cli = fakeEC2Client{
+			volumes: [][]*ec2.Volume{
+				{{VolumeId: aws.String("vol-2")}},
+				{{VolumeId: aws.String("vol-1")}},
+			},
+		}
+
+		rows := runMetricFindQuery(t, map[string]interface{}{
+			"subtype": "ebs_volume_ids",
+			"region":  "us-east-1",
+		})
+
+		assert.Equal(t, []tsdb.RowValues{
+			{"vol-1", "vol-1"},
+			{"vol-2", "vol-2"},
+		}, rows)
+	})
+}
+
+func TestQuery_InstanceTypes(t *testing.T) {
+	origNewEC2Client := newEC2Client
+	t.Cleanup(func() {
+		newEC2Client = origNewEC2Client
+	})
+
+	cli := fakeEC2Client{
+		instanceTypes: [][]string{
+			{"t3.micro", "m5.large"},
+			{"t3.large", "c5.xlarge"},
+		},
+	}
+	newEC2Client = func(client.ConfigProvider) ec2iface.EC2API {
+		return cli
+	}
+
+	runQuery := func(t *testing.T, filter string) []tsdb.RowValues {
+		return runMetricFindQuery(t, map[string]interface{}{
+			"subtype": "instance_types",
+			"region":  "us-east-1",
+			"filter":  filter,
+		})
+	}
+
+	t.Run("Instance types from all pages are returned", func(t *testing.T) {
+		rows := runQuery(t, "")
+
+		assert.Equal(t, []tsdb.RowValues{
+			{"c5.xlarge", "c5.xlarge"},
+			{"m5.large", "m5.large"},
+			{"t3.large", "t3.large"},
+			{"t3.micro", "t3.micro"},
+		}, rows)
+	})
+
+	t.Run("Instance types are filtered by substring", func(t *testing.T) {
+		rows := runQuery(t, "T3.")
+
+		assert.Equal(t, []tsdb.RowValues{
+			{"t3.large", "t3.large"},
+			{"t3.micro", "t3.micro"},
+		}, rows)
+	})
+}
+
+func TestQuery_CallerIdentity(t *testing.T) {
+	origNewSTSClient := newSTSClient
+	t.Cleanup(func() {
+		newSTSClient = origNewSTSClient
+	})
+
+	newSTSClient = func(client.ConfigProvider) stsiface.STSAPI {
+		return fakeSTSClient{
+			identity: sts.GetCallerIdentityOutput{
+				Account: aws.String("123456789012"),
+				Arn:     aws.String("arn:aws:sts::123456789012:assumed-role/grafana-role/grafana"),
+				UserId:  aws.String("AROAEXAMPLEID:grafana"),
+			},
+		}
+	}
+
+	runQuery := func(t *testing.T, maskARN bool) []tsdb.RowValues {
+		return runMetricFindQuery(t, map[string]interface{}{
+			"subtype": "caller_identity",
+			"region":  "us-east-1",
+			"maskArn": maskARN,
+		})
+	}
+
+	t.Run("Caller identity is returned", func(t *testing.T) {
+		rows := runQuery(t, false)
+
+		assert.Equal(t, []tsdb.RowValues{
+			{"account", "123456789012"},
+			{"arn", "arn:aws:sts::123456789012:assumed-role/grafana-role/grafana"},
+			{"userId", "AROAEXAMPLEID:grafana"},
+		}, rows)
+	})
+
+	t.Run("Account id in the ARN is masked", func(t *testing.T) {
+		rows := runQuery(t, true)
+
+		assert.Equal(t, []tsdb.RowValues{
+			{"account", "123456789012"},
+			{"arn", "arn:aws:sts::********9012:assumed-role/grafana-role/grafana"},
+			{"userId", "AROAEXAMPLEID:grafana"},
+		}, rows)
+	})
 }
 
 func TestQuery_ResourceARNs(t *testing.T) {
@@ -499,3 +835,854 @@ func TestQuery_ResourceARNs(t *testing.T) {
 		}, resp)
 	})
 }
+
+func TestQuery_ResourceARNs_Pagination(t *testing.T) {
+	origNewRGTAClient := newRGTAClient
+	t.Cleanup(func() {
+		newRGTAClient = origNewRGTAClient
+	})
+
+	calls := &rgtaCalls{}
+	cli := fakeRGTAClient{
+		pages: [][]*resourcegroupstaggingapi.ResourceTagMapping{
+			{
+				{ResourceARN: aws.String("arn:aws:ec2:us-east-1:123456789012:instance/i-1")},
+				{ResourceARN: aws.String("arn:aws:ec2:us-east-1:123456789012:instance/i-2")},
+			},
+			{
+				{ResourceARN: aws.String("arn:aws:ec2:us-east-1:123456789012:instance/i-3")},
+			},
+		},
+		calls: calls,
+	}
+	newRGTAClient = func(client.ConfigProvider) resourcegroupstaggingapiiface.ResourceGroupsTaggingAPIAPI {
+		return cli
+	}
+
+	rows := runMetricFindQuery(t, map[string]interface{}{
+		"subtype":      "resource_arns",
+		"region":       "us-east-1",
+		"resourceType": "ec2:instance",
+		"tags": map[string]interface{}{
+			"Environment": []interface{}{"production"},
+		},
+	})
+
+	require.Len(t, calls.getResources, 2)
+	assert.Nil(t, calls.getResources[0].PaginationToken)
+	assert.Equal(t, aws.String("1"), calls.getResources[1].PaginationToken)
+	for _, in := range calls.getResources {
+		assert.Equal(t, []*string{aws.String("ec2:instance")}, in.ResourceTypeFilters)
+		assert.Equal(t, []*resourcegroupstaggingapi.TagFilter{
+			{Key: aws.String("Environment"), Values: []*string{aws.String("production")}},
+		}, in.TagFilters)
+	}
+
+	assert.Equal(t, []tsdb.RowValues{
+		{"arn:aws:ec2:us-east-1:123456789012:instance/i-1", "arn:aws:ec2:us-east-1:123456789012:instance/i-1"},
+		{"arn:aws:ec2:us-east-1:123456789012:instance/i-2", "arn:aws:ec2:us-east-1:123456789012:instance/i-2"},
+		{"arn:aws:ec2:us-east-1:123456789012:instance/i-3", "arn:aws:ec2:us-east-1:123456789012:instance/i-3"},
+	}, rows)
+}
+
+func TestQuery_LogGroups(t *testing.T) {
+	origNewCWLogsClient := NewCWLogsClient
+	t.Cleanup(func() {
+		NewCWLogsClient = origNewCWLogsClient
+	})
+
+	var cli FakeCWLogsClient
+
+	NewCWLogsClient = func(sess *session.Session) cloudwatchlogsiface.CloudWatchLogsAPI {
+		return cli
+	}
+
+	logGroups := cloudwatchlogs.DescribeLogGroupsOutput{
+		LogGroups: []*cloudwatchlogs.LogGroup{
+			{
+				LogGroupName: aws.String("/aws/lambda/a"),
+				Arn:          aws.String("arn:aws:logs:us-east-1:123456789012:log-group:/aws/lambda/a:*"),
+			},
+			{
+				LogGroupName: aws.String("/aws/lambda/b"),
+				Arn:          aws.String("arn:aws:logs:us-east-1:123456789012:log-group:/aws/lambda/b:*"),
+			},
+		},
+	}
+
+	runQuery := func(t *testing.T, model map[string]interface{}) []tsdb.RowValues {
+		t.Helper()
+
+		model["subtype"] = "logGroups"
+		return runMetricFindQuery(t, model)
+	}
+
+	t.Run("Log group names are returned for a prefix", func(t *testing.T) {
+		cli = FakeCWLogsClient{logGroups: logGroups, calls: &logsCalls{}}
+
+		rows := runQuery(t, map[string]interface{}{
+			"region":             "us-east-1",
+			"logGroupNamePrefix": "/aws/lambda",
+		})
+
+		assert.Equal(t, []tsdb.RowValues{
+			{"/aws/lambda/a", "/aws/lambda/a"},
+			{"/aws/lambda/b", "/aws/lambda/b"},
+		}, rows)
+		require.Len(t, cli.calls.describeLogGroups, 1)
+		assert.Equal(t, &cloudwatchlogs.DescribeLogGroupsInput{
+			Limit:              aws.Int64(50),
+			LogGroupNamePrefix: aws.String("/aws/lambda"),
+		}, cli.calls.describeLogGroups[0])
+	})
+
+	t.Run("Log group ARNs are used as values when requested", func(t *testing.T) {
+		cli = FakeCWLogsClient{logGroups: logGroups, calls: &logsCalls{}}
+
+		rows := runQuery(t, map[string]interface{}{
+			"region":     "default",
+			"returnArns": true,
+		})
+
+		assert.Equal(t, []tsdb.RowValues{
+			{"/aws/lambda/a", "arn:aws:logs:us-east-1:123456789012:log-group:/aws/lambda/a"},
+			{"/aws/lambda/b", "arn:aws:logs:us-east-1:123456789012:log-group:/aws/lambda/b"},
+		}, rows)
+		require.Len(t, cli.calls.describeLogGroups, 1)
+		assert.Nil(t, cli.calls.describeLogGroups[0].LogGroupNamePrefix)
+	})
+}
+
+func TestQuery_DimensionKeysByFilter(t *testing.T) {
+	origNewCWClient := NewCWClient
+	t.Cleanup(func() {
+		NewCWClient = origNewCWClient
+	})
+
+	newMetric := func(dimensionNames ...string) *cloudwatch.Metric {
+		metric := &cloudwatch.Metric{
+			Namespace:  aws.String("AWS/EC2"),
+			MetricName: aws.String("CPUUtilization"),
+		}
+		for _, name := range dimensionNames {
+			metric.Dimensions = append(metric.Dimensions, &cloudwatch.Dimension{
+				Name:  aws.String(name),
+				Value: aws.String("value"),
+			})
+		}
+		return metric
+	}
+	cli := FakeCWClient{
+		Metrics: []*cloudwatch.Metric{
+			newMetric("InstanceId"),
+			newMetric("AutoScalingGroupName"),
+			newMetric("InstanceId", "ImageId"),
+			newMetric("InstanceType", "InstanceId"),
+			newMetric(),
+		},
+		calls: &cloudWatchCalls{},
+	}
+	NewCWClient = func(sess *session.Session) cloudwatchiface.CloudWatchAPI {
+		return cli
+	}
+
+	runQuery := func(t *testing.T, dimensions map[string]interface{}) []tsdb.RowValues {
+		return runMetricFindQuery(t, map[string]interface{}{
+			"subtype":    "dimension_keys",
+			"region":     "us-east-1",
+			"namespace":  "AWS/EC2",
+			"metricName": "CPUUtilization",
+			"dimensions": dimensions,
+		})
+	}
+
+	t.Run("Distinct dimension keys of the metric are returned", func(t *testing.T) {
+		cli.calls.listMetrics = nil
+
+		rows := runQuery(t, map[string]interface{}{})
+
+		assert.Equal(t, []tsdb.RowValues{
+			{"AutoScalingGroupName", "AutoScalingGroupName"},
+			{"ImageId", "ImageId"},
+			{"InstanceId", "InstanceId"},
+			{"InstanceType", "InstanceType"},
+		}, rows)
+		require.Len(t, cli.calls.listMetrics, 1)
+		assert.Equal(t, &cloudwatch.ListMetricsInput{
+			Namespace:  aws.String("AWS/EC2"),
+			MetricName: aws.String("CPUUtilization"),
+		}, cli.calls.listMetrics[0])
+	})
+
+	t.Run("Selected dimensions filter the metrics and are left out", func(t *testing.T) {
+		cli.calls.listMetrics = nil
+
+		rows := runQuery(t, map[string]interface{}{
+			"InstanceId": []interface{}{"i-123"},
+		})
+
+		// The fake client doesn't filter, but the selected key itself must not be suggested again
+		assert.Equal(t, []tsdb.RowValues{
+			{"AutoScalingGroupName", "AutoScalingGroupName"},
+			{"ImageId", "ImageId"},
+			{"InstanceType", "InstanceType"},
+		}, rows)
+		require.Len(t, cli.calls.listMetrics, 1)
+		assert.Equal(t, []*cloudwatch.DimensionFilter{
+			{Name: aws.String("InstanceId"), Value: aws.String("i-123")},
+		}, cli.calls.listMetrics[0].Dimensions)
+	})
+
+	t.Run("Selected values that aren't strings are left out", func(t *testing.T) {
+		cli.calls.listMetrics = nil
+
+		rows := runQuery(t, map[string]interface{}{
+			"InstanceId": []interface{}{"i-123", 42, nil, map[string]interface{}{"value": "i-456"}},
+		})
+
+		assert.Len(t, rows, 3)
+		require.Len(t, cli.calls.listMetrics, 1)
+		assert.Equal(t, []*cloudwatch.DimensionFilter{
+			{Name: aws.String("InstanceId"), Value: aws.String("i-123")},
+		}, cli.calls.listMetrics[0].Dimensions)
+	})
+}
+
+func TestQuery_ListMetrics_Pagination(t *testing.T) {
+	origNewCWClient := NewCWClient
+	origMaxListMetricsPages := maxListMetricsPages
+	t.Cleanup(func() {
+		NewCWClient = origNewCWClient
+		maxListMetricsPages = origMaxListMetricsPages
+	})
+
+	newMetric := func(name, dimensionName string) *cloudwatch.Metric {
+		return &cloudwatch.Metric{
+			MetricName: aws.String(name),
+			Dimensions: []*cloudwatch.Dimension{
+				{Name: aws.String(dimensionName), Value: aws.String("value")},
+			},
+		}
+	}
+	cli := FakeCWClient{
+		MetricPages: [][]*cloudwatch.Metric{
+			{newMetric("MetricA", "DimensionA")},
+			{newMetric("MetricB", "DimensionB")},
+		},
+	}
+	NewCWClient = func(sess *session.Session) cloudwatchiface.CloudWatchAPI {
+		return cli
+	}
+
+	runQuery := func(t *testing.T, model map[string]interface{}) []tsdb.RowValues {
+		model["region"] = "us-east-1"
+		return runMetricFindQuery(t, model)
+	}
+
+	t.Run("Metrics from all pages are returned", func(t *testing.T) {
+		rows := runQuery(t, map[string]interface{}{
+			"subtype":   "metrics",
+			"namespace": "custom/Paginated",
+		})
+
+		assert.Equal(t, []tsdb.RowValues{
+			{"MetricA", "MetricA"},
+			{"MetricB", "MetricB"},
+		}, rows)
+	})
+
+	t.Run("Dimension keys from all pages are returned", func(t *testing.T) {
+		rows := runQuery(t, map[string]interface{}{
+			"subtype":    "dimension_keys",
+			"namespace":  "custom/Paginated",
+			"metricName": "MetricA",
+		})
+
+		assert.Equal(t, []tsdb.RowValues{
+			{"DimensionA", "DimensionA"},
+			{"DimensionB", "DimensionB"},
+		}, rows)
+	})
+
+	t.Run("Pages beyond the limit are not fetched", func(t *testing.T) {
+		maxListMetricsPages = 1
+		t.Cleanup(func() {
+			maxListMetricsPages = origMaxListMetricsPages
+		})
+
+		rows := runQuery(t, map[string]interface{}{
+			"subtype":    "dimension_keys",
+			"namespace":  "custom/Paginated",
+			"metricName": "MetricA",
+		})
+
+		assert.Equal(t, []tsdb.RowValues{
+			{"DimensionA", "DimensionA"},
+		}, rows)
+	})
+}
+
+func TestQuery_AllDimensionKeys(t *testing.T) {
+	origNewCWClient := NewCWClient
+	t.Cleanup(func() {
+		NewCWClient = origNewCWClient
+	})
+
+	newMetric := func(name string, dimensionNames ...string) *cloudwatch.Metric {
+		metric := &cloudwatch.Metric{MetricName: aws.String(name)}
+		for _, dimensionName := range dimensionNames {
+			metric.Dimensions = append(metric.Dimensions, &cloudwatch.Dimension{
+				Name:  aws.String(dimensionName),
+				Value: aws.String("value"),
+			})
+		}
+		return metric
+	}
+	cli := FakeCWClient{
+		MetricPages: [][]*cloudwatch.Metric{
+			{newMetric("CPUUtilization", "InstanceId"), newMetric("CPUUtilization", "AutoScalingGroupName")},
+			{newMetric("NetworkIn", "InstanceId", "InstanceType"), newMetric("StatusCheckFailed")},
+			{newMetric("DiskReadOps", "ImageId", "InstanceId")},
+		},
+		calls: &cloudWatchCalls{},
+	}
+	NewCWClient = func(sess *session.Session) cloudwatchiface.CloudWatchAPI {
+		return cli
+	}
+
+	rows := runMetricFindQuery(t, map[string]interface{}{
+		"subtype":   "allDimensionKeys",
+		"region":    "us-east-1",
+		"namespace": "AWS/EC2",
+	})
+
+	assert.Equal(t, []tsdb.RowValues{
+		{"AutoScalingGroupName", "AutoScalingGroupName"},
+		{"ImageId", "ImageId"},
+		{"InstanceId", "InstanceId"},
+		{"InstanceType", "InstanceType"},
+	}, rows)
+
+	require.Len(t, cli.calls.listMetrics, 1)
+	assert.Equal(t, "AWS/EC2", *cli.calls.listMetrics[0].Namespace)
+	assert.Nil(t, cli.calls.listMetrics[0].MetricName)
+	assert.Empty(t, cli.calls.listMetrics[0].Dimensions)
+}
+
+func TestQuery_DimensionValues(t *testing.T) {
+	stubNewSession(t)
+	origNewCWClient := NewCWClient
+	t.Cleanup(func() {
+		NewCWClient = origNewCWClient
+	})
+
+	newMetric := func(dimensions map[string]string) *cloudwatch.Metric {
+		metric := &cloudwatch.Metric{
+			Namespace:  aws.String("AWS/EC2"),
+			MetricName: aws.String("CPUUtilization"),
+		}
+		for name, value := range dimensions {
+			metric.Dimensions = append(metric.Dimensions, &cloudwatch.Dimension{
+				Name:  aws.String(name),
+				Value: aws.String(value),
+			})
+		}
+		return metric
+	}
+	cli := FakeCWClient{
+		Metrics: []*cloudwatch.Metric{
+			newMetric(map[string]string{"InstanceId": "i-2", "InstanceType": "t3.micro"}),
+			newMetric(map[string]string{"InstanceId": "i-1", "InstanceType": "t3.micro"}),
+			newMetric(map[string]string{"InstanceId": "i-2"}),
+			newMetric(map[string]string{"AutoScalingGroupName": "asg"}),
+		},
+		calls: &cloudWatchCalls{},
+	}
+	var regions []string
+	NewCWClient = func(sess *session.Session) cloudwatchiface.CloudWatchAPI {
+		regions = append(regions, aws.StringValue(sess.Config.Region))
+		return cli
+	}
+
+	dataSource := fakeDataSource()
+	dataSource.JsonData.Set("defaultRegion", "eu-west-1")
+
+	executor := newExecutor(nil)
+	resp, err := executor.Query(context.Background(), dataSource, &tsdb.TsdbQuery{
+		Queries: []*tsdb.Query{
+			{
+				Model: simplejson.NewFromAny(map[string]interface{}{
+					"type":         "metricFindQuery",
+					"subtype":      "dimension_values",
+					"namespace":    "AWS/EC2",
+					"metricName":   "CPUUtilization",
+					"dimensionKey": "InstanceId",
+					"dimensions": map[string]interface{}{
+						"InstanceType": "t3.micro",
+					},
+				}),
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, []tsdb.RowValues{
+		{"i-1", "i-1"},
+		{"i-2", "i-2"},
+	}, resp.Results[""].Tables[0].Rows)
+	assert.Equal(t, []string{"eu-west-1"}, regions)
+	require.Len(t, cli.calls.listMetrics, 1)
+	assert.Equal(t, &cloudwatch.ListMetricsInput{
+		Namespace:  aws.String("AWS/EC2"),
+		MetricName: aws.String("CPUUtilization"),
+		Dimensions: []*cloudwatch.DimensionFilter{
+			{Name: aws.String("InstanceType"), Value: aws.String("t3.micro")},
+			{Name: aws.String("InstanceId")},
+		},
+	}, cli.calls.listMetrics[0])
+}
+
+func TestQuery_DimensionValues_MultipleRegions(t *testing.T) {
+	stubNewSession(t)
+	origNewCWClient := NewCWClient
+	t.Cleanup(func() {
+		NewCWClient = origNewCWClient
+	})
+
+	newMetric := func(instanceID string) *cloudwatch.Metric {
+		return &cloudwatch.Metric{
+			Namespace:  aws.String("AWS/EC2"),
+			MetricName: aws.String("CPUUtilization"),
+			Dimensions: []*cloudwatch.Dimension{
+				{Name: aws.String("InstanceId"), Value: aws.String(instanceID)},
+			},
+		}
+	}
+	metricsByRegion := map[string][]*cloudwatch.Metric{
+		"us-east-1": {newMetric("i-3"), newMetric("i-2")},
+		"eu-west-1": {newMetric("i-2"), newMetric("i-1")},
+	}
+	var regions []string
+	NewCWClient = func(sess *session.Session) cloudwatchiface.CloudWatchAPI {
+		region := aws.StringValue(sess.Config.Region)
+		regions = append(regions, region)
+		return FakeCWClient{Metrics: metricsByRegion[region], calls: &cloudWatchCalls{}}
+	}
+
+	for name, region := range map[string]interface{}{
+		"list":                []interface{}{"us-east-1", "eu-west-1"},
+		"multi-valued string": "{us-east-1,eu-west-1}",
+	} {
+		t.Run(name, func(t *testing.T) {
+			regions = nil
+
+			rows := runMetricFindQuery(t, map[string]interface{}{
+				"subtype":      "dimension_values",
+				"region":       region,
+				"namespace":    "AWS/EC2",
+				"metricName":   "CPUUtilization",
+				"dimensionKey": "InstanceId",
+			})
+
+			assert.Equal(t, []tsdb.RowValues{
+				{"i-2", "i-2"},
+				{"i-3", "i-3"},
+				{"i-1", "i-1"},
+			}, rows)
+			assert.Equal(t, []string{"us-east-1", "eu-west-1"}, regions)
+		})
+	}
+
+	for name, region := range map[string]interface{}{
+		"empty list":          []interface{}{},
+		"list of blank names": []interface{}{"", " "},
+	} {
+		t.Run(name+" queries the default region", func(t *testing.T) {
+			regions = nil
+
+			rows := runMetricFindQuery(t, map[string]interface{}{
+				"subtype":      "dimension_values",
+				"region":       region,
+				"namespace":    "AWS/EC2",
+				"metricName":   "CPUUtilization",
+				"dimensionKey": "InstanceId",
+			})
+
+			assert.Equal(t, []tsdb.RowValues{
+				{"i-2", "i-2"},
+				{"i-3", "i-3"},
+			}, rows)
+			assert.Equal(t, []string{"us-east-1"}, regions)
+		})
+	}
+}
+
+func TestQuery_DimensionValues_MultipleFilterValues(t *testing.T) {
+	origNewCWClient := NewCWClient
+	t.Cleanup(func() {
+		NewCWClient = origNewCWClient
+	})
+
+	newMetric := func(instanceID, instanceType, imageID string) *cloudwatch.Metric {
+		return &cloudwatch.Metric{
+			Namespace:  aws.String("AWS/EC2"),
+			MetricName: aws.String("CPUUtilization"),
+			Dimensions: []*cloudwatch.Dimension{
+				{Name: aws.String("InstanceId"), Value: aws.String(instanceID)},
+				{Name: aws.String("InstanceType"), Value: aws.String(instanceType)},
+				{Name: aws.String("ImageId"), Value: aws.String(imageID)},
+			},
+		}
+	}
+	var cli FakeCWClient
+	NewCWClient = func(sess *session.Session) cloudwatchiface.CloudWatchAPI {
+		return cli
+	}
+
+	runQuery := func(t *testing.T, dimensions map[string]interface{}) []tsdb.RowValues {
+		cli = FakeCWClient{
+			Metrics: []*cloudwatch.Metric{
+				newMetric("i-1", "t3.micro", "ami-a"),
+				newMetric("i-2", "t3.large", "ami-a"),
+				newMetric("i-3", "t3.xlarge", "ami-a"),
+				newMetric("i-4", "t3.micro", "ami-b"),
+			},
+			FilterMetrics: true,
+			calls:         &cloudWatchCalls{},
+		}
+
+		return runMetricFindQuery(t, map[string]interface{}{
+			"subtype":      "dimension_values",
+			"region":       "us-east-1",
+			"namespace":    "AWS/EC2",
+			"metricName":   "CPUUtilization",
+			"dimensionKey": "InstanceId",
+			"dimensions":   dimensions,
+		})
+	}
+
+	t.Run("Values of a dimension are ORed", func(t *testing.T) {
+		rows := runQuery(t, map[string]interface{}{
+			"InstanceType": []interface{}{"t3.micro", "t3.large"},
+		})
+
+		assert.Equal(t, []tsdb.RowValues{
+			{"i-1", "i-1"},
+			{"i-2", "i-2"},
+			{"i-4", "i-4"},
+		}, rows)
+		assert.Len(t, cli.calls.listMetrics, 2)
+	})
+
+	t.Run("Different dimensions are ANDed", func(t *testing.T) {
+		rows := runQuery(t, map[string]interface{}{
+			"InstanceType": []interface{}{"t3.micro", "t3.large"},
+			"ImageId":      "ami-a",
+		})
+
+		assert.Equal(t, []tsdb.RowValues{
+			{"i-1", "i-1"},
+			{"i-2", "i-2"},
+		}, rows)
+		assert.Len(t, cli.calls.listMetrics, 2)
+	})
+
+	t.Run("Too many combinations of values are rejected", func(t *testing.T) {
+		values := make([]interface{}, 0, maxDimensionFilterCombinations+1)
+		for i := 0; i <= maxDimensionFilterCombinations; i++ {
+			values = append(values, fmt.Sprintf("t3.size%d", i))
+		}
+		cli = FakeCWClient{calls: &cloudWatchCalls{}}
+
+		executor := newExecutor(nil)
+		_, err := executor.Query(context.Background(), fakeDataSource(), &tsdb.TsdbQuery{
+			Queries: []*tsdb.Query{
+				{
+					Model: simplejson.NewFromAny(map[string]interface{}{
+						"type":         "metricFindQuery",
+						"subtype":      "dimension_values",
+						"region":       "us-east-1",
+						"namespace":    "AWS/EC2",
+						"metricName":   "CPUUtilization",
+						"dimensionKey": "InstanceId",
+						"dimensions":   map[string]interface{}{"InstanceType": values},
+					}),
+				},
+			},
+		})
+		require.Error(t, err)
+		assert.Empty(t, cli.calls.listMetrics)
+	})
+}
+
+func TestQuery_MetricStreams(t *testing.T) {
+	origNewMetricStreamsClient := newMetricStreamsClient
+	t.Cleanup(func() {
+		newMetricStreamsClient = origNewMetricStreamsClient
+	})
+
+	var calls []*listMetricStreamsInput
+	newMetricStreamsClient = func(*session.Session) metricStreamsAPI {
+		return fakeMetricStreamsClient{
+			pages: [][]*metricStreamEntry{
+				{
+					{Name: aws.String("to-firehose"), State: aws.String("running")},
+					{Name: aws.String("all-metrics"), State: aws.String("stopped")},
+				},
+				{
+					{Name: aws.String("ec2-metrics"), State: aws.String("running")},
+				},
+			},
+			calls: &calls,
+		}
+	}
+
+	rows := runMetricFindQuery(t, map[string]interface{}{
+		"subtype": "metric_streams",
+		"region":  "us-east-1",
+	})
+
+	require.Len(t, calls, 2)
+	assert.Nil(t, calls[0].NextToken)
+	assert.Equal(t, "1", aws.StringValue(calls[1].NextToken))
+	assert.Equal(t, []tsdb.RowValues{
+		{"all-metrics", "stopped"},
+		{"ec2-metrics", "running"},
+		{"to-firehose", "running"},
+	}, rows)
+}
+
+func TestQuery_ECS(t *testing.T) {
+	origNewECSClient := newECSClient
+	t.Cleanup(func() {
+		newECSClient = origNewECSClient
+	})
+
+	newECSClient = func(client.ConfigProvider) ecsiface.ECSAPI {
+		return fakeECSClient{
+			clusterPages: [][]string{
+				{"arn:aws:ecs:us-east-1:123456789012:cluster/web"},
+				{"arn:aws:ecs:us-east-1:123456789012:cluster/batch"},
+			},
+			servicePages: map[string][][]string{
+				"web": {
+					{"arn:aws:ecs:us-east-1:123456789012:service/web/frontend"},
+					{"arn:aws:ecs:us-east-1:123456789012:service/api"},
+				},
+			},
+		}
+	}
+
+	t.Run("Cluster names of all pages are returned", func(t *testing.T) {
+		rows := runMetricFindQuery(t, map[string]interface{}{
+			"subtype": "ecs_clusters",
+			"region":  "us-east-1",
+		})
+
+		assert.Equal(t, []tsdb.RowValues{
+			{"batch", "batch"},
+			{"web", "web"},
+		}, rows)
+	})
+
+	t.Run("Service names of all pages are returned", func(t *testing.T) {
+		rows := runMetricFindQuery(t, map[string]interface{}{
+			"subtype": "ecs_services",
+			"region":  "us-east-1",
+			"cluster": "web",
+		})
+
+		assert.Equal(t, []tsdb.RowValues{
+			{"api", "api"},
+			{"frontend", "frontend"},
+		}, rows)
+	})
+
+	t.Run("Services require a cluster", func(t *testing.T) {
+		executor := newExecutor(nil)
+		_, err := executor.Query(context.Background(), fakeDataSource(), &tsdb.TsdbQuery{
+			Queries: []*tsdb.Query{
+				{
+					Model: simplejson.NewFromAny(map[string]interface{}{
+						"type":    "metricFindQuery",
+						"subtype": "ecs_services",
+						"region":  "us-east-1",
+					}),
+				},
+			},
+		})
+		assert.EqualError(t, err, "cluster is required")
+	})
+}
+
+func TestQuery_Statistics(t *testing.T) {
+	runQuery := func(t *testing.T, namespace string) []tsdb.RowValues {
+		t.Helper()
+
+		return runMetricFindQuery(t, map[string]interface{}{
+			"subtype":   "statistics",
+			"namespace": namespace,
+		})
+	}
+
+	t.Run("Standard and common extended statistics are returned for any namespace", func(t *testing.T) {
+		expected := []tsdb.RowValues{
+			{"Average", "Average"},
+			{"Maximum", "Maximum"},
+			{"Minimum", "Minimum"},
+			{"Sum", "Sum"},
+			{"SampleCount", "SampleCount"},
+			{"p50", "p50"},
+			{"p90", "p90"},
+			{"p95", "p95"},
+			{"p99", "p99"},
+		}
+		assert.Equal(t, expected, runQuery(t, "AWS/EC2"))
+		assert.Equal(t, expected, runQuery(t, "custom"))
+		assert.Equal(t, expected, runQuery(t, ""))
+	})
+
+	t.Run("Latency statistics are added for namespaces with latency metrics", func(t *testing.T) {
+		assert.Equal(t, []tsdb.RowValues{
+			{"Average", "Average"},
+			{"Maximum", "Maximum"},
+			{"Minimum", "Minimum"},
+			{"Sum", "Sum"},
+			{"SampleCount", "SampleCount"},
+			{"p50", "p50"},
+			{"p90", "p90"},
+			{"p95", "p95"},
+			{"p99", "p99"},
+			{"p99.9", "p99.9"},
+			{"tm90", "tm90"},
+			{"tm99", "tm99"},
+		}, runQuery(t, "AWS/ApplicationELB"))
+	})
+}
+
+func TestQuery_TestRegion(t *testing.T) {
+	stubNewSession(t)
+	origNewCWClient := NewCWClient
+	t.Cleanup(func() {
+		NewCWClient = origNewCWClient
+	})
+
+	calls := &cloudWatchCalls{}
+	NewCWClient = func(sess *session.Session) cloudwatchiface.CloudWatchAPI {
+		cli := FakeCWClient{calls: calls}
+		if aws.StringValue(sess.Config.Region) == "eu-west-1" {
+			cli.ListMetricsErr = awserr.New("AccessDeniedException",
+				"User is not authorized to perform: cloudwatch:ListMetrics with an explicit deny", nil)
+		}
+		return cli
+	}
+
+	runQuery := func(t *testing.T, region string) []tsdb.RowValues {
+		t.Helper()
+
+		return runMetricFindQuery(t, map[string]interface{}{
+			"subtype": "test_region",
+			"region":  region,
+		})
+	}
+
+	t.Run("Reachable region", func(t *testing.T) {
+		calls.listMetrics = nil
+
+		assert.Equal(t, []tsdb.RowValues{{"us-east-1", "ok"}}, runQuery(t, "us-east-1"))
+		require.Len(t, calls.listMetrics, 1)
+		assert.Equal(t, "AWS/EC2", aws.StringValue(calls.listMetrics[0].Namespace))
+	})
+
+	t.Run("Each of several regions is tested", func(t *testing.T) {
+		calls.listMetrics = nil
+
+		assert.Equal(t, []tsdb.RowValues{
+			{"us-east-1", "ok"},
+			{"eu-west-1", "failed to call cloudwatch:ListMetrics: AccessDeniedException: User is not authorized to " +
+				"perform: cloudwatch:ListMetrics with an explicit deny"},
+			{"default", "ok"},
+		}, runQuery(t, "{us-east-1,eu-west-1,default}"))
+		assert.Len(t, calls.listMetrics, 3)
+	})
+}
+
+func TestQuery_S3Buckets(t *testing.T) {
+	origNewS3Client := newS3Client
+	t.Cleanup(func() {
+		newS3Client = origNewS3Client
+	})
+
+	newS3Client = func(client.ConfigProvider) s3iface.S3API {
+		return fakeS3Client{
+			buckets: map[string]string{
+				"logs-virginia": "",
+				"logs-ireland":  "EU",
+				"assets":        "eu-west-1",
+				"backups":       "ap-southeast-2",
+				"private":       "eu-west-1",
+			},
+			locationErrors: map[string]error{
+				"private": awserr.New("AccessDenied", "Access Denied", nil),
+			},
+		}
+	}
+
+	runQuery := func(t *testing.T, model map[string]interface{}) []tsdb.RowValues {
+		t.Helper()
+
+		model["subtype"] = "s3_buckets"
+		return runMetricFindQuery(t, model)
+	}
+
+	t.Run("Buckets of all regions are returned", func(t *testing.T) {
+		assert.Equal(t, []tsdb.RowValues{
+			{"assets", "assets"},
+			{"backups", "backups"},
+			{"logs-ireland", "logs-ireland"},
+			{"logs-virginia", "logs-virginia"},
+			{"private", "private"},
+		}, runQuery(t, map[string]interface{}{"region": "eu-west-1"}))
+	})
+
+	t.Run("Buckets can be filtered by region", func(t *testing.T) {
+		assert.Equal(t, []tsdb.RowValues{
+			{"assets", "assets"},
+			{"logs-ireland", "logs-ireland"},
+		}, runQuery(t, map[string]interface{}{"region": "eu-west-1", "filterByRegion": true}))
+	})
+
+	t.Run("Buckets without location constraint are in us-east-1", func(t *testing.T) {
+		assert.Equal(t, []tsdb.RowValues{
+			{"logs-virginia", "logs-virginia"},
+		}, runQuery(t, map[string]interface{}{"region": "default", "filterByRegion": true}))
+	})
+
+	t.Run("Bucket locations are requested a few at a time", func(t *testing.T) {
+		origMaxConcurrentBucketLocations := maxConcurrentBucketLocations
+		t.Cleanup(func() {
+			maxConcurrentBucketLocations = origMaxConcurrentBucketLocations
+		})
+		maxConcurrentBucketLocations = 3
+
+		buckets := map[string]string{}
+		var expected []tsdb.RowValues
+		for i := 0; i < 20; i++ {
+			name := fmt.Sprintf("bucket-%02d", i)
+			if i%2 == 0 {
+				buckets[name] = "eu-west-1"
+				expected = append(expected, tsdb.RowValues{name, name})
+			} else {
+				buckets[name] = "us-west-2"
+			}
+		}
+		locationRequests := &inFlightRequests{}
+		newS3Client = func(client.ConfigProvider) s3iface.S3API {
+			return fakeS3Client{buckets: buckets, locationRequests: locationRequests}
+		}
+
+		assert.Equal(t, expected, runQuery(t, map[string]interface{}{"region": "eu-west-1", "filterByRegion": true}))
+		assert.LessOrEqual(t, locationRequests.max, 3)
+		assert.Zero(t, locationRequests.current)
+	})
+}
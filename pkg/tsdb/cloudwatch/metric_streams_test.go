@@ -0,0 +1,150 @@
+package cloudwatch
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Responses as documented for the CloudWatch Query API, since the SDK in use has no ListMetricStreams to compare with
+const listMetricStreamsFirstPage = `<ListMetricStreamsResponse xmlns="http://monitoring.amazonaws.com/doc/2010-08-01/">
+  <ListMetricStreamsResult>
+    <Entries>
+      <member>
+        <Arn>arn:aws:cloudwatch:us-east-1:123456789012:metric-stream/to-firehose</Arn>
+        <CreationDate>2021-03-31T08:00:00Z</CreationDate>
+        <FirehoseArn>arn:aws:firehose:us-east-1:123456789012:deliverystream/metrics</FirehoseArn>
+        <LastUpdateDate>2021-04-01T09:30:00Z</LastUpdateDate>
+        <Name>to-firehose</Name>
+        <OutputFormat>json</OutputFormat>
+        <State>running</State>
+      </member>
+      <member>
+        <Arn>arn:aws:cloudwatch:us-east-1:123456789012:metric-stream/all-metrics</Arn>
+        <CreationDate>2021-03-30T08:00:00Z</CreationDate>
+        <FirehoseArn>arn:aws:firehose:us-east-1:123456789012:deliverystream/all</FirehoseArn>
+        <LastUpdateDate>2021-03-30T08:00:00Z</LastUpdateDate>
+        <Name>all-metrics</Name>
+        <OutputFormat>opentelemetry0.7</OutputFormat>
+        <State>stopped</State>
+      </member>
+    </Entries>
+    <NextToken>page-2</NextToken>
+  </ListMetricStreamsResult>
+  <ResponseMetadata>
+    <RequestId>0f1c2e4a-1111-4b6e-8f1a-5a0b2d3c4e5f</RequestId>
+  </ResponseMetadata>
+</ListMetricStreamsResponse>`
+
+const listMetricStreamsLastPage = `<ListMetricStreamsResponse xmlns="http://monitoring.amazonaws.com/doc/2010-08-01/">
+  <ListMetricStreamsResult>
+    <Entries>
+      <member>
+        <Arn>arn:aws:cloudwatch:us-east-1:123456789012:metric-stream/ec2-metrics</Arn>
+        <CreationDate>2021-04-02T08:00:00Z</CreationDate>
+        <FirehoseArn>arn:aws:firehose:us-east-1:123456789012:deliverystream/ec2</FirehoseArn>
+        <LastUpdateDate>2021-04-02T08:00:00Z</LastUpdateDate>
+        <Name>ec2-metrics</Name>
+        <OutputFormat>json</OutputFormat>
+        <State>running</State>
+      </member>
+    </Entries>
+  </ListMetricStreamsResult>
+  <ResponseMetadata>
+    <RequestId>7a8b9c0d-2222-4b6e-8f1a-5a0b2d3c4e5f</RequestId>
+  </ResponseMetadata>
+</ListMetricStreamsResponse>`
+
+const listMetricStreamsAccessDenied = `<ErrorResponse xmlns="http://monitoring.amazonaws.com/doc/2010-08-01/">
+  <Error>
+    <Type>Sender</Type>
+    <Code>AccessDenied</Code>
+    <Message>User is not authorized to perform: cloudwatch:ListMetricStreams</Message>
+  </Error>
+  <RequestId>3d4e5f6a-3333-4b6e-8f1a-5a0b2d3c4e5f</RequestId>
+</ErrorResponse>`
+
+func TestMetricStreamsClient(t *testing.T) {
+	var forms []map[string]string
+	var respond func(w http.ResponseWriter, r *http.Request)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		form := map[string]string{}
+		for key := range r.PostForm {
+			form[key] = r.PostForm.Get(key)
+		}
+		forms = append(forms, form)
+		respond(w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	sess, err := session.NewSession(&aws.Config{
+		Region:      aws.String("us-east-1"),
+		Endpoint:    aws.String(server.URL),
+		Credentials: credentials.NewStaticCredentials("AKID", "SECRET", ""),
+		MaxRetries:  aws.Int(0),
+	})
+	require.NoError(t, err)
+	client := newMetricStreamsClient(sess)
+
+	t.Run("Pages of metric streams are sent and parsed like the CloudWatch Query API does", func(t *testing.T) {
+		forms = nil
+		respond = func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/xml")
+			if r.PostForm.Get("NextToken") == "" {
+				_, _ = w.Write([]byte(listMetricStreamsFirstPage))
+				return
+			}
+			_, _ = w.Write([]byte(listMetricStreamsLastPage))
+		}
+
+		output, err := client.ListMetricStreamsWithContext(context.Background(), &listMetricStreamsInput{})
+		require.NoError(t, err)
+		require.Len(t, output.Entries, 2)
+		assert.Equal(t, &metricStreamEntry{
+			Arn:            aws.String("arn:aws:cloudwatch:us-east-1:123456789012:metric-stream/to-firehose"),
+			CreationDate:   aws.Time(time.Date(2021, 3, 31, 8, 0, 0, 0, time.UTC)),
+			FirehoseArn:    aws.String("arn:aws:firehose:us-east-1:123456789012:deliverystream/metrics"),
+			LastUpdateDate: aws.Time(time.Date(2021, 4, 1, 9, 30, 0, 0, time.UTC)),
+			Name:           aws.String("to-firehose"),
+			OutputFormat:   aws.String("json"),
+			State:          aws.String("running"),
+		}, output.Entries[0])
+		assert.Equal(t, "all-metrics", aws.StringValue(output.Entries[1].Name))
+		assert.Equal(t, "stopped", aws.StringValue(output.Entries[1].State))
+		assert.Equal(t, "page-2", aws.StringValue(output.NextToken))
+
+		output, err = client.ListMetricStreamsWithContext(context.Background(),
+			&listMetricStreamsInput{NextToken: output.NextToken, MaxResults: aws.Int64(10)})
+		require.NoError(t, err)
+		require.Len(t, output.Entries, 1)
+		assert.Equal(t, "ec2-metrics", aws.StringValue(output.Entries[0].Name))
+		assert.Nil(t, output.NextToken)
+
+		assert.Equal(t, []map[string]string{
+			{"Action": "ListMetricStreams", "Version": "2010-08-01"},
+			{"Action": "ListMetricStreams", "Version": "2010-08-01", "NextToken": "page-2", "MaxResults": "10"},
+		}, forms)
+	})
+
+	t.Run("CloudWatch errors are returned with their code", func(t *testing.T) {
+		respond = func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/xml")
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte(listMetricStreamsAccessDenied))
+		}
+
+		_, err := client.ListMetricStreamsWithContext(context.Background(), &listMetricStreamsInput{})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "AccessDenied")
+		assert.Contains(t, err.Error(), "not authorized to perform: cloudwatch:ListMetricStreams")
+	})
+}
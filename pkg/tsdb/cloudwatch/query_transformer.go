@@ -4,14 +4,18 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/url"
+	"regexp"
 	"sort"
 	"strings"
 	"time"
 
+	"github.com/aws/aws-sdk-go/aws"
 	"github.com/grafana/grafana-plugin-sdk-go/data"
 	"github.com/grafana/grafana/pkg/tsdb"
 )
 
+var invalidMetricDataQueryIDChars = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
 // returns a map of queries with query id as key. In the case a q request query
 // has more than one statistic defined, one cloudwatchQuery will be created for each statistic.
 // If the query doesn't have an Id defined by the user, we'll give it an with format `query[RefId]`. In the case
@@ -21,13 +25,20 @@ func (e *cloudWatchExecutor) transformRequestQueriesToCloudWatchQueries(requestQ
 	plog.Debug("Transforming CloudWatch request queries")
 	cloudwatchQueries := make(map[string]*cloudWatchQuery)
 	for _, requestQuery := range requestQueries {
-		for _, stat := range requestQuery.Statistics {
+		statistics := requestQuery.Statistics
+		if requestQuery.SqlExpression != "" {
+			// The statistic of a Metrics Insights query is part of its SQL
+			statistics = []*string{aws.String("")}
+		}
+		for _, stat := range statistics {
 			id := requestQuery.Id
 			if id == "" {
 				id = fmt.Sprintf("query%s", requestQuery.RefId)
 			}
-			if len(requestQuery.Statistics) > 1 {
-				id = fmt.Sprintf("%s_%v", id, strings.ReplaceAll(*stat, ".", "_"))
+			multipleStats := len(statistics) > 1
+			if multipleStats {
+				// Extended statistics such as p99.9 or tm(10%:90%) contain characters not allowed in ids
+				id = fmt.Sprintf("%s_%v", id, invalidMetricDataQueryIDChars.ReplaceAllString(*stat, "_"))
 			}
 
 			if _, ok := cloudwatchQueries[id]; ok {
@@ -35,27 +46,53 @@ func (e *cloudWatchExecutor) transformRequestQueriesToCloudWatchQueries(requestQ
 			}
 
 			query := &cloudWatchQuery{
-				Id:         id,
-				RefId:      requestQuery.RefId,
-				Region:     requestQuery.Region,
-				Namespace:  requestQuery.Namespace,
-				MetricName: requestQuery.MetricName,
-				Dimensions: requestQuery.Dimensions,
-				Stats:      *stat,
-				Period:     requestQuery.Period,
-				Alias:      requestQuery.Alias,
-				Expression: requestQuery.Expression,
-				ReturnData: requestQuery.ReturnData,
-				MatchExact: requestQuery.MatchExact,
+				Id:                   id,
+				RefId:                requestQuery.RefId,
+				Region:               requestQuery.Region,
+				Namespace:            requestQuery.Namespace,
+				MetricName:           requestQuery.MetricName,
+				Dimensions:           requestQuery.Dimensions,
+				Stats:                *stat,
+				Period:               requestQuery.Period,
+				Alias:                requestQuery.Alias,
+				Expression:           requestQuery.Expression,
+				SqlExpression:        requestQuery.SqlExpression,
+				ReturnData:           requestQuery.ReturnData,
+				MatchExact:           requestQuery.MatchExact,
+				Timezone:             requestQuery.Timezone,
+				MultipleStats:        multipleStats,
+				MultipleRegions:      requestQuery.MultipleRegions,
+				Unit:                 requestQuery.Unit,
+				IncludeRawResults:    requestQuery.IncludeRawResults,
+				ResolveInstanceNames: requestQuery.ResolveInstanceNames,
+				MaxDataPoints:        requestQuery.MaxDataPoints,
 			}
 			cloudwatchQueries[id] = query
 		}
 	}
 
+	for _, query := range cloudwatchQueries {
+		if !query.isAnomalyDetectionBandExpression() {
+			continue
+		}
+
+		metricID := query.anomalyDetectionBandMetricID()
+		metric, ok := cloudwatchQueries[metricID]
+		if !ok {
+			return nil, fmt.Errorf("error in query %q - anomaly detection band references unknown metric id %q",
+				query.RefId, metricID)
+		}
+		if metric.isMathExpression() {
+			return nil, fmt.Errorf("error in query %q - anomaly detection band must reference a metric, but %q is an expression",
+				query.RefId, metricID)
+		}
+	}
+
 	return cloudwatchQueries, nil
 }
 
-func (e *cloudWatchExecutor) transformQueryResponsesToQueryResult(cloudwatchResponses []*cloudwatchResponse, requestQueries []*requestQuery, startTime time.Time, endTime time.Time) (map[string]*tsdb.QueryResult, error) {
+func (e *cloudWatchExecutor) transformQueryResponsesToQueryResult(cloudwatchResponses []*cloudwatchResponse, requestQueries []*requestQuery,
+	executedRequest string, startTime time.Time, endTime time.Time) (map[string]*tsdb.QueryResult, error) {
 	responsesByRefID := make(map[string][]*cloudwatchResponse)
 	refIDs := sort.StringSlice{}
 	for _, res := range cloudwatchResponses {
@@ -68,6 +105,11 @@ func (e *cloudWatchExecutor) transformQueryResponsesToQueryResult(cloudwatchResp
 	results := make(map[string]*tsdb.QueryResult)
 	for _, refID := range refIDs {
 		responses := responsesByRefID[refID]
+		// Responses are parsed from a map, so order them by query ID to keep series in the same order between
+		// refreshes
+		sort.Slice(responses, func(i, j int) bool {
+			return responses[i].Id < responses[j].Id
+		})
 		queryResult := tsdb.NewQueryResult()
 		queryResult.RefId = refID
 		queryResult.Series = tsdb.TimeSeriesSlice{}
@@ -76,9 +118,22 @@ func (e *cloudWatchExecutor) transformQueryResponsesToQueryResult(cloudwatchResp
 		requestExceededMaxLimit := false
 		partialData := false
 		executedQueries := []executedQuery{}
+		periods := make(map[*data.Frame]int)
+		rawResults := make(map[*data.Frame][]rawMetricDataResult)
+		notices := make(map[*data.Frame][]data.Notice)
 
 		for _, response := range responses {
+			sortFrames(response.DataFrames)
 			frames = append(frames, response.DataFrames...)
+			for _, frame := range response.DataFrames {
+				periods[frame] = effectivePeriod(response.Period, startTime, time.Now())
+				if response.RawResults != nil {
+					rawResults[frame] = response.RawResults
+				}
+				if len(response.Messages) > 0 {
+					notices[frame] = messageNotices(response.Messages)
+				}
+			}
 			requestExceededMaxLimit = requestExceededMaxLimit || response.RequestExceededMaxLimit
 			partialData = partialData || response.PartialData
 			executedQueries = append(executedQueries, executedQuery{
@@ -88,10 +143,6 @@ func (e *cloudWatchExecutor) transformQueryResponsesToQueryResult(cloudwatchResp
 			})
 		}
 
-		sort.Slice(frames, func(i, j int) bool {
-			return frames[i].Name < frames[j].Name
-		})
-
 		if requestExceededMaxLimit {
 			queryResult.ErrorString = "Cloudwatch GetMetricData error: Maximum number of allowed metrics exceeded. Your search may have been limited."
 		}
@@ -118,8 +169,17 @@ func (e *cloudWatchExecutor) transformQueryResponsesToQueryResult(cloudwatchResp
 		}
 
 		for _, frame := range frames {
+			custom := map[string]interface{}{
+				"query":  executedRequest,
+				"period": periods[frame],
+			}
+			if raw, ok := rawResults[frame]; ok {
+				custom["rawResults"] = raw
+			}
 			frame.Meta = &data.FrameMeta{
 				ExecutedQueryString: string(eq),
+				Custom:              custom,
+				Notices:             notices[frame],
 			}
 
 			if link == "" || len(frame.Fields) < 2 {
@@ -140,6 +200,51 @@ func (e *cloudWatchExecutor) transformQueryResponsesToQueryResult(cloudwatchResp
 	return results, nil
 }
 
+// effectivePeriod returns the period, in seconds, of the datapoints CloudWatch returns for a query starting at
+// startTime. Datapoints are kept at a minute for 15 days, at 5 minutes for 63 days and at an hour beyond, so the
+// period requested for older data is rounded up to a multiple of the period its datapoints are still kept at.
+func effectivePeriod(period int, startTime time.Time, now time.Time) int {
+	minPeriod := minPeriodForAge(now.Sub(startTime))
+	if minPeriod == 0 || period%minPeriod == 0 {
+		return period
+	}
+
+	return (period/minPeriod + 1) * minPeriod
+}
+
+// minPeriodForAge returns the shortest period, in seconds, CloudWatch keeps datapoints of the given age at.
+// Queries for older data with a shorter period return no datapoints.
+func minPeriodForAge(age time.Duration) int {
+	switch {
+	case age > 63*24*time.Hour:
+		return 3600
+	case age > 15*24*time.Hour:
+		return 300
+	case age > 3*time.Hour:
+		// High resolution datapoints, with periods under a minute, are only kept for 3 hours
+		return 60
+	default:
+		return 0
+	}
+}
+
+// sortFrames sorts the frames of a query by name, then by labels, since several series can have the same name.
+func sortFrames(frames data.Frames) {
+	labels := func(frame *data.Frame) string {
+		if len(frame.Fields) < 2 {
+			return ""
+		}
+		return frame.Fields[1].Labels.String()
+	}
+
+	sort.SliceStable(frames, func(i, j int) bool {
+		if frames[i].Name != frames[j].Name {
+			return frames[i].Name < frames[j].Name
+		}
+		return labels(frames[i]) < labels(frames[j])
+	})
+}
+
 // buildDeepLink generates a deep link from Grafana to the CloudWatch console. The link params are based on metric(s) for a given query row in the Query Editor.
 func buildDeepLink(refID string, requestQueries []*requestQuery, executedQueries []executedQuery, startTime time.Time, endTime time.Time) (string, error) {
 	if isMathExpression(executedQueries) {
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -245,4 +246,188 @@ func TestQueryTransformer(t *testing.T) {
 		require.NoError(t, err)
 		assert.Equal(t, "", decodedLink)
 	})
+
+	t.Run("Anomaly detection band", func(t *testing.T) {
+		newRequestQueries := func(expression string) []*requestQuery {
+			return []*requestQuery{
+				{
+					RefId:      "A",
+					Region:     "us-east-1",
+					Namespace:  "AWS/EC2",
+					MetricName: "CPUUtilization",
+					Statistics: aws.StringSlice([]string{"Average"}),
+					Period:     300,
+					Id:         "m1",
+				},
+				{
+					RefId:      "B",
+					Region:     "us-east-1",
+					Statistics: aws.StringSlice([]string{"Average"}),
+					Period:     300,
+					Id:         "ad",
+					Expression: expression,
+					ReturnData: true,
+				},
+			}
+		}
+
+		t.Run("referencing a metric is allowed", func(t *testing.T) {
+			res, err := executor.transformRequestQueriesToCloudWatchQueries(newRequestQueries("ANOMALY_DETECTION_BAND(m1, 2)"))
+			require.NoError(t, err)
+			require.Contains(t, res, "ad")
+			assert.Equal(t, "m1", res["ad"].anomalyDetectionBandMetricID())
+		})
+
+		t.Run("referencing an unknown metric is rejected", func(t *testing.T) {
+			_, err := executor.transformRequestQueriesToCloudWatchQueries(newRequestQueries("ANOMALY_DETECTION_BAND(m2)"))
+			require.EqualError(t, err, `error in query "B" - anomaly detection band references unknown metric id "m2"`)
+		})
+
+		t.Run("referencing an expression is rejected", func(t *testing.T) {
+			_, err := executor.transformRequestQueriesToCloudWatchQueries(newRequestQueries("ANOMALY_DETECTION_BAND(ad)"))
+			require.EqualError(t, err, `error in query "B" - anomaly detection band must reference a metric, but "ad" is an expression`)
+		})
+	})
+
+	t.Run("Extended statistics are turned into valid ids", func(t *testing.T) {
+		requestQueries := []*requestQuery{
+			{
+				RefId:      "D",
+				Region:     "us-east-1",
+				Namespace:  "ec2",
+				MetricName: "CPUUtilization",
+				Statistics: aws.StringSlice([]string{"p99.9", "tm(10%:90%)"}),
+				Period:     600,
+			},
+		}
+
+		res, err := executor.transformRequestQueriesToCloudWatchQueries(requestQueries)
+		require.NoError(t, err)
+		require.Contains(t, res, "queryD_p99_9")
+		require.Contains(t, res, "queryD_tm_10__90__")
+		assert.Equal(t, "tm(10%:90%)", res["queryD_tm_10__90__"].Stats)
+		assert.True(t, res["queryD_p99_9"].MultipleStats)
+	})
+}
+
+func TestQueryTransformer_FrameOrder(t *testing.T) {
+	executor := newExecutor(nil)
+
+	newFrame := func(name string, instanceID string) *data.Frame {
+		return data.NewFrame(name,
+			data.NewField("timestamp", nil, []*time.Time{}),
+			data.NewField("value", data.Labels{"InstanceId": instanceID}, []*float64{}),
+		)
+	}
+	newResponses := func() []*cloudwatchResponse {
+		return []*cloudwatchResponse{
+			{
+				Id:    "queryA_Maximum",
+				RefId: "A",
+				DataFrames: data.Frames{
+					newFrame("cpu", "i-2"),
+					newFrame("cpu", "i-1"),
+				},
+			},
+			{
+				Id:    "queryA_Average",
+				RefId: "A",
+				DataFrames: data.Frames{
+					newFrame("cpu", "i-3"),
+					newFrame("cpu", "i-1"),
+				},
+			},
+		}
+	}
+	requestQueries := []*requestQuery{
+		{
+			RefId:      "A",
+			Region:     "us-east-1",
+			Namespace:  "AWS/EC2",
+			MetricName: "CPUUtilization",
+			Statistics: aws.StringSlice([]string{"Average", "Maximum"}),
+			Period:     300,
+		},
+	}
+	instanceIDs := func(responses []*cloudwatchResponse) []string {
+		t.Helper()
+
+		res, err := executor.transformQueryResponsesToQueryResult(responses, requestQueries, "", time.Now().Add(-time.Hour),
+			time.Now())
+		require.NoError(t, err)
+		frames, err := res["A"].Dataframes.Decoded()
+		require.NoError(t, err)
+
+		ids := []string{}
+		for _, frame := range frames {
+			ids = append(ids, frame.Fields[1].Labels["InstanceId"])
+		}
+		return ids
+	}
+
+	// Frames are sorted by query ID, then by name and labels
+	expected := []string{"i-1", "i-3", "i-1", "i-2"}
+	assert.Equal(t, expected, instanceIDs(newResponses()))
+
+	responses := newResponses()
+	responses[0], responses[1] = responses[1], responses[0]
+	assert.Equal(t, expected, instanceIDs(responses))
+}
+
+func TestQueryTransformer_EffectivePeriod(t *testing.T) {
+	now := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	testCases := map[string]struct {
+		period   int
+		age      time.Duration
+		expected int
+	}{
+		"High resolution period for data under 3h":     {period: 10, age: 2 * time.Hour, expected: 10},
+		"High resolution period for data over 3h":      {period: 10, age: 4 * time.Hour, expected: 60},
+		"Minute period for data under 15 days":         {period: 60, age: 14 * 24 * time.Hour, expected: 60},
+		"Minute period for data over 15 days":          {period: 60, age: 16 * 24 * time.Hour, expected: 300},
+		"Five minute period for data under 63 days":    {period: 300, age: 62 * 24 * time.Hour, expected: 300},
+		"Five minute period for data over 63 days":     {period: 300, age: 64 * 24 * time.Hour, expected: 3600},
+		"Period rounded up to a multiple of 5 minutes": {period: 360, age: 20 * 24 * time.Hour, expected: 600},
+		"Coarser period is kept":                       {period: 86400, age: 500 * 24 * time.Hour, expected: 86400},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, effectivePeriod(tc.period, now.Add(-tc.age), now))
+		})
+	}
+
+	t.Run("Effective period is set on the frame metadata", func(t *testing.T) {
+		executor := newExecutor(nil)
+		responses := []*cloudwatchResponse{
+			{
+				Id:     "queryA",
+				RefId:  "A",
+				Period: 10,
+				DataFrames: data.Frames{
+					data.NewFrame("cpu",
+						data.NewField("timestamp", nil, []*time.Time{}),
+						data.NewField("value", nil, []*float64{}),
+					),
+				},
+			},
+		}
+		requestQueries := []*requestQuery{
+			{
+				RefId:      "A",
+				Region:     "us-east-1",
+				Namespace:  "AWS/EC2",
+				MetricName: "CPUUtilization",
+				Statistics: aws.StringSlice([]string{"Average"}),
+				Period:     10,
+			},
+		}
+
+		res, err := executor.transformQueryResponsesToQueryResult(responses, requestQueries, "",
+			time.Now().Add(-24*time.Hour), time.Now())
+		require.NoError(t, err)
+		frames, err := res["A"].Dataframes.Decoded()
+		require.NoError(t, err)
+		require.Len(t, frames, 1)
+		assert.Equal(t, 60, frames[0].Meta.Custom.(map[string]interface{})["period"])
+	})
 }
@@ -0,0 +1,59 @@
+package cloudwatch
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/grafana/grafana/pkg/components/simplejson"
+	"github.com/grafana/grafana/pkg/infra/metrics"
+	"github.com/grafana/grafana/pkg/tsdb"
+)
+
+// regionReachable is the status of a region CloudWatch can be queried in.
+const regionReachable = "ok"
+
+// handleTestRegion tells whether CloudWatch can be queried in each of the regions of the region parameter, which may
+// be a list or multi-valued. This helps to find the regions where requests are denied, e.g. by service control
+// policies or VPC endpoint policies. A row is returned per region, holding either "ok" or the error.
+func (e *cloudWatchExecutor) handleTestRegion(ctx context.Context, parameters *simplejson.Json,
+	queryContext *tsdb.TsdbQuery) ([]suggestData, error) {
+	regions := metricFindQueryRegions(parameters)
+	if regions == nil {
+		regions = []string{parameters.Get("region").MustString(defaultRegion)}
+	}
+
+	result := make([]suggestData, 0, len(regions))
+	for _, region := range regions {
+		if region == "" {
+			continue
+		}
+
+		status := regionReachable
+		if err := e.testRegion(ctx, region); err != nil {
+			plog.Debug("CloudWatch can't be queried in region", "region", region, "err", err)
+			status = err.Error()
+		}
+		result = append(result, suggestData{Text: region, Value: status})
+	}
+
+	return result, nil
+}
+
+// testRegion makes the smallest ListMetrics request there is in a region, a single page of a single namespace.
+func (e *cloudWatchExecutor) testRegion(ctx context.Context, region string) error {
+	client, err := e.getCWClient(region)
+	if err != nil {
+		return err
+	}
+
+	metrics.MAwsCloudWatchListMetrics.Inc()
+	if _, err := client.ListMetricsWithContext(ctx, &cloudwatch.ListMetricsInput{
+		Namespace: aws.String("AWS/EC2"),
+	}); err != nil {
+		return fmt.Errorf("failed to call cloudwatch:ListMetrics: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,78 @@
+package cloudwatch
+
+import (
+	"sync"
+	"time"
+)
+
+// How long region lists and the region of the EC2 instance Grafana runs on are cached.
+// Stubbable by tests.
+var regionCacheTTL = time.Hour
+
+type regionsCacheEntry struct {
+	regions    []suggestData
+	expiration time.Time
+}
+
+type metadataRegionCacheEntry struct {
+	region     string
+	expiration time.Time
+}
+
+var (
+	// Region lists by data source, see dataSourceVersion
+	regionsCache = map[string]regionsCacheEntry{}
+	// The region of the EC2 instance Grafana runs on is the same for all data sources
+	metadataRegionCache metadataRegionCacheEntry
+	regionCacheLock     sync.Mutex
+)
+
+func cachedRegions(key string) ([]suggestData, bool) {
+	regionCacheLock.Lock()
+	defer regionCacheLock.Unlock()
+
+	entry, ok := regionsCache[key]
+	if !ok || !entry.expiration.After(time.Now()) {
+		return nil, false
+	}
+	return entry.regions, true
+}
+
+func cacheRegions(key string, regions []suggestData) {
+	regionCacheLock.Lock()
+	defer regionCacheLock.Unlock()
+
+	regionsCache[key] = regionsCacheEntry{
+		regions:    regions,
+		expiration: time.Now().Add(regionCacheTTL),
+	}
+}
+
+func cachedMetadataRegion() (string, bool) {
+	regionCacheLock.Lock()
+	defer regionCacheLock.Unlock()
+
+	if metadataRegionCache.region == "" || !metadataRegionCache.expiration.After(time.Now()) {
+		return "", false
+	}
+	return metadataRegionCache.region, true
+}
+
+func cacheMetadataRegion(region string) {
+	regionCacheLock.Lock()
+	defer regionCacheLock.Unlock()
+
+	metadataRegionCache = metadataRegionCacheEntry{
+		region:     region,
+		expiration: time.Now().Add(regionCacheTTL),
+	}
+}
+
+// invalidateRegionCaches drops the cached region lists and EC2 instance region, so they're fetched again.
+func invalidateRegionCaches() {
+	regionCacheLock.Lock()
+	defer regionCacheLock.Unlock()
+
+	regionsCache = map[string]regionsCacheEntry{}
+	metadataRegionCache = metadataRegionCacheEntry{}
+}
@@ -2,6 +2,7 @@ package cloudwatch
 
 import (
 	"errors"
+	"fmt"
 	"math"
 	"regexp"
 	"sort"
@@ -10,13 +11,21 @@ import (
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/grafana/grafana/pkg/components/gtime"
 	"github.com/grafana/grafana/pkg/components/simplejson"
 	"github.com/grafana/grafana/pkg/tsdb"
 )
 
-// Parses the json queries and returns a requestQuery. The requestQuery has a 1 to 1 mapping to a query editor row
-func (e *cloudWatchExecutor) parseQueries(queryContext *tsdb.TsdbQuery, startTime time.Time, endTime time.Time) (map[string][]*requestQuery, error) {
+// CloudWatch rejects metrics with more dimensions than this
+const maxDimensionsPerMetric = 30
+
+// Parses the json queries and returns a requestQuery. The requestQuery has a 1 to 1 mapping to a query editor row.
+// Queries that can't be parsed are left out, and their errors returned by RefID, so they don't fail the others.
+func (e *cloudWatchExecutor) parseQueries(queryContext *tsdb.TsdbQuery, startTime time.Time,
+	endTime time.Time) (map[string][]*requestQuery, map[string]error) {
 	requestQueries := make(map[string][]*requestQuery)
+	queryErrors := make(map[string]error)
 	for i, query := range queryContext.Queries {
 		queryType := query.Model.Get("type").MustString()
 		if queryType != "timeSeriesQuery" && queryType != "" {
@@ -24,27 +33,90 @@ func (e *cloudWatchExecutor) parseQueries(queryContext *tsdb.TsdbQuery, startTim
 		}
 
 		refID := query.RefId
-		query, err := parseRequestQuery(queryContext.Queries[i].Model, refID, startTime, endTime)
+		models, err := regionModels(queryContext.Queries[i].Model)
 		if err != nil {
-			return nil, &queryError{err: err, RefID: refID}
+			queryErrors[refID] = &queryError{err: err, RefID: refID}
+			continue
+		}
+
+		parsed := make([]*requestQuery, 0, len(models))
+		for _, model := range models {
+			query, err := parseRequestQuery(model, refID, startTime, endTime)
+			if err != nil {
+				queryErrors[refID] = &queryError{err: err, RefID: refID}
+				break
+			}
+			if query.SqlExpression == "" && len(query.Statistics) == 0 {
+				statistic, err := e.defaultStatistic()
+				if err != nil {
+					queryErrors[refID] = &queryError{err: err, RefID: refID}
+					break
+				}
+				plog.Debug("Using the default statistic for a query without one", "refId", refID, "statistic", statistic)
+				query.Statistics = []*string{aws.String(statistic)}
+			}
+			query.MultipleRegions = len(models) > 1
+			query.MaxDataPoints = queryContext.Queries[i].MaxDataPoints
+			query.Period = periodForMaxDataPoints(query.Period, query.MaxDataPoints, startTime, endTime)
+			query.Period = periodForAge(refID, query.Period, startTime)
+			parsed = append(parsed, query)
+		}
+		if _, invalid := queryErrors[refID]; invalid {
+			continue
+		}
+
+		for _, query := range parsed {
+			requestQueries[query.Region] = append(requestQueries[query.Region], query)
+		}
+	}
+
+	return requestQueries, queryErrors
+}
+
+// regionModels returns the model of a query once for each of its regions, so that a query with a list of regions
+// is executed in each of them. The model of a query with a single region is returned as is.
+func regionModels(model *simplejson.Json) ([]*simplejson.Json, error) {
+	regions, err := model.Get("region").StringArray()
+	if err != nil {
+		return []*simplejson.Json{model}, nil
+	}
+	if len(regions) == 0 {
+		return nil, errors.New("at least one region is required")
+	}
+
+	models := make([]*simplejson.Json, 0, len(regions))
+	seen := make(map[string]bool, len(regions))
+	for _, region := range regions {
+		if seen[region] {
+			return nil, fmt.Errorf("region %q is listed more than once", region)
 		}
+		seen[region] = true
 
-		if _, exist := requestQueries[query.Region]; !exist {
-			requestQueries[query.Region] = make([]*requestQuery, 0)
+		regionModel := make(map[string]interface{})
+		for key, value := range model.MustMap() {
+			regionModel[key] = value
 		}
-		requestQueries[query.Region] = append(requestQueries[query.Region], query)
+		regionModel["region"] = region
+		models = append(models, simplejson.NewFromAny(regionModel))
 	}
 
-	return requestQueries, nil
+	return models, nil
 }
 
+var validRegion = regexp.MustCompile(`^[a-z]{2}(-[a-z]+)+-\d+$`)
+
 func parseRequestQuery(model *simplejson.Json, refId string, startTime time.Time, endTime time.Time) (*requestQuery, error) {
 	plog.Debug("Parsing request query", "query", model)
-	reNumber := regexp.MustCompile(`^\d+$`)
 	region, err := model.Get("region").String()
 	if err != nil {
 		return nil, err
 	}
+	if region != defaultRegion && !validRegion.MatchString(region) {
+		return nil, fmt.Errorf("invalid region %q", region)
+	}
+	if model.Get("metricQueryType").MustString("") == metricQueryTypeInsights {
+		return parseMetricsInsightsQuery(model, refId, region, startTime, endTime)
+	}
 	namespace, err := model.Get("namespace").String()
 	if err != nil {
 		return nil, err
@@ -57,42 +129,57 @@ func parseRequestQuery(model *simplejson.Json, refId string, startTime time.Time
 	if err != nil {
 		return nil, err
 	}
+	if len(dimensions) > maxDimensionsPerMetric {
+		return nil, fmt.Errorf("too many dimensions: %d dimensions were specified, but CloudWatch allows at most %d per metric",
+			len(dimensions), maxDimensionsPerMetric)
+	}
 	statistics, err := parseStatistics(model)
 	if err != nil {
 		return nil, err
 	}
-
-	p := model.Get("period").MustString("")
-	var period int
-	if strings.ToLower(p) == "auto" || p == "" {
-		deltaInSeconds := endTime.Sub(startTime).Seconds()
-		periods := []int{60, 300, 900, 3600, 21600, 86400}
-		datapoints := int(math.Ceil(deltaInSeconds / 2000))
-		period = periods[len(periods)-1]
-		for _, value := range periods {
-			if datapoints <= value {
-				period = value
-				break
-			}
-		}
-	} else {
-		if reNumber.Match([]byte(p)) {
-			period, err = strconv.Atoi(p)
-			if err != nil {
-				return nil, err
-			}
-		} else {
-			d, err := time.ParseDuration(p)
-			if err != nil {
-				return nil, err
-			}
-			period = int(d.Seconds())
-		}
+	period, err := parsePeriod(model, startTime, endTime)
+	if err != nil {
+		return nil, err
+	}
+	unit, err := parseUnit(model)
+	if err != nil {
+		return nil, err
 	}
 
 	id := model.Get("id").MustString("")
 	expression := model.Get("expression").MustString("")
 	alias := model.Get("alias").MustString()
+	returnData := parseReturnData(model)
+
+	matchExact := model.Get("matchExact").MustBool(true)
+
+	timezone, err := parseTimezone(model.Get("timezone").MustString(""))
+	if err != nil {
+		return nil, err
+	}
+
+	return &requestQuery{
+		RefId:                  refId,
+		Region:                 region,
+		Namespace:              namespace,
+		MetricName:             metricName,
+		Dimensions:             dimensions,
+		Statistics:             aws.StringSlice(statistics),
+		Period:                 period,
+		Alias:                  alias,
+		Id:                     id,
+		Expression:             expression,
+		ReturnData:             returnData,
+		MatchExact:             matchExact,
+		Timezone:               timezone,
+		UseGetMetricStatistics: model.Get("useGetMetricStatistics").MustBool(false),
+		Unit:                   unit,
+		IncludeRawResults:      model.Get("includeRawResults").MustBool(false),
+		ResolveInstanceNames:   model.Get("resolveInstanceNames").MustBool(false),
+	}, nil
+}
+
+func parseReturnData(model *simplejson.Json) bool {
 	returnData := !model.Get("hide").MustBool(false)
 	queryType := model.Get("type").MustString()
 	if queryType == "" {
@@ -101,29 +188,214 @@ func parseRequestQuery(model *simplejson.Json, refId string, startTime time.Time
 		// who (which service) called the TsdbQueryEndpoint.Query(...) function.
 		returnData = true
 	}
+	// An explicit returnData takes precedence, so source metrics of a math expression can be left out of the
+	// results while still being fetched for the expression
+	if explicitReturnData, err := model.Get("returnData").Bool(); err == nil {
+		returnData = explicitReturnData
+	}
 
-	matchExact := model.Get("matchExact").MustBool(true)
+	return returnData
+}
+
+// The metric query type of queries written in the SQL of CloudWatch Metrics Insights
+const metricQueryTypeInsights = "insights"
+
+// parseMetricsInsightsQuery parses a query whose metrics are selected by a Metrics Insights SQL statement, such as
+// SELECT AVG(CPUUtilization) FROM SCHEMA("AWS/EC2", InstanceId) GROUP BY InstanceId. The namespace, metric,
+// dimensions and statistic are all part of the SQL, but the period must be set, as Metrics Insights has no
+// default one.
+func parseMetricsInsightsQuery(model *simplejson.Json, refId string, region string, startTime time.Time,
+	endTime time.Time) (*requestQuery, error) {
+	sqlExpression := strings.TrimSpace(model.Get("sqlExpression").MustString(""))
+	if sqlExpression == "" {
+		return nil, errors.New("a SQL expression is required for Metrics Insights queries")
+	}
+	if p, err := model.Get("period").String(); (err == nil && strings.TrimSpace(p) == "") ||
+		model.Get("period").Interface() == nil {
+		return nil, errors.New("a period is required for Metrics Insights queries")
+	}
+	period, err := parsePeriod(model, startTime, endTime)
+	if err != nil {
+		return nil, err
+	}
 
 	return &requestQuery{
-		RefId:      refId,
-		Region:     region,
-		Namespace:  namespace,
-		MetricName: metricName,
-		Dimensions: dimensions,
-		Statistics: aws.StringSlice(statistics),
-		Period:     period,
-		Alias:      alias,
-		Id:         id,
-		Expression: expression,
-		ReturnData: returnData,
-		MatchExact: matchExact,
+		RefId:                refId,
+		Region:               region,
+		Id:                   model.Get("id").MustString(""),
+		SqlExpression:        sqlExpression,
+		Period:               period,
+		Alias:                model.Get("alias").MustString(),
+		ReturnData:           parseReturnData(model),
+		MatchExact:           true,
+		IncludeRawResults:    model.Get("includeRawResults").MustBool(false),
+		ResolveInstanceNames: model.Get("resolveInstanceNames").MustBool(false),
 	}, nil
 }
 
+var timezoneOffset = regexp.MustCompile(`^([+-])(\d{2})(\d{2})$`)
+
+// parseTimezone parses the timezone periods are aligned to, given like the time zone of a dashboard, either as
+// "utc", "browser" or an IANA time zone name, or as an offset such as "+0130" like CloudWatch's label options.
+// The browser time zone isn't known to the backend, so no timezone is returned for it, like when none is given.
+func parseTimezone(tz string) (*time.Location, error) {
+	switch strings.ToLower(tz) {
+	case "", "browser":
+		return nil, nil
+	case "utc":
+		return time.UTC, nil
+	}
+
+	if matches := timezoneOffset.FindStringSubmatch(tz); matches != nil {
+		hours, _ := strconv.Atoi(matches[2])
+		minutes, _ := strconv.Atoi(matches[3])
+		if hours > 14 || minutes > 59 {
+			return nil, fmt.Errorf("invalid timezone %q: offset out of range", tz)
+		}
+		offset := (hours*60 + minutes) * 60
+		if matches[1] == "-" {
+			offset = -offset
+		}
+		return time.FixedZone(tz, offset), nil
+	}
+
+	location, err := time.LoadLocation(tz)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timezone %q: %w", tz, err)
+	}
+
+	return location, nil
+}
+
+// parseUnit parses the optional unit a query's metric is restricted to, which has to be one of the units
+// supported by CloudWatch. Metrics published with several units are otherwise aggregated across all of them.
+func parseUnit(model *simplejson.Json) (string, error) {
+	unit := model.Get("unit").MustString("")
+	if unit == "" {
+		return "", nil
+	}
+
+	for _, standardUnit := range cloudwatch.StandardUnit_Values() {
+		if unit == standardUnit {
+			return unit, nil
+		}
+	}
+
+	return "", fmt.Errorf("invalid unit %q", unit)
+}
+
+var periodSeconds = regexp.MustCompile(`^\d+$`)
+
+// The period keyword making the period of a query derived from its time range
+const periodAuto = "auto"
+
+// parsePeriod parses the period of a query, given either in seconds, as a number or a string, or as a duration
+// string such as "5m" or "1h". A period of "auto" is derived from the time range. An empty period defaults to
+// the same, as queries saved before "auto" existed have none.
+func parsePeriod(model *simplejson.Json, startTime time.Time, endTime time.Time) (int, error) {
+	p := strings.TrimSpace(model.Get("period").MustString(""))
+	if n, err := model.Get("period").Int(); err == nil {
+		p = strconv.Itoa(n)
+	}
+
+	switch {
+	case p == "":
+		return defaultPeriod(startTime, endTime), nil
+	case strings.EqualFold(p, periodAuto):
+		return autoPeriod(startTime, endTime), nil
+	}
+
+	var period int
+	if periodSeconds.MatchString(p) {
+		var err error
+		if period, err = strconv.Atoi(p); err != nil {
+			return 0, fmt.Errorf("invalid period %q: %w", p, err)
+		}
+	} else {
+		d, err := gtime.ParseDuration(p)
+		if err != nil {
+			return 0, fmt.Errorf("invalid period %q: must be a number of seconds or a duration such as 5m", p)
+		}
+		if d%time.Second != 0 {
+			return 0, fmt.Errorf("invalid period %q: must be a whole number of seconds", p)
+		}
+		period = int(d.Seconds())
+	}
+
+	// CloudWatch supports high resolution periods of 1, 5, 10 and 30 seconds, and multiples of a minute
+	switch {
+	case period == 1, period == 5, period == 10, period == 30, period > 0 && period%60 == 0:
+		return period, nil
+	default:
+		return 0, fmt.Errorf("invalid period %q: must be 1, 5, 10, 30 or a multiple of 60 seconds", p)
+	}
+}
+
+// defaultPeriod returns the period of queries without one, which has always been the auto period.
+func defaultPeriod(startTime time.Time, endTime time.Time) int {
+	return autoPeriod(startTime, endTime)
+}
+
+// autoPeriod returns the shortest of the usual periods keeping the number of datapoints of a time range under
+// 2000.
+func autoPeriod(startTime time.Time, endTime time.Time) int {
+	deltaInSeconds := endTime.Sub(startTime).Seconds()
+	periods := []int{60, 300, 900, 3600, 21600, 86400}
+	datapoints := int(math.Ceil(deltaInSeconds / 2000))
+	for _, value := range periods {
+		if datapoints <= value {
+			return value
+		}
+	}
+
+	return periods[len(periods)-1]
+}
+
+// periodForAge raises the period of a query to one CloudWatch still keeps the datapoints of the start of its time
+// range at, since queries for older data with a shorter period return no datapoints.
+func periodForAge(refID string, period int, startTime time.Time) int {
+	raised := effectivePeriod(period, startTime, time.Now())
+	if raised != period {
+		plog.Debug("Raising the period to one CloudWatch keeps datapoints of the time range at", "refId", refID,
+			"period", period, "raisedPeriod", raised, "from", startTime)
+	}
+
+	return raised
+}
+
+// periodForMaxDataPoints raises the period of a query to the shortest valid one keeping the number of datapoints
+// of the time range under the max data points the panel shows. The max data points are forwarded to GetMetricData
+// too, but CloudWatch only paginates the datapoints beyond them rather than downsample.
+func periodForMaxDataPoints(period int, maxDataPoints int64, startTime time.Time, endTime time.Time) int {
+	if maxDataPoints <= 0 {
+		return period
+	}
+
+	minPeriod := int(math.Ceil(endTime.Sub(startTime).Seconds() / float64(maxDataPoints)))
+	if minPeriod <= period {
+		return period
+	}
+	for _, highResolutionPeriod := range []int{1, 5, 10, 30} {
+		if minPeriod <= highResolutionPeriod {
+			return highResolutionPeriod
+		}
+	}
+
+	return int(math.Ceil(float64(minPeriod)/60)) * 60
+}
+
+// parseStatistics parses the statistics of a query, leaving out blank ones. Queries left without a statistic are
+// given the default one of the data source by parseQueries.
 func parseStatistics(model *simplejson.Json) ([]string, error) {
 	var statistics []string
 	for _, s := range model.Get("statistics").MustArray() {
-		statistics = append(statistics, s.(string))
+		statistic, ok := s.(string)
+		if !ok {
+			return nil, fmt.Errorf("invalid statistic %v, must be a string", s)
+		}
+		if statistic = strings.TrimSpace(statistic); statistic != "" {
+			statistics = append(statistics, statistic)
+		}
 	}
 
 	return statistics, nil
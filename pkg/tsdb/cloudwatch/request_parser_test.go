@@ -1,9 +1,11 @@
 package cloudwatch
 
 import (
+	"fmt"
 	"testing"
 	"time"
 
+	"github.com/aws/aws-sdk-go/aws"
 	"github.com/grafana/grafana/pkg/components/simplejson"
 	"github.com/grafana/grafana/pkg/tsdb"
 	"github.com/stretchr/testify/assert"
@@ -86,6 +88,29 @@ func TestRequestParser(t *testing.T) {
 		assert.Equal(t, "Average", *res.Statistics[0])
 	})
 
+	t.Run("Too many dimensions should result in error", func(t *testing.T) {
+		dimensions := map[string]interface{}{}
+		for i := 0; i <= maxDimensionsPerMetric; i++ {
+			dimensions[fmt.Sprintf("Dimension%d", i)] = []interface{}{"value"}
+		}
+		query := simplejson.NewFromAny(map[string]interface{}{
+			"refId":      "ref1",
+			"region":     "us-east-1",
+			"namespace":  "ec2",
+			"metricName": "CPUUtilization",
+			"id":         "",
+			"expression": "",
+			"dimensions": dimensions,
+			"statistics": []interface{}{"Average"},
+			"period":     "600",
+			"hide":       false,
+		})
+
+		_, err := parseRequestQuery(query, "ref1", from, to)
+		require.Error(t, err)
+		assert.Equal(t, "too many dimensions: 31 dimensions were specified, but CloudWatch allows at most 30 per metric", err.Error())
+	})
+
 	t.Run("Period defined in the editor by the user is being used when time range is short", func(t *testing.T) {
 		query := simplejson.NewFromAny(map[string]interface{}{
 			"refId":      "ref1",
@@ -113,6 +138,118 @@ func TestRequestParser(t *testing.T) {
 		assert.Equal(t, 900, res.Period)
 	})
 
+	t.Run("Hidden queries don't return data", func(t *testing.T) {
+		query := simplejson.NewFromAny(map[string]interface{}{
+			"type":       "timeSeriesQuery",
+			"region":     "us-east-1",
+			"namespace":  "ec2",
+			"metricName": "CPUUtilization",
+			"statistics": []interface{}{"Average"},
+			"period":     "600",
+			"hide":       true,
+		})
+
+		res, err := parseRequestQuery(query, "ref1", from, to)
+		require.NoError(t, err)
+		assert.False(t, res.ReturnData)
+	})
+
+	t.Run("Explicit returnData takes precedence over hide", func(t *testing.T) {
+		query := simplejson.NewFromAny(map[string]interface{}{
+			"region":     "us-east-1",
+			"namespace":  "ec2",
+			"metricName": "CPUUtilization",
+			"statistics": []interface{}{"Average"},
+			"period":     "600",
+			"hide":       false,
+			"returnData": false,
+		})
+
+		res, err := parseRequestQuery(query, "ref1", from, to)
+		require.NoError(t, err)
+		assert.False(t, res.ReturnData)
+	})
+
+	t.Run("Period is parsed from seconds and duration strings", func(t *testing.T) {
+		tests := []struct {
+			period   interface{}
+			expected int
+		}{
+			{period: "300", expected: 300},
+			{period: 300, expected: 300},
+			{period: "5m", expected: 300},
+			{period: "1h", expected: 3600},
+			{period: "1d", expected: 86400},
+			{period: "10s", expected: 10},
+		}
+		for _, tc := range tests {
+			query := simplejson.NewFromAny(map[string]interface{}{
+				"region":     "us-east-1",
+				"namespace":  "ec2",
+				"metricName": "CPUUtilization",
+				"statistics": []interface{}{"Average"},
+				"period":     tc.period,
+			})
+
+			res, err := parseRequestQuery(query, "ref1", from, to)
+			require.NoError(t, err, "period %v", tc.period)
+			assert.Equal(t, tc.expected, res.Period, "period %v", tc.period)
+		}
+	})
+
+	t.Run("Empty, auto and explicit periods are told apart", func(t *testing.T) {
+		to := time.Now()
+		from := to.Add(-3 * 24 * time.Hour)
+		tests := map[string]struct {
+			period   interface{}
+			expected int
+		}{
+			"Missing period defaults to auto": {period: nil, expected: 300},
+			"Empty period defaults to auto":   {period: "", expected: 300},
+			"Auto period":                     {period: "auto", expected: 300},
+			"Auto period in other case":       {period: " Auto ", expected: 300},
+			"Explicit period":                 {period: "60", expected: 60},
+			"Explicit duration":               {period: "1m", expected: 60},
+		}
+		for name, tc := range tests {
+			model := map[string]interface{}{
+				"region":     "us-east-1",
+				"namespace":  "ec2",
+				"metricName": "CPUUtilization",
+				"statistics": []interface{}{"Average"},
+			}
+			if tc.period != nil {
+				model["period"] = tc.period
+			}
+
+			res, err := parseRequestQuery(simplejson.NewFromAny(model), "ref1", from, to)
+			require.NoError(t, err, name)
+			assert.Equal(t, tc.expected, res.Period, name)
+		}
+	})
+
+	t.Run("Invalid periods are rejected", func(t *testing.T) {
+		tests := map[string]string{
+			"soon":  `invalid period "soon": must be a number of seconds or a duration such as 5m`,
+			"90":    `invalid period "90": must be 1, 5, 10, 30 or a multiple of 60 seconds`,
+			"90s":   `invalid period "90s": must be 1, 5, 10, 30 or a multiple of 60 seconds`,
+			"0":     `invalid period "0": must be 1, 5, 10, 30 or a multiple of 60 seconds`,
+			"500ms": `invalid period "500ms": must be a whole number of seconds`,
+		}
+		for period, expectedErr := range tests {
+			query := simplejson.NewFromAny(map[string]interface{}{
+				"region":     "us-east-1",
+				"namespace":  "ec2",
+				"metricName": "CPUUtilization",
+				"statistics": []interface{}{"Average"},
+				"period":     period,
+			})
+
+			_, err := parseRequestQuery(query, "ref1", from, to)
+			require.EqualError(t, err, expectedErr)
+		}
+	})
+
 	t.Run("Period is parsed correctly if not defined by user", func(t *testing.T) {
 		query := simplejson.NewFromAny(map[string]interface{}{
 			"refId":      "ref1",
@@ -210,3 +347,310 @@ func TestRequestParser(t *testing.T) {
 		})
 	})
 }
+
+func TestRequestParser_Regions(t *testing.T) {
+	timeRange := tsdb.NewTimeRange("now-1h", "now")
+	from, err := timeRange.ParseFrom()
+	require.NoError(t, err)
+	to, err := timeRange.ParseTo()
+	require.NoError(t, err)
+
+	newQueryContext := func(region interface{}) *tsdb.TsdbQuery {
+		return &tsdb.TsdbQuery{
+			Queries: []*tsdb.Query{
+				{
+					RefId: "A",
+					Model: simplejson.NewFromAny(map[string]interface{}{
+						"region":     region,
+						"namespace":  "AWS/EC2",
+						"metricName": "CPUUtilization",
+						"statistics": []interface{}{"Average"},
+						"period":     "300",
+					}),
+				},
+			},
+		}
+	}
+
+	executor := newExecutor(nil)
+
+	t.Run("A list of regions is parsed into a query per region", func(t *testing.T) {
+		queries, errs := executor.parseQueries(newQueryContext([]interface{}{"us-east-1", "eu-west-1"}), from, to)
+		require.Empty(t, errs)
+		require.Len(t, queries, 2)
+		for _, region := range []string{"us-east-1", "eu-west-1"} {
+			require.Len(t, queries[region], 1)
+			assert.Equal(t, "A", queries[region][0].RefId)
+			assert.Equal(t, region, queries[region][0].Region)
+			assert.True(t, queries[region][0].MultipleRegions)
+		}
+	})
+
+	t.Run("A single region isn't labelled as multiple regions", func(t *testing.T) {
+		queries, errs := executor.parseQueries(newQueryContext([]interface{}{"us-east-1"}), from, to)
+		require.Empty(t, errs)
+		require.Len(t, queries["us-east-1"], 1)
+		assert.False(t, queries["us-east-1"][0].MultipleRegions)
+	})
+
+	t.Run("The default region is accepted", func(t *testing.T) {
+		queries, errs := executor.parseQueries(newQueryContext("default"), from, to)
+		require.Empty(t, errs)
+		assert.Len(t, queries["default"], 1)
+	})
+
+	t.Run("An empty list of regions is rejected", func(t *testing.T) {
+		queries, errs := executor.parseQueries(newQueryContext([]interface{}{}), from, to)
+		assert.Empty(t, queries)
+		assert.EqualError(t, errs["A"], `error parsing query "A", at least one region is required`)
+	})
+
+	t.Run("A region listed twice is rejected", func(t *testing.T) {
+		queries, errs := executor.parseQueries(newQueryContext([]interface{}{"us-east-1", "us-east-1"}), from, to)
+		assert.Empty(t, queries)
+		assert.EqualError(t, errs["A"], `error parsing query "A", region "us-east-1" is listed more than once`)
+	})
+
+	t.Run("An invalid region is rejected", func(t *testing.T) {
+		queries, errs := executor.parseQueries(newQueryContext([]interface{}{"us-east-1", "mars-1"}), from, to)
+		assert.Empty(t, queries)
+		assert.EqualError(t, errs["A"], `error parsing query "A", invalid region "mars-1"`)
+	})
+}
+
+func TestRequestParser_DefaultStatistic(t *testing.T) {
+	timeRange := tsdb.NewTimeRange("now-1h", "now")
+	from, err := timeRange.ParseFrom()
+	require.NoError(t, err)
+	to, err := timeRange.ParseTo()
+	require.NoError(t, err)
+
+	newQueryContext := func(statistics interface{}) *tsdb.TsdbQuery {
+		model := map[string]interface{}{
+			"region":     "us-east-1",
+			"namespace":  "AWS/EC2",
+			"metricName": "CPUUtilization",
+			"period":     "300",
+		}
+		if statistics != nil {
+			model["statistics"] = statistics
+		}
+		return &tsdb.TsdbQuery{
+			Queries: []*tsdb.Query{
+				{RefId: "A", Model: simplejson.NewFromAny(model)},
+			},
+		}
+	}
+	parseStatistics := func(t *testing.T, executor *cloudWatchExecutor, statistics interface{}) []string {
+		t.Helper()
+
+		queries, errs := executor.parseQueries(newQueryContext(statistics), from, to)
+		require.Empty(t, errs)
+		require.Len(t, queries["us-east-1"], 1)
+		return aws.StringValueSlice(queries["us-east-1"][0].Statistics)
+	}
+
+	t.Run("Queries without a statistic get the average", func(t *testing.T) {
+		executor := newExecutor(nil)
+		executor.DataSource = fakeDataSource()
+
+		assert.Equal(t, []string{"Average"}, parseStatistics(t, executor, nil))
+		assert.Equal(t, []string{"Average"}, parseStatistics(t, executor, []interface{}{}))
+		assert.Equal(t, []string{"Average"}, parseStatistics(t, executor, []interface{}{" "}))
+	})
+
+	t.Run("The default statistic can be set by the data source", func(t *testing.T) {
+		executor := newExecutor(nil)
+		executor.DataSource = fakeDataSource()
+		executor.DataSource.JsonData.Set("defaultStatistic", "Maximum")
+
+		assert.Equal(t, []string{"Maximum"}, parseStatistics(t, executor, nil))
+	})
+
+	t.Run("Extended statistics can be the default", func(t *testing.T) {
+		executor := newExecutor(nil)
+		executor.DataSource = fakeDataSource()
+		executor.DataSource.JsonData.Set("defaultStatistic", " P95 ")
+
+		assert.Equal(t, []string{"p95"}, parseStatistics(t, executor, nil))
+	})
+
+	t.Run("Invalid default statistics are rejected", func(t *testing.T) {
+		executor := newExecutor(nil)
+		executor.DataSource = fakeDataSource()
+		executor.DataSource.JsonData.Set("defaultStatistic", "Averge")
+
+		queries, errs := executor.parseQueries(newQueryContext(nil), from, to)
+		assert.Empty(t, queries)
+		assert.EqualError(t, errs["A"], `error parsing query "A", invalid default statistic of the data source: `+
+			`invalid statistic "Averge", must be one of Average, Sum, Minimum, Maximum, SampleCount `+
+			`or an extended statistic such as p99 or TM(10%:90%)`)
+	})
+
+	t.Run("An invalid default statistic doesn't fail queries with statistics", func(t *testing.T) {
+		executor := newExecutor(nil)
+		executor.DataSource = fakeDataSource()
+		executor.DataSource.JsonData.Set("defaultStatistic", "Averge")
+
+		assert.Equal(t, []string{"Sum"}, parseStatistics(t, executor, []interface{}{"Sum"}))
+	})
+
+	t.Run("The statistics of a query take precedence", func(t *testing.T) {
+		executor := newExecutor(nil)
+		executor.DataSource = fakeDataSource()
+		executor.DataSource.JsonData.Set("defaultStatistic", "Maximum")
+
+		assert.Equal(t, []string{"Sum", "p99"}, parseStatistics(t, executor, []interface{}{"Sum", "p99"}))
+	})
+
+	t.Run("Statistics which aren't strings are rejected", func(t *testing.T) {
+		executor := newExecutor(nil)
+		queries, errs := executor.parseQueries(newQueryContext([]interface{}{"Sum", 99}), from, to)
+		assert.Empty(t, queries)
+		assert.EqualError(t, errs["A"], `error parsing query "A", invalid statistic 99, must be a string`)
+	})
+}
+
+func TestRequestParser_Unit(t *testing.T) {
+	timeRange := tsdb.NewTimeRange("now-1h", "now")
+	from, err := timeRange.ParseFrom()
+	require.NoError(t, err)
+	to, err := timeRange.ParseTo()
+	require.NoError(t, err)
+
+	newQuery := func(unit string) *simplejson.Json {
+		return simplejson.NewFromAny(map[string]interface{}{
+			"region":     "us-east-1",
+			"namespace":  "AWS/EC2",
+			"metricName": "NetworkIn",
+			"statistics": []interface{}{"Sum"},
+			"period":     "300",
+			"unit":       unit,
+		})
+	}
+
+	t.Run("No unit by default", func(t *testing.T) {
+		res, err := parseRequestQuery(newQuery(""), "ref1", from, to)
+		require.NoError(t, err)
+		assert.Empty(t, res.Unit)
+	})
+
+	t.Run("A CloudWatch unit is accepted", func(t *testing.T) {
+		res, err := parseRequestQuery(newQuery("Bytes/Second"), "ref1", from, to)
+		require.NoError(t, err)
+		assert.Equal(t, "Bytes/Second", res.Unit)
+	})
+
+	t.Run("An unknown unit is rejected", func(t *testing.T) {
+		_, err := parseRequestQuery(newQuery("bytes"), "ref1", from, to)
+		assert.EqualError(t, err, `invalid unit "bytes"`)
+	})
+}
+
+func TestRequestParser_PeriodForOldData(t *testing.T) {
+	testCases := map[string]struct {
+		period   string
+		sql      bool
+		age      time.Duration
+		expected int
+	}{
+		"High resolution period for data under 3h":      {period: "10", age: time.Hour, expected: 10},
+		"High resolution period for data over 3h":       {period: "10", age: 4 * time.Hour, expected: 60},
+		"Minute period for data under 15 days":          {period: "60", age: 10 * 24 * time.Hour, expected: 60},
+		"Minute period for data over 15 days":           {period: "60", age: 20 * 24 * time.Hour, expected: 300},
+		"Five minute period for data over 63 days":      {period: "300", age: 90 * 24 * time.Hour, expected: 3600},
+		"Coarser period for data over 63 days":          {period: "86400", age: 90 * 24 * time.Hour, expected: 86400},
+		"Metrics Insights period for data over 15 days": {period: "60", sql: true, age: 20 * 24 * time.Hour, expected: 300},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			model := map[string]interface{}{
+				"region":     "us-east-1",
+				"namespace":  "AWS/EC2",
+				"metricName": "CPUUtilization",
+				"statistics": []interface{}{"Average"},
+				"period":     tc.period,
+			}
+			if tc.sql {
+				model = map[string]interface{}{
+					"region":          "us-east-1",
+					"metricQueryType": metricQueryTypeInsights,
+					"sqlExpression":   `SELECT AVG(CPUUtilization) FROM SCHEMA("AWS/EC2", InstanceId)`,
+					"period":          tc.period,
+				}
+			}
+			to := time.Now()
+			from := to.Add(-tc.age)
+
+			executor := newExecutor(nil)
+			queries, errs := executor.parseQueries(&tsdb.TsdbQuery{
+				Queries: []*tsdb.Query{{RefId: "A", Model: simplejson.NewFromAny(model)}},
+			}, from, to)
+			require.Empty(t, errs)
+			require.Len(t, queries["us-east-1"], 1)
+			assert.Equal(t, tc.expected, queries["us-east-1"][0].Period)
+		})
+	}
+}
+
+func TestParseTimezone(t *testing.T) {
+	stockholm, err := time.LoadLocation("Europe/Stockholm")
+	require.NoError(t, err)
+
+	testCases := map[string]struct {
+		timezone       string
+		expected       *time.Location
+		expectedOffset int
+		expectedErr    string
+	}{
+		"No timezone": {
+			timezone: "",
+		},
+		"Browser timezone is unknown to the backend": {
+			timezone: "browser",
+		},
+		"UTC": {
+			timezone: "utc",
+			expected: time.UTC,
+		},
+		"IANA name": {
+			timezone: "Europe/Stockholm",
+			expected: stockholm,
+		},
+		"Positive offset": {
+			timezone:       "+0130",
+			expectedOffset: 90 * 60,
+		},
+		"Negative offset": {
+			timezone:       "-0800",
+			expectedOffset: -8 * 60 * 60,
+		},
+		"Offset out of range": {
+			timezone:    "+1575",
+			expectedErr: `invalid timezone "+1575": offset out of range`,
+		},
+		"Unknown name": {
+			timezone:    "Mars/Olympus_Mons",
+			expectedErr: `invalid timezone "Mars/Olympus_Mons"`,
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			location, err := parseTimezone(tc.timezone)
+			if tc.expectedErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tc.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+
+			if tc.expectedOffset != 0 {
+				require.NotNil(t, location)
+				_, offset := time.Now().In(location).Zone()
+				assert.Equal(t, tc.expectedOffset, offset)
+				return
+			}
+			assert.Equal(t, tc.expected, location)
+		})
+	}
+}
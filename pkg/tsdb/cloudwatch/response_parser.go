@@ -7,6 +7,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/cloudwatch"
 	"github.com/grafana/grafana-plugin-sdk-go/data"
 )
@@ -16,6 +17,7 @@ func (e *cloudWatchExecutor) parseResponse(metricDataOutputs []*cloudwatch.GetMe
 	// Map from result ID -> label -> result
 	mdrs := make(map[string]map[string]*cloudwatch.MetricDataResult)
 	labels := map[string][]string{}
+	messages := map[string][]*cloudwatch.MessageData{}
 	for _, mdo := range metricDataOutputs {
 		requestExceededMaxLimit := false
 		for _, message := range mdo.Messages {
@@ -43,12 +45,19 @@ func (e *cloudWatchExecutor) parseResponse(metricDataOutputs []*cloudwatch.GetMe
 				}
 			}
 			queries[id].RequestExceededMaxLimit = requestExceededMaxLimit
+			messages[id] = appendMessages(messages[id], mdo.Messages...)
+			messages[id] = appendMessages(messages[id], r.Messages...)
 		}
 	}
 
 	cloudWatchResponses := make([]*cloudwatchResponse, 0, len(mdrs))
 	for id, lr := range mdrs {
 		query := queries[id]
+		// Queries sent with ReturnData false are only used by expressions, and aren't part of the response
+		if !query.ReturnData {
+			continue
+		}
+
 		frames, partialData, err := parseMetricResults(lr, labels[id], query)
 		if err != nil {
 			return nil, err
@@ -62,13 +71,92 @@ func (e *cloudWatchExecutor) parseResponse(metricDataOutputs []*cloudwatch.GetMe
 			Id:                      query.Id,
 			RequestExceededMaxLimit: query.RequestExceededMaxLimit,
 			PartialData:             partialData,
+			Messages:                messages[id],
+		}
+		if query.IncludeRawResults {
+			response.RawResults = rawMetricDataResults(lr, labels[id])
 		}
 		cloudWatchResponses = append(cloudWatchResponses, response)
 	}
 
+	for id, query := range queries {
+		if _, exists := mdrs[id]; exists || !query.ReturnData {
+			continue
+		}
+
+		cloudWatchResponses = append(cloudWatchResponses, &cloudwatchResponse{
+			DataFrames:              noResultFrames(query),
+			Period:                  query.Period,
+			Expression:              query.UsedExpression,
+			RefId:                   query.RefId,
+			Id:                      query.Id,
+			RequestExceededMaxLimit: query.RequestExceededMaxLimit,
+			Messages:                messages[id],
+		})
+	}
+
 	return cloudWatchResponses, nil
 }
 
+// appendMessages appends the GetMetricData messages not already in messages, as the same messages are returned with
+// each page of results.
+func appendMessages(messages []*cloudwatch.MessageData, newMessages ...*cloudwatch.MessageData) []*cloudwatch.MessageData {
+	for _, message := range newMessages {
+		duplicate := false
+		for _, existing := range messages {
+			if aws.StringValue(existing.Code) == aws.StringValue(message.Code) &&
+				aws.StringValue(existing.Value) == aws.StringValue(message.Value) {
+				duplicate = true
+				break
+			}
+		}
+		if !duplicate {
+			messages = append(messages, message)
+		}
+	}
+
+	return messages
+}
+
+// messageNotices returns a warning notice for each GetMetricData message, such as MaxMetricsExceeded when the
+// results were limited.
+func messageNotices(messages []*cloudwatch.MessageData) []data.Notice {
+	notices := make([]data.Notice, 0, len(messages))
+	for _, message := range messages {
+		text := aws.StringValue(message.Code)
+		if value := aws.StringValue(message.Value); value != "" {
+			text = fmt.Sprintf("%s: %s", text, value)
+		}
+		notices = append(notices, data.Notice{
+			Severity: data.NoticeSeverityWarning,
+			Text:     text,
+		})
+	}
+
+	return notices
+}
+
+// rawMetricDataResults returns the GetMetricData results of a query, with timestamps in epoch milliseconds.
+func rawMetricDataResults(results map[string]*cloudwatch.MetricDataResult, labels []string) []rawMetricDataResult {
+	raw := make([]rawMetricDataResult, 0, len(labels))
+	for _, label := range labels {
+		result := results[label]
+		timestamps := make([]int64, 0, len(result.Timestamps))
+		for _, t := range result.Timestamps {
+			timestamps = append(timestamps, t.UnixNano()/int64(time.Millisecond))
+		}
+		raw = append(raw, rawMetricDataResult{
+			ID:         aws.StringValue(result.Id),
+			Label:      label,
+			StatusCode: aws.StringValue(result.StatusCode),
+			Timestamps: timestamps,
+			Values:     result.Values,
+		})
+	}
+
+	return raw
+}
+
 func parseMetricResults(results map[string]*cloudwatch.MetricDataResult, labels []string,
 	query *cloudWatchQuery) (data.Frames, bool, error) {
 	partialData := false
@@ -88,39 +176,7 @@ func parseMetricResults(results map[string]*cloudwatch.MetricDataResult, labels
 		// In case a multi-valued dimension is used and the cloudwatch query yields no values, create one empty time
 		// series for each dimension value. Use that dimension value to expand the alias field
 		if len(result.Values) == 0 && query.isMultiValuedDimensionExpression() {
-			series := 0
-			multiValuedDimension := ""
-			for key, values := range query.Dimensions {
-				if len(values) > series {
-					series = len(values)
-					multiValuedDimension = key
-				}
-			}
-
-			for _, value := range query.Dimensions[multiValuedDimension] {
-				tags := map[string]string{multiValuedDimension: value}
-				for key, values := range query.Dimensions {
-					if key != multiValuedDimension && len(values) > 0 {
-						tags[key] = values[0]
-					}
-				}
-
-				timeField := data.NewField(data.TimeSeriesTimeFieldName, nil, []*time.Time{})
-				valueField := data.NewField(data.TimeSeriesValueFieldName, tags, []*float64{})
-
-				frameName := formatAlias(query, query.Stats, tags, label)
-				valueField.SetConfig(&data.FieldConfig{DisplayNameFromDS: frameName})
-
-				emptyFrame := data.Frame{
-					Name: frameName,
-					Fields: []*data.Field{
-						timeField,
-						valueField,
-					},
-					RefID: query.RefId,
-				}
-				frames = append(frames, &emptyFrame)
-			}
+			frames = append(frames, multiValuedDimensionEmptyFrames(query, label)...)
 		} else {
 			dims := make([]string, 0, len(query.Dimensions))
 			for k := range query.Dimensions {
@@ -144,6 +200,11 @@ func parseMetricResults(results map[string]*cloudwatch.MetricDataResult, labels
 				}
 			}
 
+			// The results of a Metrics Insights query grouped by a single key are labelled with its value
+			if groupBy := query.metricsInsightsGroupByKeys(); len(groupBy) == 1 {
+				tags[groupBy[0]] = label
+			}
+
 			timestamps := []*time.Time{}
 			points := []*float64{}
 			for j, t := range result.Timestamps {
@@ -159,10 +220,17 @@ func parseMetricResults(results map[string]*cloudwatch.MetricDataResult, labels
 				points = append(points, val)
 			}
 
+			frameName := regionFrameName(query, formatAlias(query, query.Stats, tags, label))
+			if query.isAnomalyDetectionBandExpression() {
+				if band := anomalyDetectionBand(label); band != "" {
+					tags["band"] = band
+					frameName += " " + band
+				}
+			}
+			addMetricLabels(tags, query)
+
 			timeField := data.NewField(data.TimeSeriesTimeFieldName, nil, timestamps)
 			valueField := data.NewField(data.TimeSeriesValueFieldName, tags, points)
-
-			frameName := formatAlias(query, query.Stats, tags, label)
 			valueField.SetConfig(&data.FieldConfig{DisplayNameFromDS: frameName})
 
 			frame := data.Frame{
@@ -180,6 +248,81 @@ func parseMetricResults(results map[string]*cloudwatch.MetricDataResult, labels
 	return frames, partialData, nil
 }
 
+// multiValuedDimensionEmptyFrames returns an empty series for each value of the multi-valued dimension of a query.
+func multiValuedDimensionEmptyFrames(query *cloudWatchQuery, label string) data.Frames {
+	series := 0
+	multiValuedDimension := ""
+	for key, values := range query.Dimensions {
+		if len(values) > series {
+			series = len(values)
+			multiValuedDimension = key
+		}
+	}
+
+	frames := data.Frames{}
+	for _, value := range query.Dimensions[multiValuedDimension] {
+		tags := map[string]string{multiValuedDimension: value}
+		for key, values := range query.Dimensions {
+			if key != multiValuedDimension && len(values) > 0 {
+				tags[key] = values[0]
+			}
+		}
+
+		frameName := regionFrameName(query, formatAlias(query, query.Stats, tags, label))
+		addMetricLabels(tags, query)
+		frames = append(frames, emptyMetricFrame(query, frameName, tags))
+	}
+
+	return frames
+}
+
+// noResultFrames returns the frames of a query GetMetricData returned no results for, such as a search expression
+// matching no metrics. It gets empty series like a query whose metrics have no datapoints, rather than no frames.
+func noResultFrames(query *cloudWatchQuery) data.Frames {
+	// The label CloudWatch would have returned for a single metric, or for an expression
+	label := query.MetricName
+	if label == "" {
+		label = query.Id
+	}
+
+	if query.isMultiValuedDimensionExpression() {
+		return multiValuedDimensionEmptyFrames(query, label)
+	}
+
+	// Wildcards have no value to label the series with
+	tags := data.Labels{}
+	for key, values := range query.Dimensions {
+		if len(values) == 1 && values[0] != "*" {
+			tags[key] = values[0]
+		}
+	}
+	frameName := regionFrameName(query, formatAlias(query, query.Stats, tags, label))
+	addMetricLabels(tags, query)
+
+	return data.Frames{emptyMetricFrame(query, frameName, tags)}
+}
+
+// emptyMetricFrame returns a series without datapoints, with the same fields as the series of other results.
+func emptyMetricFrame(query *cloudWatchQuery, frameName string, tags data.Labels) *data.Frame {
+	timeField := data.NewField(data.TimeSeriesTimeFieldName, nil, []*time.Time{})
+	valueField := data.NewField(data.TimeSeriesValueFieldName, tags, []*float64{})
+	valueField.SetConfig(&data.FieldConfig{DisplayNameFromDS: frameName})
+
+	return &data.Frame{
+		Name: frameName,
+		Fields: []*data.Field{
+			timeField,
+			valueField,
+		},
+		RefID: query.RefId,
+	}
+}
+
+// formatAlias returns the name of a series, replacing the {{token}}s in the alias of the query. The tokens are the
+// region, namespace, metric, stat, period and label, the latter being the label returned by CloudWatch, and the
+// dimensions of the series, which take precedence over the other tokens when they share a name. Tokens without a
+// value, such as the label of GetMetricStatistics results, are replaced with an empty string, while unknown tokens
+// are left as they are.
 func formatAlias(query *cloudWatchQuery, stat string, dimensions map[string]string, label string) string {
 	region := query.Region
 	namespace := query.Namespace
@@ -196,6 +339,9 @@ func formatAlias(query *cloudWatchQuery, stat string, dimensions map[string]stri
 	if len(query.Alias) == 0 && query.isMathExpression() {
 		return query.Id
 	}
+	if len(query.Alias) == 0 && query.isMetricsInsightsQuery() {
+		return label
+	}
 	if len(query.Alias) == 0 && query.isInferredSearchExpression() && !query.isMultiValuedDimensionExpression() {
 		return label
 	}
@@ -206,9 +352,7 @@ func formatAlias(query *cloudWatchQuery, stat string, dimensions map[string]stri
 		"metric":    metricName,
 		"stat":      stat,
 		"period":    period,
-	}
-	if len(label) != 0 {
-		data["label"] = label
+		"label":     label,
 	}
 	for k, v := range dimensions {
 		data[k] = v
@@ -226,8 +370,74 @@ func formatAlias(query *cloudWatchQuery, stat string, dimensions map[string]stri
 	})
 
 	if string(result) == "" {
-		return metricName + "_" + stat
+		return defaultAlias(metricName, stat, dimensions, query.MultipleStats)
 	}
 
 	return string(result)
 }
+
+// addMetricLabels adds the namespace, metric name and statistic of a query to the labels of its series, next to
+// the dimensions, so they can be used in transformations and field overrides. Queries executed in several regions
+// are labelled with the region as well.
+func addMetricLabels(labels data.Labels, query *cloudWatchQuery) {
+	if query.Namespace != "" {
+		labels["namespace"] = query.Namespace
+	}
+	if query.MetricName != "" {
+		labels["metricName"] = query.MetricName
+	}
+	if query.Stats != "" && !query.isMathExpression() {
+		labels["stat"] = query.Stats
+	}
+	if query.MultipleRegions {
+		labels["region"] = query.Region
+	}
+}
+
+// regionFrameName appends the region to the name of a series of a query executed in several regions, unless the
+// name comes from an alias, which can include the region itself.
+func regionFrameName(query *cloudWatchQuery, frameName string) string {
+	if !query.MultipleRegions || query.Alias != "" {
+		return frameName
+	}
+
+	return frameName + " " + query.Region
+}
+
+// anomalyDetectionBand tells which side of an anomaly detection band a result belongs to. CloudWatch returns
+// the band as two results sharing the expression id, told apart by the " High" and " Low" suffixes of their labels.
+func anomalyDetectionBand(label string) string {
+	switch {
+	case strings.HasSuffix(label, " High"):
+		return "upper"
+	case strings.HasSuffix(label, " Low"):
+		return "lower"
+	default:
+		return ""
+	}
+}
+
+// defaultAlias returns the series name used when no alias is set. Like the CloudWatch console, the metric name
+// is followed by the values of its dimensions, ordered by dimension name, and the statistic if the query has
+// several. Metrics without dimensions keep the <metric>_<stat> format.
+func defaultAlias(metricName string, stat string, dimensions map[string]string, includeStat bool) string {
+	if len(dimensions) == 0 {
+		return metricName + "_" + stat
+	}
+
+	keys := make([]string, 0, len(dimensions))
+	for k := range dimensions {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	name := metricName
+	for _, k := range keys {
+		name += " " + dimensions[k]
+	}
+	if includeStat {
+		name += " " + stat
+	}
+
+	return name
+}
@@ -6,11 +6,13 @@ import (
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
 func TestCloudWatchResponseParser(t *testing.T) {
+	executor := newExecutor(nil)
 	t.Run("Expand dimension value using exact match", func(t *testing.T) {
 		timestamp := time.Unix(0, 0)
 		labels := []string{"lb1", "lb2"}
@@ -319,4 +321,383 @@ func TestCloudWatchResponseParser(t *testing.T) {
 		assert.Equal(t, "Value", frame.Fields[1].Name)
 		assert.Equal(t, "", frame.Fields[1].Config.DisplayName)
 	})
+
+	t.Run("Console style name is used when no alias is set", func(t *testing.T) {
+		timestamp := time.Unix(0, 0)
+		labels := []string{"TargetResponseTime"}
+		mdrs := map[string]*cloudwatch.MetricDataResult{
+			"TargetResponseTime": {
+				Id:    aws.String("id1"),
+				Label: aws.String("TargetResponseTime"),
+				Timestamps: []*time.Time{
+					aws.Time(timestamp),
+				},
+				Values: []*float64{
+					aws.Float64(10),
+				},
+				StatusCode: aws.String("Complete"),
+			},
+		}
+
+		query := &cloudWatchQuery{
+			RefId:      "refId1",
+			Region:     "us-east-1",
+			Namespace:  "AWS/ApplicationELB",
+			MetricName: "TargetResponseTime",
+			Dimensions: map[string][]string{
+				"TargetGroup":  {"tg"},
+				"LoadBalancer": {"lb"},
+			},
+			Stats:      "Average",
+			Period:     60,
+			MatchExact: true,
+		}
+		frames, _, err := parseMetricResults(mdrs, labels, query)
+		require.NoError(t, err)
+
+		require.Len(t, frames, 1)
+		assert.Equal(t, "TargetResponseTime lb tg", frames[0].Name)
+		assert.Equal(t, "TargetResponseTime lb tg", frames[0].Fields[1].Config.DisplayNameFromDS)
+	})
+
+	t.Run("Metric name and stat is used when no alias is set and there are no dimensions", func(t *testing.T) {
+		query := &cloudWatchQuery{
+			Namespace:  "AWS/ApplicationELB",
+			MetricName: "TargetResponseTime",
+			Dimensions: map[string][]string{},
+			Stats:      "Average",
+			Period:     60,
+			MatchExact: true,
+		}
+
+		assert.Equal(t, "TargetResponseTime_Average", formatAlias(query, query.Stats, map[string]string{}, "TargetResponseTime"))
+	})
+
+	t.Run("Region and period can be used in the alias", func(t *testing.T) {
+		query := &cloudWatchQuery{
+			Region:     "eu-west-1",
+			Namespace:  "AWS/ApplicationELB",
+			MetricName: "TargetResponseTime",
+			Dimensions: map[string][]string{},
+			Stats:      "Average",
+			Period:     300,
+			Alias:      "{{metric}} in {{ region }} every {{ period }}s",
+			MatchExact: true,
+		}
+
+		assert.Equal(t, "TargetResponseTime in eu-west-1 every 300s",
+			formatAlias(query, query.Stats, map[string]string{}, "TargetResponseTime"))
+	})
+
+	t.Run("Period of a search expression is used in the alias", func(t *testing.T) {
+		query := &cloudWatchQuery{
+			Region:     "eu-west-1",
+			Expression: `SEARCH('{AWS/EC2,InstanceId} MetricName="CPUUtilization"', 'Maximum', 600)`,
+			Stats:      "Average",
+			Period:     300,
+			Alias:      "{{region}} {{stat}} {{period}}",
+		}
+
+		assert.Equal(t, "eu-west-1 Maximum 600", formatAlias(query, query.Stats, map[string]string{}, ""))
+	})
+
+	t.Run("Stat and label can be used in the alias", func(t *testing.T) {
+		query := &cloudWatchQuery{
+			Namespace:  "AWS/ApplicationELB",
+			MetricName: "TargetResponseTime",
+			Dimensions: map[string][]string{},
+			Stats:      "p99",
+			Period:     60,
+			Alias:      "{{ label }} ({{ stat }})",
+			MatchExact: true,
+		}
+
+		assert.Equal(t, "TargetResponseTime lb1 (p99)",
+			formatAlias(query, query.Stats, map[string]string{}, "TargetResponseTime lb1"))
+	})
+
+	t.Run("Tokens without a value are replaced with an empty string", func(t *testing.T) {
+		query := &cloudWatchQuery{
+			Namespace:     "AWS/ApplicationELB",
+			MetricName:    "TargetResponseTime",
+			SqlExpression: `SELECT AVG(TargetResponseTime) FROM "AWS/ApplicationELB"`,
+			Dimensions:    map[string][]string{},
+			Period:        60,
+			Alias:         "{{metric}}[{{label}}][{{stat}}] {{unknown}}",
+		}
+
+		assert.Equal(t, "TargetResponseTime[][] {{unknown}}", formatAlias(query, "", map[string]string{}, ""))
+	})
+
+	t.Run("Dimensions take precedence over the other tokens", func(t *testing.T) {
+		query := &cloudWatchQuery{
+			Namespace:  "Custom",
+			MetricName: "Requests",
+			Dimensions: map[string][]string{"stat": {"*"}},
+			Stats:      "Sum",
+			Period:     60,
+			Alias:      "{{stat}}",
+			MatchExact: true,
+		}
+
+		assert.Equal(t, "cached", formatAlias(query, query.Stats, map[string]string{"stat": "cached"}, ""))
+	})
+
+	t.Run("Dimensions, namespace, metric name and stat are set as labels", func(t *testing.T) {
+		timestamp := time.Unix(0, 0)
+		labels := []string{"lb1", "lb2"}
+		mdrs := map[string]*cloudwatch.MetricDataResult{
+			"lb1": {
+				Id:         aws.String("id1"),
+				Label:      aws.String("lb1"),
+				Timestamps: []*time.Time{aws.Time(timestamp)},
+				Values:     []*float64{aws.Float64(10)},
+				StatusCode: aws.String("Complete"),
+			},
+			"lb2": {
+				Id:         aws.String("id1"),
+				Label:      aws.String("lb2"),
+				Timestamps: []*time.Time{aws.Time(timestamp)},
+				Values:     []*float64{aws.Float64(20)},
+				StatusCode: aws.String("Complete"),
+			},
+		}
+
+		query := &cloudWatchQuery{
+			RefId:      "refId1",
+			Region:     "us-east-1",
+			Namespace:  "AWS/ApplicationELB",
+			MetricName: "TargetResponseTime",
+			Dimensions: map[string][]string{
+				"LoadBalancer": {"lb1", "lb2"},
+				"TargetGroup":  {"tg"},
+			},
+			Stats:  "Average",
+			Period: 60,
+			Alias:  "{{LoadBalancer}}",
+		}
+		frames, _, err := parseMetricResults(mdrs, labels, query)
+		require.NoError(t, err)
+		require.Len(t, frames, 2)
+
+		assert.Equal(t, "lb1", frames[0].Name)
+		assert.Equal(t, data.Labels{
+			"LoadBalancer": "lb1",
+			"TargetGroup":  "tg",
+			"namespace":    "AWS/ApplicationELB",
+			"metricName":   "TargetResponseTime",
+			"stat":         "Average",
+		}, frames[0].Fields[1].Labels)
+
+		assert.Equal(t, "lb2", frames[1].Name)
+		assert.Equal(t, data.Labels{
+			"LoadBalancer": "lb2",
+			"TargetGroup":  "tg",
+			"namespace":    "AWS/ApplicationELB",
+			"metricName":   "TargetResponseTime",
+			"stat":         "Average",
+		}, frames[1].Fields[1].Labels)
+	})
+
+	t.Run("Math expressions are not labelled with a stat", func(t *testing.T) {
+		timestamp := time.Unix(0, 0)
+		labels := []string{"e1"}
+		mdrs := map[string]*cloudwatch.MetricDataResult{
+			"e1": {
+				Id:         aws.String("e1"),
+				Label:      aws.String("e1"),
+				Timestamps: []*time.Time{aws.Time(timestamp)},
+				Values:     []*float64{aws.Float64(10)},
+				StatusCode: aws.String("Complete"),
+			},
+		}
+
+		query := &cloudWatchQuery{
+			RefId:      "refId1",
+			Region:     "us-east-1",
+			Id:         "e1",
+			Expression: "m1 * 2",
+			Stats:      "Average",
+			Period:     60,
+		}
+		frames, _, err := parseMetricResults(mdrs, labels, query)
+		require.NoError(t, err)
+		require.Len(t, frames, 1)
+		assert.Empty(t, frames[0].Fields[1].Labels)
+	})
+
+	t.Run("Anomaly detection band is returned as upper and lower frames", func(t *testing.T) {
+		timestamp := time.Unix(0, 0)
+		mdo := &cloudwatch.GetMetricDataOutput{
+			MetricDataResults: []*cloudwatch.MetricDataResult{
+				{
+					Id:         aws.String("ad"),
+					Label:      aws.String("CPUUtilization (expected) High"),
+					Timestamps: []*time.Time{aws.Time(timestamp)},
+					Values:     []*float64{aws.Float64(12)},
+					StatusCode: aws.String("Complete"),
+				},
+				{
+					Id:         aws.String("ad"),
+					Label:      aws.String("CPUUtilization (expected) Low"),
+					Timestamps: []*time.Time{aws.Time(timestamp)},
+					Values:     []*float64{aws.Float64(8)},
+					StatusCode: aws.String("Complete"),
+				},
+			},
+		}
+		queries := map[string]*cloudWatchQuery{
+			"ad": {
+				RefId:      "B",
+				Region:     "us-east-1",
+				Id:         "ad",
+				Expression: "ANOMALY_DETECTION_BAND(m1, 2)",
+				Period:     60,
+				ReturnData: true,
+			},
+		}
+
+		responses, err := executor.parseResponse([]*cloudwatch.GetMetricDataOutput{mdo}, queries)
+		require.NoError(t, err)
+		require.Len(t, responses, 1)
+
+		frames := responses[0].DataFrames
+		require.Len(t, frames, 2)
+		assert.Equal(t, "ad upper", frames[0].Name)
+		assert.Equal(t, "upper", frames[0].Fields[1].Labels["band"])
+		assert.Equal(t, 12.0, *frames[0].Fields[1].At(0).(*float64))
+		assert.Equal(t, "ad lower", frames[1].Name)
+		assert.Equal(t, "lower", frames[1].Fields[1].Labels["band"])
+		assert.Equal(t, 8.0, *frames[1].Fields[1].At(0).(*float64))
+	})
+
+	t.Run("Result without datapoints is returned as an empty frame", func(t *testing.T) {
+		mdo := &cloudwatch.GetMetricDataOutput{
+			MetricDataResults: []*cloudwatch.MetricDataResult{
+				{
+					Id:         aws.String("m1"),
+					Label:      aws.String("CPUUtilization"),
+					Timestamps: []*time.Time{},
+					Values:     []*float64{},
+					StatusCode: aws.String("Complete"),
+				},
+			},
+		}
+		queries := map[string]*cloudWatchQuery{
+			"m1": {
+				RefId:      "A",
+				Region:     "us-east-1",
+				Id:         "m1",
+				Namespace:  "AWS/EC2",
+				MetricName: "CPUUtilization",
+				Dimensions: map[string][]string{"InstanceId": {"i-123"}},
+				Stats:      "Average",
+				Period:     60,
+				ReturnData: true,
+			},
+		}
+
+		responses, err := executor.parseResponse([]*cloudwatch.GetMetricDataOutput{mdo}, queries)
+		require.NoError(t, err)
+		require.Len(t, responses, 1)
+		require.Len(t, responses[0].DataFrames, 1)
+		assertEmptyMetricFrame(t, responses[0].DataFrames[0], "A")
+	})
+
+	t.Run("Query without results is returned as an empty frame", func(t *testing.T) {
+		queries := map[string]*cloudWatchQuery{
+			"m1": {
+				RefId:      "A",
+				Region:     "us-east-1",
+				Id:         "m1",
+				Namespace:  "AWS/EC2",
+				MetricName: "CPUUtilization",
+				Dimensions: map[string][]string{"InstanceId": {"i-123"}, "AutoScalingGroupName": {"*"}},
+				Stats:      "Average",
+				Period:     60,
+				ReturnData: true,
+			},
+			"m2": {
+				RefId:      "A",
+				Region:     "us-east-1",
+				Id:         "m2",
+				Namespace:  "AWS/EC2",
+				MetricName: "CPUUtilization",
+				Stats:      "Average",
+				Period:     60,
+				ReturnData: false,
+			},
+		}
+
+		responses, err := executor.parseResponse([]*cloudwatch.GetMetricDataOutput{{}}, queries)
+		require.NoError(t, err)
+		require.Len(t, responses, 1)
+		assert.Equal(t, "A", responses[0].RefId)
+		assert.Equal(t, "m1", responses[0].Id)
+		require.Len(t, responses[0].DataFrames, 1)
+
+		frame := responses[0].DataFrames[0]
+		assertEmptyMetricFrame(t, frame, "A")
+		assert.Equal(t, "CPUUtilization", frame.Name)
+		assert.Equal(t, "i-123", frame.Fields[1].Labels["InstanceId"])
+		assert.NotContains(t, frame.Fields[1].Labels, "AutoScalingGroupName")
+	})
+
+	t.Run("Query with a multi-valued dimension without results is returned as an empty frame per value", func(t *testing.T) {
+		queries := map[string]*cloudWatchQuery{
+			"m1": {
+				RefId:      "A",
+				Region:     "us-east-1",
+				Id:         "m1",
+				Namespace:  "AWS/ApplicationELB",
+				MetricName: "TargetResponseTime",
+				Dimensions: map[string][]string{"LoadBalancer": {"lb1", "lb2"}},
+				Stats:      "Average",
+				Period:     60,
+				Alias:      "{{LoadBalancer}}",
+				ReturnData: true,
+			},
+		}
+
+		responses, err := executor.parseResponse([]*cloudwatch.GetMetricDataOutput{{}}, queries)
+		require.NoError(t, err)
+		require.Len(t, responses, 1)
+
+		frames := responses[0].DataFrames
+		require.Len(t, frames, 2)
+		for _, frame := range frames {
+			assertEmptyMetricFrame(t, frame, "A")
+		}
+		assert.ElementsMatch(t, []string{"lb1", "lb2"}, []string{frames[0].Name, frames[1].Name})
+	})
+}
+
+func assertEmptyMetricFrame(t *testing.T, frame *data.Frame, refID string) {
+	t.Helper()
+
+	assert.Equal(t, refID, frame.RefID)
+	require.Len(t, frame.Fields, 2)
+	assert.Equal(t, data.TimeSeriesTimeFieldName, frame.Fields[0].Name)
+	assert.Equal(t, data.FieldTypeNullableTime, frame.Fields[0].Type())
+	assert.Equal(t, data.TimeSeriesValueFieldName, frame.Fields[1].Name)
+	assert.Equal(t, data.FieldTypeNullableFloat64, frame.Fields[1].Type())
+	rows, err := frame.RowLen()
+	require.NoError(t, err)
+	assert.Equal(t, 0, rows)
+}
+
+func TestAnomalyDetectionBand(t *testing.T) {
+	testCases := map[string]string{
+		"CPUUtilization (expected) High": "upper",
+		"CPUUtilization (expected) Low":  "lower",
+		"HighLatency":                    "",
+		"SlowQueries":                    "",
+		"FlowCount":                      "",
+		"FlowCount Slow":                 "",
+		"Latency (expected) high":        "",
+		"Latency High (expected)":        "",
+	}
+	for label, expected := range testCases {
+		assert.Equal(t, expected, anomalyDetectionBand(label), label)
+	}
 }
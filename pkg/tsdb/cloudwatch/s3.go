@@ -0,0 +1,119 @@
+package cloudwatch
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/grafana/grafana/pkg/components/simplejson"
+	"github.com/grafana/grafana/pkg/tsdb"
+	"golang.org/x/sync/errgroup"
+)
+
+// S3 client factory.
+//
+// Stubbable by tests.
+var newS3Client = func(provider client.ConfigProvider) s3iface.S3API {
+	client := s3.New(provider)
+	setUserAgent(&client.Handlers)
+
+	return client
+}
+
+func (e *cloudWatchExecutor) getS3Client(region string) (s3iface.S3API, error) {
+	sess, err := e.newSession(region)
+	if err != nil {
+		return nil, err
+	}
+
+	return newS3Client(sess), nil
+}
+
+// The number of buckets whose location is requested at once when filtering buckets by region.
+// Stubbable by tests.
+var maxConcurrentBucketLocations = 10
+
+// handleGetS3Buckets returns the names of the S3 buckets of the account, as used by the BucketName dimension.
+// Buckets are listed for all regions at once, so with filterByRegion set, only the buckets located in the region
+// of the query are returned.
+func (e *cloudWatchExecutor) handleGetS3Buckets(ctx context.Context, parameters *simplejson.Json,
+	queryContext *tsdb.TsdbQuery) ([]suggestData, error) {
+	region := parameters.Get("region").MustString(defaultRegion)
+	filterByRegion := parameters.Get("filterByRegion").MustBool(false)
+
+	client, err := e.getS3Client(region)
+	if err != nil {
+		return nil, err
+	}
+
+	output, err := client.ListBucketsWithContext(ctx, &s3.ListBucketsInput{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to call s3:ListBuckets, %w", err)
+	}
+
+	buckets := output.Buckets
+	if filterByRegion {
+		if region, err = e.resolveRegion(region); err != nil {
+			return nil, err
+		}
+		if buckets, err = bucketsInRegion(ctx, client, buckets, region); err != nil {
+			return nil, err
+		}
+	}
+
+	names := make([]string, 0, len(buckets))
+	for _, bucket := range buckets {
+		names = append(names, aws.StringValue(bucket.Name))
+	}
+
+	return sortedSuggestData(names), nil
+}
+
+// bucketsInRegion returns the buckets located in region. A request is made per bucket for its location, so these
+// are made concurrently, at most maxConcurrentBucketLocations at once.
+func bucketsInRegion(ctx context.Context, client s3iface.S3API, buckets []*s3.Bucket,
+	region string) ([]*s3.Bucket, error) {
+	inRegion := make([]bool, len(buckets))
+	slots := make(chan struct{}, maxConcurrentBucketLocations)
+	var eg errgroup.Group
+	for i, b := range buckets {
+		if ctx.Err() != nil {
+			break
+		}
+		i, bucket := i, b
+		slots <- struct{}{}
+		eg.Go(func() error {
+			defer func() { <-slots }()
+
+			location, err := client.GetBucketLocationWithContext(ctx, &s3.GetBucketLocationInput{
+				Bucket: bucket.Name,
+			})
+			if err != nil {
+				// The bucket may e.g. deny access to its location, in which case it can't be told apart
+				plog.Debug("Leaving out S3 bucket of unknown location", "bucket", aws.StringValue(bucket.Name),
+					"err", err)
+				return nil
+			}
+			inRegion[i] = s3.NormalizeBucketLocation(aws.StringValue(location.LocationConstraint)) == region
+			return nil
+		})
+	}
+	if err := eg.Wait(); err != nil {
+		return nil, err
+	}
+	// A cancelled query fails, rather than leaving out the buckets whose location wasn't requested
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var result []*s3.Bucket
+	for i, bucket := range buckets {
+		if inRegion[i] {
+			result = append(result, bucket)
+		}
+	}
+	return result, nil
+}
@@ -16,6 +16,7 @@ type envelope struct {
 }
 
 var sessCache = map[string]envelope{}
+var sessRefreshing = map[string]bool{}
 var sessCacheLock sync.RWMutex
 
 // Session factory.
@@ -25,6 +26,13 @@ var newSession = func(cfgs ...*aws.Config) (*session.Session, error) {
 	return session.NewSession(cfgs...)
 }
 
+// Factory for sessions built from the shared config files, e.g. for SSO or credential_process profiles.
+// Stubbable by tests.
+//nolint:gocritic
+var newSessionWithOptions = func(opts session.Options) (*session.Session, error) {
+	return session.NewSessionWithOptions(opts)
+}
+
 // STS credentials factory.
 // Stubbable by tests.
 //nolint:gocritic
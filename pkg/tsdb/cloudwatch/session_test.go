@@ -1,17 +1,30 @@
 package cloudwatch
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/client"
 	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
 	"github.com/aws/aws-sdk-go/aws/ec2metadata"
+	"github.com/aws/aws-sdk-go/aws/endpoints"
 	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/grafana/grafana/pkg/models"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -67,8 +80,9 @@ func TestNewSession_AssumeRole(t *testing.T) {
 		require.NotNil(t, sess)
 
 		expCreds := credentials.NewCredentials(&stscreds.AssumeRoleProvider{
-			RoleARN:  roleARN,
-			Duration: duration,
+			RoleARN:         roleARN,
+			RoleSessionName: "grafana",
+			Duration:        duration,
 		})
 		diff := cmp.Diff(expCreds, sess.Config.Credentials, cmp.Exporter(func(_ reflect.Type) bool {
 			return true
@@ -95,13 +109,1138 @@ func TestNewSession_AssumeRole(t *testing.T) {
 		require.NotNil(t, sess)
 
 		expCreds := credentials.NewCredentials(&stscreds.AssumeRoleProvider{
-			RoleARN:    roleARN,
-			ExternalID: aws.String(externalID),
-			Duration:   duration,
+			RoleARN:         roleARN,
+			ExternalID:      aws.String(externalID),
+			RoleSessionName: "grafana",
+			Duration:        duration,
 		})
 		diff := cmp.Diff(expCreds, sess.Config.Credentials, cmp.Exporter(func(_ reflect.Type) bool {
 			return true
 		}), cmpopts.IgnoreFields(stscreds.AssumeRoleProvider{}, "Expiry"))
 		assert.Empty(t, diff)
 	})
+
+	t.Run("With role session name", func(t *testing.T) {
+		t.Cleanup(func() {
+			sessCache = map[string]envelope{}
+		})
+
+		const roleARN = "test"
+		const roleSessionName = "grafana-alice"
+
+		e := newExecutor(nil)
+		e.DataSource = fakeDataSource(fakeDataSourceCfg{
+			assumeRoleARN:   roleARN,
+			roleSessionName: roleSessionName,
+		})
+
+		sess, err := e.newSession(defaultRegion)
+		require.NoError(t, err)
+		require.NotNil(t, sess)
+
+		expCreds := credentials.NewCredentials(&stscreds.AssumeRoleProvider{
+			RoleARN:         roleARN,
+			RoleSessionName: roleSessionName,
+			Duration:        duration,
+		})
+		diff := cmp.Diff(expCreds, sess.Config.Credentials, cmp.Exporter(func(_ reflect.Type) bool {
+			return true
+		}), cmpopts.IgnoreFields(stscreds.AssumeRoleProvider{}, "Expiry"))
+		assert.Empty(t, diff)
+	})
+
+	t.Run("With custom duration", func(t *testing.T) {
+		t.Cleanup(func() {
+			sessCache = map[string]envelope{}
+		})
+
+		const roleARN = "test"
+
+		e := newExecutor(nil)
+		e.DataSource = fakeDataSource(fakeDataSourceCfg{
+			assumeRoleARN:      roleARN,
+			assumeRoleDuration: "4h",
+		})
+
+		sess, err := e.newSession(defaultRegion)
+		require.NoError(t, err)
+		require.NotNil(t, sess)
+
+		expCreds := credentials.NewCredentials(&stscreds.AssumeRoleProvider{
+			RoleARN:         roleARN,
+			RoleSessionName: "grafana",
+			Duration:        4 * time.Hour,
+		})
+		diff := cmp.Diff(expCreds, sess.Config.Credentials, cmp.Exporter(func(_ reflect.Type) bool {
+			return true
+		}), cmpopts.IgnoreFields(stscreds.AssumeRoleProvider{}, "Expiry"))
+		assert.Empty(t, diff)
+
+		require.Len(t, sessCache, 1)
+		for _, env := range sessCache {
+			assert.WithinDuration(t, time.Now().Add(4*time.Hour), env.expiration, time.Minute)
+		}
+	})
+
+	t.Run("With invalid duration", func(t *testing.T) {
+		t.Cleanup(func() {
+			sessCache = map[string]envelope{}
+		})
+
+		for _, d := range []string{"5m", "24h", "soon"} {
+			e := newExecutor(nil)
+			e.DataSource = fakeDataSource(fakeDataSourceCfg{
+				assumeRoleARN:      "test",
+				assumeRoleDuration: d,
+			})
+
+			_, err := e.newSession(defaultRegion)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), fmt.Sprintf("invalid assume role duration %q", d))
+		}
+	})
+}
+
+// stubNewSession makes newSession return a session with the merged configs, without touching AWS.
+func stubNewSession(t *testing.T) {
+	t.Helper()
+
+	origNewSession := newSession
+	t.Cleanup(func() {
+		newSession = origNewSession
+		sessCache = map[string]envelope{}
+	})
+	newSession = func(cfgs ...*aws.Config) (*session.Session, error) {
+		cfg := aws.Config{}
+		cfg.MergeIn(cfgs...)
+		return &session.Session{
+			Config: &cfg,
+		}, nil
+	}
+}
+
+// stubEC2MetadataWithoutRegion makes the EC2 instance metadata service fail to return a region, as it does when
+// Grafana doesn't run on EC2.
+func stubEC2MetadataWithoutRegion(t *testing.T) {
+	t.Helper()
+
+	origNewEC2Metadata := newEC2Metadata
+	invalidateRegionCaches()
+	t.Cleanup(func() {
+		newEC2Metadata = origNewEC2Metadata
+		invalidateRegionCaches()
+	})
+
+	server := httptest.NewServer(http.NotFoundHandler())
+	t.Cleanup(server.Close)
+	newEC2Metadata = func(p client.ConfigProvider, cfgs ...*aws.Config) *ec2metadata.EC2Metadata {
+		cfgs = append(cfgs, &aws.Config{
+			Endpoint:   aws.String(server.URL),
+			MaxRetries: aws.Int(0),
+		})
+		return origNewEC2Metadata(p, cfgs...)
+	}
+}
+
+func TestNewSession_Proxy(t *testing.T) {
+	stubNewSession(t)
+
+	t.Run("Without proxy the default transport is used", func(t *testing.T) {
+		t.Cleanup(func() {
+			sessCache = map[string]envelope{}
+		})
+
+		e := newExecutor(nil)
+		e.DataSource = fakeDataSource()
+
+		sess, err := e.newSession("us-east-1")
+		require.NoError(t, err)
+		require.NotNil(t, sess.Config.HTTPClient)
+		transport, ok := sess.Config.HTTPClient.Transport.(*http.Transport)
+		require.True(t, ok)
+		assert.Nil(t, transport.TLSClientConfig)
+	})
+
+	t.Run("With proxy", func(t *testing.T) {
+		t.Cleanup(func() {
+			sessCache = map[string]envelope{}
+		})
+
+		e := newExecutor(nil)
+		e.DataSource = fakeDataSource(fakeDataSourceCfg{
+			proxyURL: "http://proxy.example.com:3128",
+			noProxy:  "internal.example.com",
+		})
+
+		sess, err := e.newSession("us-east-1")
+		require.NoError(t, err)
+		require.NotNil(t, sess.Config.HTTPClient)
+		transport, ok := sess.Config.HTTPClient.Transport.(*http.Transport)
+		require.True(t, ok)
+
+		req, err := http.NewRequest(http.MethodPost, "https://monitoring.us-east-1.amazonaws.com", nil)
+		require.NoError(t, err)
+		proxyURL, err := transport.Proxy(req)
+		require.NoError(t, err)
+		require.NotNil(t, proxyURL)
+		assert.Equal(t, "http://proxy.example.com:3128", proxyURL.String())
+
+		req, err = http.NewRequest(http.MethodPost, "https://monitoring.internal.example.com", nil)
+		require.NoError(t, err)
+		proxyURL, err = transport.Proxy(req)
+		require.NoError(t, err)
+		assert.Nil(t, proxyURL)
+	})
+}
+
+func TestNewSession_Timeouts(t *testing.T) {
+	stubNewSession(t)
+
+	t.Run("Default timeout", func(t *testing.T) {
+		t.Cleanup(func() {
+			sessCache = map[string]envelope{}
+		})
+
+		e := newExecutor(nil)
+		e.DataSource = fakeDataSource()
+
+		sess, err := e.newSession("us-east-1")
+		require.NoError(t, err)
+		require.NotNil(t, sess.Config.HTTPClient)
+		assert.Equal(t, defaultHTTPTimeout, sess.Config.HTTPClient.Timeout)
+	})
+
+	t.Run("Configured timeout", func(t *testing.T) {
+		t.Cleanup(func() {
+			sessCache = map[string]envelope{}
+		})
+
+		e := newExecutor(nil)
+		e.DataSource = fakeDataSource()
+		e.DataSource.JsonData.Set("timeout", 90)
+		e.DataSource.JsonData.Set("dialTimeout", 5)
+
+		sess, err := e.newSession("us-east-1")
+		require.NoError(t, err)
+		require.NotNil(t, sess.Config.HTTPClient)
+		assert.Equal(t, 90*time.Second, sess.Config.HTTPClient.Timeout)
+		transport, ok := sess.Config.HTTPClient.Transport.(*http.Transport)
+		require.True(t, ok)
+		assert.NotNil(t, transport.DialContext)
+	})
+}
+
+func TestNewSession_AssumeRoleMFA(t *testing.T) {
+	stubNewSession(t)
+	origNewSTSCredentials := newSTSCredentials
+	t.Cleanup(func() {
+		newSTSCredentials = origNewSTSCredentials
+	})
+
+	var provider *stscreds.AssumeRoleProvider
+	newSTSCredentials = func(c client.ConfigProvider, roleARN string,
+		options ...func(*stscreds.AssumeRoleProvider)) *credentials.Credentials {
+		provider = &stscreds.AssumeRoleProvider{
+			RoleARN: roleARN,
+		}
+		for _, o := range options {
+			o(provider)
+		}
+
+		return credentials.NewCredentials(provider)
+	}
+
+	const roleARN = "arn:aws:iam::123456789012:role/grafana"
+	const serialNumber = "arn:aws:iam::123456789012:mfa/grafana"
+
+	t.Run("Serial number and token are set on the provider", func(t *testing.T) {
+		t.Cleanup(func() {
+			sessCache = map[string]envelope{}
+		})
+		provider = nil
+
+		e := newExecutor(nil)
+		e.DataSource = fakeDataSource(fakeDataSourceCfg{
+			assumeRoleARN:   roleARN,
+			mfaSerialNumber: serialNumber,
+			mfaToken:        "123456",
+		})
+
+		_, err := e.newSession("us-east-1")
+		require.NoError(t, err)
+
+		require.NotNil(t, provider)
+		assert.Equal(t, aws.String(serialNumber), provider.SerialNumber)
+		require.NotNil(t, provider.TokenProvider)
+		token, err := provider.TokenProvider()
+		require.NoError(t, err)
+		assert.Equal(t, "123456", token)
+	})
+
+	t.Run("Missing token results in an error", func(t *testing.T) {
+		t.Cleanup(func() {
+			sessCache = map[string]envelope{}
+		})
+		provider = nil
+
+		e := newExecutor(nil)
+		e.DataSource = fakeDataSource(fakeDataSourceCfg{
+			assumeRoleARN:   roleARN,
+			mfaSerialNumber: serialNumber,
+		})
+
+		_, err := e.newSession("us-east-1")
+		require.EqualError(t, err, `assuming role "arn:aws:iam::123456789012:role/grafana" requires MFA with device `+
+			`"arn:aws:iam::123456789012:mfa/grafana", but no MFA token is configured`)
+		assert.Nil(t, provider)
+	})
+
+	t.Run("Without serial number no MFA is used", func(t *testing.T) {
+		t.Cleanup(func() {
+			sessCache = map[string]envelope{}
+		})
+		provider = nil
+
+		e := newExecutor(nil)
+		e.DataSource = fakeDataSource(fakeDataSourceCfg{
+			assumeRoleARN: roleARN,
+		})
+
+		_, err := e.newSession("us-east-1")
+		require.NoError(t, err)
+
+		require.NotNil(t, provider)
+		assert.Nil(t, provider.SerialNumber)
+		assert.Nil(t, provider.TokenProvider)
+	})
+}
+
+func TestNewSession_RoleSessionNameWithUser(t *testing.T) {
+	stubNewSession(t)
+	origNewSTSCredentials := newSTSCredentials
+	t.Cleanup(func() {
+		newSTSCredentials = origNewSTSCredentials
+	})
+
+	var provider *stscreds.AssumeRoleProvider
+	newSTSCredentials = func(c client.ConfigProvider, roleARN string,
+		options ...func(*stscreds.AssumeRoleProvider)) *credentials.Credentials {
+		provider = &stscreds.AssumeRoleProvider{
+			RoleARN: roleARN,
+		}
+		for _, o := range options {
+			o(provider)
+		}
+
+		return credentials.NewCredentials(provider)
+	}
+
+	newExecutorForUser := func(withUser bool, login string) *cloudWatchExecutor {
+		e := newExecutor(nil)
+		e.DataSource = fakeDataSource(fakeDataSourceCfg{
+			assumeRoleARN:   "arn:aws:iam::123456789012:role/grafana",
+			roleSessionName: "grafana-prod",
+		})
+		e.DataSource.JsonData.Set("roleSessionNameWithUser", withUser)
+		e.user = &models.SignedInUser{Login: login}
+		return e
+	}
+
+	tests := []struct {
+		name     string
+		withUser bool
+		login    string
+		expected string
+	}{
+		{name: "User login is appended", withUser: true, login: "alice@example.com",
+			expected: "grafana-prod-alice@example.com"},
+		{name: "Disallowed characters are replaced", withUser: true, login: "Jöhn Doe/ops",
+			expected: "grafana-prod-J_hn_Doe_ops"},
+		{name: "Long names are truncated", withUser: true, login: strings.Repeat("a", 100),
+			expected: "grafana-prod-" + strings.Repeat("a", 51)},
+		{name: "Users without login are left out", withUser: true, login: "", expected: "grafana-prod"},
+		{name: "User is left out unless enabled", withUser: false, login: "alice", expected: "grafana-prod"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Cleanup(func() {
+				sessCache = map[string]envelope{}
+			})
+			provider = nil
+
+			_, err := newExecutorForUser(tc.withUser, tc.login).newSession("us-east-1")
+			require.NoError(t, err)
+
+			require.NotNil(t, provider)
+			assert.Equal(t, tc.expected, provider.RoleSessionName)
+		})
+	}
+
+	t.Run("Sessions of different users are cached apart", func(t *testing.T) {
+		alice := newExecutorForUser(true, "alice")
+		bob := newExecutorForUser(true, "bob")
+
+		assert.NotEqual(t, sessionCacheKey(alice.getDSInfo("us-east-1"), "us-east-1"),
+			sessionCacheKey(bob.getDSInfo("us-east-1"), "us-east-1"))
+	})
+}
+
+func TestNewSession_AssumeRoleChain(t *testing.T) {
+	stubNewSession(t)
+	origNewSTSCredentials := newSTSCredentials
+	t.Cleanup(func() {
+		newSTSCredentials = origNewSTSCredentials
+	})
+
+	type assumption struct {
+		provider    *stscreds.AssumeRoleProvider
+		parentCreds *credentials.Credentials
+		creds       *credentials.Credentials
+	}
+	var assumptions []assumption
+	newSTSCredentials = func(c client.ConfigProvider, roleARN string,
+		options ...func(*stscreds.AssumeRoleProvider)) *credentials.Credentials {
+		provider := &stscreds.AssumeRoleProvider{
+			RoleARN: roleARN,
+		}
+		for _, o := range options {
+			o(provider)
+		}
+
+		creds := credentials.NewCredentials(provider)
+		assumptions = append(assumptions, assumption{
+			provider:    provider,
+			parentCreds: c.(*session.Session).Config.Credentials,
+			creds:       creds,
+		})
+		return creds
+	}
+
+	const intermediateRoleARN = "arn:aws:iam::123456789012:role/intermediate"
+	const finalRoleARN = "arn:aws:iam::210987654321:role/grafana"
+	newExecutorWithRoles := func(roleARNs interface{}) *cloudWatchExecutor {
+		e := newExecutor(nil)
+		e.DataSource = fakeDataSource(fakeDataSourceCfg{
+			externalID:      "external",
+			mfaSerialNumber: "arn:aws:iam::123456789012:mfa/grafana",
+			mfaToken:        "123456",
+		})
+		e.DataSource.JsonData.Set("assumeRoleArn", roleARNs)
+		return e
+	}
+
+	for name, roleARNs := range map[string]interface{}{
+		"list":                   []interface{}{intermediateRoleARN, finalRoleARN},
+		"comma separated string": intermediateRoleARN + ", " + finalRoleARN,
+	} {
+		t.Run(fmt.Sprintf("Roles given as %s are assumed in turn", name), func(t *testing.T) {
+			t.Cleanup(func() {
+				sessCache = map[string]envelope{}
+			})
+			assumptions = nil
+
+			sess, err := newExecutorWithRoles(roleARNs).newSession("us-east-1")
+			require.NoError(t, err)
+
+			require.Len(t, assumptions, 2)
+			assert.Equal(t, intermediateRoleARN, assumptions[0].provider.RoleARN)
+			assert.Equal(t, finalRoleARN, assumptions[1].provider.RoleARN)
+			// The final role is assumed with the credentials of the intermediate role
+			assert.Same(t, assumptions[0].creds, assumptions[1].parentCreds)
+			assert.Same(t, assumptions[1].creds, sess.Config.Credentials)
+
+			// MFA authenticates the first assumption, the external ID is for the last one
+			assert.Equal(t, aws.String("arn:aws:iam::123456789012:mfa/grafana"), assumptions[0].provider.SerialNumber)
+			assert.Nil(t, assumptions[0].provider.ExternalID)
+			assert.Nil(t, assumptions[1].provider.SerialNumber)
+			assert.Equal(t, aws.String("external"), assumptions[1].provider.ExternalID)
+		})
+	}
+
+	t.Run("All roles are part of the session cache key", func(t *testing.T) {
+		chained := newExecutorWithRoles([]interface{}{intermediateRoleARN, finalRoleARN})
+		direct := newExecutorWithRoles([]interface{}{finalRoleARN})
+
+		assert.NotEqual(t, sessionCacheKey(chained.getDSInfo("us-east-1"), "us-east-1"),
+			sessionCacheKey(direct.getDSInfo("us-east-1"), "us-east-1"))
+	})
+
+	t.Run("Chained role sessions can't last over an hour", func(t *testing.T) {
+		t.Cleanup(func() {
+			sessCache = map[string]envelope{}
+		})
+
+		e := newExecutorWithRoles([]interface{}{intermediateRoleARN, finalRoleARN})
+		e.DataSource.JsonData.Set("assumeRoleDuration", "2h")
+
+		_, err := e.newSession("us-east-1")
+		assert.EqualError(t, err, `invalid assume role duration "2h": must be at most 1h when assuming several `+
+			`roles in turn`)
+	})
+
+	for name, externalIDs := range map[string]interface{}{
+		"list":                   []interface{}{"", "final"},
+		"comma separated string": ", final",
+	} {
+		t.Run(fmt.Sprintf("External IDs given as %s are used for their role", name), func(t *testing.T) {
+			t.Cleanup(func() {
+				sessCache = map[string]envelope{}
+			})
+			assumptions = nil
+
+			e := newExecutorWithRoles([]interface{}{intermediateRoleARN, finalRoleARN})
+			e.DataSource.JsonData.Set("externalId", externalIDs)
+			_, err := e.newSession("us-east-1")
+			require.NoError(t, err)
+
+			require.Len(t, assumptions, 2)
+			assert.Nil(t, assumptions[0].provider.ExternalID)
+			assert.Equal(t, aws.String("final"), assumptions[1].provider.ExternalID)
+		})
+	}
+
+	t.Run("Each role is assumed with its own external ID", func(t *testing.T) {
+		t.Cleanup(func() {
+			sessCache = map[string]envelope{}
+		})
+		assumptions = nil
+
+		e := newExecutorWithRoles([]interface{}{intermediateRoleARN, finalRoleARN})
+		e.DataSource.JsonData.Set("externalId", []interface{}{"intermediate", "final"})
+		_, err := e.newSession("us-east-1")
+		require.NoError(t, err)
+
+		require.Len(t, assumptions, 2)
+		assert.Equal(t, aws.String("intermediate"), assumptions[0].provider.ExternalID)
+		assert.Equal(t, aws.String("final"), assumptions[1].provider.ExternalID)
+	})
+
+	t.Run("External IDs must match the roles", func(t *testing.T) {
+		t.Cleanup(func() {
+			sessCache = map[string]envelope{}
+		})
+		assumptions = nil
+
+		e := newExecutorWithRoles([]interface{}{intermediateRoleARN, finalRoleARN})
+		e.DataSource.JsonData.Set("externalId", []interface{}{"a", "b", "c"})
+		_, err := e.newSession("us-east-1")
+		assert.EqualError(t, err, "invalid external IDs: 3 given for 2 roles, must be one per role or a single one "+
+			"for the last role")
+		assert.Empty(t, assumptions)
+	})
+
+	t.Run("External IDs are part of the session cache key", func(t *testing.T) {
+		e1 := newExecutorWithRoles([]interface{}{intermediateRoleARN, finalRoleARN})
+		e2 := newExecutorWithRoles([]interface{}{intermediateRoleARN, finalRoleARN})
+		e2.DataSource.JsonData.Set("externalId", []interface{}{"intermediate", "external"})
+
+		assert.NotEqual(t, sessionCacheKey(e1.getDSInfo("us-east-1"), "us-east-1"),
+			sessionCacheKey(e2.getDSInfo("us-east-1"), "us-east-1"))
+	})
+}
+
+func TestNewSession_SharedCredentials(t *testing.T) {
+	stubNewSession(t)
+	origNewSessionWithOptions := newSessionWithOptions
+	t.Cleanup(func() {
+		newSessionWithOptions = origNewSessionWithOptions
+	})
+
+	var opts []session.Options
+	newSessionWithOptions = func(o session.Options) (*session.Session, error) {
+		opts = append(opts, o)
+		cfg := o.Config
+		return &session.Session{
+			Config: &cfg,
+		}, nil
+	}
+
+	e := newExecutor(nil)
+	e.DataSource = fakeDataSource()
+	e.DataSource.JsonData.Set("authType", "credentials")
+	e.DataSource.JsonData.Set("profile", "sso-profile")
+
+	sess, err := e.newSession("us-east-1")
+	require.NoError(t, err)
+	require.NotNil(t, sess)
+
+	require.Len(t, opts, 1)
+	assert.Equal(t, "sso-profile", opts[0].Profile)
+	assert.Equal(t, session.SharedConfigEnable, opts[0].SharedConfigState)
+	assert.Equal(t, "us-east-1", aws.StringValue(opts[0].Config.Region))
+	// The credentials are resolved from the profile by the SDK, not set explicitly
+	assert.Nil(t, opts[0].Config.Credentials)
+}
+
+func TestNewSession_StaticCredentials(t *testing.T) {
+	stubNewSession(t)
+
+	getCredentials := func(t *testing.T, cfg fakeDataSourceCfg) credentials.Value {
+		t.Helper()
+
+		e := newExecutor(nil)
+		e.DataSource = fakeDataSource(cfg)
+		sess, err := e.newSession("us-east-1")
+		require.NoError(t, err)
+		require.NotNil(t, sess)
+
+		value, err := sess.Config.Credentials.Get()
+		require.NoError(t, err)
+		return value
+	}
+
+	t.Run("Without session token", func(t *testing.T) {
+		value := getCredentials(t, fakeDataSourceCfg{
+			accessKey: "AKIAFAKEACCESSKEY",
+			secretKey: "fake-secret-key",
+		})
+
+		assert.Equal(t, "AKIAFAKEACCESSKEY", value.AccessKeyID)
+		assert.Equal(t, "fake-secret-key", value.SecretAccessKey)
+		assert.Empty(t, value.SessionToken)
+	})
+
+	t.Run("With session token", func(t *testing.T) {
+		value := getCredentials(t, fakeDataSourceCfg{
+			accessKey:    "ASIAFAKEACCESSKEY",
+			secretKey:    "fake-secret-key",
+			sessionToken: "fake-session-token",
+		})
+
+		assert.Equal(t, "ASIAFAKEACCESSKEY", value.AccessKeyID)
+		assert.Equal(t, "fake-secret-key", value.SecretAccessKey)
+		assert.Equal(t, "fake-session-token", value.SessionToken)
+	})
+
+	t.Run("Session token is hashed in the cache key", func(t *testing.T) {
+		e := newExecutor(nil)
+		e.DataSource = fakeDataSource(fakeDataSourceCfg{
+			accessKey:    "ASIAFAKEACCESSKEY",
+			secretKey:    "fake-secret-key",
+			sessionToken: "fake-session-token",
+		})
+
+		cacheKey := sessionCacheKey(e.getDSInfo("us-east-1"), "us-east-1")
+		assert.NotContains(t, cacheKey, "fake-session-token")
+		assert.NotEqual(t, sessionCacheKey(&datasourceInfo{AccessKey: "ASIAFAKEACCESSKEY"}, "us-east-1"),
+			sessionCacheKey(&datasourceInfo{AccessKey: "ASIAFAKEACCESSKEY", SessionToken: "token"}, "us-east-1"))
+		// Renewed temporary credentials may keep the access key, but must not reuse the session of the old token
+		assert.NotEqual(t,
+			sessionCacheKey(&datasourceInfo{AccessKey: "ASIAFAKEACCESSKEY", SessionToken: "old-token"}, "us-east-1"),
+			sessionCacheKey(&datasourceInfo{AccessKey: "ASIAFAKEACCESSKEY", SessionToken: "new-token"}, "us-east-1"))
+	})
+}
+
+func TestNewSession_SharedCredentialsSourceProfile(t *testing.T) {
+	t.Cleanup(func() {
+		sessCache = map[string]envelope{}
+	})
+
+	var roleARN, authorization string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.NoError(t, r.ParseForm())
+		roleARN = r.Form.Get("RoleArn")
+		authorization = r.Header.Get("Authorization")
+		_, err := w.Write([]byte(`<AssumeRoleResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/">
+  <AssumeRoleResult>
+    <Credentials>
+      <AccessKeyId>CHAINEDKEY</AccessKeyId>
+      <SecretAccessKey>chainedsecret</SecretAccessKey>
+      <SessionToken>chainedtoken</SessionToken>
+      <Expiration>2100-01-01T00:00:00Z</Expiration>
+    </Credentials>
+  </AssumeRoleResult>
+</AssumeRoleResponse>`))
+		assert.NoError(t, err)
+	}))
+	t.Cleanup(server.Close)
+
+	dir := t.TempDir()
+	credentialsFile := filepath.Join(dir, "credentials")
+	require.NoError(t, ioutil.WriteFile(credentialsFile, []byte(`[source]
+aws_access_key_id = SOURCEKEY
+aws_secret_access_key = sourcesecret
+`), 0600))
+	configFile := filepath.Join(dir, "config")
+	require.NoError(t, ioutil.WriteFile(configFile, []byte(`[profile chained]
+role_arn = arn:aws:iam::123456789012:role/chained
+source_profile = source
+`), 0600))
+	setEnv(t, "AWS_SHARED_CREDENTIALS_FILE", credentialsFile)
+	setEnv(t, "AWS_CONFIG_FILE", configFile)
+	setEnv(t, "AWS_ACCESS_KEY_ID", "")
+	setEnv(t, "AWS_SECRET_ACCESS_KEY", "")
+	setEnv(t, "AWS_PROFILE", "")
+
+	e := newExecutor(nil)
+	e.DataSource = fakeDataSource()
+	e.DataSource.JsonData.Set("authType", "credentials")
+	e.DataSource.JsonData.Set("profile", "chained")
+	e.DataSource.JsonData.Set("endpoint", server.URL)
+
+	sess, err := e.newSession("us-east-1")
+	require.NoError(t, err)
+
+	creds, err := sess.Config.Credentials.Get()
+	require.NoError(t, err)
+	assert.Equal(t, "CHAINEDKEY", creds.AccessKeyID)
+	assert.Equal(t, "chainedtoken", creds.SessionToken)
+	// The role of the profile is assumed with the credentials of its source profile
+	assert.Equal(t, "arn:aws:iam::123456789012:role/chained", roleARN)
+	assert.Contains(t, authorization, "Credential=SOURCEKEY/")
+}
+
+func TestNewSession_Partition(t *testing.T) {
+	stubNewSession(t)
+
+	testCases := []struct {
+		name        string
+		region      string
+		partitionID string
+		stsEndpoint string
+	}{
+		{
+			name:        "China region",
+			region:      "cn-north-1",
+			partitionID: endpoints.AwsCnPartitionID,
+			stsEndpoint: "https://sts.cn-north-1.amazonaws.com.cn",
+		},
+		{
+			name:        "GovCloud region",
+			region:      "us-gov-west-1",
+			partitionID: endpoints.AwsUsGovPartitionID,
+			stsEndpoint: "https://sts.us-gov-west-1.amazonaws.com",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Cleanup(func() {
+				sessCache = map[string]envelope{}
+			})
+
+			e := newExecutor(nil)
+			e.DataSource = fakeDataSource()
+
+			sess, err := e.newSession(tc.region)
+			require.NoError(t, err)
+
+			partition, ok := sess.Config.EndpointResolver.(endpoints.Partition)
+			require.True(t, ok)
+			assert.Equal(t, tc.partitionID, partition.ID())
+			assert.Equal(t, endpoints.RegionalSTSEndpoint, sess.Config.STSRegionalEndpoint)
+
+			resolved, err := sess.Config.EndpointResolver.EndpointFor("sts", tc.region, func(o *endpoints.Options) {
+				o.STSRegionalEndpoint = sess.Config.STSRegionalEndpoint
+			})
+			require.NoError(t, err)
+			assert.Equal(t, tc.stsEndpoint, resolved.URL)
+		})
+	}
+
+	t.Run("Standard partition keeps the SDK defaults", func(t *testing.T) {
+		t.Cleanup(func() {
+			sessCache = map[string]envelope{}
+		})
+
+		e := newExecutor(nil)
+		e.DataSource = fakeDataSource()
+
+		sess, err := e.newSession("us-east-1")
+		require.NoError(t, err)
+		assert.Nil(t, sess.Config.EndpointResolver)
+	})
+}
+
+const testCACert = `-----BEGIN CERTIFICATE-----
+MIICAjCCAWugAwIBAgIUf6Cg24k1XCiiEpF5P8QMQLvs9VowDQYJKoZIhvcNAQEL
+BQAwEjEQMA4GA1UEAwwHVGVzdCBDQTAgFw0yNjEwMTYxMDI4NTdaGA8yMTI2MDky
+MjEwMjg1N1owEjEQMA4GA1UEAwwHVGVzdCBDQTCBnzANBgkqhkiG9w0BAQEFAAOB
+jQAwgYkCgYEA2Va3ubN4dwOxkStysXL1PcnUaWEj0l1NSQ4kq8GvAlDp1/EyAk1i
+3C0QqcsHAD4IfYruDJIB62t75hoc0LpBH6IxnMipFUZCCpN9UN0CaIZIjsvAgAXM
+Cs5w85ULiz4M1JoNYaTDhQzImI39/9jaWv6dYPwg0Mh8+uaCi5X+jX0CAwEAAaNT
+MFEwHQYDVR0OBBYEFA9L28t5Gh5OCM6Xb0eT4zTaFuYsMB8GA1UdIwQYMBaAFA9L
+28t5Gh5OCM6Xb0eT4zTaFuYsMA8GA1UdEwEB/wQFMAMBAf8wDQYJKoZIhvcNAQEL
+BQADgYEAcVG5cNSGrMvjbrZ0/CaAQCwyXra+y55RO+ho5GiRTRsPZhXN5zfjZYJm
+v1YAWfhk/3uFdCSbFHt6nf5lOY+I7TMqjLTBHUKJG6ueFXaHDU7DJOh/ZZMY+h/y
+aTS7/A3xaBGTuxpF2x0CICM0XgcCSQrBLuu5PJSudTrfLgsHHH4=
+-----END CERTIFICATE-----`
+
+func TestNewSession_TLS(t *testing.T) {
+	stubNewSession(t)
+
+	newTransport := func(t *testing.T, cfg fakeDataSourceCfg) *http.Transport {
+		t.Helper()
+		t.Cleanup(func() {
+			sessCache = map[string]envelope{}
+		})
+
+		e := newExecutor(nil)
+		e.DataSource = fakeDataSource(cfg)
+
+		sess, err := e.newSession("us-east-1")
+		require.NoError(t, err)
+		require.NotNil(t, sess.Config.HTTPClient)
+		transport, ok := sess.Config.HTTPClient.Transport.(*http.Transport)
+		require.True(t, ok)
+		require.NotNil(t, transport.TLSClientConfig)
+
+		return transport
+	}
+
+	t.Run("With skip verify", func(t *testing.T) {
+		transport := newTransport(t, fakeDataSourceCfg{
+			tlsSkipVerify: true,
+		})
+
+		assert.True(t, transport.TLSClientConfig.InsecureSkipVerify)
+		assert.Nil(t, transport.TLSClientConfig.RootCAs)
+	})
+
+	t.Run("With CA certificate", func(t *testing.T) {
+		transport := newTransport(t, fakeDataSourceCfg{
+			tlsCACert: testCACert,
+		})
+
+		assert.False(t, transport.TLSClientConfig.InsecureSkipVerify)
+		require.NotNil(t, transport.TLSClientConfig.RootCAs)
+		assert.Len(t, transport.TLSClientConfig.RootCAs.Subjects(), 1)
+	})
+
+	t.Run("With invalid CA certificate", func(t *testing.T) {
+		t.Cleanup(func() {
+			sessCache = map[string]envelope{}
+		})
+
+		e := newExecutor(nil)
+		e.DataSource = fakeDataSource(fakeDataSourceCfg{
+			tlsCACert: "not a certificate",
+		})
+
+		_, err := e.newSession("us-east-1")
+		require.EqualError(t, err, "failed to parse TLS CA PEM certificate")
+	})
+}
+
+func TestNewSession_RefreshAheadOfExpiry(t *testing.T) {
+	created := make(chan *session.Session, 1)
+	origNewSession := newSession
+	t.Cleanup(func() {
+		newSession = origNewSession
+		sessCache = map[string]envelope{}
+	})
+	newSession = func(cfgs ...*aws.Config) (*session.Session, error) {
+		cfg := aws.Config{}
+		cfg.MergeIn(cfgs...)
+		sess := &session.Session{
+			Config: &cfg,
+		}
+		created <- sess
+		return sess, nil
+	}
+
+	e := newExecutor(nil)
+	e.DataSource = fakeDataSource()
+	e.DataSource.JsonData.Set("sessionRefreshWindow", "5m")
+	cacheKey := sessionCacheKey(e.getDSInfo("us-east-1"), "us-east-1")
+
+	t.Run("Session near expiry is not refreshed unless the data source sets a refresh window", func(t *testing.T) {
+		withoutRefresh := newExecutor(nil)
+		withoutRefresh.DataSource = fakeDataSource()
+		require.Equal(t, cacheKey, sessionCacheKey(withoutRefresh.getDSInfo("us-east-1"), "us-east-1"))
+		cached := &session.Session{Config: &aws.Config{}}
+		sessCache[cacheKey] = envelope{
+			session:    cached,
+			expiration: time.Now().UTC().Add(time.Minute),
+		}
+
+		sess, err := withoutRefresh.newSession("us-east-1")
+		require.NoError(t, err)
+		assert.Same(t, cached, sess)
+
+		select {
+		case <-created:
+			t.Fatal("session should not have been refreshed")
+		case <-time.After(100 * time.Millisecond):
+		}
+	})
+
+	t.Run("Session far from expiry is not refreshed", func(t *testing.T) {
+		cached := &session.Session{Config: &aws.Config{}}
+		sessCache[cacheKey] = envelope{
+			session:    cached,
+			expiration: time.Now().UTC().Add(time.Hour),
+		}
+
+		sess, err := e.newSession("us-east-1")
+		require.NoError(t, err)
+		assert.Same(t, cached, sess)
+
+		select {
+		case <-created:
+			t.Fatal("session should not have been refreshed")
+		case <-time.After(100 * time.Millisecond):
+		}
+	})
+
+	t.Run("Session near expiry is refreshed in the background", func(t *testing.T) {
+		cached := &session.Session{Config: &aws.Config{}}
+		sessCache[cacheKey] = envelope{
+			session:    cached,
+			expiration: time.Now().UTC().Add(time.Minute),
+		}
+
+		sess, err := e.newSession("us-east-1")
+		require.NoError(t, err)
+		assert.Same(t, cached, sess, "the cached session should be returned without waiting for the refresh")
+
+		var refreshed *session.Session
+		select {
+		case refreshed = <-created:
+		case <-time.After(5 * time.Second):
+			t.Fatal("session was not refreshed")
+		}
+
+		assert.Eventually(t, func() bool {
+			sessCacheLock.RLock()
+			defer sessCacheLock.RUnlock()
+			return sessCache[cacheKey].session == refreshed
+		}, 5*time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("Refresh windows are durations, invalid ones turn refreshing off", func(t *testing.T) {
+		ds := fakeDataSource()
+		for _, window := range []string{"", "soon", "-5m"} {
+			ds.JsonData.Set("sessionRefreshWindow", window)
+			assert.Zero(t, jsonDataDuration(ds.JsonData, "sessionRefreshWindow"), window)
+		}
+		ds.JsonData.Set("sessionRefreshWindow", "10m")
+		assert.Equal(t, 10*time.Minute, jsonDataDuration(ds.JsonData, "sessionRefreshWindow"))
+	})
+}
+
+func TestNewSession_EvictedOnCredentialsErrors(t *testing.T) {
+	t.Cleanup(func() {
+		sessCache = map[string]envelope{}
+	})
+
+	var errorType string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+		w.WriteHeader(http.StatusBadRequest)
+		_, err := fmt.Fprintf(w, `{"__type": %q, "message": "rejected"}`, errorType)
+		require.NoError(t, err)
+	}))
+	t.Cleanup(server.Close)
+
+	ds := fakeDataSource(fakeDataSourceCfg{
+		accessKey: "AKIAFAKEACCESSKEY",
+		secretKey: "fake-secret-key",
+	})
+	ds.JsonData.Set("endpoint", server.URL)
+	e := newExecutor(nil)
+	e.DataSource = ds
+	cacheKey := sessionCacheKey(e.getDSInfo("us-east-1"), "us-east-1")
+
+	describeLogGroups := func(t *testing.T) error {
+		t.Helper()
+
+		logsClient, err := e.getCWLogsClient("us-east-1")
+		require.NoError(t, err)
+		require.Contains(t, sessCache, cacheKey)
+
+		_, err = logsClient.DescribeLogGroupsWithContext(context.Background(), &cloudwatchlogs.DescribeLogGroupsInput{})
+		return err
+	}
+
+	t.Run("Session is evicted on an auth error", func(t *testing.T) {
+		errorType = "ExpiredTokenException"
+
+		err := describeLogGroups(t)
+		var credsErr *credentialsError
+		require.True(t, errors.As(err, &credsErr), "unexpected error %v", err)
+		assert.NotContains(t, sessCache, cacheKey)
+	})
+
+	t.Run("Session is kept on other errors", func(t *testing.T) {
+		errorType = "ResourceNotFoundException"
+
+		err := describeLogGroups(t)
+		require.Error(t, err)
+		var credsErr *credentialsError
+		assert.False(t, errors.As(err, &credsErr))
+		assert.Contains(t, sessCache, cacheKey)
+	})
+}
+
+// setEnv sets an environment variable for the duration of a test, unsetting it if value is empty.
+func setEnv(t *testing.T, name string, value string) {
+	t.Helper()
+
+	orig, ok := os.LookupEnv(name)
+	t.Cleanup(func() {
+		if ok {
+			require.NoError(t, os.Setenv(name, orig))
+		} else {
+			require.NoError(t, os.Unsetenv(name))
+		}
+	})
+	if value == "" {
+		require.NoError(t, os.Unsetenv(name))
+	} else {
+		require.NoError(t, os.Setenv(name, value))
+	}
+}
+
+func TestResolveRegion(t *testing.T) {
+	origNewEC2Metadata := newEC2Metadata
+	t.Cleanup(func() {
+		newEC2Metadata = origNewEC2Metadata
+	})
+
+	metadataRegion := ""
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPut && r.URL.Path == "/latest/api/token":
+			w.Header().Set("X-Aws-Ec2-Metadata-Token-Ttl-Seconds", "21600")
+			_, _ = w.Write([]byte("token"))
+		case metadataRegion == "":
+			w.WriteHeader(http.StatusNotFound)
+		case r.URL.Path == "/latest/dynamic/instance-identity/document":
+			_, _ = fmt.Fprintf(w, `{"region": %q}`, metadataRegion)
+		case r.URL.Path == "/latest/meta-data/placement/region":
+			_, _ = w.Write([]byte(metadataRegion))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+	newEC2Metadata = func(p client.ConfigProvider, cfgs ...*aws.Config) *ec2metadata.EC2Metadata {
+		cfgs = append(cfgs, &aws.Config{
+			Endpoint:   aws.String(server.URL),
+			MaxRetries: aws.Int(0),
+		})
+		return origNewEC2Metadata(p, cfgs...)
+	}
+
+	newExecutorWithDefaultRegion := func(region string) *cloudWatchExecutor {
+		e := newExecutor(nil)
+		e.DataSource = fakeDataSource()
+		e.DataSource.JsonData.Set("defaultRegion", region)
+		return e
+	}
+
+	t.Run("Query region is used first", func(t *testing.T) {
+		setEnv(t, "AWS_REGION", "ap-south-1")
+
+		region, err := newExecutorWithDefaultRegion("eu-west-1").resolveRegion("us-west-2")
+		require.NoError(t, err)
+		assert.Equal(t, "us-west-2", region)
+	})
+
+	t.Run("Data source default region is used for the default region", func(t *testing.T) {
+		setEnv(t, "AWS_REGION", "ap-south-1")
+
+		region, err := newExecutorWithDefaultRegion("eu-west-1").resolveRegion(defaultRegion)
+		require.NoError(t, err)
+		assert.Equal(t, "eu-west-1", region)
+	})
+
+	t.Run("AWS_REGION is used without data source default region", func(t *testing.T) {
+		setEnv(t, "AWS_REGION", "ap-south-1")
+		setEnv(t, "AWS_DEFAULT_REGION", "ap-east-1")
+
+		region, err := newExecutorWithDefaultRegion("").resolveRegion(defaultRegion)
+		require.NoError(t, err)
+		assert.Equal(t, "ap-south-1", region)
+	})
+
+	t.Run("AWS_DEFAULT_REGION is used without AWS_REGION", func(t *testing.T) {
+		setEnv(t, "AWS_REGION", "")
+		setEnv(t, "AWS_DEFAULT_REGION", "ap-east-1")
+
+		region, err := newExecutorWithDefaultRegion(defaultRegion).resolveRegion("")
+		require.NoError(t, err)
+		assert.Equal(t, "ap-east-1", region)
+	})
+
+	t.Run("EC2 instance metadata region is used last", func(t *testing.T) {
+		setEnv(t, "AWS_REGION", "")
+		setEnv(t, "AWS_DEFAULT_REGION", "")
+		metadataRegion = "eu-north-1"
+		t.Cleanup(func() {
+			metadataRegion = ""
+			invalidateRegionCaches()
+		})
+
+		region, err := newExecutorWithDefaultRegion("").resolveRegion(defaultRegion)
+		require.NoError(t, err)
+		assert.Equal(t, "eu-north-1", region)
+	})
+
+	t.Run("EC2 instance metadata region is cached", func(t *testing.T) {
+		setEnv(t, "AWS_REGION", "")
+		setEnv(t, "AWS_DEFAULT_REGION", "")
+		metadataRegion = "eu-north-1"
+		t.Cleanup(func() {
+			metadataRegion = ""
+			invalidateRegionCaches()
+		})
+
+		_, err := newExecutorWithDefaultRegion("").resolveRegion(defaultRegion)
+		require.NoError(t, err)
+		metadataRegion = ""
+
+		region, err := newExecutorWithDefaultRegion("").resolveRegion(defaultRegion)
+		require.NoError(t, err)
+		assert.Equal(t, "eu-north-1", region)
+
+		invalidateRegionCaches()
+		_, err = newExecutorWithDefaultRegion("").resolveRegion(defaultRegion)
+		assert.True(t, errors.Is(err, errMissingRegion))
+	})
+
+	t.Run("Error if no region can be found", func(t *testing.T) {
+		setEnv(t, "AWS_REGION", "")
+		setEnv(t, "AWS_DEFAULT_REGION", "")
+
+		_, err := newExecutorWithDefaultRegion("").resolveRegion(defaultRegion)
+		assert.True(t, errors.Is(err, errMissingRegion))
+		assert.EqualError(t, err, "no AWS region is configured, set a default region in the data source settings "+
+			"or a region on the query")
+	})
+}
+
+func TestNewSession_SettingsChange(t *testing.T) {
+	stubNewSession(t)
+
+	e := newExecutor(nil)
+	e.DataSource = fakeDataSource()
+	e.DataSource.Version = 1
+
+	t.Run("Editing the settings changes the cache key", func(t *testing.T) {
+		before := sessionCacheKey(e.getDSInfo("us-east-1"), "us-east-1")
+		e.DataSource.Version = 2
+		t.Cleanup(func() {
+			e.DataSource.Version = 1
+		})
+
+		assert.NotEqual(t, before, sessionCacheKey(e.getDSInfo("us-east-1"), "us-east-1"))
+	})
+
+	t.Run("Sessions of the default region are created again once it's edited", func(t *testing.T) {
+		t.Cleanup(func() {
+			sessCache = map[string]envelope{}
+		})
+
+		sess, err := e.newSession(defaultRegion)
+		require.NoError(t, err)
+		assert.Equal(t, "us-east-1", aws.StringValue(sess.Config.Region))
+
+		e.DataSource.JsonData.Set("defaultRegion", "eu-west-1")
+		e.DataSource.Version = 2
+		edited, err := e.newSession(defaultRegion)
+		require.NoError(t, err)
+		assert.NotSame(t, sess, edited)
+		assert.Equal(t, "eu-west-1", aws.StringValue(edited.Config.Region))
+	})
 }
@@ -1,6 +1,7 @@
 package cloudwatch
 
 import (
+	"sort"
 	"time"
 
 	"github.com/grafana/grafana-plugin-sdk-go/data"
@@ -39,3 +40,48 @@ func (a ByTime) Less(i, j int) bool {
 
 	return (timeField.At(i).(*time.Time)).Before(*timeField.At(j).(*time.Time))
 }
+
+// Orders in which log results can be sorted by their @timestamp field.
+const (
+	sortOrderAscending  = "asc"
+	sortOrderDescending = "desc"
+)
+
+// byTimestamp implements sort.Interface for data.Frame based on the frame's @timestamp field
+type byTimestamp struct {
+	frame      *data.Frame
+	timeField  *data.Field
+	descending bool
+}
+
+func (a byTimestamp) Len() int {
+	return a.timeField.Len()
+}
+
+func (a byTimestamp) Swap(i, j int) {
+	ByTime(*a.frame).Swap(i, j)
+}
+
+func (a byTimestamp) Less(i, j int) bool {
+	ti, tj := a.timeField.At(i).(*time.Time), a.timeField.At(j).(*time.Time)
+	// Rows without a timestamp are always put last
+	if ti == nil || tj == nil {
+		return ti != nil
+	}
+	if a.descending {
+		return ti.After(*tj)
+	}
+
+	return ti.Before(*tj)
+}
+
+// sortByTimestamp sorts the rows of a log results frame by their @timestamp field. Rows with equal timestamps keep
+// their relative order. Frames without a @timestamp field are left untouched.
+func sortByTimestamp(frame *data.Frame, descending bool) {
+	for _, field := range frame.Fields {
+		if field.Name == "@timestamp" && field.Type() == data.FieldTypeNullableTime {
+			sort.Stable(byTimestamp{frame: frame, timeField: field, descending: descending})
+			return
+		}
+	}
+}
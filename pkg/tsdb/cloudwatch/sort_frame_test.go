@@ -55,3 +55,46 @@ func TestFrameSort(t *testing.T) {
 	assert.Equal(t, *numberField.At(1).(*float64), 50.0)
 	assert.Equal(t, *numberField.At(2).(*float64), 20.0)
 }
+
+func TestSortByTimestamp(t *testing.T) {
+	newFrame := func() *data.Frame {
+		timeA := time.Date(2020, 3, 2, 17, 4, 5, 0, time.UTC)
+		timeB := time.Date(2020, 3, 2, 15, 4, 5, 0, time.UTC)
+		return data.NewFrame("CloudWatchLogsResponse",
+			data.NewField("@timestamp", nil, []*time.Time{&timeA, nil, &timeB, &timeA}),
+			data.NewField("line", nil, []*string{
+				aws.String("a"),
+				aws.String("b"),
+				aws.String("c"),
+				aws.String("d"),
+			}),
+		)
+	}
+	lines := func(frame *data.Frame) []string {
+		var result []string
+		for i := 0; i < frame.Fields[1].Len(); i++ {
+			result = append(result, *frame.Fields[1].At(i).(*string))
+		}
+		return result
+	}
+
+	t.Run("Ascending", func(t *testing.T) {
+		frame := newFrame()
+		sortByTimestamp(frame, false)
+		assert.Equal(t, []string{"c", "a", "d", "b"}, lines(frame))
+	})
+
+	t.Run("Descending", func(t *testing.T) {
+		frame := newFrame()
+		sortByTimestamp(frame, true)
+		assert.Equal(t, []string{"a", "d", "c", "b"}, lines(frame))
+	})
+
+	t.Run("Frame without @timestamp field is left untouched", func(t *testing.T) {
+		frame := data.NewFrame("CloudWatchLogsResponse",
+			data.NewField("line", nil, []*string{aws.String("b"), aws.String("a")}),
+		)
+		sortByTimestamp(frame, false)
+		assert.Equal(t, "b", *frame.Fields[0].At(0).(*string))
+	})
+}
@@ -0,0 +1,64 @@
+package cloudwatch
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/grafana/grafana/pkg/components/simplejson"
+	"github.com/grafana/grafana/pkg/tsdb"
+)
+
+// fallbackStatistic is the statistic of queries without one, unless the data source sets another.
+const fallbackStatistic = "Average"
+
+// standardStatistics are supported by every metric.
+var standardStatistics = []string{"Average", "Maximum", "Minimum", "Sum", "SampleCount"}
+
+// commonExtendedStatistics are the extended statistics suggested for any metric.
+var commonExtendedStatistics = []string{"p50", "p90", "p95", "p99"}
+
+// namespaceExtendedStatistics are additional extended statistics suggested for namespaces with latency metrics,
+// where the tail of the distribution matters and trimmed means filter out the outliers.
+var namespaceExtendedStatistics = map[string][]string{
+	"AWS/ApiGateway":     {"p99.9", "tm90", "tm99"},
+	"AWS/AppSync":        {"p99.9", "tm90", "tm99"},
+	"AWS/ApplicationELB": {"p99.9", "tm90", "tm99"},
+	"AWS/ELB":            {"p99.9", "tm90", "tm99"},
+	"AWS/Lambda":         {"p99.9", "tm90", "tm99"},
+}
+
+// handleGetStatistics returns the statistics suggested for the metrics of a namespace, standard statistics first.
+func (e *cloudWatchExecutor) handleGetStatistics(ctx context.Context, parameters *simplejson.Json,
+	queryContext *tsdb.TsdbQuery) ([]suggestData, error) {
+	namespace := parameters.Get("namespace").MustString()
+
+	statistics := make([]string, 0, len(standardStatistics)+len(commonExtendedStatistics))
+	statistics = append(statistics, standardStatistics...)
+	statistics = append(statistics, commonExtendedStatistics...)
+	statistics = append(statistics, namespaceExtendedStatistics[namespace]...)
+
+	result := make([]suggestData, 0, len(statistics))
+	for _, statistic := range statistics {
+		result = append(result, suggestData{Text: statistic, Value: statistic})
+	}
+
+	return result, nil
+}
+
+// defaultStatistic returns the statistic of queries without one, as set by the defaultStatistic setting of the data
+// source. The setting is validated like the statistics of queries, so that a typo, e.g. in a provisioned data
+// source, fails with a clear error rather than being sent to CloudWatch.
+func (e *cloudWatchExecutor) defaultStatistic() (string, error) {
+	if e.DataSource != nil {
+		if statistic := strings.TrimSpace(jsonDataString(e.DataSource.JsonData, "defaultStatistic")); statistic != "" {
+			statistic, err := validateStatistic(statistic)
+			if err != nil {
+				return "", fmt.Errorf("invalid default statistic of the data source: %w", err)
+			}
+			return statistic, nil
+		}
+	}
+
+	return fallbackStatistic, nil
+}
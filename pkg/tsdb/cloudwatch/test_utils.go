@@ -2,6 +2,12 @@ package cloudwatch
 
 import (
 	"context"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/request"
@@ -11,35 +17,89 @@ import (
 	"github.com/aws/aws-sdk-go/service/cloudwatchlogs/cloudwatchlogsiface"
 	"github.com/aws/aws-sdk-go/service/ec2"
 	"github.com/aws/aws-sdk-go/service/ec2/ec2iface"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/aws/aws-sdk-go/service/ecs/ecsiface"
 	"github.com/aws/aws-sdk-go/service/resourcegroupstaggingapi"
 	"github.com/aws/aws-sdk-go/service/resourcegroupstaggingapi/resourcegroupstaggingapiiface"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/aws/aws-sdk-go/service/sts/stsiface"
 	"github.com/grafana/grafana/pkg/components/securejsondata"
 	"github.com/grafana/grafana/pkg/components/simplejson"
 	"github.com/grafana/grafana/pkg/models"
 )
 
 type fakeDataSourceCfg struct {
-	assumeRoleARN string
-	externalID    string
+	accessKey          string
+	secretKey          string
+	sessionToken       string
+	assumeRoleARN      string
+	externalID         string
+	roleSessionName    string
+	assumeRoleDuration string
+	mfaSerialNumber    string
+	mfaToken           string
+	proxyURL           string
+	noProxy            string
+	tlsSkipVerify      bool
+	tlsCACert          string
 }
 
 func fakeDataSource(cfgs ...fakeDataSourceCfg) *models.DataSource {
 	jsonData := simplejson.New()
-	jsonData.Set("defaultRegion", defaultRegion)
+	jsonData.Set("defaultRegion", "us-east-1")
 	jsonData.Set("authType", "default")
+	secureJSONData := map[string]string{}
 	for _, cfg := range cfgs {
+		if cfg.accessKey != "" || cfg.secretKey != "" {
+			jsonData.Set("authType", "keys")
+			secureJSONData["accessKey"] = cfg.accessKey
+			secureJSONData["secretKey"] = cfg.secretKey
+		}
+		if cfg.sessionToken != "" {
+			secureJSONData["sessionToken"] = cfg.sessionToken
+		}
 		if cfg.assumeRoleARN != "" {
 			jsonData.Set("assumeRoleArn", cfg.assumeRoleARN)
 		}
 		if cfg.externalID != "" {
 			jsonData.Set("externalId", cfg.externalID)
 		}
+		if cfg.roleSessionName != "" {
+			jsonData.Set("roleSessionName", cfg.roleSessionName)
+		}
+		if cfg.assumeRoleDuration != "" {
+			jsonData.Set("assumeRoleDuration", cfg.assumeRoleDuration)
+		}
+		if cfg.mfaSerialNumber != "" {
+			jsonData.Set("mfaSerialNumber", cfg.mfaSerialNumber)
+		}
+		if cfg.mfaToken != "" {
+			secureJSONData["mfaToken"] = cfg.mfaToken
+		}
+		if cfg.proxyURL != "" {
+			jsonData.Set("proxyUrl", cfg.proxyURL)
+		}
+		if cfg.noProxy != "" {
+			jsonData.Set("noProxy", cfg.noProxy)
+		}
+		if cfg.tlsSkipVerify {
+			jsonData.Set("tlsSkipVerify", true)
+		}
+		if cfg.tlsCACert != "" {
+			secureJSONData["tlsCACert"] = cfg.tlsCACert
+		}
 	}
+
+	// All fake data sources share the same ID, so make sure no stale decrypted values are used
+	models.ClearDSDecryptionCache()
+
 	return &models.DataSource{
 		Id:             1,
 		Database:       "default",
 		JsonData:       jsonData,
-		SecureJsonData: securejsondata.SecureJsonData{},
+		SecureJsonData: securejsondata.GetEncryptedJsonData(secureJSONData),
 	}
 }
 
@@ -48,25 +108,111 @@ type FakeCWLogsClient struct {
 	logGroups      cloudwatchlogs.DescribeLogGroupsOutput
 	logGroupFields cloudwatchlogs.GetLogGroupFieldsOutput
 	queryResults   cloudwatchlogs.GetQueryResultsOutput
+	// queryResultsPolls, if set, are returned by successive GetQueryResults calls instead of queryResults, the
+	// last one repeatedly, which requires calls to be set
+	queryResultsPolls []cloudwatchlogs.GetQueryResultsOutput
+	// startQueryErrors are returned by the first StartQuery calls, which requires calls to be set
+	startQueryErrors []error
+	// stopQueryError, if set, is returned by StopQuery
+	stopQueryError error
+	// logRecord is returned by GetLogRecord
+	logRecord map[string]*string
+	// logGroupClasses are the classes of logGroups by name, returned in the hand-rolled DescribeLogGroups output
+	logGroupClasses map[string]string
+
+	calls *logsCalls
+}
+
+// logsCalls records the inputs FakeCWLogsClient was called with.
+type logsCalls struct {
+	startQuery []*cloudwatchlogs.StartQueryInput
+	// startQueryParams are the hand-rolled inputs StartQuery was made to send instead, see withShapes
+	startQueryParams  []*startQueryInput
+	stopQuery         []*cloudwatchlogs.StopQueryInput
+	describeLogGroups []*cloudwatchlogs.DescribeLogGroupsInput
+	getQueryResults   []*cloudwatchlogs.GetQueryResultsInput
+	getLogRecord      []*cloudwatchlogs.GetLogRecordInput
+	// describeLogGroupsParams are the hand-rolled inputs DescribeLogGroups was made to send instead, see withShapes
+	describeLogGroupsParams []*describeLogGroupsInput
+}
+
+func (m FakeCWLogsClient) GetLogRecordWithContext(ctx context.Context, input *cloudwatchlogs.GetLogRecordInput, option ...request.Option) (*cloudwatchlogs.GetLogRecordOutput, error) {
+	if m.calls != nil {
+		m.calls.getLogRecord = append(m.calls.getLogRecord, input)
+	}
+
+	return &cloudwatchlogs.GetLogRecordOutput{LogRecord: m.logRecord}, nil
 }
 
 func (m FakeCWLogsClient) GetQueryResultsWithContext(ctx context.Context, input *cloudwatchlogs.GetQueryResultsInput, option ...request.Option) (*cloudwatchlogs.GetQueryResultsOutput, error) {
+	if m.calls != nil {
+		m.calls.getQueryResults = append(m.calls.getQueryResults, input)
+		if len(m.queryResultsPolls) > 0 {
+			poll := len(m.calls.getQueryResults) - 1
+			if poll >= len(m.queryResultsPolls) {
+				poll = len(m.queryResultsPolls) - 1
+			}
+			return &m.queryResultsPolls[poll], nil
+		}
+	}
+
 	return &m.queryResults, nil
 }
 
 func (m FakeCWLogsClient) StartQueryWithContext(ctx context.Context, input *cloudwatchlogs.StartQueryInput, option ...request.Option) (*cloudwatchlogs.StartQueryOutput, error) {
+	if m.calls != nil {
+		m.calls.startQuery = append(m.calls.startQuery, input)
+		r := &request.Request{Params: input}
+		r.ApplyOptions(option...)
+		if params, ok := r.Params.(*startQueryInput); ok {
+			m.calls.startQueryParams = append(m.calls.startQueryParams, params)
+		}
+		if attempt := len(m.calls.startQuery); attempt <= len(m.startQueryErrors) {
+			return nil, m.startQueryErrors[attempt-1]
+		}
+	}
+
 	return &cloudwatchlogs.StartQueryOutput{
 		QueryId: aws.String("abcd-efgh-ijkl-mnop"),
 	}, nil
 }
 
 func (m FakeCWLogsClient) StopQueryWithContext(ctx context.Context, input *cloudwatchlogs.StopQueryInput, option ...request.Option) (*cloudwatchlogs.StopQueryOutput, error) {
+	if m.calls != nil {
+		m.calls.stopQuery = append(m.calls.stopQuery, input)
+	}
+	if m.stopQueryError != nil {
+		return nil, m.stopQueryError
+	}
+
 	return &cloudwatchlogs.StopQueryOutput{
 		Success: aws.Bool(true),
 	}, nil
 }
 
 func (m FakeCWLogsClient) DescribeLogGroupsWithContext(ctx context.Context, input *cloudwatchlogs.DescribeLogGroupsInput, option ...request.Option) (*cloudwatchlogs.DescribeLogGroupsOutput, error) {
+	if m.calls != nil {
+		m.calls.describeLogGroups = append(m.calls.describeLogGroups, input)
+	}
+	r := &request.Request{Params: input}
+	r.ApplyOptions(option...)
+	if params, ok := r.Params.(*describeLogGroupsInput); ok && m.calls != nil {
+		m.calls.describeLogGroupsParams = append(m.calls.describeLogGroupsParams, params)
+	}
+	if output, ok := r.Data.(*describeLogGroupsOutput); ok {
+		for _, group := range m.logGroups.LogGroups {
+			described := &logGroup{
+				Arn:          group.Arn,
+				LogGroupName: group.LogGroupName,
+			}
+			if class, ok := m.logGroupClasses[aws.StringValue(group.LogGroupName)]; ok {
+				described.LogGroupClass = aws.String(class)
+			}
+			output.LogGroups = append(output.LogGroups, described)
+		}
+		output.NextToken = m.logGroups.NextToken
+	}
+
 	return &m.logGroups, nil
 }
 
@@ -77,21 +223,163 @@ func (m FakeCWLogsClient) GetLogGroupFieldsWithContext(ctx context.Context, inpu
 type FakeCWClient struct {
 	cloudwatchiface.CloudWatchAPI
 
-	Metrics []*cloudwatch.Metric
+	Metrics          []*cloudwatch.Metric
+	MetricDataOutput cloudwatch.GetMetricDataOutput
+	// MetricPages, if set, is returned by ListMetricsPages page by page instead of Metrics
+	MetricPages [][]*cloudwatch.Metric
+	// FilterMetrics makes ListMetricsPages only return the Metrics matching the dimension filters of the input
+	FilterMetrics          bool
+	MetricStatisticsOutput cloudwatch.GetMetricStatisticsOutput
+	// AlarmPages is returned by DescribeAlarmsPagesWithContext page by page
+	AlarmPages [][]*cloudwatch.MetricAlarm
+	// CompositeAlarmPages is returned instead of AlarmPages when composite alarms are described
+	CompositeAlarmPages [][]*cloudwatch.CompositeAlarm
+	// AlarmHistoryPages is returned by DescribeAlarmHistoryPagesWithContext page by page, by alarm name
+	AlarmHistoryPages map[string][][]*cloudwatch.AlarmHistoryItem
+	// ListMetricsErr is returned by ListMetricsWithContext
+	ListMetricsErr error
+
+	calls *cloudWatchCalls
+}
+
+// cloudWatchCalls records the inputs FakeCWClient was called with.
+type cloudWatchCalls struct {
+	getMetricData        []*cloudwatch.GetMetricDataInput
+	getMetricStatistics  []*cloudwatch.GetMetricStatisticsInput
+	listMetrics          []*cloudwatch.ListMetricsInput
+	describeAlarms       []*cloudwatch.DescribeAlarmsInput
+	describeAlarmHistory []*cloudwatch.DescribeAlarmHistoryInput
+}
+
+func (c FakeCWClient) GetMetricDataWithContext(ctx context.Context, input *cloudwatch.GetMetricDataInput, opts ...request.Option) (*cloudwatch.GetMetricDataOutput, error) {
+	if c.calls != nil {
+		c.calls.getMetricData = append(c.calls.getMetricData, input)
+	}
+
+	return &c.MetricDataOutput, nil
+}
+
+func (c FakeCWClient) GetMetricStatisticsWithContext(ctx context.Context, input *cloudwatch.GetMetricStatisticsInput, opts ...request.Option) (*cloudwatch.GetMetricStatisticsOutput, error) {
+	if c.calls != nil {
+		c.calls.getMetricStatistics = append(c.calls.getMetricStatistics, input)
+	}
+
+	return &c.MetricStatisticsOutput, nil
 }
 
 func (c FakeCWClient) ListMetricsPages(input *cloudwatch.ListMetricsInput, fn func(*cloudwatch.ListMetricsOutput, bool) bool) error {
+	if c.calls != nil {
+		c.calls.listMetrics = append(c.calls.listMetrics, input)
+	}
+
+	if c.MetricPages != nil {
+		for i, page := range c.MetricPages {
+			lastPage := i == len(c.MetricPages)-1
+			if !fn(&cloudwatch.ListMetricsOutput{Metrics: page}, lastPage) {
+				break
+			}
+		}
+		return nil
+	}
+
+	metrics := c.Metrics
+	if c.FilterMetrics {
+		metrics = nil
+		for _, metric := range c.Metrics {
+			if metricMatchesFilters(metric, input.Dimensions) {
+				metrics = append(metrics, metric)
+			}
+		}
+	}
+
 	fn(&cloudwatch.ListMetricsOutput{
-		Metrics: c.Metrics,
+		Metrics: metrics,
 	}, true)
 	return nil
 }
 
+func (c FakeCWClient) ListMetricsWithContext(ctx context.Context, input *cloudwatch.ListMetricsInput, opts ...request.Option) (*cloudwatch.ListMetricsOutput, error) {
+	if c.calls != nil {
+		c.calls.listMetrics = append(c.calls.listMetrics, input)
+	}
+	if c.ListMetricsErr != nil {
+		return nil, c.ListMetricsErr
+	}
+
+	return &cloudwatch.ListMetricsOutput{Metrics: c.Metrics}, nil
+}
+
+func (c FakeCWClient) DescribeAlarmsPagesWithContext(ctx context.Context, input *cloudwatch.DescribeAlarmsInput,
+	fn func(*cloudwatch.DescribeAlarmsOutput, bool) bool, opts ...request.Option) error {
+	if c.calls != nil {
+		c.calls.describeAlarms = append(c.calls.describeAlarms, input)
+	}
+
+	for _, alarmType := range input.AlarmTypes {
+		if *alarmType == cloudwatch.AlarmTypeCompositeAlarm {
+			for i, page := range c.CompositeAlarmPages {
+				if !fn(&cloudwatch.DescribeAlarmsOutput{CompositeAlarms: page}, i == len(c.CompositeAlarmPages)-1) {
+					break
+				}
+			}
+			return nil
+		}
+	}
+
+	for i, page := range c.AlarmPages {
+		if !fn(&cloudwatch.DescribeAlarmsOutput{MetricAlarms: page}, i == len(c.AlarmPages)-1) {
+			break
+		}
+	}
+	return nil
+}
+
+func (c FakeCWClient) DescribeAlarmHistoryPagesWithContext(ctx context.Context,
+	input *cloudwatch.DescribeAlarmHistoryInput, fn func(*cloudwatch.DescribeAlarmHistoryOutput, bool) bool,
+	opts ...request.Option) error {
+	if c.calls != nil {
+		c.calls.describeAlarmHistory = append(c.calls.describeAlarmHistory, input)
+	}
+
+	pages := c.AlarmHistoryPages[aws.StringValue(input.AlarmName)]
+	for i, page := range pages {
+		if !fn(&cloudwatch.DescribeAlarmHistoryOutput{AlarmHistoryItems: page}, i == len(pages)-1) {
+			break
+		}
+	}
+	return nil
+}
+
+func metricMatchesFilters(metric *cloudwatch.Metric, filters []*cloudwatch.DimensionFilter) bool {
+	for _, filter := range filters {
+		matches := false
+		for _, dim := range metric.Dimensions {
+			if *dim.Name == *filter.Name && (filter.Value == nil || *dim.Value == *filter.Value) {
+				matches = true
+				break
+			}
+		}
+		if !matches {
+			return false
+		}
+	}
+	return true
+}
+
 type fakeEC2Client struct {
 	ec2iface.EC2API
 
 	regions      []string
 	reservations []*ec2.Reservation
+	// instanceTypes is returned by DescribeInstanceTypesPagesWithContext, one page per element
+	instanceTypes [][]string
+	// volumes is returned by DescribeVolumesPagesWithContext, one page per element, leaving out the volumes
+	// not matching the tag filters of the input
+	volumes [][]*ec2.Volume
+	// tags is returned by DescribeTagsPagesWithContext, leaving out the tags of other resources than the input's
+	tags []*ec2.TagDescription
+	// describeTagsInputs, if set, records the inputs DescribeTagsPagesWithContext was called with
+	describeTagsInputs *[]*ec2.DescribeTagsInput
 }
 
 func (c fakeEC2Client) DescribeRegions(*ec2.DescribeRegionsInput) (*ec2.DescribeRegionsOutput, error) {
@@ -132,16 +420,315 @@ func (c fakeEC2Client) DescribeInstancesPages(in *ec2.DescribeInstancesInput,
 	return nil
 }
 
+func (c fakeEC2Client) DescribeInstanceTypesPagesWithContext(ctx context.Context, in *ec2.DescribeInstanceTypesInput,
+	fn func(*ec2.DescribeInstanceTypesOutput, bool) bool, opts ...request.Option) error {
+	for i, page := range c.instanceTypes {
+		output := &ec2.DescribeInstanceTypesOutput{}
+		for _, instanceType := range page {
+			output.InstanceTypes = append(output.InstanceTypes, &ec2.InstanceTypeInfo{
+				InstanceType: aws.String(instanceType),
+			})
+		}
+		if !fn(output, i == len(c.instanceTypes)-1) {
+			break
+		}
+	}
+	return nil
+}
+
+func (c fakeEC2Client) DescribeVolumesPagesWithContext(ctx context.Context, in *ec2.DescribeVolumesInput,
+	fn func(*ec2.DescribeVolumesOutput, bool) bool, opts ...request.Option) error {
+	for i, page := range c.volumes {
+		output := &ec2.DescribeVolumesOutput{}
+		for _, volume := range page {
+			if volumeMatchesTagFilters(volume, in.Filters) {
+				output.Volumes = append(output.Volumes, volume)
+			}
+		}
+		if !fn(output, i == len(c.volumes)-1) {
+			break
+		}
+	}
+	return nil
+}
+
+func (c fakeEC2Client) DescribeTagsPagesWithContext(ctx context.Context, in *ec2.DescribeTagsInput,
+	fn func(*ec2.DescribeTagsOutput, bool) bool, opts ...request.Option) error {
+	if c.describeTagsInputs != nil {
+		*c.describeTagsInputs = append(*c.describeTagsInputs, in)
+	}
+
+	resourceIds := map[string]bool{}
+	for _, filter := range in.Filters {
+		if *filter.Name == "resource-id" {
+			for _, id := range filter.Values {
+				resourceIds[*id] = true
+			}
+		}
+	}
+
+	output := &ec2.DescribeTagsOutput{}
+	for _, tag := range c.tags {
+		if resourceIds[*tag.ResourceId] {
+			output.Tags = append(output.Tags, tag)
+		}
+	}
+	fn(output, true)
+	return nil
+}
+
+func volumeMatchesTagFilters(volume *ec2.Volume, filters []*ec2.Filter) bool {
+	for _, filter := range filters {
+		key := strings.TrimPrefix(*filter.Name, "tag:")
+		matches := false
+		for _, tag := range volume.Tags {
+			if *tag.Key != key {
+				continue
+			}
+			for _, value := range filter.Values {
+				if *tag.Value == *value {
+					matches = true
+				}
+			}
+		}
+		if !matches {
+			return false
+		}
+	}
+	return true
+}
+
 type fakeRGTAClient struct {
 	resourcegroupstaggingapiiface.ResourceGroupsTaggingAPIAPI
 
 	tagMapping []*resourcegroupstaggingapi.ResourceTagMapping
+	// pages, when set, is returned one page per call instead of tagMapping
+	pages [][]*resourcegroupstaggingapi.ResourceTagMapping
+
+	calls *rgtaCalls
 }
 
-func (c fakeRGTAClient) GetResourcesPages(in *resourcegroupstaggingapi.GetResourcesInput,
-	fn func(*resourcegroupstaggingapi.GetResourcesOutput, bool) bool) error {
-	fn(&resourcegroupstaggingapi.GetResourcesOutput{
-		ResourceTagMappingList: c.tagMapping,
-	}, true)
+// rgtaCalls records the inputs fakeRGTAClient was called with.
+type rgtaCalls struct {
+	getResources []*resourcegroupstaggingapi.GetResourcesInput
+}
+
+func (c fakeRGTAClient) GetResourcesWithContext(ctx context.Context, in *resourcegroupstaggingapi.GetResourcesInput,
+	opts ...request.Option) (*resourcegroupstaggingapi.GetResourcesOutput, error) {
+	if c.calls != nil {
+		input := *in
+		c.calls.getResources = append(c.calls.getResources, &input)
+	}
+
+	if c.pages == nil {
+		return &resourcegroupstaggingapi.GetResourcesOutput{
+			ResourceTagMappingList: c.tagMapping,
+		}, nil
+	}
+
+	page := 0
+	if in.PaginationToken != nil {
+		var err error
+		if page, err = strconv.Atoi(*in.PaginationToken); err != nil {
+			return nil, err
+		}
+	}
+	out := &resourcegroupstaggingapi.GetResourcesOutput{
+		ResourceTagMappingList: c.pages[page],
+	}
+	if page+1 < len(c.pages) {
+		out.PaginationToken = aws.String(strconv.Itoa(page + 1))
+	}
+
+	return out, nil
+}
+
+type fakeSTSClient struct {
+	stsiface.STSAPI
+
+	identity sts.GetCallerIdentityOutput
+}
+
+func (c fakeSTSClient) GetCallerIdentityWithContext(ctx context.Context, input *sts.GetCallerIdentityInput,
+	opts ...request.Option) (*sts.GetCallerIdentityOutput, error) {
+	return &c.identity, nil
+}
+
+type fakeMetricStreamsClient struct {
+	// pages is returned one page per call
+	pages [][]*metricStreamEntry
+
+	calls *[]*listMetricStreamsInput
+}
+
+func (c fakeMetricStreamsClient) ListMetricStreamsWithContext(ctx context.Context, in *listMetricStreamsInput,
+	opts ...request.Option) (*listMetricStreamsOutput, error) {
+	if c.calls != nil {
+		input := *in
+		*c.calls = append(*c.calls, &input)
+	}
+
+	page := 0
+	if in.NextToken != nil {
+		var err error
+		if page, err = strconv.Atoi(*in.NextToken); err != nil {
+			return nil, err
+		}
+	}
+	out := &listMetricStreamsOutput{
+		Entries: c.pages[page],
+	}
+	if page+1 < len(c.pages) {
+		out.NextToken = aws.String(strconv.Itoa(page + 1))
+	}
+
+	return out, nil
+}
+
+type fakeLiveTailClient struct {
+	stream *fakeLiveTailStream
+
+	calls *[]*startLiveTailInput
+}
+
+func (c fakeLiveTailClient) StartLiveTailWithContext(ctx context.Context, in *startLiveTailInput,
+	opts ...request.Option) (liveTailStream, error) {
+	if c.calls != nil {
+		*c.calls = append(*c.calls, in)
+	}
+
+	return c.stream, nil
+}
+
+// fakeLiveTailStream returns the updates sent on its channel, until it's closed.
+type fakeLiveTailStream struct {
+	updates   chan *liveTailSessionUpdate
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func newFakeLiveTailStream() *fakeLiveTailStream {
+	return &fakeLiveTailStream{
+		updates: make(chan *liveTailSessionUpdate),
+		closed:  make(chan struct{}),
+	}
+}
+
+func (s *fakeLiveTailStream) Recv() (*liveTailSessionUpdate, error) {
+	select {
+	case update := <-s.updates:
+		return update, nil
+	case <-s.closed:
+		return nil, errors.New("read on closed response body")
+	}
+}
+
+func (s *fakeLiveTailStream) Close() error {
+	s.closeOnce.Do(func() {
+		close(s.closed)
+	})
 	return nil
 }
+
+type fakeECSClient struct {
+	ecsiface.ECSAPI
+
+	// clusterPages is returned by ListClustersPagesWithContext, one page per element
+	clusterPages [][]string
+	// servicePages is returned by ListServicesPagesWithContext for the cluster of the input, one page per element
+	servicePages map[string][][]string
+}
+
+func (c fakeECSClient) ListClustersPagesWithContext(ctx context.Context, in *ecs.ListClustersInput,
+	fn func(*ecs.ListClustersOutput, bool) bool, opts ...request.Option) error {
+	for i, page := range c.clusterPages {
+		if !fn(&ecs.ListClustersOutput{ClusterArns: aws.StringSlice(page)}, i == len(c.clusterPages)-1) {
+			break
+		}
+	}
+
+	return nil
+}
+
+func (c fakeECSClient) ListServicesPagesWithContext(ctx context.Context, in *ecs.ListServicesInput,
+	fn func(*ecs.ListServicesOutput, bool) bool, opts ...request.Option) error {
+	pages := c.servicePages[aws.StringValue(in.Cluster)]
+	for i, page := range pages {
+		if !fn(&ecs.ListServicesOutput{ServiceArns: aws.StringSlice(page)}, i == len(pages)-1) {
+			break
+		}
+	}
+
+	return nil
+}
+
+type fakeS3Client struct {
+	s3iface.S3API
+
+	// buckets are returned by ListBucketsWithContext, by name, with their location constraint
+	buckets map[string]string
+	// locationErrors are returned by GetBucketLocationWithContext, by bucket name
+	locationErrors map[string]error
+	// locationRequests counts the GetBucketLocationWithContext calls in flight, if set
+	locationRequests *inFlightRequests
+}
+
+// inFlightRequests counts the requests in flight, and the most of them there have been at once.
+type inFlightRequests struct {
+	mu      sync.Mutex
+	current int
+	max     int
+}
+
+func (r *inFlightRequests) start() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.current++
+	if r.current > r.max {
+		r.max = r.current
+	}
+}
+
+func (r *inFlightRequests) done() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.current--
+}
+
+// ListBucketsWithContext returns the buckets sorted by name, like S3 does.
+func (c fakeS3Client) ListBucketsWithContext(ctx context.Context, in *s3.ListBucketsInput,
+	opts ...request.Option) (*s3.ListBucketsOutput, error) {
+	names := make([]string, 0, len(c.buckets))
+	for name := range c.buckets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	output := &s3.ListBucketsOutput{}
+	for _, name := range names {
+		output.Buckets = append(output.Buckets, &s3.Bucket{Name: aws.String(name)})
+	}
+
+	return output, nil
+}
+
+func (c fakeS3Client) GetBucketLocationWithContext(ctx context.Context, in *s3.GetBucketLocationInput,
+	opts ...request.Option) (*s3.GetBucketLocationOutput, error) {
+	if c.locationRequests != nil {
+		c.locationRequests.start()
+		defer c.locationRequests.done()
+		// Requests take a while, so that concurrent ones overlap
+		time.Sleep(time.Millisecond)
+	}
+
+	name := aws.StringValue(in.Bucket)
+	if err := c.locationErrors[name]; err != nil {
+		return nil, err
+	}
+
+	output := &s3.GetBucketLocationOutput{}
+	if location := c.buckets[name]; location != "" {
+		output.LocationConstraint = aws.String(location)
+	}
+	return output, nil
+}
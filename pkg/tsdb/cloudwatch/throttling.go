@@ -0,0 +1,57 @@
+package cloudwatch
+
+import (
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/grafana/grafana/pkg/infra/metrics"
+)
+
+// addThrottlingHandlers makes requests sent with sess count how often AWS throttles them, and how often they are
+// retried, for the data source named dsName. Cached sessions are keyed on the data source and version of its
+// settings, so a session is only ever used by the data source it's counted for, even if another one has the same
+// settings, and renaming the data source creates a session counted under the new name.
+func addThrottlingHandlers(sess *session.Session, dsName string) {
+	sess.Handlers.Retry.PushBackNamed(throttledRequestHandler(dsName))
+	sess.Handlers.Complete.PushBackNamed(retriesHandler(dsName))
+}
+
+// throttledRequestHandler counts the attempts of a request that are throttled. Retry handlers run after every failed
+// attempt, before the SDK decides whether to retry it.
+func throttledRequestHandler(dsName string) request.NamedHandler {
+	return request.NamedHandler{
+		Name: "grafana.ThrottledRequestHandler",
+		Fn: func(r *request.Request) {
+			if !request.IsErrorThrottle(r.Error) {
+				return
+			}
+
+			metrics.MAwsCloudWatchThrottledRequests.WithLabelValues(dsName).Inc()
+			plog.Debug("AWS throttled a request", "datasource", dsName, "operation", operationName(r),
+				"retryCount", r.RetryCount)
+		},
+	}
+}
+
+// retriesHandler counts the retries of a request once it completes, and warns when it's still throttled after them.
+func retriesHandler(dsName string) request.NamedHandler {
+	return request.NamedHandler{
+		Name: "grafana.RetriesHandler",
+		Fn: func(r *request.Request) {
+			if r.RetryCount > 0 {
+				metrics.MAwsCloudWatchRetries.WithLabelValues(dsName).Add(float64(r.RetryCount))
+			}
+			if request.IsErrorThrottle(r.Error) {
+				plog.Warn("AWS throttled a request after all its retries", "datasource", dsName,
+					"operation", operationName(r), "retryCount", r.RetryCount)
+			}
+		},
+	}
+}
+
+func operationName(r *request.Request) string {
+	if r.Operation == nil {
+		return ""
+	}
+
+	return r.Operation.Name
+}
@@ -0,0 +1,100 @@
+package cloudwatch
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/grafana/grafana/pkg/infra/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestThrottlingHandlers(t *testing.T) {
+	t.Run("Throttled attempts are counted", func(t *testing.T) {
+		const dsName = "throttled"
+		handler := throttledRequestHandler(dsName)
+
+		for _, err := range []error{
+			awserr.New("Throttling", "Rate exceeded", nil),
+			awserr.New("ThrottlingException", "Rate exceeded", nil),
+		} {
+			handler.Fn(&request.Request{Error: err})
+		}
+
+		assert.Equal(t, 2.0, testutil.ToFloat64(metrics.MAwsCloudWatchThrottledRequests.WithLabelValues(dsName)))
+	})
+
+	t.Run("Other errors aren't counted as throttled", func(t *testing.T) {
+		const dsName = "not throttled"
+		handler := throttledRequestHandler(dsName)
+
+		handler.Fn(&request.Request{Error: awserr.New("ValidationError", "invalid", nil)})
+		handler.Fn(&request.Request{Error: errors.New("connection reset")})
+		handler.Fn(&request.Request{})
+
+		assert.Equal(t, 0.0, testutil.ToFloat64(metrics.MAwsCloudWatchThrottledRequests.WithLabelValues(dsName)))
+	})
+
+	t.Run("Retries of completed requests are counted", func(t *testing.T) {
+		const dsName = "retried"
+		handler := retriesHandler(dsName)
+
+		handler.Fn(&request.Request{RetryCount: 2})
+		handler.Fn(&request.Request{RetryCount: 3, Error: awserr.New("Throttling", "Rate exceeded", nil)})
+		handler.Fn(&request.Request{})
+
+		assert.Equal(t, 5.0, testutil.ToFloat64(metrics.MAwsCloudWatchRetries.WithLabelValues(dsName)))
+	})
+}
+
+func TestThrottlingHandlers_PerDataSource(t *testing.T) {
+	t.Cleanup(func() {
+		sessCache = map[string]envelope{}
+	})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+		w.WriteHeader(http.StatusBadRequest)
+		_, err := w.Write([]byte(`{"__type": "ThrottlingException", "message": "Rate exceeded"}`))
+		require.NoError(t, err)
+	}))
+	t.Cleanup(server.Close)
+
+	// Data sources with the same settings must not share a session counted for only one of them
+	sendThrottledRequest := func(t *testing.T, id int64, name string) {
+		t.Helper()
+
+		ds := fakeDataSource(fakeDataSourceCfg{
+			accessKey: "AKIAFAKEACCESSKEY",
+			secretKey: "fake-secret-key",
+		})
+		ds.Id = id
+		ds.Name = name
+		ds.JsonData.Set("endpoint", server.URL)
+		e := newExecutor(nil)
+		e.DataSource = ds
+
+		sess, err := e.newSession("us-east-1")
+		require.NoError(t, err)
+		client := cloudwatchlogs.New(sess, &aws.Config{MaxRetries: aws.Int(0)})
+		_, err = client.DescribeLogGroupsWithContext(context.Background(), &cloudwatchlogs.DescribeLogGroupsInput{})
+		require.Error(t, err)
+	}
+
+	sendThrottledRequest(t, 1, "first data source")
+	sendThrottledRequest(t, 2, "second data source")
+	sendThrottledRequest(t, 2, "second data source")
+
+	assert.Equal(t, 1.0,
+		testutil.ToFloat64(metrics.MAwsCloudWatchThrottledRequests.WithLabelValues("first data source")))
+	assert.Equal(t, 2.0,
+		testutil.ToFloat64(metrics.MAwsCloudWatchThrottledRequests.WithLabelValues("second data source")))
+}
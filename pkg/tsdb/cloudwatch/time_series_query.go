@@ -2,8 +2,11 @@ package cloudwatch
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"time"
 
+	"github.com/grafana/grafana-plugin-sdk-go/data"
 	"github.com/grafana/grafana/pkg/infra/log"
 	"github.com/grafana/grafana/pkg/tsdb"
 	"github.com/grafana/grafana/pkg/util/errutil"
@@ -12,30 +15,29 @@ import (
 
 func (e *cloudWatchExecutor) executeTimeSeriesQuery(ctx context.Context, queryContext *tsdb.TsdbQuery) (*tsdb.Response, error) {
 	plog.Debug("Executing time series query")
-	startTime, err := queryContext.TimeRange.ParseFrom()
+	startTime, endTime, err := parseTimeSeriesTimeRange(queryContext.TimeRange)
 	if err != nil {
-		return nil, errutil.Wrap("failed to parse start time", err)
-	}
-	endTime, err := queryContext.TimeRange.ParseTo()
-	if err != nil {
-		return nil, errutil.Wrap("failed to parse end time", err)
-	}
-	if !startTime.Before(endTime) {
-		return nil, fmt.Errorf("invalid time range: start time must be before end time")
+		return nil, err
 	}
 
-	requestQueriesByRegion, err := e.parseQueries(queryContext, startTime, endTime)
-	if err != nil {
-		return nil, err
+	requestQueriesByRegion, queryErrors := e.parseQueries(queryContext, startTime, endTime)
+	results := &tsdb.Response{
+		Results: make(map[string]*tsdb.QueryResult),
+	}
+	for refID, err := range queryErrors {
+		results.Results[refID] = &tsdb.QueryResult{RefId: refID, Error: err}
 	}
 
 	if len(requestQueriesByRegion) == 0 {
-		return &tsdb.Response{
-			Results: make(map[string]*tsdb.QueryResult),
-		}, nil
+		return results, nil
 	}
 
-	resultChan := make(chan *tsdb.QueryResult, len(queryContext.Queries))
+	// Queries for several regions are executed once per region, and may each produce a result
+	numQueries := 0
+	for _, requestQueries := range requestQueriesByRegion {
+		numQueries += len(requestQueries)
+	}
+	resultChan := make(chan *tsdb.QueryResult, numQueries)
 	eg, ectx := errgroup.WithContext(ctx)
 	for r, q := range requestQueriesByRegion {
 		requestQueries := q
@@ -57,6 +59,30 @@ func (e *cloudWatchExecutor) executeTimeSeriesQuery(ctx context.Context, queryCo
 				return err
 			}
 
+			// Queries in the default region are labelled with the region they're executed in, e.g. for aliases
+			resolvedRegion, err := e.resolveRegion(region)
+			if err != nil {
+				return err
+			}
+			for _, query := range requestQueries {
+				query.Region = resolvedRegion
+			}
+
+			requestQueries, legacyQueries := splitGetMetricStatisticsQueries(requestQueries)
+			for _, query := range legacyQueries {
+				queryResult, err := e.executeGetMetricStatisticsQuery(ectx, client, query, startTime, endTime)
+				if err != nil {
+					queryResult = &tsdb.QueryResult{
+						RefId: query.RefId,
+						Error: err,
+					}
+				}
+				resultChan <- queryResult
+			}
+			if len(requestQueries) == 0 {
+				return nil
+			}
+
 			queries, err := e.transformRequestQueriesToCloudWatchQueries(requestQueries)
 			if err != nil {
 				for _, query := range requestQueries {
@@ -68,11 +94,30 @@ func (e *cloudWatchExecutor) executeTimeSeriesQuery(ctx context.Context, queryCo
 				return nil
 			}
 
+			invalidQueries := e.excludeInvalidQueries(queries)
+			for refID, err := range invalidQueries {
+				resultChan <- &tsdb.QueryResult{
+					RefId: refID,
+					Error: err,
+				}
+			}
+			requestQueries = withoutRefIDs(requestQueries, invalidQueries)
+			if len(requestQueries) == 0 {
+				return nil
+			}
+
 			metricDataInput, err := e.buildMetricDataInput(startTime, endTime, queries)
 			if err != nil {
 				return err
 			}
 
+			// The input only describes the queries; credentials are applied when the request is signed,
+			// so it can safely be exposed to the query inspector as is.
+			executedRequest, err := json.Marshal(metricDataInput)
+			if err != nil {
+				return fmt.Errorf("could not marshal GetMetricData request: %w", err)
+			}
+
 			cloudwatchResponses := make([]*cloudwatchResponse, 0)
 			mdo, err := e.executeRequest(ectx, client, metricDataInput)
 			if err != nil {
@@ -96,8 +141,19 @@ func (e *cloudWatchExecutor) executeTimeSeriesQuery(ctx context.Context, queryCo
 				return nil
 			}
 
+			if err := e.resolveInstanceNames(ectx, region, queries, responses); err != nil {
+				for _, query := range requestQueries {
+					resultChan <- &tsdb.QueryResult{
+						RefId: query.RefId,
+						Error: err,
+					}
+				}
+				return nil
+			}
+
 			cloudwatchResponses = append(cloudwatchResponses, responses...)
-			res, err := e.transformQueryResponsesToQueryResult(cloudwatchResponses, requestQueries, startTime, endTime)
+			res, err := e.transformQueryResponsesToQueryResult(cloudwatchResponses, requestQueries,
+				string(executedRequest), startTime, endTime)
 			if err != nil {
 				for _, query := range requestQueries {
 					resultChan <- &tsdb.QueryResult{
@@ -119,11 +175,148 @@ func (e *cloudWatchExecutor) executeTimeSeriesQuery(ctx context.Context, queryCo
 	}
 	close(resultChan)
 
+	for result := range resultChan {
+		if existing, ok := results.Results[result.RefId]; ok {
+			merged, err := mergeQueryResults(existing, result)
+			if err != nil {
+				return nil, err
+			}
+			result = merged
+		}
+		results.Results[result.RefId] = result
+	}
+	return results, nil
+}
+
+// validateTimeSeriesQuery parses time series queries and builds their requests like executeTimeSeriesQuery,
+// without calling AWS. Each query gets an empty result, or one holding the error it would fail with.
+func (e *cloudWatchExecutor) validateTimeSeriesQuery(queryContext *tsdb.TsdbQuery) (*tsdb.Response, error) {
+	plog.Debug("Validating time series query")
+	startTime, endTime, err := parseTimeSeriesTimeRange(queryContext.TimeRange)
+	if err != nil {
+		return nil, err
+	}
+
+	requestQueriesByRegion, queryErrors := e.parseQueries(queryContext, startTime, endTime)
 	results := &tsdb.Response{
 		Results: make(map[string]*tsdb.QueryResult),
 	}
-	for result := range resultChan {
-		results.Results[result.RefId] = result
+	for refID, err := range queryErrors {
+		results.Results[refID] = &tsdb.QueryResult{RefId: refID, Error: err}
+	}
+	setError := func(queries []*requestQuery, err error) {
+		for _, query := range queries {
+			results.Results[query.RefId] = &tsdb.QueryResult{RefId: query.RefId, Error: err}
+		}
+	}
+	for region, requestQueries := range requestQueriesByRegion {
+		for _, query := range requestQueries {
+			if _, exists := results.Results[query.RefId]; !exists {
+				results.Results[query.RefId] = &tsdb.QueryResult{RefId: query.RefId}
+			}
+		}
+
+		if _, err := e.resolveRegion(region); err != nil {
+			setError(requestQueries, err)
+			continue
+		}
+
+		requestQueries, legacyQueries := splitGetMetricStatisticsQueries(requestQueries)
+		for _, query := range legacyQueries {
+			if _, err := getMetricStatisticsQueries(query); err != nil {
+				setError([]*requestQuery{query}, err)
+			}
+		}
+		if len(requestQueries) == 0 {
+			continue
+		}
+
+		queries, err := e.transformRequestQueriesToCloudWatchQueries(requestQueries)
+		if err != nil {
+			setError(requestQueries, err)
+			continue
+		}
+		invalidQueries := e.excludeInvalidQueries(queries)
+		for refID, err := range invalidQueries {
+			results.Results[refID] = &tsdb.QueryResult{RefId: refID, Error: err}
+		}
+		if len(queries) == 0 {
+			continue
+		}
+		if _, err := e.buildMetricDataInput(startTime, endTime, queries); err != nil {
+			setError(requestQueries, err)
+		}
 	}
+
 	return results, nil
 }
+
+// parseTimeSeriesTimeRange parses the time range of time series queries, which must not be empty.
+func parseTimeSeriesTimeRange(timeRange *tsdb.TimeRange) (time.Time, time.Time, error) {
+	startTime, err := timeRange.ParseFrom()
+	if err != nil {
+		return time.Time{}, time.Time{}, errutil.Wrap("failed to parse start time", err)
+	}
+	endTime, err := timeRange.ParseTo()
+	if err != nil {
+		return time.Time{}, time.Time{}, errutil.Wrap("failed to parse end time", err)
+	}
+	if !startTime.Before(endTime) {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid time range: start time must be before end time")
+	}
+
+	return startTime, endTime, nil
+}
+
+// mergeQueryResults merges the results of a query executed in several regions. If the query failed in any of
+// them, the error is returned as the result.
+func mergeQueryResults(a *tsdb.QueryResult, b *tsdb.QueryResult) (*tsdb.QueryResult, error) {
+	if a.Error != nil {
+		return a, nil
+	}
+	if b.Error != nil {
+		return b, nil
+	}
+
+	var frames data.Frames
+	for _, result := range []*tsdb.QueryResult{a, b} {
+		if result.Dataframes == nil {
+			continue
+		}
+		decoded, err := result.Dataframes.Decoded()
+		if err != nil {
+			return nil, err
+		}
+		frames = append(frames, decoded...)
+	}
+	// Results arrive in no particular order, sort the frames so the series are listed consistently
+	sortFrames(frames)
+
+	merged := tsdb.NewQueryResult()
+	merged.RefId = a.RefId
+	// Time series queries keep the executed queries and periods of each region in the meta of their frames, which
+	// are all kept. They don't set the meta of the result, so the one of the first region's result is enough.
+	merged.Meta = a.Meta
+	merged.Dataframes = tsdb.NewDecodedDataFrames(frames)
+	merged.ErrorString = a.ErrorString
+	if merged.ErrorString == "" {
+		merged.ErrorString = b.ErrorString
+	}
+
+	return merged, nil
+}
+
+// splitGetMetricStatisticsQueries separates the queries executed with GetMetricData from the ones using the legacy
+// GetMetricStatistics API.
+func splitGetMetricStatisticsQueries(requestQueries []*requestQuery) ([]*requestQuery, []*requestQuery) {
+	var metricDataQueries, metricStatisticsQueries []*requestQuery
+	for _, query := range requestQueries {
+		if query.UseGetMetricStatistics {
+			metricStatisticsQueries = append(metricStatisticsQueries, query)
+		} else {
+			metricDataQueries = append(metricDataQueries, query)
+		}
+	}
+
+	return metricDataQueries, metricStatisticsQueries
+}
@@ -2,10 +2,25 @@ package cloudwatch
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"testing"
+	"time"
 
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/aws/aws-sdk-go/service/cloudwatch/cloudwatchiface"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/ec2/ec2iface"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/grafana/grafana/pkg/components/simplejson"
+	"github.com/grafana/grafana/pkg/models"
 	"github.com/grafana/grafana/pkg/tsdb"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestTimeSeriesQuery(t *testing.T) {
@@ -21,3 +36,1186 @@ func TestTimeSeriesQuery(t *testing.T) {
 		assert.EqualError(t, err, "invalid time range: start time must be before end time")
 	})
 }
+
+func TestTimeSeriesQuery_PeriodSnapping(t *testing.T) {
+	origNewCWClient := NewCWClient
+	t.Cleanup(func() {
+		NewCWClient = origNewCWClient
+	})
+
+	var cli FakeCWClient
+
+	NewCWClient = func(sess *session.Session) cloudwatchiface.CloudWatchAPI {
+		return cli
+	}
+
+	// 2020-03-20 10:37:23 UTC - 2020-03-22 10:37:23 UTC
+	timeRange := tsdb.NewTimeRange("1584700643000", "1584873443000")
+	newQuery := func(timezone string) *tsdb.TsdbQuery {
+		model := map[string]interface{}{
+			"region":     "us-east-1",
+			"namespace":  "AWS/EC2",
+			"metricName": "CPUUtilization",
+			"dimensions": map[string]interface{}{
+				"InstanceId": "i-123",
+			},
+			"statistics": []interface{}{"Average"},
+			"period":     "86400",
+		}
+		if timezone != "" {
+			model["timezone"] = timezone
+		}
+
+		return &tsdb.TsdbQuery{
+			TimeRange: timeRange,
+			Headers:   map[string]string{"FromAlert": "true"},
+			Queries: []*tsdb.Query{
+				{
+					RefId: "A",
+					Model: simplejson.NewFromAny(model),
+				},
+			},
+		}
+	}
+
+	t.Run("Alert query periods are snapped to the query timezone", func(t *testing.T) {
+		cli = FakeCWClient{calls: &cloudWatchCalls{}}
+
+		executor := newExecutor(nil)
+		_, err := executor.Query(context.Background(), fakeDataSource(), newQuery("Europe/Stockholm"))
+		require.NoError(t, err)
+
+		require.Len(t, cli.calls.getMetricData, 1)
+		input := cli.calls.getMetricData[0]
+		assert.Equal(t, time.Date(2020, 3, 19, 23, 0, 0, 0, time.UTC), input.StartTime.UTC())
+		assert.Equal(t, time.Date(2020, 3, 22, 23, 0, 0, 0, time.UTC), input.EndTime.UTC())
+		assert.Equal(t, &cloudwatch.LabelOptions{Timezone: aws.String("+0100")}, input.LabelOptions)
+	})
+
+	t.Run("Alert query periods are snapped to a timezone offset", func(t *testing.T) {
+		cli = FakeCWClient{calls: &cloudWatchCalls{}}
+
+		executor := newExecutor(nil)
+		_, err := executor.Query(context.Background(), fakeDataSource(), newQuery("-0530"))
+		require.NoError(t, err)
+
+		require.Len(t, cli.calls.getMetricData, 1)
+		input := cli.calls.getMetricData[0]
+		assert.Equal(t, time.Date(2020, 3, 20, 5, 30, 0, 0, time.UTC), input.StartTime.UTC())
+		assert.Equal(t, time.Date(2020, 3, 23, 5, 30, 0, 0, time.UTC), input.EndTime.UTC())
+		assert.Equal(t, &cloudwatch.LabelOptions{Timezone: aws.String("-0530")}, input.LabelOptions)
+	})
+
+	t.Run("Alert query time range is left untouched without timezone", func(t *testing.T) {
+		cli = FakeCWClient{calls: &cloudWatchCalls{}}
+
+		executor := newExecutor(nil)
+		_, err := executor.Query(context.Background(), fakeDataSource(), newQuery(""))
+		require.NoError(t, err)
+
+		require.Len(t, cli.calls.getMetricData, 1)
+		input := cli.calls.getMetricData[0]
+		assert.Equal(t, time.Date(2020, 3, 20, 10, 37, 23, 0, time.UTC), input.StartTime.UTC())
+		assert.Equal(t, time.Date(2020, 3, 22, 10, 37, 23, 0, time.UTC), input.EndTime.UTC())
+		assert.Nil(t, input.LabelOptions)
+	})
+
+	t.Run("Invalid timezone should result in error", func(t *testing.T) {
+		cli = FakeCWClient{calls: &cloudWatchCalls{}}
+
+		executor := newExecutor(nil)
+		_, err := executor.Query(context.Background(), fakeDataSource(), newQuery("Mars/Olympus_Mons"))
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), `invalid timezone "Mars/Olympus_Mons"`)
+		assert.Empty(t, cli.calls.getMetricData)
+	})
+}
+
+func TestLabelTimezone(t *testing.T) {
+	stockholm, err := time.LoadLocation("Europe/Stockholm")
+	require.NoError(t, err)
+	summer := time.Date(2020, 7, 1, 0, 0, 0, 0, time.UTC)
+
+	t.Run("Daylight saving time is taken at the start time", func(t *testing.T) {
+		assert.Equal(t, "+0200", labelTimezone(summer, map[string]*cloudWatchQuery{
+			"a": {Timezone: stockholm},
+			"b": {},
+		}))
+	})
+
+	t.Run("Same offsets are shared", func(t *testing.T) {
+		assert.Equal(t, "+0200", labelTimezone(summer, map[string]*cloudWatchQuery{
+			"a": {Timezone: stockholm},
+			"b": {Timezone: time.FixedZone("+0200", 2*60*60)},
+		}))
+	})
+
+	t.Run("Different offsets aren't set", func(t *testing.T) {
+		assert.Equal(t, "", labelTimezone(summer, map[string]*cloudWatchQuery{
+			"a": {Timezone: stockholm},
+			"b": {Timezone: time.UTC},
+		}))
+	})
+}
+
+func TestTimeSeriesQuery_ExecutedRequest(t *testing.T) {
+	origNewCWClient := NewCWClient
+	t.Cleanup(func() {
+		NewCWClient = origNewCWClient
+	})
+
+	cli := FakeCWClient{
+		MetricDataOutput: cloudwatch.GetMetricDataOutput{
+			MetricDataResults: []*cloudwatch.MetricDataResult{
+				{
+					Id:         aws.String("queryA"),
+					Label:      aws.String("CPUUtilization"),
+					Timestamps: []*time.Time{aws.Time(time.Unix(1584700800, 0))},
+					Values:     []*float64{aws.Float64(10)},
+					StatusCode: aws.String("Complete"),
+				},
+			},
+		},
+		calls: &cloudWatchCalls{},
+	}
+	NewCWClient = func(sess *session.Session) cloudwatchiface.CloudWatchAPI {
+		return cli
+	}
+
+	executor := newExecutor(nil)
+	resp, err := executor.Query(context.Background(), fakeDataSource(fakeDataSourceCfg{
+		accessKey: "AKIAFAKEACCESSKEY",
+		secretKey: "fake-secret-key",
+	}), &tsdb.TsdbQuery{
+		TimeRange: tsdb.NewTimeRange("1584700643000", "1584873443000"),
+		Queries: []*tsdb.Query{
+			{
+				RefId: "A",
+				Model: simplejson.NewFromAny(map[string]interface{}{
+					"region":     "us-east-1",
+					"namespace":  "AWS/EC2",
+					"metricName": "CPUUtilization",
+					"dimensions": map[string]interface{}{
+						"InstanceId": "i-123",
+					},
+					"statistics": []interface{}{"Average"},
+					"period":     "300",
+				}),
+			},
+		},
+	})
+	require.NoError(t, err)
+	require.Len(t, cli.calls.getMetricData, 1)
+
+	frames, err := resp.Results["A"].Dataframes.Decoded()
+	require.NoError(t, err)
+	require.NotEmpty(t, frames)
+	for _, frame := range frames {
+		executedRequest, ok := frame.Meta.Custom.(map[string]interface{})["query"].(string)
+		require.True(t, ok)
+
+		assert.Contains(t, executedRequest, `"MetricName":"CPUUtilization"`)
+		assert.Contains(t, executedRequest, `"Namespace":"AWS/EC2"`)
+		assert.NotContains(t, executedRequest, "AKIAFAKEACCESSKEY")
+		assert.NotContains(t, executedRequest, "fake-secret-key")
+	}
+}
+
+func TestTimeSeriesQuery_RawResults(t *testing.T) {
+	origNewCWClient := NewCWClient
+	t.Cleanup(func() {
+		NewCWClient = origNewCWClient
+	})
+
+	cli := FakeCWClient{
+		MetricDataOutput: cloudwatch.GetMetricDataOutput{
+			MetricDataResults: []*cloudwatch.MetricDataResult{
+				{
+					Id:         aws.String("queryA"),
+					Label:      aws.String("CPUUtilization"),
+					Timestamps: []*time.Time{aws.Time(time.Unix(1584700800, 0))},
+					Values:     []*float64{aws.Float64(10)},
+					StatusCode: aws.String("Complete"),
+				},
+			},
+		},
+	}
+	NewCWClient = func(sess *session.Session) cloudwatchiface.CloudWatchAPI {
+		return cli
+	}
+
+	runQuery := func(t *testing.T, includeRawResults bool) map[string]interface{} {
+		executor := newExecutor(nil)
+		resp, err := executor.Query(context.Background(), fakeDataSource(), &tsdb.TsdbQuery{
+			TimeRange: tsdb.NewTimeRange("1584700643000", "1584873443000"),
+			Queries: []*tsdb.Query{
+				{
+					RefId: "A",
+					Model: simplejson.NewFromAny(map[string]interface{}{
+						"region":            "us-east-1",
+						"namespace":         "AWS/EC2",
+						"metricName":        "CPUUtilization",
+						"statistics":        []interface{}{"Average"},
+						"period":            "300",
+						"includeRawResults": includeRawResults,
+					}),
+				},
+			},
+		})
+		require.NoError(t, err)
+
+		frames, err := resp.Results["A"].Dataframes.Decoded()
+		require.NoError(t, err)
+		require.Len(t, frames, 1)
+		return frames[0].Meta.Custom.(map[string]interface{})
+	}
+
+	t.Run("Raw results are left out by default", func(t *testing.T) {
+		custom := runQuery(t, false)
+		assert.NotContains(t, custom, "rawResults")
+	})
+
+	t.Run("Raw results are included when requested", func(t *testing.T) {
+		custom := runQuery(t, true)
+		require.Contains(t, custom, "rawResults")
+
+		raw, err := json.Marshal(custom["rawResults"])
+		require.NoError(t, err)
+		assert.JSONEq(t, `[{"id":"queryA","label":"CPUUtilization","statusCode":"Complete",`+
+			`"timestamps":[1584700800000],"values":[10]}]`, string(raw))
+	})
+}
+
+func TestTimeSeriesQuery_ResolveInstanceNames(t *testing.T) {
+	origNewCWClient, origNewEC2Client := NewCWClient, newEC2Client
+	t.Cleanup(func() {
+		NewCWClient, newEC2Client = origNewCWClient, origNewEC2Client
+		instanceNameCache.Range(func(key, _ interface{}) bool {
+			instanceNameCache.Delete(key)
+			return true
+		})
+	})
+
+	newResult := func(instanceId string) *cloudwatch.MetricDataResult {
+		return &cloudwatch.MetricDataResult{
+			Id:         aws.String("queryA"),
+			Label:      aws.String(instanceId),
+			Timestamps: []*time.Time{aws.Time(time.Unix(1584700800, 0))},
+			Values:     []*float64{aws.Float64(10)},
+			StatusCode: aws.String("Complete"),
+		}
+	}
+	cli := FakeCWClient{
+		MetricDataOutput: cloudwatch.GetMetricDataOutput{
+			MetricDataResults: []*cloudwatch.MetricDataResult{newResult("i-1"), newResult("i-2")},
+		},
+	}
+	NewCWClient = func(sess *session.Session) cloudwatchiface.CloudWatchAPI {
+		return cli
+	}
+	var describeTagsInputs []*ec2.DescribeTagsInput
+	ec2Cli := fakeEC2Client{
+		tags: []*ec2.TagDescription{
+			{ResourceId: aws.String("i-1"), Key: aws.String("Name"), Value: aws.String("web-server")},
+		},
+		describeTagsInputs: &describeTagsInputs,
+	}
+	newEC2Client = func(client.ConfigProvider) ec2iface.EC2API {
+		return ec2Cli
+	}
+
+	runQuery := func(t *testing.T, alias string) map[string]*data.Frame {
+		t.Helper()
+
+		executor := newExecutor(nil)
+		resp, err := executor.Query(context.Background(), fakeDataSource(), &tsdb.TsdbQuery{
+			TimeRange: tsdb.NewTimeRange("1584700643000", "1584873443000"),
+			Queries: []*tsdb.Query{
+				{
+					RefId: "A",
+					Model: simplejson.NewFromAny(map[string]interface{}{
+						"region":     "us-east-1",
+						"namespace":  "AWS/EC2",
+						"metricName": "CPUUtilization",
+						"dimensions": map[string]interface{}{
+							"InstanceId": "*",
+						},
+						"statistics":           []interface{}{"Average"},
+						"period":               "300",
+						"alias":                alias,
+						"resolveInstanceNames": true,
+					}),
+				},
+			},
+		})
+		require.NoError(t, err)
+
+		frames, err := resp.Results["A"].Dataframes.Decoded()
+		require.NoError(t, err)
+		framesByInstance := map[string]*data.Frame{}
+		for _, frame := range frames {
+			framesByInstance[frame.Fields[1].Labels["InstanceId"]] = frame
+		}
+		return framesByInstance
+	}
+
+	t.Run("Series are named after the Name tag of their instance", func(t *testing.T) {
+		frames := runQuery(t, "")
+		require.Len(t, frames, 2)
+
+		assert.Equal(t, "web-server", frames["i-1"].Name)
+		assert.Equal(t, "web-server", frames["i-1"].Fields[1].Labels["Name"])
+		assert.Equal(t, "web-server", frames["i-1"].Fields[1].Config.DisplayNameFromDS)
+		// Untagged instances keep their id
+		assert.Equal(t, "i-2", frames["i-2"].Name)
+		assert.NotContains(t, frames["i-2"].Fields[1].Labels, "Name")
+
+		require.Len(t, describeTagsInputs, 1)
+	})
+
+	t.Run("Name can be used in aliases", func(t *testing.T) {
+		frames := runQuery(t, "{{ Name }} ({{InstanceId}})")
+		require.Len(t, frames, 2)
+
+		assert.Equal(t, "web-server (i-1)", frames["i-1"].Name)
+		assert.Equal(t, "i-2 (i-2)", frames["i-2"].Name)
+
+		// The names of both instances, tagged or not, were cached by the first query
+		require.Len(t, describeTagsInputs, 1)
+	})
+}
+
+func TestTimeSeriesQuery_Messages(t *testing.T) {
+	origNewCWClient := NewCWClient
+	t.Cleanup(func() {
+		NewCWClient = origNewCWClient
+	})
+
+	cli := FakeCWClient{
+		MetricDataOutput: cloudwatch.GetMetricDataOutput{
+			Messages: []*cloudwatch.MessageData{
+				{Code: aws.String("MaxMetricsExceeded"), Value: aws.String("The maximum number of metrics was exceeded")},
+			},
+			MetricDataResults: []*cloudwatch.MetricDataResult{
+				{
+					Id:         aws.String("queryA"),
+					Label:      aws.String("CPUUtilization"),
+					Timestamps: []*time.Time{aws.Time(time.Unix(1584700800, 0))},
+					Values:     []*float64{aws.Float64(10)},
+					StatusCode: aws.String("Complete"),
+					Messages: []*cloudwatch.MessageData{
+						{Code: aws.String("Warning"), Value: aws.String("Some datapoints were dropped")},
+					},
+				},
+			},
+		},
+	}
+	NewCWClient = func(sess *session.Session) cloudwatchiface.CloudWatchAPI {
+		return cli
+	}
+
+	executor := newExecutor(nil)
+	resp, err := executor.Query(context.Background(), fakeDataSource(), &tsdb.TsdbQuery{
+		TimeRange: tsdb.NewTimeRange("1584700643000", "1584873443000"),
+		Queries: []*tsdb.Query{
+			{
+				RefId: "A",
+				Model: simplejson.NewFromAny(map[string]interface{}{
+					"region":     "us-east-1",
+					"namespace":  "AWS/EC2",
+					"metricName": "CPUUtilization",
+					"statistics": []interface{}{"Average"},
+					"period":     "300",
+				}),
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	frames, err := resp.Results["A"].Dataframes.Decoded()
+	require.NoError(t, err)
+	require.Len(t, frames, 1)
+	assert.Equal(t, []data.Notice{
+		{Severity: data.NoticeSeverityWarning, Text: "MaxMetricsExceeded: The maximum number of metrics was exceeded"},
+		{Severity: data.NoticeSeverityWarning, Text: "Warning: Some datapoints were dropped"},
+	}, frames[0].Meta.Notices)
+}
+
+func TestTimeSeriesQuery_MetricsInsights(t *testing.T) {
+	origNewCWClient := NewCWClient
+	t.Cleanup(func() {
+		NewCWClient = origNewCWClient
+	})
+
+	const sql = `SELECT AVG(CPUUtilization) FROM SCHEMA("AWS/EC2", InstanceId) GROUP BY InstanceId`
+	newResult := func(label string, value float64) *cloudwatch.MetricDataResult {
+		return &cloudwatch.MetricDataResult{
+			Id:         aws.String("queryA"),
+			Label:      aws.String(label),
+			Timestamps: []*time.Time{aws.Time(time.Unix(1584700800, 0))},
+			Values:     []*float64{aws.Float64(value)},
+			StatusCode: aws.String("Complete"),
+		}
+	}
+	cli := FakeCWClient{
+		MetricDataOutput: cloudwatch.GetMetricDataOutput{
+			MetricDataResults: []*cloudwatch.MetricDataResult{newResult("i-2", 20), newResult("i-1", 10)},
+		},
+		calls: &cloudWatchCalls{},
+	}
+	NewCWClient = func(sess *session.Session) cloudwatchiface.CloudWatchAPI {
+		return cli
+	}
+
+	runQuery := func(t *testing.T, model map[string]interface{}) (*tsdb.Response, error) {
+		t.Helper()
+
+		model["region"] = "us-east-1"
+		model["metricQueryType"] = "insights"
+		executor := newExecutor(nil)
+		return executor.Query(context.Background(), fakeDataSource(), &tsdb.TsdbQuery{
+			// Recent enough for the period not to be raised
+			TimeRange: tsdb.NewTimeRange("now-2d", "now"),
+			Queries: []*tsdb.Query{
+				{
+					RefId: "A",
+					Model: simplejson.NewFromAny(model),
+				},
+			},
+		})
+	}
+
+	t.Run("SQL is sent as an expression and grouped results become frames", func(t *testing.T) {
+		resp, err := runQuery(t, map[string]interface{}{
+			"sqlExpression": sql,
+			"period":        "300",
+		})
+		require.NoError(t, err)
+
+		require.Len(t, cli.calls.getMetricData, 1)
+		require.Len(t, cli.calls.getMetricData[0].MetricDataQueries, 1)
+		mdq := cli.calls.getMetricData[0].MetricDataQueries[0]
+		assert.Equal(t, sql, aws.StringValue(mdq.Expression))
+		assert.Equal(t, int64(300), aws.Int64Value(mdq.Period))
+		assert.Nil(t, mdq.MetricStat)
+
+		frames, err := resp.Results["A"].Dataframes.Decoded()
+		require.NoError(t, err)
+		require.Len(t, frames, 2)
+		assert.Equal(t, "i-1", frames[0].Name)
+		assert.Equal(t, "i-1", frames[0].Fields[1].Labels["InstanceId"])
+		assert.Equal(t, aws.Float64(10), frames[0].Fields[1].At(0))
+		assert.Equal(t, "i-2", frames[1].Name)
+		assert.Equal(t, "i-2", frames[1].Fields[1].Labels["InstanceId"])
+		assert.Equal(t, aws.Float64(20), frames[1].Fields[1].At(0))
+	})
+
+	t.Run("Period is required", func(t *testing.T) {
+		_, err := runQuery(t, map[string]interface{}{
+			"sqlExpression": sql,
+		})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "a period is required for Metrics Insights queries")
+	})
+
+	t.Run("SQL is required", func(t *testing.T) {
+		_, err := runQuery(t, map[string]interface{}{
+			"period": "300",
+		})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "a SQL expression is required for Metrics Insights queries")
+	})
+}
+
+func TestTimeSeriesQuery_MultipleStatistics(t *testing.T) {
+	origNewCWClient := NewCWClient
+	t.Cleanup(func() {
+		NewCWClient = origNewCWClient
+	})
+
+	newResult := func(id string, value float64) *cloudwatch.MetricDataResult {
+		return &cloudwatch.MetricDataResult{
+			Id:         aws.String(id),
+			Label:      aws.String("CPUUtilization"),
+			Timestamps: []*time.Time{aws.Time(time.Unix(1584700800, 0))},
+			Values:     []*float64{aws.Float64(value)},
+			StatusCode: aws.String("Complete"),
+		}
+	}
+	cli := FakeCWClient{
+		MetricDataOutput: cloudwatch.GetMetricDataOutput{
+			// GetMetricData doesn't return the results in the order of the queries
+			MetricDataResults: []*cloudwatch.MetricDataResult{
+				newResult("queryA_p95", 25),
+				newResult("queryA_Average", 10),
+				newResult("queryA_Maximum", 30),
+			},
+		},
+		calls: &cloudWatchCalls{},
+	}
+	NewCWClient = func(sess *session.Session) cloudwatchiface.CloudWatchAPI {
+		return cli
+	}
+
+	executor := newExecutor(nil)
+	resp, err := executor.Query(context.Background(), fakeDataSource(), &tsdb.TsdbQuery{
+		TimeRange: tsdb.NewTimeRange("1584700643000", "1584873443000"),
+		Queries: []*tsdb.Query{
+			{
+				RefId: "A",
+				Model: simplejson.NewFromAny(map[string]interface{}{
+					"region":     "us-east-1",
+					"namespace":  "AWS/EC2",
+					"metricName": "CPUUtilization",
+					"dimensions": map[string]interface{}{
+						"InstanceId": "i-123",
+					},
+					"statistics": []interface{}{"Average", "Maximum", "p95"},
+					"period":     "300",
+				}),
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	require.Len(t, cli.calls.getMetricData, 1)
+	stats := map[string]string{}
+	for _, mdq := range cli.calls.getMetricData[0].MetricDataQueries {
+		require.NotNil(t, mdq.MetricStat)
+		stats[*mdq.Id] = *mdq.MetricStat.Stat
+	}
+	assert.Equal(t, map[string]string{
+		"queryA_Average": "Average",
+		"queryA_Maximum": "Maximum",
+		"queryA_p95":     "p95",
+	}, stats)
+
+	frames, err := resp.Results["A"].Dataframes.Decoded()
+	require.NoError(t, err)
+	require.Len(t, frames, 3)
+	names := []string{}
+	for _, frame := range frames {
+		names = append(names, frame.Name)
+		assert.Equal(t, "i-123", frame.Fields[1].Labels["InstanceId"])
+	}
+	assert.Equal(t, []string{
+		"CPUUtilization i-123 Average",
+		"CPUUtilization i-123 Maximum",
+		"CPUUtilization i-123 p95",
+	}, names)
+	assert.Equal(t, "Average", frames[0].Fields[1].Labels["stat"])
+	assert.Equal(t, "Maximum", frames[1].Fields[1].Labels["stat"])
+	assert.Equal(t, "p95", frames[2].Fields[1].Labels["stat"])
+	// Each frame holds the values of the result of its own statistic
+	assert.Equal(t, aws.Float64(10), frames[0].Fields[1].At(0))
+	assert.Equal(t, aws.Float64(30), frames[1].Fields[1].At(0))
+	assert.Equal(t, aws.Float64(25), frames[2].Fields[1].At(0))
+}
+
+func TestTimeSeriesQuery_HiddenSourceMetrics(t *testing.T) {
+	origNewCWClient := NewCWClient
+	t.Cleanup(func() {
+		NewCWClient = origNewCWClient
+	})
+
+	newResult := func(id string, value float64) *cloudwatch.MetricDataResult {
+		return &cloudwatch.MetricDataResult{
+			Id:         aws.String(id),
+			Label:      aws.String(id),
+			Timestamps: []*time.Time{aws.Time(time.Unix(1584700800, 0))},
+			Values:     []*float64{aws.Float64(value)},
+			StatusCode: aws.String("Complete"),
+		}
+	}
+	cli := FakeCWClient{
+		// CloudWatch leaves out results of queries with ReturnData false, but make sure they'd be dropped anyway
+		MetricDataOutput: cloudwatch.GetMetricDataOutput{
+			MetricDataResults: []*cloudwatch.MetricDataResult{
+				newResult("m1", 10),
+				newResult("e1", 20),
+			},
+		},
+		calls: &cloudWatchCalls{},
+	}
+	NewCWClient = func(sess *session.Session) cloudwatchiface.CloudWatchAPI {
+		return cli
+	}
+
+	executor := newExecutor(nil)
+	resp, err := executor.Query(context.Background(), fakeDataSource(), &tsdb.TsdbQuery{
+		TimeRange: tsdb.NewTimeRange("1584700643000", "1584873443000"),
+		Queries: []*tsdb.Query{
+			{
+				RefId: "A",
+				Model: simplejson.NewFromAny(map[string]interface{}{
+					"type":       "timeSeriesQuery",
+					"region":     "us-east-1",
+					"id":         "m1",
+					"namespace":  "AWS/EC2",
+					"metricName": "CPUUtilization",
+					"statistics": []interface{}{"Average"},
+					"period":     "300",
+					"hide":       true,
+				}),
+			},
+			{
+				RefId: "B",
+				Model: simplejson.NewFromAny(map[string]interface{}{
+					"type":       "timeSeriesQuery",
+					"region":     "us-east-1",
+					"id":         "e1",
+					"expression": "m1 * 2",
+					"statistics": []interface{}{"Average"},
+					"period":     "300",
+				}),
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	require.Len(t, cli.calls.getMetricData, 1)
+	returnData := map[string]bool{}
+	for _, mdq := range cli.calls.getMetricData[0].MetricDataQueries {
+		returnData[*mdq.Id] = *mdq.ReturnData
+	}
+	assert.Equal(t, map[string]bool{
+		"m1": false,
+		"e1": true,
+	}, returnData)
+
+	assert.NotContains(t, resp.Results, "A")
+	require.Contains(t, resp.Results, "B")
+	frames, err := resp.Results["B"].Dataframes.Decoded()
+	require.NoError(t, err)
+	require.Len(t, frames, 1)
+	assert.Equal(t, "e1", frames[0].Name)
+}
+
+func TestTimeSeriesQuery_GetMetricStatistics(t *testing.T) {
+	origNewCWClient := NewCWClient
+	t.Cleanup(func() {
+		NewCWClient = origNewCWClient
+	})
+
+	timestamp := time.Unix(1584700800, 0)
+	cli := FakeCWClient{
+		MetricStatisticsOutput: cloudwatch.GetMetricStatisticsOutput{
+			// Datapoints aren't ordered by time
+			Datapoints: []*cloudwatch.Datapoint{
+				{
+					Timestamp:          aws.Time(timestamp.Add(300 * time.Second)),
+					Average:            aws.Float64(20),
+					Maximum:            aws.Float64(40),
+					ExtendedStatistics: map[string]*float64{"p95": aws.Float64(35)},
+				},
+				{
+					Timestamp:          aws.Time(timestamp),
+					Average:            aws.Float64(10),
+					Maximum:            aws.Float64(30),
+					ExtendedStatistics: map[string]*float64{"p95": aws.Float64(25)},
+				},
+			},
+		},
+		calls: &cloudWatchCalls{},
+	}
+	NewCWClient = func(sess *session.Session) cloudwatchiface.CloudWatchAPI {
+		return cli
+	}
+
+	executor := newExecutor(nil)
+	resp, err := executor.Query(context.Background(), fakeDataSource(), &tsdb.TsdbQuery{
+		TimeRange: tsdb.NewTimeRange("1584700643000", "1584873443000"),
+		Queries: []*tsdb.Query{
+			{
+				RefId: "A",
+				Model: simplejson.NewFromAny(map[string]interface{}{
+					"type":       "timeSeriesQuery",
+					"region":     "us-east-1",
+					"namespace":  "AWS/EC2",
+					"metricName": "CPUUtilization",
+					"dimensions": map[string]interface{}{
+						"InstanceId": "i-123",
+					},
+					"statistics":             []interface{}{"Average", "Maximum", "p95"},
+					"period":                 "300",
+					"useGetMetricStatistics": true,
+				}),
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	assert.Empty(t, cli.calls.getMetricData)
+	require.Len(t, cli.calls.getMetricStatistics, 1)
+	input := cli.calls.getMetricStatistics[0]
+	assert.Equal(t, "AWS/EC2", *input.Namespace)
+	assert.Equal(t, "CPUUtilization", *input.MetricName)
+	// The time range is over 63 days old, so the period is raised to an hour
+	assert.Equal(t, int64(3600), *input.Period)
+	assert.Equal(t, []*cloudwatch.Dimension{
+		{Name: aws.String("InstanceId"), Value: aws.String("i-123")},
+	}, input.Dimensions)
+	assert.Equal(t, []*string{aws.String("Average"), aws.String("Maximum")}, input.Statistics)
+	assert.Equal(t, []*string{aws.String("p95")}, input.ExtendedStatistics)
+
+	frames, err := resp.Results["A"].Dataframes.Decoded()
+	require.NoError(t, err)
+	require.Len(t, frames, 3)
+
+	expected := []struct {
+		name   string
+		stat   string
+		values []float64
+	}{
+		{name: "CPUUtilization i-123 Average", stat: "Average", values: []float64{10, 20}},
+		{name: "CPUUtilization i-123 Maximum", stat: "Maximum", values: []float64{30, 40}},
+		{name: "CPUUtilization i-123 p95", stat: "p95", values: []float64{25, 35}},
+	}
+	for i, exp := range expected {
+		frame := frames[i]
+		assert.Equal(t, exp.name, frame.Name)
+		assert.Equal(t, "i-123", frame.Fields[1].Labels["InstanceId"])
+		assert.Equal(t, exp.stat, frame.Fields[1].Labels["stat"])
+		require.Equal(t, 2, frame.Fields[0].Len())
+		assert.Equal(t, timestamp.UTC(), frame.Fields[0].At(0).(*time.Time).UTC())
+		assert.Equal(t, timestamp.Add(300*time.Second).UTC(), frame.Fields[0].At(1).(*time.Time).UTC())
+		for j, value := range exp.values {
+			assert.Equal(t, value, *frame.Fields[1].At(j).(*float64))
+		}
+	}
+}
+
+func TestTimeSeriesQuery_GetMetricStatistics_MultiValuedDimension(t *testing.T) {
+	origNewCWClient := NewCWClient
+	t.Cleanup(func() {
+		NewCWClient = origNewCWClient
+	})
+
+	cli := FakeCWClient{calls: &cloudWatchCalls{}}
+	NewCWClient = func(sess *session.Session) cloudwatchiface.CloudWatchAPI {
+		return cli
+	}
+
+	executor := newExecutor(nil)
+	resp, err := executor.Query(context.Background(), fakeDataSource(), &tsdb.TsdbQuery{
+		TimeRange: tsdb.NewTimeRange("1584700643000", "1584873443000"),
+		Queries: []*tsdb.Query{
+			{
+				RefId: "A",
+				Model: simplejson.NewFromAny(map[string]interface{}{
+					"type":       "timeSeriesQuery",
+					"region":     "us-east-1",
+					"namespace":  "AWS/EC2",
+					"metricName": "CPUUtilization",
+					"dimensions": map[string]interface{}{
+						"InstanceId": []interface{}{"i-123", "i-456"},
+					},
+					"statistics":             []interface{}{"Average"},
+					"period":                 "300",
+					"useGetMetricStatistics": true,
+				}),
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	assert.Empty(t, cli.calls.getMetricStatistics)
+	require.Error(t, resp.Results["A"].Error)
+	assert.Equal(t, `dimension "InstanceId" must have exactly one value when using GetMetricStatistics`,
+		resp.Results["A"].Error.Error())
+}
+
+func TestTimeSeriesQuery_MultipleRegions(t *testing.T) {
+	origNewCWClient := NewCWClient
+	t.Cleanup(func() {
+		NewCWClient = origNewCWClient
+	})
+
+	newClient := func(value float64) FakeCWClient {
+		return FakeCWClient{
+			MetricDataOutput: cloudwatch.GetMetricDataOutput{
+				MetricDataResults: []*cloudwatch.MetricDataResult{
+					{
+						Id:         aws.String("queryA"),
+						Label:      aws.String("CPUUtilization"),
+						Timestamps: []*time.Time{aws.Time(time.Unix(1584700800, 0))},
+						Values:     []*float64{aws.Float64(value)},
+						StatusCode: aws.String("Complete"),
+					},
+				},
+			},
+			calls: &cloudWatchCalls{},
+		}
+	}
+	clients := map[string]FakeCWClient{
+		"us-east-1": newClient(10),
+		"eu-west-1": newClient(20),
+	}
+	NewCWClient = func(sess *session.Session) cloudwatchiface.CloudWatchAPI {
+		return clients[aws.StringValue(sess.Config.Region)]
+	}
+
+	runQuery := func(t *testing.T, alias string) data.Frames {
+		for _, cli := range clients {
+			cli.calls.getMetricData = nil
+		}
+
+		executor := newExecutor(nil)
+		resp, err := executor.Query(context.Background(), fakeDataSource(), &tsdb.TsdbQuery{
+			TimeRange: tsdb.NewTimeRange("1584700643000", "1584873443000"),
+			Queries: []*tsdb.Query{
+				{
+					RefId: "A",
+					Model: simplejson.NewFromAny(map[string]interface{}{
+						"region":     []interface{}{"us-east-1", "eu-west-1"},
+						"namespace":  "AWS/EC2",
+						"metricName": "CPUUtilization",
+						"dimensions": map[string]interface{}{
+							"InstanceId": "i-123",
+						},
+						"statistics": []interface{}{"Average"},
+						"period":     "300",
+						"alias":      alias,
+					}),
+				},
+			},
+		})
+		require.NoError(t, err)
+
+		for region, cli := range clients {
+			assert.Len(t, cli.calls.getMetricData, 1, region)
+		}
+
+		require.Contains(t, resp.Results, "A")
+		frames, err := resp.Results["A"].Dataframes.Decoded()
+		require.NoError(t, err)
+		return frames
+	}
+
+	t.Run("Frames of all regions are sorted by name", func(t *testing.T) {
+		frames := runQuery(t, "")
+
+		require.Len(t, frames, 2)
+		assert.Equal(t, "CPUUtilization i-123 eu-west-1", frames[0].Name)
+		assert.Equal(t, "eu-west-1", frames[0].Fields[1].Labels["region"])
+		assert.Equal(t, 20.0, *frames[0].Fields[1].At(0).(*float64))
+		assert.Equal(t, "CPUUtilization i-123 us-east-1", frames[1].Name)
+		assert.Equal(t, "us-east-1", frames[1].Fields[1].Labels["region"])
+		assert.Equal(t, 10.0, *frames[1].Fields[1].At(0).(*float64))
+	})
+
+	t.Run("Frames with the same name are sorted by labels", func(t *testing.T) {
+		// Results of the regions are merged in the order they complete, run a few times to catch either
+		for i := 0; i < 10; i++ {
+			frames := runQuery(t, "{{metric}}")
+
+			require.Len(t, frames, 2)
+			assert.Equal(t, "CPUUtilization", frames[0].Name)
+			assert.Equal(t, "eu-west-1", frames[0].Fields[1].Labels["region"])
+			assert.Equal(t, "CPUUtilization", frames[1].Name)
+			assert.Equal(t, "us-east-1", frames[1].Fields[1].Labels["region"])
+		}
+	})
+}
+
+func TestTimeSeriesQuery_MaxDataPoints(t *testing.T) {
+	origNewCWClient := NewCWClient
+	t.Cleanup(func() {
+		NewCWClient = origNewCWClient
+	})
+	cli := FakeCWClient{calls: &cloudWatchCalls{}}
+	NewCWClient = func(sess *session.Session) cloudwatchiface.CloudWatchAPI {
+		return cli
+	}
+
+	newQuery := func(refID string, maxDataPoints int64) *tsdb.Query {
+		return &tsdb.Query{
+			RefId:         refID,
+			MaxDataPoints: maxDataPoints,
+			Model: simplejson.NewFromAny(map[string]interface{}{
+				"region":     "us-east-1",
+				"namespace":  "AWS/EC2",
+				"metricName": "CPUUtilization",
+				"dimensions": map[string]interface{}{
+					"InstanceId": "i-123",
+				},
+				"statistics": []interface{}{"Average"},
+				"period":     "300",
+			}),
+		}
+	}
+	query := func(t *testing.T, queries ...*tsdb.Query) *cloudwatch.GetMetricDataInput {
+		t.Helper()
+
+		cli.calls.getMetricData = nil
+		_, err := newExecutor(nil).Query(context.Background(), fakeDataSource(), &tsdb.TsdbQuery{
+			TimeRange: tsdb.NewTimeRange("now-2d", "now"),
+			Queries:   queries,
+		})
+		require.NoError(t, err)
+		require.Len(t, cli.calls.getMetricData, 1)
+
+		return cli.calls.getMetricData[0]
+	}
+	period := func(t *testing.T, q *tsdb.Query) int64 {
+		t.Helper()
+
+		input := query(t, q)
+		require.Len(t, input.MetricDataQueries, 1)
+		return aws.Int64Value(input.MetricDataQueries[0].MetricStat.Period)
+	}
+
+	t.Run("Max data points are forwarded", func(t *testing.T) {
+		input := query(t, newQuery("A", 500))
+		assert.Equal(t, aws.Int64(500), input.MaxDatapoints)
+	})
+
+	t.Run("Smallest max data points of a request are forwarded", func(t *testing.T) {
+		input := query(t, newQuery("A", 800), newQuery("B", 0), newQuery("C", 300))
+		assert.Equal(t, aws.Int64(300), input.MaxDatapoints)
+	})
+
+	t.Run("Max data points are left unset when not specified", func(t *testing.T) {
+		input := query(t, newQuery("A", 0))
+		assert.Nil(t, input.MaxDatapoints)
+	})
+
+	t.Run("Period is raised to keep the datapoints under max data points", func(t *testing.T) {
+		// 576 datapoints of 300s in 2 days, down to 480 of 360s
+		assert.Equal(t, int64(360), period(t, newQuery("A", 500)))
+	})
+
+	t.Run("Period is kept if the datapoints are under max data points", func(t *testing.T) {
+		assert.Equal(t, int64(300), period(t, newQuery("A", 1000)))
+	})
+
+	t.Run("Period is kept without max data points", func(t *testing.T) {
+		assert.Equal(t, int64(300), period(t, newQuery("A", 0)))
+	})
+
+	t.Run("High resolution periods are kept valid", func(t *testing.T) {
+		startTime := time.Date(2020, 3, 20, 10, 0, 0, 0, time.UTC)
+		assert.Equal(t, 5, periodForMaxDataPoints(1, 1000, startTime, startTime.Add(time.Hour)))
+		assert.Equal(t, 60, periodForMaxDataPoints(1, 100, startTime, startTime.Add(time.Hour)))
+	})
+}
+
+func TestTimeSeriesQuery_AliasWithDefaultRegionAndAutoPeriod(t *testing.T) {
+	origNewCWClient := NewCWClient
+	t.Cleanup(func() {
+		NewCWClient = origNewCWClient
+	})
+	NewCWClient = func(sess *session.Session) cloudwatchiface.CloudWatchAPI {
+		return FakeCWClient{
+			MetricDataOutput: cloudwatch.GetMetricDataOutput{
+				MetricDataResults: []*cloudwatch.MetricDataResult{
+					{
+						Id:         aws.String("queryA"),
+						Label:      aws.String("CPUUtilization"),
+						Timestamps: []*time.Time{aws.Time(time.Unix(1584700800, 0))},
+						Values:     []*float64{aws.Float64(10)},
+						StatusCode: aws.String("Complete"),
+					},
+				},
+			},
+		}
+	}
+
+	executor := newExecutor(nil)
+	resp, err := executor.Query(context.Background(), fakeDataSource(), &tsdb.TsdbQuery{
+		TimeRange: tsdb.NewTimeRange("1584700643000", "1584873443000"),
+		Queries: []*tsdb.Query{
+			{
+				RefId: "A",
+				Model: simplejson.NewFromAny(map[string]interface{}{
+					"region":     "default",
+					"namespace":  "AWS/EC2",
+					"metricName": "CPUUtilization",
+					"dimensions": map[string]interface{}{
+						"InstanceId": "i-123",
+					},
+					"statistics": []interface{}{"Average"},
+					"period":     "auto",
+					"alias":      "{{region}} {{period}}",
+				}),
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	require.Contains(t, resp.Results, "A")
+	frames, err := resp.Results["A"].Dataframes.Decoded()
+	require.NoError(t, err)
+	require.Len(t, frames, 1)
+	// Data this old is only kept at an hourly resolution, so the auto period is raised to an hour
+	assert.Equal(t, "us-east-1 3600", frames[0].Name)
+}
+
+func TestTimeSeriesQuery_InvalidQueriesInBatch(t *testing.T) {
+	origNewCWClient := NewCWClient
+	t.Cleanup(func() {
+		NewCWClient = origNewCWClient
+	})
+	cli := FakeCWClient{
+		MetricDataOutput: cloudwatch.GetMetricDataOutput{
+			MetricDataResults: []*cloudwatch.MetricDataResult{
+				{
+					Id:         aws.String("valid"),
+					Label:      aws.String("CPUUtilization"),
+					Timestamps: []*time.Time{aws.Time(time.Unix(1584700800, 0))},
+					Values:     []*float64{aws.Float64(10)},
+					StatusCode: aws.String("Complete"),
+				},
+			},
+		},
+		calls: &cloudWatchCalls{},
+	}
+	NewCWClient = func(sess *session.Session) cloudwatchiface.CloudWatchAPI {
+		return cli
+	}
+
+	newModel := func(id string, statistic string, dimensions map[string]interface{}) map[string]interface{} {
+		return map[string]interface{}{
+			"id":         id,
+			"region":     "us-east-1",
+			"namespace":  "AWS/EC2",
+			"metricName": "CPUUtilization",
+			"dimensions": dimensions,
+			"statistics": []interface{}{statistic},
+			"period":     "300",
+			"alias":      "{{InstanceId}}",
+		}
+	}
+	tooManyDimensions := make(map[string]interface{})
+	for i := 0; i <= maxDimensionsPerMetric; i++ {
+		tooManyDimensions[fmt.Sprintf("Dimension%d", i)] = "value"
+	}
+
+	for name, invalidModel := range map[string]map[string]interface{}{
+		"invalid dimensions": newModel("invalid", "Average", tooManyDimensions),
+		"invalid statistic":  newModel("invalid", "p101", map[string]interface{}{"InstanceId": "i-456"}),
+	} {
+		t.Run("A query with "+name+" doesn't fail the other queries", func(t *testing.T) {
+			cli.calls.getMetricData = nil
+
+			executor := newExecutor(nil)
+			resp, err := executor.Query(context.Background(), fakeDataSource(), &tsdb.TsdbQuery{
+				TimeRange: tsdb.NewTimeRange("1584700643000", "1584873443000"),
+				Queries: []*tsdb.Query{
+					{
+						RefId: "A",
+						Model: simplejson.NewFromAny(newModel("valid", "Average",
+							map[string]interface{}{"InstanceId": "i-123"})),
+					},
+					{
+						RefId: "B",
+						Model: simplejson.NewFromAny(invalidModel),
+					},
+				},
+			})
+			require.NoError(t, err)
+
+			require.Len(t, cli.calls.getMetricData, 1)
+			require.Len(t, cli.calls.getMetricData[0].MetricDataQueries, 1)
+			assert.Equal(t, "valid", *cli.calls.getMetricData[0].MetricDataQueries[0].Id)
+
+			require.Contains(t, resp.Results, "A")
+			require.NoError(t, resp.Results["A"].Error)
+			frames, err := resp.Results["A"].Dataframes.Decoded()
+			require.NoError(t, err)
+			require.Len(t, frames, 1)
+			assert.Equal(t, "i-123", frames[0].Name)
+
+			require.Contains(t, resp.Results, "B")
+			assert.Error(t, resp.Results["B"].Error)
+			assert.Nil(t, resp.Results["B"].Dataframes)
+		})
+	}
+}
+
+func TestTimeSeriesQuery_ValidateOnly(t *testing.T) {
+	origNewCWClient := NewCWClient
+	t.Cleanup(func() {
+		NewCWClient = origNewCWClient
+	})
+	NewCWClient = func(sess *session.Session) cloudwatchiface.CloudWatchAPI {
+		t.Error("no CloudWatch client should be created when validating queries")
+		return FakeCWClient{calls: &cloudWatchCalls{}}
+	}
+
+	newModel := func(id string, period string) map[string]interface{} {
+		return map[string]interface{}{
+			"type":         "timeSeriesQuery",
+			"validateOnly": true,
+			"id":           id,
+			"region":       "us-east-1",
+			"namespace":    "AWS/EC2",
+			"metricName":   "CPUUtilization",
+			"dimensions": map[string]interface{}{
+				"InstanceId": "i-123",
+			},
+			"statistics": []interface{}{"Average"},
+			"period":     period,
+		}
+	}
+	runQuery := func(dataSource *models.DataSource, queryModels ...map[string]interface{}) (*tsdb.Response, error) {
+		queries := make([]*tsdb.Query, 0, len(queryModels))
+		for i, model := range queryModels {
+			queries = append(queries, &tsdb.Query{
+				RefId: string(rune('A' + i)),
+				Model: simplejson.NewFromAny(model),
+			})
+		}
+
+		executor := newExecutor(nil)
+		return executor.Query(context.Background(), dataSource, &tsdb.TsdbQuery{
+			TimeRange: tsdb.NewTimeRange("now-1h", "now"),
+			Queries:   queries,
+		})
+	}
+
+	t.Run("Valid queries get empty results", func(t *testing.T) {
+		resp, err := runQuery(fakeDataSource(), newModel("a", "300"))
+		require.NoError(t, err)
+
+		require.Contains(t, resp.Results, "A")
+		assert.NoError(t, resp.Results["A"].Error)
+		assert.Nil(t, resp.Results["A"].Dataframes)
+	})
+
+	t.Run("Invalid query parameters are set on the results of their queries", func(t *testing.T) {
+		resp, err := runQuery(fakeDataSource(), newModel("a", "7"), newModel("b", "300"))
+		require.NoError(t, err)
+
+		require.Len(t, resp.Results, 2)
+		require.Error(t, resp.Results["A"].Error)
+		assert.Contains(t, resp.Results["A"].Error.Error(), `invalid period "7"`)
+		assert.NoError(t, resp.Results["B"].Error)
+	})
+
+	t.Run("Errors building the request are set on the results", func(t *testing.T) {
+		resp, err := runQuery(fakeDataSource(), newModel("a", "300"), newModel("a", "300"))
+		require.NoError(t, err)
+
+		require.Len(t, resp.Results, 2)
+		for _, result := range resp.Results {
+			assert.EqualError(t, result.Error, `error in query "B" - query ID "a" is not unique`)
+		}
+	})
+
+	t.Run("Missing region is set on the results", func(t *testing.T) {
+		stubEC2MetadataWithoutRegion(t)
+		setEnv(t, "AWS_REGION", "")
+		setEnv(t, "AWS_DEFAULT_REGION", "")
+		dataSource := fakeDataSource()
+		dataSource.JsonData.Set("defaultRegion", "")
+		model := newModel("a", "300")
+		model["region"] = "default"
+
+		resp, err := runQuery(dataSource, model)
+		require.NoError(t, err)
+
+		require.Contains(t, resp.Results, "A")
+		assert.True(t, errors.Is(resp.Results["A"].Error, errMissingRegion))
+	})
+}
@@ -2,25 +2,38 @@ package cloudwatch
 
 import (
 	"fmt"
+	"time"
 
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
 	"github.com/grafana/grafana-plugin-sdk-go/data"
 )
 
 type requestQuery struct {
-	RefId              string
-	Region             string
-	Id                 string
-	Namespace          string
-	MetricName         string
-	Statistics         []*string
-	QueryType          string
-	Expression         string
-	ReturnData         bool
-	Dimensions         map[string][]string
-	ExtendedStatistics []*string
-	Period             int
-	Alias              string
-	MatchExact         bool
+	RefId                  string
+	Region                 string
+	Id                     string
+	Namespace              string
+	MetricName             string
+	Statistics             []*string
+	QueryType              string
+	Expression             string
+	SqlExpression          string
+	ReturnData             bool
+	Dimensions             map[string][]string
+	ExtendedStatistics     []*string
+	Period                 int
+	Alias                  string
+	MatchExact             bool
+	Timezone               *time.Location
+	UseGetMetricStatistics bool
+	MultipleRegions        bool
+	Unit                   string
+	// IncludeRawResults adds the GetMetricData results to the frame metadata, for the query inspector
+	IncludeRawResults bool
+	// ResolveInstanceNames labels the series of EC2 instances with their Name tag
+	ResolveInstanceNames bool
+	// MaxDataPoints is the maximum number of data points the panel can show
+	MaxDataPoints int64
 }
 
 type cloudwatchResponse struct {
@@ -31,6 +44,18 @@ type cloudwatchResponse struct {
 	RequestExceededMaxLimit bool
 	PartialData             bool
 	Period                  int
+	RawResults              []rawMetricDataResult
+	// Messages are the messages GetMetricData returned with the results of the query, or for the whole request
+	Messages []*cloudwatch.MessageData
+}
+
+// rawMetricDataResult is a GetMetricData result as included in the frame metadata when raw results are requested.
+type rawMetricDataResult struct {
+	ID         string     `json:"id"`
+	Label      string     `json:"label"`
+	StatusCode string     `json:"statusCode"`
+	Timestamps []int64    `json:"timestamps"`
+	Values     []*float64 `json:"values"`
 }
 
 type queryError struct {
@@ -15,6 +15,7 @@ const (
 
 // Retry retries the provided function using exponential backoff, starting with `minDelay` between attempts, and increasing to
 // `maxDelay` after each failure. Stops when the provided function returns `FuncComplete`, or `maxRetries` is reached.
+// A `maxRetries` of 0 doesn't limit the number of retries.
 func Retry(body func() (RetrySignal, error), maxRetries int, minDelay time.Duration, maxDelay time.Duration) error {
 	currentDelay := minDelay
 	ticker := time.NewTicker(currentDelay)
@@ -40,7 +41,7 @@ func Retry(body func() (RetrySignal, error), maxRetries int, minDelay time.Durat
 			return nil
 		}
 
-		if retries >= maxRetries {
+		if maxRetries > 0 && retries >= maxRetries {
 			return nil
 		}
 	}
@@ -20,3 +20,20 @@ func TestMaxRetries(t *testing.T) {
 
 	assert.Equal(t, 8, retryVal)
 }
+
+func TestUnlimitedRetries(t *testing.T) {
+	retryVal := 0
+
+	err := Retry(func() (RetrySignal, error) {
+		retryVal++
+		if retryVal == 20 {
+			return FuncComplete, nil
+		}
+		return FuncFailure, nil
+	}, 0, time.Millisecond, time.Millisecond)
+	if err != nil {
+		assert.FailNow(t, "Error while retrying function")
+	}
+
+	assert.Equal(t, 20, retryVal)
+}